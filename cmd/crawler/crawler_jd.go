@@ -2,36 +2,57 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
-	"time"
+	"os"
 
 	"github.com/chromedp/chromedp"
+	"github.com/drkliu/zj-raya/internal/config"
 	"github.com/gocolly/colly"
 	"github.com/gocolly/colly/extensions"
 )
 
 func main() {
+	cfg, err := config.Parse(flag.CommandLine, os.Args[1:], config.SectionCrawler)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Log.Apply(); err != nil {
+		log.Fatal(err)
+	}
+	crawler := cfg.Crawler
+
 	// Array containing all the known URLs in a sitemap
 	knownUrls := []string{}
 
 	// Create a Collector specifically for Shopify
-	c := colly.NewCollector(colly.AllowedDomains("item.jd.com"))
-	extensions.RandomUserAgent(c)
-    extensions.Referer(c)
-	c.OnHTML("div.sku-name",func(h *colly.HTMLElement) {
+	c := colly.NewCollector(colly.AllowedDomains(crawler.AllowedDomains...))
+	c.SetRequestTimeout(crawler.Timeout)
+	if err := c.Limit(&colly.LimitRule{DomainGlob: "*", Parallelism: crawler.Parallelism, Delay: crawler.Delay}); err != nil {
+		log.Fatal(err)
+	}
+	if len(crawler.UserAgent) > 0 {
+		c.UserAgent = crawler.UserAgent
+	} else {
+		extensions.RandomUserAgent(c)
+	}
+	extensions.Referer(c)
+	c.OnHTML("div.sku-name", func(h *colly.HTMLElement) {
 		fmt.Println(h.Text)
-		
+
 	})
-	c.OnHTML("span.p-price",func(h *colly.HTMLElement) {
+	c.OnHTML("span.p-price", func(h *colly.HTMLElement) {
 		fmt.Println(h.Text)
 	})
-	c.OnHTML("div#choose-attrs",func(h *colly.HTMLElement) {
+	c.OnHTML("div#choose-attrs", func(h *colly.HTMLElement) {
 		fmt.Println(h.DOM.Html())
 	})
 	// Start the collector
-	c.Visit("https://item.jd.com/100026667928.html")
-	
+	for _, url := range crawler.URLs {
+		c.Visit(url)
+	}
+
 	fmt.Println("All known URLs:")
 	for _, url := range knownUrls {
 		fmt.Println("\t", url)
@@ -46,13 +67,13 @@ func main() {
 	defer cancel()
 
 	// create a timeout
-	ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
+	ctx, cancel = context.WithTimeout(ctx, crawler.Timeout)
 	defer cancel()
 
 	// navigate to a page, wait for an element, click
 	var example string
-	err := chromedp.Run(ctx,
-		chromedp.Navigate(`https://item.jd.com/100026667928.html`),
+	err = chromedp.Run(ctx,
+		chromedp.Navigate(crawler.URLs[0]),
 		// wait for footer element is visible (ie, page is loaded)
 		//chromedp.WaitVisible(`body > footer`),
 		// find and click "Expand All" link
@@ -64,4 +85,4 @@ func main() {
 		log.Fatal(err)
 	}
 	log.Printf("Go's time.After example:\n%s", example)
-}
\ No newline at end of file
+}
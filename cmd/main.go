@@ -2,23 +2,24 @@ package main
 
 import (
 	"context"
-
+	"flag"
 	"log"
+	"os"
+	"time"
 
+	"github.com/drkliu/zj-raya/internal/config"
 	"github.com/drkliu/zj-raya/internal/meta"
- 
-
- 
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// Connection URI
-const uri = "mongodb://localhost:27017/?maxPoolSize=20&w=majority"
-
 func main() {
-	
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(uri))
+	cfg, err := config.Parse(flag.CommandLine, os.Args[1:], config.SectionMongo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Log.Apply(); err != nil {
+		log.Fatal(err)
+	}
+	client, err := cfg.Mongo.Connect(context.TODO())
 	if err != nil {
 		panic(err)
 	}
@@ -27,11 +28,20 @@ func main() {
 			panic(err)
 		}
 	}()
-	db := client.Database("tea")
+	db := client.Database(cfg.Mongo.Database)
 	metaDatabase := meta.Database(*db)
-	repository := meta.NewRepository(&metaDatabase)
-	metaService := meta.NewService(&repository)
-	productMetaTable,err:=metaService.FindMetaTableByName("products")
+	repository := meta.NewRepository(&metaDatabase, meta.WithTimeout(cfg.Mongo.Timeout))
+	registry := meta.NewRegistry(repository)
+	if err := registry.Load(); err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go registry.Watch(ctx, 0)
+	metaService := meta.NewService(&repository,
+		meta.WithRegistry(registry),
+		meta.WithDictionaryCache(meta.NewDictionaryCache(repository, time.Minute)))
+	productMetaTable, err := metaService.FindMetaTableByName("products")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -40,8 +50,5 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	log.Printf("%s",json)
+	log.Printf("%s", json)
 }
-
- 
-	 
\ No newline at end of file
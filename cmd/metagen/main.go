@@ -0,0 +1,127 @@
+// Command metagen generates go structs and typed repositories, an OpenAPI document
+// or TypeScript interfaces from meta tables, read from yaml files or from the metas collection.
+//
+//	metagen -yaml tests/fixtures/meta/meta_tables.yml -package models -out models/models.go
+//	metagen -uri mongodb://localhost:27017 -db tea -tables products,carts
+//	metagen -yaml tests/fixtures/meta/meta_tables.yml -format openapi -out api/openapi.json
+//	metagen -yaml tests/fixtures/meta/meta_tables.yml -format typescript -out web/models.ts
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drkliu/zj-raya/internal/codegen"
+	"github.com/drkliu/zj-raya/internal/config"
+	"github.com/drkliu/zj-raya/internal/meta"
+)
+
+func main() {
+	yamlFiles := flag.String("yaml", "", "comma separated yaml files or globs, the metas collection is read when empty")
+	tableNames := flag.String("tables", "", "comma separated tables to generate, all when empty")
+	pkg := flag.String("package", "models", "package of the generated file")
+	out := flag.String("out", "", "output file, stdout when empty")
+	repositories := flag.Bool("repositories", true, "generate typed repositories")
+	format := flag.String("format", "go", "go, openapi or typescript")
+	title := flag.String("title", "raya", "title of the openapi document")
+	version := flag.String("version", "1.0.0", "version of the openapi document")
+	cfg, err := config.Parse(flag.CommandLine, os.Args[1:], config.SectionMongo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Log.Apply(); err != nil {
+		log.Fatal(err)
+	}
+
+	var tables []*meta.MetaTable
+	if len(*yamlFiles) > 0 {
+		tables, err = readYAML(*yamlFiles)
+	} else {
+		tables, err = readMetas(&cfg.Mongo)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	tables = filter(tables, *tableNames)
+	if len(tables) == 0 {
+		log.Fatal("no meta table to generate")
+	}
+	var source []byte
+	switch *format {
+	case "go":
+		source, err = codegen.GenerateGo(tables, codegen.GoOptions{Package: *pkg, Repositories: *repositories})
+	case "openapi":
+		source, err = codegen.GenerateOpenAPI(tables, codegen.OpenAPIOptions{Title: *title, Version: *version})
+	case "typescript":
+		source, err = codegen.GenerateTypeScript(tables)
+	default:
+		log.Fatal("unknown format " + *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(*out) == 0 {
+		os.Stdout.Write(source)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(*out), 0755); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*out, source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readYAML(patterns string) ([]*meta.MetaTable, error) {
+	var tables []*meta.MetaTable
+	for _, pattern := range strings.Split(patterns, ",") {
+		files, err := filepath.Glob(strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			read, err := meta.UnmarshalMetaTablesYAML(data)
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, read...)
+		}
+	}
+	return tables, nil
+}
+
+func readMetas(c *config.MongoConfig) ([]*meta.MetaTable, error) {
+	client, err := c.Connect(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Disconnect(context.TODO())
+	db := meta.Database(*client.Database(c.Database))
+	return meta.NewRepository(&db, meta.WithTimeout(c.Timeout)).FindAllMetaTables()
+}
+
+func filter(tables []*meta.MetaTable, names string) []*meta.MetaTable {
+	if len(names) == 0 {
+		return tables
+	}
+	wanted := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		wanted[strings.TrimSpace(name)] = true
+	}
+	var filtered []*meta.MetaTable
+	for _, table := range tables {
+		if wanted[table.Name] {
+			filtered = append(filtered, table)
+		}
+	}
+	return filtered
+}
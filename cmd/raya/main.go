@@ -0,0 +1,46 @@
+// Command raya manages meta tables, their records and indexes from the shell,
+// see package cli for the subcommands.
+//
+//	raya meta apply -uri mongodb://localhost:27017 -db tea tests/fixtures/meta/meta_tables.yml
+//	raya data import -key note carts carts.xlsx
+//	raya data export -format csv -sort -total carts > carts.csv
+//
+// See package config for the settings.
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/cli"
+	"github.com/drkliu/zj-raya/internal/config"
+	"github.com/drkliu/zj-raya/internal/meta"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := cli.Run(ctx, os.Args[1:], &cli.Env{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr, Open: open})
+	stop()
+	os.Exit(code)
+}
+
+func open(ctx context.Context, cfg *config.Config) (meta.MetaService, func(), error) {
+	client, err := cfg.Mongo.Connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	release := func() { client.Disconnect(context.Background()) }
+	db := meta.Database(*client.Database(cfg.Mongo.Database))
+	repository := meta.NewRepository(&db, meta.WithTimeout(cfg.Mongo.Timeout))
+	registry := meta.NewRegistry(repository)
+	if err := registry.Load(); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return meta.NewService(&repository,
+		meta.WithRegistry(registry),
+		meta.WithDictionaryCache(meta.NewDictionaryCache(repository, time.Minute))), release, nil
+}
@@ -0,0 +1,99 @@
+// Command server exposes every meta table over HTTP, see package rest for the routes
+// and package gql for the GraphQL API served at /graphql.
+// With -grpc-addr the RecordService of package rpc is served as well.
+//
+//	server -config raya.yml -uri mongodb://localhost:27017 -db tea -addr :8080
+//
+// See package config for the settings.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/config"
+	"github.com/drkliu/zj-raya/internal/gql"
+	"github.com/drkliu/zj-raya/internal/logging"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/drkliu/zj-raya/internal/rest"
+	"github.com/drkliu/zj-raya/internal/rpc"
+	"github.com/drkliu/zj-raya/internal/rpc/rpcpb"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	cfg, err := config.Parse(flag.CommandLine, os.Args[1:], config.SectionMongo, config.SectionServer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Log.Apply(); err != nil {
+		log.Fatal(err)
+	}
+	client, err := cfg.Mongo.Connect(context.TODO())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Disconnect(context.TODO())
+	db := meta.Database(*client.Database(cfg.Mongo.Database))
+	repository := meta.NewRepository(&db, meta.WithTimeout(cfg.Mongo.Timeout))
+	registry := meta.NewRegistry(repository)
+	if err := registry.Load(); err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go registry.Watch(ctx, 0)
+	metaService := meta.NewService(&repository,
+		meta.WithRegistry(registry),
+		meta.WithDictionaryCache(meta.NewDictionaryCache(repository, time.Minute)))
+	graphql, err := gql.NewHandler(metaService, registry, gql.WithMaxPageSize(cfg.Server.MaxPageSize))
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/graphql", graphql)
+	mux.Handle("/", rest.NewServer(metaService, rest.WithMaxPageSize(cfg.Server.MaxPageSize)))
+
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+	}
+	if len(cfg.Server.GRPCAddr) > 0 {
+		listener, err := net.Listen("tcp", cfg.Server.GRPCAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		grpcServer := grpc.NewServer()
+		rpcpb.RegisterRecordServiceServer(grpcServer, rpc.NewServer(metaService, rpc.WithMaxLimit(int64(cfg.Server.MaxPageSize))))
+		go func() {
+			<-ctx.Done()
+			grpcServer.GracefulStop()
+		}()
+		go func() {
+			logging.Infof("serving gRPC on %s", cfg.Server.GRPCAddr)
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	logging.Infof("listening on %s", cfg.Server.Addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
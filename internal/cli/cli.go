@@ -0,0 +1,271 @@
+// Package cli implements the raya command, which manages meta tables and their records:
+//
+//	raya meta list | show NAME | apply FILE... | diff FILE... | delete NAME
+//	raya data get TABLE ID | query TABLE | insert TABLE [FILE] | import TABLE FILE | export TABLE
+//	raya index sync [TABLE...]
+//
+// Flags come before the arguments, every subcommand accepts the mongo flags of package config.
+// Results are written to stdout as JSON, or NDJSON and CSV for records, errors to stderr as
+// {"error": {"code": "validation", "message": "...", "table": "carts", "column": "note"}},
+// and the exit code tells the kind of failure, see ExitValidation.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/drkliu/zj-raya/internal/config"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	ExitOK = 0
+	// ExitError is returned for failures of the database or of the environment.
+	ExitError = 1
+	// ExitUsage is returned for unknown subcommands, flags or missing arguments.
+	ExitUsage = 2
+	// ExitValidation is returned when a meta table or a record does not satisfy its definition.
+	ExitValidation = 3
+	// ExitNotFound is returned when a meta table or a record does not exist.
+	ExitNotFound = 4
+)
+
+// Env is the environment of a run, Open is replaced by tests.
+type Env struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Open returns the service of the configured database and a function releasing it.
+	Open func(ctx context.Context, cfg *config.Config) (meta.MetaService, func(), error)
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, r *runner, args []string) error
+}
+
+var groups = map[string][]*command{
+	"meta": {
+		{"list", "", metaList},
+		{"show", "[-format json|yaml] NAME", metaShow},
+		{"apply", "[-dry-run] FILE...", metaApply},
+		{"diff", "FILE...", metaDiff},
+		{"delete", "NAME", metaDelete},
+	},
+	"data": {
+		{"get", "TABLE ID", dataGet},
+		{"query", "[-filter JSON] [-sort PATHS] [-skip N] [-limit N] [-format json|ndjson|csv] [-columns PATHS] [-explode PATHS] TABLE", dataQuery},
+		{"insert", "TABLE [FILE]", dataInsert},
+		{"import", "[-format csv|xlsx|json|ndjson] [-dry-run] [-key COLUMNS] [-batch N] [-sheet NAME] TABLE FILE", dataImport},
+		{"export", "[-format json|ndjson|csv] [-filter JSON] [-sort PATHS] [-columns PATHS] [-explode PATHS] [-out FILE] TABLE", dataExport},
+	},
+	"index": {
+		{"sync", "[-dry-run] [TABLE...]", indexSync},
+	},
+}
+
+var groupOrder = []string{"meta", "data", "index"}
+
+// runner holds the state shared by the subcommands.
+type runner struct {
+	env     *Env
+	name    string
+	fs      *flag.FlagSet
+	service meta.MetaService
+	close   func()
+}
+
+// Run executes args, the arguments following the program name, and returns the exit code.
+func Run(ctx context.Context, args []string, env *Env) int {
+	if len(args) < 2 {
+		writeUsage(env.Stderr)
+		return ExitUsage
+	}
+	var cmd *command
+	for _, c := range groups[args[0]] {
+		if c.name == args[1] {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		writeUsage(env.Stderr)
+		return ExitUsage
+	}
+	r := &runner{env: env, name: "raya " + args[0] + " " + cmd.name}
+	r.fs = flag.NewFlagSet(r.name, flag.ContinueOnError)
+	r.fs.SetOutput(env.Stderr)
+	r.fs.Usage = func() {
+		fmt.Fprintf(env.Stderr, "usage: %s %s\n", r.name, cmd.usage)
+		r.fs.PrintDefaults()
+	}
+	err := cmd.run(ctx, r, args[2:])
+	if r.close != nil {
+		r.close()
+	}
+	return r.exit(err)
+}
+
+func writeUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: raya <group> <command> [flags] [arguments]")
+	for _, group := range groupOrder {
+		for _, c := range groups[group] {
+			fmt.Fprintf(w, "  raya %s %s %s\n", group, c.name, c.usage)
+		}
+	}
+}
+
+// parse parses the flags registered on r.fs and the config flags, then opens the service.
+func (r *runner) parse(ctx context.Context, args []string, minArgs int) error {
+	cfg, err := config.Parse(r.fs, args, config.SectionMongo)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		var problems config.Error
+		if errors.As(err, &problems) {
+			return err
+		}
+		return usageError(err.Error())
+	}
+	if r.fs.NArg() < minArgs {
+		return usageError("missing arguments")
+	}
+	if err := cfg.Log.Apply(); err != nil {
+		return err
+	}
+	r.service, r.close, err = r.env.Open(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	r.service = r.service.WithContext(ctx)
+	return nil
+}
+
+func (r *runner) table(name string) (*meta.MetaTable, error) {
+	table, err := r.service.FindMetaTableByName(name)
+	if isNotFound(err) {
+		return nil, &notFoundError{message: "no meta table " + name, table: name}
+	}
+	return table, err
+}
+
+// writeJSON writes v indented, followed by a new line.
+func (r *runner) writeJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = r.env.Stdout.Write(append(b, '\n'))
+	return err
+}
+
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+type notFoundError struct {
+	message string
+	table   string
+}
+
+func (e *notFoundError) Error() string {
+	return e.message
+}
+
+// errorBody is written to stderr, the codes are the ones of the REST API.
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Table   string `json:"table,omitempty"`
+	Column  string `json:"column,omitempty"`
+}
+
+// exit writes err to stderr and maps it to its exit code.
+func (r *runner) exit(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitUsage
+	}
+	var usage usageError
+	var notFound *notFoundError
+	var validation *meta.ValidationError
+	var problems config.Error
+	var reported *reportedError
+	body := &errorBody{Code: "internal", Message: err.Error()}
+	code := ExitError
+	switch {
+	case errors.As(err, &reported):
+		return reported.code
+	case errors.As(err, &usage):
+		r.fs.Usage()
+		body.Code, code = "usage", ExitUsage
+	case errors.As(err, &validation):
+		body = &errorBody{Code: "validation", Message: validation.Message, Table: validation.Table, Column: validation.Column}
+		code = ExitValidation
+	case errors.As(err, &notFound):
+		body.Code, body.Table, code = "notFound", notFound.table, ExitNotFound
+	case errors.Is(err, mongo.ErrNoDocuments):
+		body.Code, body.Message, code = "notFound", "no such record", ExitNotFound
+	case errors.As(err, &problems):
+		body.Code, code = "config", ExitUsage
+	case isInvalidInput(err):
+		body.Code, code = "validation", ExitValidation
+	}
+	b, _ := json.Marshal(struct {
+		Error *errorBody `json:"error"`
+	}{body})
+	r.env.Stderr.Write(append(b, '\n'))
+	return code
+}
+
+// invalidInput marks the errors of reading files given by the user: yaml, json or csv syntax.
+type invalidInput struct {
+	err error
+}
+
+func (e *invalidInput) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidInput) Unwrap() error {
+	return e.err
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, mongo.ErrNoDocuments)
+}
+
+func isInvalidInput(err error) bool {
+	var invalid *invalidInput
+	return errors.As(err, &invalid)
+}
+
+// reportedError is returned once the failure was written to stdout as part of the result.
+type reportedError struct {
+	code int
+}
+
+func (e *reportedError) Error() string {
+	return fmt.Sprintf("exit code %d", e.code)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
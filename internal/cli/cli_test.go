@@ -0,0 +1,189 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/cli"
+	"github.com/drkliu/zj-raya/internal/config"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/drkliu/zj-raya/internal/meta/metatest"
+	"github.com/stretchr/testify/assert"
+)
+
+var fixture = metatest.Fixture
+
+func newService(t *testing.T) meta.MetaService {
+	service, _ := metatest.NewService(t)
+	return service
+}
+
+// run executes args against service with stdin and returns the exit code, stdout and stderr.
+func run(service meta.MetaService, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	env := &cli.Env{
+		Stdin:  strings.NewReader(stdin),
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Open: func(ctx context.Context, cfg *config.Config) (meta.MetaService, func(), error) {
+			return service, func() {}, nil
+		},
+	}
+	code := cli.Run(context.Background(), args, env)
+	return code, stdout.String(), stderr.String()
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestMetaCommands(t *testing.T) {
+	service := newService(t)
+
+	code, out, _ := run(service, "", "meta", "list")
+	assert.Equal(t, cli.ExitOK, code)
+	var summaries []map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(out), &summaries))
+	assert.Len(t, summaries, 2)
+	assert.Equal(t, "brands", summaries[0]["name"])
+
+	code, out, _ = run(service, "", "meta", "diff", fixture)
+	assert.Equal(t, cli.ExitOK, code)
+	var results []map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(out), &results))
+	for _, result := range results {
+		assert.Equal(t, "none", result["action"], result["table"])
+	}
+
+	changed := writeFile(t, "carts.yml", `
+- name: carts
+  columns:
+    - name: userId
+      dataType: objectId
+`)
+	code, out, _ = run(service, "", "meta", "apply", "-dry-run", changed)
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Contains(t, out, `"action": "update"`)
+	assert.Contains(t, out, `"path": "columns.cartItems"`)
+	carts, err := service.FindMetaTableByName("carts")
+	assert.NoError(t, err)
+	assert.NotNil(t, carts.ColumnByPath("cartItems"), "dry run should not write")
+
+	code, _, stderr := run(service, "", "meta", "show", "orders")
+	assert.Equal(t, cli.ExitNotFound, code)
+	assert.Contains(t, stderr, `"code":"notFound"`)
+
+	code, _, _ = run(service, "", "meta", "rename")
+	assert.Equal(t, cli.ExitUsage, code)
+}
+
+const cartsCSV = `userId,cartItems,tags,note
+5f1d7a9b2c3e4f5a6b7c8d9e,"[{""productId"":""5f1d7a9b2c3e4f5a6b7c8d9f"",""quantity"":2,""price"":{""currency"":""CNY"",""amount"":""10.50""}}]","[""gift""]",first
+5f1d7a9b2c3e4f5a6b7c8d9e,"[{""productId"":""5f1d7a9b2c3e4f5a6b7c8d9f"",""quantity"":""1"",""price"":{""currency"":""CNY"",""amount"":""3""}}]",,
+`
+
+func TestDataImportExport(t *testing.T) {
+	service := newService(t)
+
+	invalid := writeFile(t, "carts.csv", cartsCSV+`5f1d7a9b2c3e4f5a6b7c8d9e,"[{""quantity"":""many""}]",,`+"\n")
+	code, out, _ := run(service, "", "data", "import", "carts", invalid)
+	assert.Equal(t, cli.ExitValidation, code)
+	var report map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(out), &report))
+	assert.Equal(t, float64(0), report["inserted"])
+	errs := report["errors"].([]interface{})
+	assert.Len(t, errs, 1)
+	assert.Equal(t, float64(4), errs[0].(map[string]interface{})["row"])
+	assert.Equal(t, "cartItems.0.quantity", errs[0].(map[string]interface{})["column"])
+
+	valid := writeFile(t, "carts.csv", cartsCSV)
+	code, out, _ = run(service, "", "data", "import", "-dry-run", "carts", valid)
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Contains(t, out, `"dryRun": true`)
+	carts, err := service.FindMetaTableByName("carts")
+	assert.NoError(t, err)
+	count, err := service.Count(carts, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count, "dry run should not write")
+	code, out, _ = run(service, "", "data", "import", "carts", valid)
+	assert.Equal(t, cli.ExitOK, code, out)
+	assert.Contains(t, out, `"inserted": 2`)
+
+	code, out, _ = run(service, "", "data", "query", "-filter", `{"cartItems.quantity": {"$gte": 2}}`, "-format", "ndjson", "carts")
+	assert.Equal(t, cli.ExitOK, code)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Len(t, lines, 1)
+	var cart map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &cart))
+	assert.Equal(t, "first", cart["note"])
+
+	code, out, _ = run(service, "", "data", "get", "carts", cart["_id"].(string))
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Contains(t, out, `"first"`)
+	code, _, _ = run(service, "", "data", "get", "carts", "5f1d7a9b2c3e4f5a6b7c8d00")
+	assert.Equal(t, cli.ExitNotFound, code)
+
+	code, _, stderr := run(service, "", "data", "query", "-filter", `{"missing": 1}`, "carts")
+	assert.Equal(t, cli.ExitValidation, code)
+	assert.Contains(t, stderr, `"column":"missing"`)
+
+	code, out, _ = run(service, "", "data", "export", "-format", "csv", "-sort", "-total", "carts")
+	assert.Equal(t, cli.ExitOK, code)
+	rows := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Len(t, rows, 3)
+	assert.Equal(t, "_id,userId,cartItems.productId,cartItems.quantity,cartItems.price.currency,cartItems.price.amount,total,itemCount,tags,note", rows[0])
+	assert.True(t, strings.HasSuffix(rows[1], ",2,CNY,10.50,21.00,1,gift,first"), rows[1])
+
+	code, out, _ = run(service, "", "data", "query", "-format", "csv", "-columns", "userId,tags,note", "-sort", "note", "carts")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Equal(t, "userId,tags,note\n5f1d7a9b2c3e4f5a6b7c8d9e,,\n5f1d7a9b2c3e4f5a6b7c8d9e,gift,first\n", out)
+
+	//the exported csv imports again
+	exported := writeFile(t, "export.csv", out)
+	code, out, _ = run(service, "", "data", "import", "-dry-run", "carts", exported)
+	assert.Equal(t, cli.ExitOK, code, out)
+	assert.Contains(t, out, `"inserted": 2`)
+
+	code, _, stderr = run(service, "", "data", "export", "-format", "csv", "-explode", "note", "carts")
+	assert.Equal(t, cli.ExitValidation, code)
+	assert.Contains(t, stderr, `"column":"note"`)
+}
+
+func TestDataInsert(t *testing.T) {
+	service := newService(t)
+
+	code, out, _ := run(service, `[{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "tags": ["a"]}, {"userId": "5f1d7a9b2c3e4f5a6b7c8d9e"}]`, "data", "insert", "carts")
+	assert.Equal(t, cli.ExitOK, code)
+	var ids map[string][]string
+	assert.NoError(t, json.Unmarshal([]byte(out), &ids))
+	assert.Len(t, ids["ids"], 2)
+
+	code, _, stderr := run(service, `{"userId": "nope"}`, "data", "insert", "carts", "-")
+	assert.Equal(t, cli.ExitValidation, code)
+	assert.Contains(t, stderr, `"column":"userId"`)
+}
+
+func TestIndexSync(t *testing.T) {
+	service := newService(t)
+
+	code, out, _ := run(service, "", "index", "sync", "-dry-run", "carts")
+	assert.Equal(t, cli.ExitOK, code)
+	var changes []*meta.IndexChanges
+	assert.NoError(t, json.Unmarshal([]byte(out), &changes))
+	assert.Len(t, changes, 1)
+	assert.Equal(t, []string{"carts_user"}, changes[0].Created)
+
+	code, _, _ = run(service, "", "index", "sync")
+	assert.Equal(t, cli.ExitOK, code)
+	code, out, _ = run(service, "", "index", "sync", "carts")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.NoError(t, json.Unmarshal([]byte(out), &changes))
+	assert.True(t, changes[0].IsEmpty())
+}
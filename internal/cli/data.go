@@ -0,0 +1,270 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/drkliu/zj-raya/internal/exporter"
+	"github.com/drkliu/zj-raya/internal/importer"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const exportBatch = 1000
+
+func dataGet(ctx context.Context, r *runner, args []string) error {
+	if err := r.parse(ctx, args, 2); err != nil {
+		return err
+	}
+	table, err := r.table(r.fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	id, err := primitive.ObjectIDFromHex(r.fs.Arg(1))
+	if err != nil {
+		return &notFoundError{message: "invalid id " + r.fs.Arg(1), table: table.Name}
+	}
+	dor, err := r.service.FindOne(table, meta.ID(id))
+	if err != nil {
+		return err
+	}
+	return r.writeJSON(dor)
+}
+
+// queryFlags registers the flags selecting records.
+func queryFlags(r *runner) (filter, sort *string) {
+	filter = r.fs.String("filter", "", `mongo filter over column paths: {"price.amount": {"$gte": 10}}`)
+	sort = r.fs.String("sort", "", "comma separated column paths, prefixed by - for descending")
+	return filter, sort
+}
+
+func buildQuery(table *meta.MetaTable, filter, sort string) (*meta.Query, error) {
+	query := &meta.Query{}
+	if len(filter) > 0 {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(filter), &m); err != nil {
+			return nil, &invalidInput{err: err}
+		}
+		d, err := meta.ConvertFilter(table, m)
+		if err != nil {
+			return nil, err
+		}
+		query.Filter = d
+	}
+	d, err := meta.ConvertSort(table, splitList(sort))
+	if err != nil {
+		return nil, err
+	}
+	query.Sort = d
+	return query, nil
+}
+
+// csvOptions registers the flags shaping csv output.
+func csvOptions(r *runner) func() []exporter.Option {
+	columns := r.fs.String("columns", "", "csv: comma separated column paths written, every column when empty")
+	explode := r.fs.String("explode", "", "csv: comma separated array columns written as a row per item")
+	separator := r.fs.String("separator", ";", "csv: separator of joined array items")
+	return func() []exporter.Option {
+		return []exporter.Option{
+			exporter.WithColumns(splitList(*columns)...),
+			exporter.WithExplode(splitList(*explode)...),
+			exporter.WithArraySeparator(*separator),
+		}
+	}
+}
+
+func dataQuery(ctx context.Context, r *runner, args []string) error {
+	filter, sort := queryFlags(r)
+	skip := r.fs.Int64("skip", 0, "number of records to skip")
+	limit := r.fs.Int64("limit", 20, "largest number of records, 0 for all")
+	format := r.fs.String("format", "json", "json, ndjson or csv")
+	options := csvOptions(r)
+	if err := r.parse(ctx, args, 1); err != nil {
+		return err
+	}
+	table, err := r.table(r.fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	query, err := buildQuery(table, *filter, *sort)
+	if err != nil {
+		return err
+	}
+	query.Skip, query.Limit = *skip, *limit
+	if *format == "csv" {
+		return exportCSV(r, table, query, r.env.Stdout, options())
+	}
+	w, err := newRecordWriter(*format, r.env.Stdout)
+	if err != nil {
+		return err
+	}
+	dors, err := r.service.Find(table, query)
+	if err != nil {
+		return err
+	}
+	for _, dor := range dors {
+		if err := w.Write(dor); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+func dataExport(ctx context.Context, r *runner, args []string) error {
+	filter, sort := queryFlags(r)
+	format := r.fs.String("format", "ndjson", "json, ndjson or csv")
+	out := r.fs.String("out", "", "output file, stdout when empty")
+	options := csvOptions(r)
+	if err := r.parse(ctx, args, 1); err != nil {
+		return err
+	}
+	table, err := r.table(r.fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	query, err := buildQuery(table, *filter, *sort)
+	if err != nil {
+		return err
+	}
+	output := r.env.Stdout
+	if len(*out) > 0 {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		output = f
+	}
+	if *format == "csv" {
+		return exportCSV(r, table, query, output, options())
+	}
+	w, err := newRecordWriter(*format, output)
+	if err != nil {
+		return err
+	}
+	//paging needs a total order
+	query.Sort = append(query.Sort, bson.E{Key: "_id", Value: 1})
+	query.Limit = exportBatch
+	for {
+		dors, err := r.service.Find(table, query)
+		if err != nil {
+			return err
+		}
+		for _, dor := range dors {
+			if err := w.Write(dor); err != nil {
+				return err
+			}
+		}
+		if len(dors) < exportBatch {
+			break
+		}
+		query.Skip += exportBatch
+	}
+	return w.Close()
+}
+
+func exportCSV(r *runner, table *meta.MetaTable, query *meta.Query, out io.Writer, options []exporter.Option) error {
+	ex, err := exporter.New(r.service, table, append(options, exporter.WithQuery(query), exporter.WithBatchSize(exportBatch))...)
+	if err != nil {
+		return err
+	}
+	_, err = ex.Export(out)
+	return err
+}
+
+func dataInsert(ctx context.Context, r *runner, args []string) error {
+	if err := r.parse(ctx, args, 1); err != nil {
+		return err
+	}
+	table, err := r.table(r.fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	in, closeInput, err := r.input(r.fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+	records, err := readJSON(in)
+	if err != nil {
+		return err
+	}
+	values := make([]*meta.DataObject, 0, len(records))
+	for _, record := range records {
+		do, err := record.decode(table)
+		if err != nil {
+			return err
+		}
+		values = append(values, do)
+	}
+	ids, err := r.service.InsertMany(table, values)
+	if err != nil {
+		return err
+	}
+	hex := make([]string, len(ids))
+	for i, id := range ids {
+		hex[i] = id.String()
+	}
+	return r.writeJSON(map[string]interface{}{"ids": hex})
+}
+
+func dataImport(ctx context.Context, r *runner, args []string) error {
+	format := r.fs.String("format", "", "csv, xlsx, json or ndjson, from the file extension when empty")
+	dryRun := r.fs.Bool("dry-run", false, "validate the records without writing them")
+	batch := r.fs.Int("batch", 500, "number of records inserted at once")
+	key := r.fs.String("key", "", "comma separated key columns, records with the same key are updated")
+	sheet := r.fs.String("sheet", "", "sheet of xlsx files, the first one when empty")
+	separator := r.fs.String("separator", ";", "separator of array items written in one cell")
+	if err := r.parse(ctx, args, 2); err != nil {
+		return err
+	}
+	if *batch < 1 {
+		return usageError("batch should be positive")
+	}
+	table, err := r.table(r.fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	file := r.fs.Arg(1)
+	if len(*format) == 0 {
+		*format = string(importer.FormatOf(file))
+	}
+	in, closeInput, err := r.input(file)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+	report, err := importer.New(r.service, table,
+		importer.WithDryRun(*dryRun),
+		importer.WithBatchSize(*batch),
+		importer.WithKeyColumns(splitList(*key)...),
+		importer.WithSheet(*sheet),
+		importer.WithArraySeparator(*separator)).Import(in, importer.Format(*format))
+	if report != nil {
+		if err := r.writeJSON(report); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if report.Failed() {
+		return &reportedError{code: ExitValidation}
+	}
+	return nil
+}
+
+// input opens file, stdin when empty or -.
+func (r *runner) input(file string) (io.Reader, func(), error) {
+	if len(file) == 0 || file == "-" {
+		return r.env.Stdin, func() {}, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
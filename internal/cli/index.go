@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"context"
+	"sort"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+)
+
+func indexSync(ctx context.Context, r *runner, args []string) error {
+	dryRun := r.fs.Bool("dry-run", false, "report the changes without writing them")
+	if err := r.parse(ctx, args, 0); err != nil {
+		return err
+	}
+	var tables []*meta.MetaTable
+	if r.fs.NArg() == 0 {
+		all, err := r.service.FindAllMetaTables()
+		if err != nil {
+			return err
+		}
+		sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+		tables = all
+	}
+	for _, name := range r.fs.Args() {
+		table, err := r.table(name)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, table)
+	}
+	results := make([]*meta.IndexChanges, 0, len(tables))
+	for _, table := range tables {
+		changes, err := r.service.SyncIndexes(table, *dryRun)
+		if err != nil {
+			return err
+		}
+		results = append(results, changes)
+	}
+	return r.writeJSON(results)
+}
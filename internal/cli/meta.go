@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+)
+
+type tableSummary struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Columns     int    `json:"columns"`
+}
+
+func metaList(ctx context.Context, r *runner, args []string) error {
+	if err := r.parse(ctx, args, 0); err != nil {
+		return err
+	}
+	tables, err := r.service.FindAllMetaTables()
+	if err != nil {
+		return err
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	summaries := make([]*tableSummary, 0, len(tables))
+	for _, table := range tables {
+		summaries = append(summaries, &tableSummary{Id: table.Id.Hex(), Name: table.Name, Description: table.Description, Columns: len(table.Columns)})
+	}
+	return r.writeJSON(summaries)
+}
+
+func metaShow(ctx context.Context, r *runner, args []string) error {
+	format := r.fs.String("format", "json", "json or yaml, the yaml form can be applied again")
+	if err := r.parse(ctx, args, 1); err != nil {
+		return err
+	}
+	table, err := r.table(r.fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "json":
+		b, err := meta.MarshalMetaTableJSON(table)
+		if err != nil {
+			return err
+		}
+		return r.writeJSON(json.RawMessage(b))
+	case "yaml":
+		b, err := meta.MarshalMetaTablesYAML([]*meta.MetaTable{table})
+		if err != nil {
+			return err
+		}
+		_, err = r.env.Stdout.Write(b)
+		return err
+	}
+	return usageError("unknown format " + *format)
+}
+
+// applyResult is the outcome of applying one table of a yaml file.
+type applyResult struct {
+	Table   string                  `json:"table"`
+	Action  string                  `json:"action"` //create, update or none
+	Changes []*meta.MetaTableChange `json:"changes"`
+}
+
+func metaApply(ctx context.Context, r *runner, args []string) error {
+	dryRun := r.fs.Bool("dry-run", false, "report the changes without writing them")
+	if err := r.parse(ctx, args, 1); err != nil {
+		return err
+	}
+	return apply(r, r.fs.Args(), *dryRun)
+}
+
+func metaDiff(ctx context.Context, r *runner, args []string) error {
+	if err := r.parse(ctx, args, 1); err != nil {
+		return err
+	}
+	return apply(r, r.fs.Args(), true)
+}
+
+// apply creates the tables of the yaml files which are not stored yet and updates the changed ones.
+func apply(r *runner, files []string, dryRun bool) error {
+	var tables []*meta.MetaTable
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		read, err := meta.UnmarshalMetaTablesYAML(data)
+		if err != nil {
+			return &invalidInput{err: err}
+		}
+		tables = append(tables, read...)
+	}
+	results := make([]*applyResult, 0, len(tables))
+	for _, table := range tables {
+		stored, err := r.service.FindMetaTableByName(table.Name)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		if stored == nil {
+			changes, err := meta.DiffMetaTables(&meta.MetaTable{Name: table.Name, ModelName: table.ModelName}, table)
+			if err != nil {
+				return err
+			}
+			results = append(results, &applyResult{Table: table.Name, Action: "create", Changes: changes})
+			if !dryRun {
+				if _, err := r.service.InsertMetaTable(table); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		changes, err := meta.DiffMetaTables(stored, table)
+		if err != nil {
+			return err
+		}
+		result := &applyResult{Table: table.Name, Action: "none", Changes: changes}
+		results = append(results, result)
+		if len(changes) == 0 {
+			continue
+		}
+		result.Action = "update"
+		if !dryRun {
+			table.Id = stored.Id
+			if err := r.service.UpdateMetaTable(table); err != nil {
+				return err
+			}
+		}
+	}
+	return r.writeJSON(results)
+}
+
+func metaDelete(ctx context.Context, r *runner, args []string) error {
+	if err := r.parse(ctx, args, 1); err != nil {
+		return err
+	}
+	table, err := r.table(r.fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := r.service.DeleteMetaTable(meta.ID(table.Id)); err != nil {
+		return err
+	}
+	return r.writeJSON(map[string]interface{}{"table": table.Name, "deleted": true})
+}
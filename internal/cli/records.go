@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+)
+
+// record is one record read from an input file, row is its position in a json array.
+type record struct {
+	row  int
+	data []byte
+}
+
+func (rec *record) decode(table *meta.MetaTable) (*meta.DataObject, error) {
+	return meta.UnmarshalDataObjectJSON(table, rec.data)
+}
+
+// readJSON reads an object or an array of objects.
+func readJSON(in io.Reader) ([]*record, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] != '[' {
+		return []*record{{row: 1, data: data}}, nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, &invalidInput{err: err}
+	}
+	records := make([]*record, len(items))
+	for i, item := range items {
+		records[i] = &record{row: i + 1, data: item}
+	}
+	return records, nil
+}
+
+// recordWriter writes records in one of the JSON output formats, csv is written by package exporter.
+type recordWriter interface {
+	Write(dor *meta.DataObjectResp) error
+	Close() error
+}
+
+func newRecordWriter(format string, out io.Writer) (recordWriter, error) {
+	switch format {
+	case "json":
+		return &jsonWriter{out: out, records: []*meta.DataObjectResp{}}, nil
+	case "ndjson", "jsonl":
+		return &ndjsonWriter{out: out}, nil
+	}
+	return nil, usageError("unknown format " + format)
+}
+
+type jsonWriter struct {
+	out     io.Writer
+	records []*meta.DataObjectResp
+}
+
+func (w *jsonWriter) Write(dor *meta.DataObjectResp) error {
+	w.records = append(w.records, dor)
+	return nil
+}
+
+func (w *jsonWriter) Close() error {
+	b, err := json.MarshalIndent(w.records, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.out.Write(append(b, '\n'))
+	return err
+}
+
+type ndjsonWriter struct {
+	out io.Writer
+}
+
+func (w *ndjsonWriter) Write(dor *meta.DataObjectResp) error {
+	b, err := json.Marshal(dor)
+	if err != nil {
+		return err
+	}
+	_, err = w.out.Write(append(b, '\n'))
+	return err
+}
+
+func (w *ndjsonWriter) Close() error {
+	return nil
+}
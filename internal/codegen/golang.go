@@ -0,0 +1,243 @@
+// Package codegen generates typed code from meta tables.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+)
+
+// runtimePackage is imported by the generated repositories, internal/meta cannot be imported
+// outside this module.
+const runtimePackage = "github.com/drkliu/zj-raya/meta"
+
+// GoOptions configures GenerateGo.
+type GoOptions struct {
+	Package      string
+	Repositories bool //emit typed wrappers around meta.Repository
+}
+
+// GenerateGo emits a go file with one struct per table, nested structs for json columns
+// and, when asked, a typed repository per table.
+func GenerateGo(tables []*meta.MetaTable, options GoOptions) ([]byte, error) {
+	g := &goGenerator{imports: map[string]bool{}, body: &bytes.Buffer{}}
+	sorted := append([]*meta.MetaTable(nil), tables...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, table := range sorted {
+		name := TypeName(table.Name)
+		g.printf("// %s is a record of the %s table.\n", name, table.Name)
+		g.writeStruct(name, table.Columns)
+		if options.Repositories {
+			g.writeRepository(name, table)
+		}
+	}
+	var file bytes.Buffer
+	fmt.Fprintf(&file, "// Code generated by metagen. DO NOT EDIT.\n\npackage %s\n\n", options.Package)
+	if len(g.imports) > 0 {
+		paths := make([]string, 0, len(g.imports))
+		for path := range g.imports {
+			paths = append(paths, path)
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			ti, tj := strings.Contains(strings.Split(paths[i], "/")[0], "."), strings.Contains(strings.Split(paths[j], "/")[0], ".")
+			if ti != tj {
+				return tj
+			}
+			return paths[i] < paths[j]
+		})
+		file.WriteString("import (\n")
+		std := true
+		for _, path := range paths {
+			if std && strings.Contains(strings.Split(path, "/")[0], ".") {
+				//third party imports after the standard library
+				std = false
+				file.WriteString("\n")
+			}
+			fmt.Fprintf(&file, "\t%q\n", path)
+		}
+		file.WriteString(")\n\n")
+	}
+	file.Write(g.body.Bytes())
+	for _, nested := range g.nested {
+		file.Write(nested.Bytes())
+	}
+	return format.Source(file.Bytes())
+}
+
+type goGenerator struct {
+	imports map[string]bool
+	body    *bytes.Buffer
+	nested  []*bytes.Buffer //nested structs, written after the tables
+}
+
+func (g *goGenerator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.body, format, args...)
+}
+
+func (g *goGenerator) writeStruct(name string, columns []*meta.MetaColumn) {
+	g.printf("type %s struct {\n", name)
+	for _, c := range columns {
+		if c.IsComputed() && c.IsVirtual {
+			continue
+		}
+		if len(c.Description) > 0 {
+			g.printf("\t// %s\n", c.Description)
+		}
+		g.printf("\t%s %s `%s`\n", FieldName(c.Name), g.fieldType(name, c), tags(c))
+	}
+	g.printf("}\n\n")
+}
+
+// fieldType returns the go type of a column, json columns get a struct named after the parent and the column.
+func (g *goGenerator) fieldType(parent string, c *meta.MetaColumn) string {
+	var t string
+	switch c.DataType {
+	case meta.DataTypeJson:
+		nested := parent + TypeName(c.Name)
+		body := g.body
+		g.body = &bytes.Buffer{}
+		g.printf("// %s is the %s column of %s.\n", nested, c.Name, parent)
+		g.writeStruct(nested, c.NestedColumns)
+		g.nested = append(g.nested, g.body)
+		g.body = body
+		t = "*" + nested
+	case meta.DataTypeString, meta.DataTypeUrl:
+		t = "string"
+	case meta.DataTypeInt:
+		t = "int32"
+	case meta.DataTypeLong:
+		t = "int64"
+	case meta.DataTypeFloat:
+		t = "float32"
+	case meta.DataTypeDouble:
+		t = "float64"
+	case meta.DataTypeDecimal:
+		g.imports["go.mongodb.org/mongo-driver/bson/primitive"] = true
+		t = "primitive.Decimal128"
+	case meta.DataTypeBool:
+		t = "bool"
+	case meta.DataTypeDateTime, meta.DataTypeTime, meta.DataTypeTimestamp:
+		g.imports["time"] = true
+		t = "time.Time"
+	case meta.DataTypeObjectId:
+		g.imports["go.mongodb.org/mongo-driver/bson/primitive"] = true
+		t = "primitive.ObjectID"
+	default:
+		t = "interface{}"
+	}
+	if c.IsArray {
+		return "[]" + t
+	}
+	if c.IsNullable && !strings.HasPrefix(t, "*") && t != "interface{}" {
+		return "*" + t
+	}
+	return t
+}
+
+func tags(c *meta.MetaColumn) string {
+	name := c.Name
+	if c.Name == "_id" || c.IsNullable || c.IsArray || c.DataType == meta.DataTypeJson {
+		name += ",omitempty"
+	}
+	return fmt.Sprintf(`bson:"%s" json:"%s"`, name, name)
+}
+
+func (g *goGenerator) writeRepository(name string, table *meta.MetaTable) {
+	g.imports[runtimePackage] = true
+	g.printf(`// %[1]sRepository reads and writes %[1]s records through a meta.Repository or a meta.MetaService.
+type %[1]sRepository struct {
+	repository meta.Repository
+	table      *meta.MetaTable
+}
+
+func New%[1]sRepository(repository meta.Repository, table *meta.MetaTable) *%[1]sRepository {
+	return &%[1]sRepository{repository: repository, table: table}
+}
+
+func (r *%[1]sRepository) FindOne(id meta.ID) (*%[1]s, error) {
+	dor, err := r.repository.FindOne(r.table, id)
+	if err != nil {
+		return nil, err
+	}
+	var v %[1]s
+	return &v, dor.Decode(r.table, &v)
+}
+
+func (r *%[1]sRepository) FindAll() ([]*%[1]s, error) {
+	dors, err := r.repository.FindAll(r.table)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]*%[1]s, len(dors))
+	for i, dor := range dors {
+		values[i] = &%[1]s{}
+		if err := dor.Decode(r.table, values[i]); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (r *%[1]sRepository) InsertOne(v *%[1]s) (*meta.ID, error) {
+	do, err := meta.EncodeDataObject(v)
+	if err != nil {
+		return nil, err
+	}
+	return r.repository.InsertOne(r.table, do)
+}
+
+func (r *%[1]sRepository) UpdateOne(id meta.ID, v *%[1]s) error {
+	do, err := meta.EncodeDataObject(v)
+	if err != nil {
+		return err
+	}
+	return r.repository.UpdateOne(r.table, id, do)
+}
+
+func (r *%[1]sRepository) DeleteOne(id meta.ID) error {
+	return r.repository.DeleteOne(r.table, id)
+}
+
+`, name)
+}
+
+// TypeName turns a table or column name into an exported singular type name: cartItems -> CartItem.
+func TypeName(name string) string {
+	name = FieldName(name)
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "ss"):
+		return name
+	case strings.HasSuffix(name, "s") && len(name) > 1:
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
+
+// FieldName turns a column name into an exported identifier: _id -> Id, user_name -> UserName.
+func FieldName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	s := b.String()
+	if len(s) == 0 || unicode.IsDigit(rune(s[0])) {
+		s = "X" + s
+	}
+	return s
+}
@@ -0,0 +1,87 @@
+package codegen_test
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/codegen"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+func fixtureTables(t *testing.T) []*meta.MetaTable {
+	data, err := ioutil.ReadFile("../../tests/fixtures/meta/meta_tables.yml")
+	assert.NoError(t, err)
+	tables, err := meta.UnmarshalMetaTablesYAML(data)
+	assert.NoError(t, err)
+	return tables
+}
+
+func TestGenerateGo(t *testing.T) {
+	source, err := codegen.GenerateGo(fixtureTables(t), codegen.GoOptions{Package: "models", Repositories: true})
+	assert.NoError(t, err)
+	_, err = parser.ParseFile(token.NewFileSet(), "models.go", source, parser.AllErrors)
+	assert.NoError(t, err)
+
+	code := string(source)
+	for _, expected := range []string{
+		"package models",
+		"type Cart struct {",
+		"Id        primitive.ObjectID   `bson:\"_id,omitempty\" json:\"_id,omitempty\"`",
+		"CartItems []*CartCartItem      `bson:\"cartItems,omitempty\" json:\"cartItems,omitempty\"`",
+		"Total     primitive.Decimal128 `bson:\"total\" json:\"total\"`",
+		"Tags      []string             `bson:\"tags,omitempty\" json:\"tags,omitempty\"`",
+		"Note      *string              `bson:\"note,omitempty\" json:\"note,omitempty\"`",
+		"type CartCartItemPrice struct {",
+		"CreateAt time.Time          `bson:\"createAt\" json:\"createAt\"`",
+		"func NewCartRepository(repository meta.Repository, table *meta.MetaTable) *CartRepository {",
+		"func (r *BrandRepository) FindOne(id meta.ID) (*Brand, error) {",
+	} {
+		assert.Contains(t, code, expected)
+	}
+	assert.NotContains(t, code, "ItemCount", "virtual columns are not stored")
+
+	source, err = codegen.GenerateGo(fixtureTables(t), codegen.GoOptions{Package: "models"})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(source), "Repository")
+}
+
+// TestGeneratedGoCompiles builds the generated repositories in a module of their own, which
+// cannot import the internal packages of zj-raya.
+func TestGeneratedGoCompiles(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not installed")
+	}
+	source, err := codegen.GenerateGo(fixtureTables(t), codegen.GoOptions{Package: "models", Repositories: true})
+	assert.NoError(t, err)
+	root, err := filepath.Abs("../..")
+	assert.NoError(t, err)
+	sum, err := ioutil.ReadFile(filepath.Join(root, "go.sum"))
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	mod := "module example.com/models\n\ngo 1.17\n\nrequire github.com/drkliu/zj-raya v0.0.0\n\nreplace github.com/drkliu/zj-raya => " + root + "\n"
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(mod), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.sum"), sum, 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "models.go"), source, 0644))
+	cmd := exec.Command(goBin, "build", "./...")
+	cmd.Dir = dir
+	//dependencies come from the module cache filled by building zj-raya
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+}
+
+func TestNames(t *testing.T) {
+	assert.Equal(t, "Id", codegen.FieldName("_id"))
+	assert.Equal(t, "UserName", codegen.FieldName("user_name"))
+	assert.Equal(t, "CartItem", codegen.TypeName("cartItems"))
+	assert.Equal(t, "Category", codegen.TypeName("categories"))
+	assert.Equal(t, "Address", codegen.TypeName("address"))
+}
@@ -0,0 +1,295 @@
+package codegen
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+)
+
+// OpenAPIOptions configures GenerateOpenAPI.
+type OpenAPIOptions struct {
+	Title    string
+	Version  string
+	BasePath string //prefix of the table paths, /api by default
+	//TrackColumns are read only, meta.DefaultTrackColumns when empty
+	TrackColumns meta.TrackColumns
+}
+
+type object = map[string]interface{}
+
+// GenerateOpenAPI emits an OpenAPI 3.1 document with a <Type> and a <Type>Patch schema per table
+// and the CRUD paths served for it:
+//
+//	GET, POST /api/{table}
+//	GET, PUT, PATCH, DELETE /api/{table}/{id}
+func GenerateOpenAPI(tables []*meta.MetaTable, options OpenAPIOptions) ([]byte, error) {
+	if len(options.BasePath) == 0 {
+		options.BasePath = "/api"
+	}
+	if options.TrackColumns == (meta.TrackColumns{}) {
+		options.TrackColumns = meta.DefaultTrackColumns
+	}
+	schemas := object{
+		"Error": object{
+			"type":       "object",
+			"required":   []string{"error"},
+			"properties": object{"error": ref("ErrorDetail")},
+		},
+		"ErrorDetail": object{
+			"type":     "object",
+			"required": []string{"code", "message"},
+			"properties": object{
+				"code":    object{"type": "string", "enum": []string{"validation", "notFound", "conflict", "badRequest", "methodNotAllowed", "internal"}},
+				"message": object{"type": "string"},
+				"table":   object{"type": "string"},
+				"column":  object{"type": "string"},
+			},
+		},
+		"Created": object{
+			"type":       "object",
+			"required":   []string{"id"},
+			"properties": object{"id": objectIdSchema()},
+		},
+	}
+	paths := object{}
+	for _, table := range tables {
+		name := TypeName(table.Name)
+		relations := map[string]*meta.RelationShip{}
+		for _, r := range table.RelationShips {
+			relations[r.Column] = r
+		}
+		schema := objectSchema(table.Columns, true, relations, options.TrackColumns)
+		schema["title"] = name
+		if len(table.Description) > 0 {
+			schema["description"] = table.Description
+		}
+		schemas[name] = schema
+		patch := objectSchema(table.Columns, false, relations, options.TrackColumns)
+		patch["title"] = name + "Patch"
+		schemas[name+"Patch"] = patch
+		schemas[name+"Page"] = object{
+			"type":     "object",
+			"required": []string{"items", "total", "page", "pageSize"},
+			"properties": object{
+				"items":    object{"type": "array", "items": ref(name)},
+				"total":    object{"type": "integer", "format": "int64"},
+				"page":     object{"type": "integer"},
+				"pageSize": object{"type": "integer"},
+			},
+		}
+		collection, item := tablePaths(table, name)
+		paths[options.BasePath+"/"+table.Name] = collection
+		paths[options.BasePath+"/"+table.Name+"/{id}"] = item
+	}
+	return json.MarshalIndent(object{
+		"openapi": "3.1.0",
+		"info":    object{"title": options.Title, "version": options.Version},
+		"paths":   paths,
+		"components": object{
+			"schemas": schemas,
+			"responses": object{
+				"Error":      errorResponse("invalid request"),
+				"NotFound":   errorResponse("no record with this id"),
+				"Validation": errorResponse("the record does not satisfy its meta table"),
+				"Conflict":   errorResponse("the record was modified since the version given by If-Match"),
+				"Duplicate":  errorResponse("a unique index already holds these values"),
+				"TooLarge":   errorResponse("the request body is too large"),
+			},
+		},
+	}, "", "  ")
+}
+
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+func errorResponse(description string) object {
+	return object{
+		"description": description,
+		"content":     object{"application/json": object{"schema": ref("Error")}},
+	}
+}
+
+func jsonContent(schema object) object {
+	return object{"application/json": object{"schema": schema}}
+}
+
+func tablePaths(table *meta.MetaTable, name string) (object, object) {
+	tag := []string{table.Name}
+	id := object{"name": "id", "in": "path", "required": true, "schema": objectIdSchema()}
+	errors := func(responses object, codes ...string) object {
+		for _, code := range codes {
+			switch code {
+			case "400":
+				responses[code] = object{"$ref": "#/components/responses/Error"}
+			case "404":
+				responses[code] = object{"$ref": "#/components/responses/NotFound"}
+			case "409":
+				responses[code] = object{"$ref": "#/components/responses/Duplicate"}
+			case "412":
+				responses[code] = object{"$ref": "#/components/responses/Conflict"}
+			case "413":
+				responses[code] = object{"$ref": "#/components/responses/TooLarge"}
+			case "422":
+				responses[code] = object{"$ref": "#/components/responses/Validation"}
+			}
+		}
+		return responses
+	}
+	ifMatch := object{"name": "If-Match", "in": "header", "schema": object{"type": "string"}, "description": "ETag of the version being replaced, * for any version"}
+	collection := object{
+		"get": object{
+			"tags":        tag,
+			"operationId": "list" + name,
+			"parameters": []object{
+				{"name": "page", "in": "query", "schema": object{"type": "integer", "minimum": 1, "default": 1}},
+				{"name": "pageSize", "in": "query", "schema": object{"type": "integer", "minimum": 1, "default": 20}},
+				{"name": "sort", "in": "query", "description": "comma separated columns, - for descending: -createAt,name", "schema": object{"type": "string"}},
+				{"name": "filter", "in": "query", "style": "deepObject", "explode": true,
+					"description": "column paths to values, with an optional operator: filter[price.amount][gte]=10",
+					"schema":      object{"type": "object"}},
+			},
+			"responses": errors(object{
+				"200": object{"description": "a page of records", "content": jsonContent(ref(name + "Page"))},
+			}, "400"),
+		},
+		"post": object{
+			"tags":        tag,
+			"operationId": "create" + name,
+			"requestBody": object{"required": true, "content": jsonContent(ref(name))},
+			"responses": errors(object{
+				"201": object{"description": "created", "content": jsonContent(ref("Created"))},
+			}, "400", "409", "413", "422"),
+		},
+	}
+	item := object{
+		"parameters": []object{id},
+		"get": object{
+			"tags":        tag,
+			"operationId": "get" + name,
+			"responses": errors(object{
+				"200": object{"description": "the record", "content": jsonContent(ref(name)),
+					"headers": object{"ETag": object{"schema": object{"type": "string"}}}},
+			}, "404"),
+		},
+		"put": object{
+			"tags":        tag,
+			"operationId": "replace" + name,
+			"parameters":  []object{ifMatch},
+			"requestBody": object{"required": true, "content": jsonContent(ref(name))},
+			"responses":   errors(object{"204": object{"description": "replaced"}}, "400", "404", "409", "412", "413", "422"),
+		},
+		"patch": object{
+			"tags":        tag,
+			"operationId": "update" + name,
+			"parameters":  []object{ifMatch},
+			"requestBody": object{"required": true, "content": jsonContent(ref(name + "Patch"))},
+			"responses":   errors(object{"204": object{"description": "updated"}}, "400", "404", "409", "412", "413", "422"),
+		},
+		"delete": object{
+			"tags":        tag,
+			"operationId": "delete" + name,
+			"responses":   errors(object{"204": object{"description": "deleted"}}, "404"),
+		},
+	}
+	return collection, item
+}
+
+// objectSchema describes json columns, required lists the non nullable columns the client writes.
+func objectSchema(columns []*meta.MetaColumn, required bool, relations map[string]*meta.RelationShip, track meta.TrackColumns) object {
+	properties := object{}
+	var names []string
+	for _, c := range columns {
+		schema := ColumnSchema(c)
+		readOnly := c.Name == "_id" || c.IsComputed() || track.Has(c.Name)
+		if readOnly {
+			schema["readOnly"] = true
+		}
+		if r, ok := relations[c.Name]; ok {
+			schema["x-relationship"] = object{"type": r.Type.String(), "table": r.RefTable, "column": r.RefColumn}
+		}
+		properties[c.Name] = schema
+		if required && !c.IsNullable && !readOnly && c.DefaultValue == nil {
+			names = append(names, c.Name)
+		}
+	}
+	schema := object{"type": "object", "properties": properties}
+	if len(names) > 0 {
+		sort.Strings(names)
+		schema["required"] = names
+	}
+	return schema
+}
+
+// ColumnSchema returns the JSON schema of a column's values as rendered by DataObjectResp.MarshalJSON:
+// decimals and object ids are strings, dates are RFC 3339 strings.
+func ColumnSchema(c *meta.MetaColumn) object {
+	var schema object
+	switch c.DataType {
+	case meta.DataTypeJson:
+		schema = objectSchema(c.NestedColumns, true, nil, meta.TrackColumns{})
+	case meta.DataTypeString:
+		schema = object{"type": "string"}
+		if c.Length > 0 {
+			schema["maxLength"] = c.Length
+		}
+	case meta.DataTypeUrl:
+		schema = object{"type": "string", "format": "uri"}
+	case meta.DataTypeInt:
+		schema = object{"type": "integer", "format": "int32"}
+	case meta.DataTypeLong:
+		schema = object{"type": "integer", "format": "int64"}
+	case meta.DataTypeFloat:
+		schema = object{"type": "number", "format": "float"}
+	case meta.DataTypeDouble:
+		schema = object{"type": "number", "format": "double"}
+	case meta.DataTypeDecimal:
+		schema = object{"type": "string", "format": "decimal", "pattern": decimalPattern(c)}
+	case meta.DataTypeBool:
+		schema = object{"type": "boolean"}
+	case meta.DataTypeDateTime, meta.DataTypeTime, meta.DataTypeTimestamp:
+		schema = object{"type": "string", "format": "date-time"}
+	case meta.DataTypeObjectId:
+		schema = objectIdSchema()
+	default:
+		schema = object{}
+	}
+	if label := c.Label(); label != c.Name {
+		schema["title"] = label
+	}
+	if len(c.Description) > 0 {
+		schema["description"] = c.Description
+	}
+	if len(c.Dictionary) > 0 {
+		schema["x-dictionary"] = c.Dictionary
+	}
+	if c.DefaultValue != nil && !c.IsArray {
+		schema["default"] = c.DefaultValue
+	}
+	if c.IsArray {
+		schema = object{"type": "array", "items": schema}
+	}
+	if c.IsNullable {
+		if t, ok := schema["type"].(string); ok {
+			schema["type"] = []string{t, "null"}
+		}
+	}
+	return schema
+}
+
+func objectIdSchema() object {
+	return object{"type": "string", "pattern": "^[0-9a-fA-F]{24}$"}
+}
+
+func decimalPattern(c *meta.MetaColumn) string {
+	scale := c.Scale
+	if scale == 0 {
+		scale = c.Precision
+	}
+	if scale == 0 {
+		return `^-?\d+(\.\d+)?$`
+	}
+	return `^-?\d+(\.\d{1,` + strconv.Itoa(scale) + `})?$`
+}
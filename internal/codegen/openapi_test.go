@@ -0,0 +1,84 @@
+package codegen_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/codegen"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateOpenAPI(t *testing.T) {
+	data, err := codegen.GenerateOpenAPI(fixtureTables(t), codegen.OpenAPIOptions{Title: "raya", Version: "1"})
+	assert.NoError(t, err)
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &doc))
+	assert.Equal(t, "3.1.0", doc["openapi"])
+
+	at := func(path string, keys ...string) interface{} {
+		var v interface{} = doc
+		for _, key := range append(strings.Split(path, "/"), keys...) {
+			m, ok := v.(map[string]interface{})
+			if !assert.True(t, ok, path) {
+				return nil
+			}
+			v = m[key]
+		}
+		return v
+	}
+	schemas := "components/schemas/"
+	assert.Equal(t, "object", at(schemas+"Cart/type"))
+	assert.Equal(t, []interface{}{"cartItems", "tags", "userId"}, at(schemas+"Cart/required"))
+	assert.Nil(t, at(schemas+"CartPatch/required"))
+	assert.Equal(t, true, at(schemas+"Cart/properties/_id/readOnly"))
+	assert.Equal(t, true, at(schemas+"Cart/properties/total/readOnly"))
+	assert.Equal(t, true, at(schemas+"Brand/properties/createAt/readOnly"))
+	assert.Equal(t, "date-time", at(schemas+"Brand/properties/createAt/format"))
+	assert.Equal(t, []interface{}{"string", "null"}, at(schemas+"Brand/properties/logo/type"))
+	assert.Equal(t, "uri", at(schemas+"Brand/properties/logo/format"))
+	assert.Equal(t, "备注", at(schemas+"Cart/properties/note/title"))
+	assert.Equal(t, "array", at(schemas+"Cart/properties/tags/type"))
+	assert.Equal(t, "string", at(schemas+"Cart/properties/tags/items/type"))
+	item := schemas + "Cart/properties/cartItems/items/properties/"
+	assert.Equal(t, "integer", at(item+"quantity/type"))
+	assert.Equal(t, "decimal", at(item+"price/properties/amount/format"))
+	assert.Equal(t, `^-?\d+(\.\d{1,2})?$`, at(item+"price/properties/amount/pattern"))
+	assert.Equal(t, "currencies", at(item+"price/properties/currency/x-dictionary"))
+	assert.Equal(t, "users", at(schemas+"Cart/properties/userId/x-relationship/table"))
+	assert.Equal(t, "manyToOne", at(schemas+"Cart/properties/userId/x-relationship/type"))
+
+	paths := doc["paths"].(map[string]interface{})
+	assert.Contains(t, paths, "/api/carts")
+	assert.Contains(t, paths, "/api/carts/{id}")
+	assert.Equal(t, "#/components/schemas/CartPage", at("paths", "/api/carts", "get", "responses", "200", "content", "application/json", "schema", "$ref"))
+	assert.Equal(t, "#/components/schemas/CartPatch", at("paths", "/api/carts/{id}", "patch", "requestBody", "content", "application/json", "schema", "$ref"))
+	assert.Equal(t, "#/components/responses/Validation", at("paths", "/api/carts", "post", "responses", "422", "$ref"))
+	assert.Equal(t, "#/components/responses/Duplicate", at("paths", "/api/carts", "post", "responses", "409", "$ref"))
+	assert.Equal(t, "#/components/responses/TooLarge", at("paths", "/api/carts/{id}", "put", "responses", "413", "$ref"))
+
+	//the body of every error: {"error": {"code": ..., "message": ...}}
+	assert.Equal(t, []interface{}{"error"}, at(schemas+"Error/required"))
+	assert.Equal(t, "#/components/schemas/ErrorDetail", at(schemas+"Error/properties/error/$ref"))
+	assert.Equal(t, []interface{}{"code", "message"}, at(schemas+"ErrorDetail/required"))
+}
+
+func TestGenerateTypeScript(t *testing.T) {
+	source, err := codegen.GenerateTypeScript(fixtureTables(t))
+	assert.NoError(t, err)
+	code := string(source)
+	for _, expected := range []string{
+		"export interface Brand {",
+		"  logo?: string | null;",
+		"export interface Cart {",
+		"  _id?: string;",
+		"  /** manyToOne reference to users._id */\n  userId: string;",
+		"  cartItems: CartCartItem[];",
+		"  /** computed: count(cartItems) */\n  itemCount?: number;",
+		"  tags: string[];",
+		"  note?: string | null;",
+		"export interface CartCartItemPrice {\n  currency: string;\n  amount: string;\n}",
+	} {
+		assert.Contains(t, code, expected)
+	}
+}
@@ -0,0 +1,112 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+)
+
+// GenerateTypeScript emits one exported interface per table and per json column, typed like
+// the json served by DataObjectResp.MarshalJSON: decimals, object ids and dates are strings.
+func GenerateTypeScript(tables []*meta.MetaTable) ([]byte, error) {
+	g := &tsGenerator{body: &bytes.Buffer{}}
+	sorted := append([]*meta.MetaTable(nil), tables...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, table := range sorted {
+		relations := map[string]*meta.RelationShip{}
+		for _, r := range table.RelationShips {
+			relations[r.Column] = r
+		}
+		name := TypeName(table.Name)
+		g.printf("/** A record of the %s table. */\n", table.Name)
+		g.writeInterface(name, table.Columns, relations)
+	}
+	var file bytes.Buffer
+	file.WriteString("// Code generated by metagen. DO NOT EDIT.\n\n")
+	file.Write(g.body.Bytes())
+	for _, nested := range g.nested {
+		file.Write(nested.Bytes())
+	}
+	return append(bytes.TrimRight(file.Bytes(), "\n"), '\n'), nil
+}
+
+type tsGenerator struct {
+	body   *bytes.Buffer
+	nested []*bytes.Buffer //nested interfaces, written after the tables
+}
+
+func (g *tsGenerator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.body, format, args...)
+}
+
+func (g *tsGenerator) writeInterface(name string, columns []*meta.MetaColumn, relations map[string]*meta.RelationShip) {
+	g.printf("export interface %s {\n", name)
+	for _, c := range columns {
+		var comments []string
+		if len(c.Description) > 0 {
+			comments = append(comments, c.Description)
+		}
+		if r, ok := relations[c.Name]; ok {
+			comments = append(comments, fmt.Sprintf("%s reference to %s.%s", r.Type, r.RefTable, r.RefColumn))
+		}
+		if c.IsComputed() {
+			comments = append(comments, "computed: "+c.Expression)
+		}
+		for _, comment := range comments {
+			g.printf("  /** %s */\n", comment)
+		}
+		t := g.fieldType(name, c)
+		if c.IsNullable {
+			g.printf("  %s?: %s | null;\n", tsKey(c.Name), t)
+			continue
+		}
+		optional := ""
+		if c.Name == "_id" || c.IsComputed() {
+			//assigned by the server
+			optional = "?"
+		}
+		g.printf("  %s%s: %s;\n", tsKey(c.Name), optional, t)
+	}
+	g.printf("}\n\n")
+}
+
+func (g *tsGenerator) fieldType(parent string, c *meta.MetaColumn) string {
+	var t string
+	switch c.DataType {
+	case meta.DataTypeJson:
+		nested := parent + TypeName(c.Name)
+		body := g.body
+		g.body = &bytes.Buffer{}
+		g.printf("/** The %s column of %s. */\n", c.Name, parent)
+		g.writeInterface(nested, c.NestedColumns, nil)
+		g.nested = append(g.nested, g.body)
+		g.body = body
+		t = nested
+	case meta.DataTypeString, meta.DataTypeUrl, meta.DataTypeObjectId, meta.DataTypeDecimal,
+		meta.DataTypeDateTime, meta.DataTypeTime, meta.DataTypeTimestamp:
+		t = "string"
+	case meta.DataTypeInt, meta.DataTypeLong, meta.DataTypeFloat, meta.DataTypeDouble:
+		t = "number"
+	case meta.DataTypeBool:
+		t = "boolean"
+	default:
+		t = "unknown"
+	}
+	if c.IsArray {
+		return t + "[]"
+	}
+	return t
+}
+
+// tsKey quotes property names that are not identifiers.
+func tsKey(name string) string {
+	for i, r := range name {
+		if r == '_' || r == '$' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9' {
+			continue
+		}
+		return fmt.Sprintf("%q", name)
+	}
+	return name
+}
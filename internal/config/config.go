@@ -0,0 +1,121 @@
+// Package config loads the settings of the commands in cmd/.
+//
+// Every setting has a default, which is overridden by the yaml file given by -config or $RAYA_CONFIG,
+// then by its environment variable, then by its flag:
+//
+//	mongo:
+//	  uri: mongodb://localhost:27017/?w=majority   # $RAYA_MONGO_URI, -uri
+//	  database: tea                                # $RAYA_MONGO_DATABASE, -db
+//	  maxPoolSize: 20                              # $RAYA_MONGO_MAX_POOL_SIZE, -max-pool-size
+//	server:
+//	  addr: :8080                                  # $RAYA_SERVER_ADDR, -addr
+//	log:
+//	  level: info                                  # $RAYA_LOG_LEVEL, -log-level
+//
+// See settings for the complete list.
+package config
+
+import (
+	"context"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/logging"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Config struct {
+	Mongo   MongoConfig   `yaml:"mongo"`
+	Server  ServerConfig  `yaml:"server"`
+	Log     LogConfig     `yaml:"log"`
+	Crawler CrawlerConfig `yaml:"crawler"`
+}
+
+type MongoConfig struct {
+	URI      string `yaml:"uri"`
+	Database string `yaml:"database"`
+	// MaxPoolSize overrides the maxPoolSize of the uri, 0 for no limit.
+	MaxPoolSize    uint64        `yaml:"maxPoolSize"`
+	ConnectTimeout time.Duration `yaml:"connectTimeout"`
+	// Timeout bounds every read and write on a connection and every call of the meta repository.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr"`
+	// GRPCAddr is the listen address of the gRPC service, not served when empty.
+	GRPCAddr          string        `yaml:"grpcAddr"`
+	MaxPageSize       int           `yaml:"maxPageSize"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout"`
+}
+
+type LogConfig struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level"`
+}
+
+type CrawlerConfig struct {
+	URLs           []string `yaml:"urls"`
+	AllowedDomains []string `yaml:"allowedDomains"`
+	// UserAgent is random for every request when empty.
+	UserAgent   string        `yaml:"userAgent"`
+	Parallelism int           `yaml:"parallelism"`
+	Delay       time.Duration `yaml:"delay"`
+	Timeout     time.Duration `yaml:"timeout"`
+}
+
+// Default is the configuration of a local development environment.
+func Default() *Config {
+	return &Config{
+		Mongo: MongoConfig{
+			URI:            "mongodb://localhost:27017/?w=majority",
+			Database:       "tea",
+			MaxPoolSize:    20,
+			ConnectTimeout: 10 * time.Second,
+			Timeout:        30 * time.Second,
+		},
+		Server: ServerConfig{
+			Addr:              ":8080",
+			MaxPageSize:       100,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			ShutdownTimeout:   10 * time.Second,
+		},
+		Log: LogConfig{Level: "info"},
+		Crawler: CrawlerConfig{
+			URLs:           []string{"https://item.jd.com/100026667928.html"},
+			AllowedDomains: []string{"item.jd.com"},
+			Parallelism:    1,
+			Timeout:        30 * time.Second,
+		},
+	}
+}
+
+// ClientOptions are the options of mongo.Connect.
+func (c *MongoConfig) ClientOptions() *options.ClientOptions {
+	return options.Client().
+		ApplyURI(c.URI).
+		SetMaxPoolSize(c.MaxPoolSize).
+		SetConnectTimeout(c.ConnectTimeout).
+		SetServerSelectionTimeout(c.ConnectTimeout).
+		SetSocketTimeout(c.Timeout)
+}
+
+// Connect connects to the configured deployment.
+func (c *MongoConfig) Connect(ctx context.Context) (*mongo.Client, error) {
+	return mongo.Connect(ctx, c.ClientOptions())
+}
+
+// Apply sets the level of package logging.
+func (c *LogConfig) Apply() error {
+	level, err := logging.ParseLevel(c.Level)
+	if err != nil {
+		return err
+	}
+	logging.SetLevel(level)
+	return nil
+}
@@ -0,0 +1,108 @@
+package config_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "raya.yml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	path := writeFile(t, `
+mongo:
+  uri: mongodb://file:27017
+  database: fromFile
+  maxPoolSize: 5
+server:
+  addr: :9000
+  writeTimeout: 2m
+`)
+	c, err := config.Load(path, env(map[string]string{
+		"RAYA_MONGO_DATABASE":      "fromEnv",
+		"RAYA_MONGO_MAX_POOL_SIZE": "7",
+		"RAYA_SERVER_GRPC_ADDR":    ":9090",
+	}), map[string]string{"db": "fromFlag"}, config.SectionMongo, config.SectionServer)
+	assert.NoError(t, err)
+	assert.Equal(t, "mongodb://file:27017", c.Mongo.URI)
+	assert.Equal(t, "fromFlag", c.Mongo.Database)
+	assert.Equal(t, uint64(7), c.Mongo.MaxPoolSize)
+	assert.Equal(t, 10*time.Second, c.Mongo.ConnectTimeout)
+	assert.Equal(t, ":9000", c.Server.Addr)
+	assert.Equal(t, ":9090", c.Server.GRPCAddr)
+	assert.Equal(t, 2*time.Minute, c.Server.WriteTimeout)
+	assert.Equal(t, "info", c.Log.Level)
+}
+
+func TestParse(t *testing.T) {
+	fs := flag.NewFlagSet("crawler", flag.ContinueOnError)
+	verbose := fs.Bool("verbose", false, "")
+	c, err := config.Parse(fs, []string{"-verbose", "-crawler-urls", "https://a.com/1, https://b.com/2", "-log-level", "debug"}, config.SectionCrawler)
+	assert.NoError(t, err)
+	assert.True(t, *verbose)
+	assert.Equal(t, []string{"https://a.com/1", "https://b.com/2"}, c.Crawler.URLs)
+	assert.Equal(t, "debug", c.Log.Level)
+	assert.Nil(t, fs.Lookup("uri"), "the crawler has no mongo flags")
+
+	fs = flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	_, err = config.Parse(fs, []string{"-timeout", "soon"}, config.SectionMongo)
+	assert.EqualError(t, err, `invalid value "soon" for flag -timeout: invalid duration "soon", expected a value like 30s or 1m`)
+}
+
+func TestValidation(t *testing.T) {
+	_, err := config.Load("", env(map[string]string{
+		"RAYA_MONGO_URI":            "localhost:27017",
+		"RAYA_MONGO_DATABASE":       "te.a",
+		"RAYA_MONGO_MAX_POOL_SIZE":  "-1",
+		"RAYA_SERVER_MAX_PAGE_SIZE": "0",
+		"RAYA_LOG_LEVEL":            "loud",
+	}), map[string]string{"addr": "8080"}, config.SectionMongo, config.SectionServer)
+	assert.Error(t, err)
+	problems := err.(config.Error)
+	assert.Len(t, problems, 6)
+	assert.Equal(t, `mongo.maxPoolSize: $RAYA_MONGO_MAX_POOL_SIZE: invalid unsigned integer "-1"`, problems[0])
+	assert.Contains(t, problems[1], "mongo.uri: ")
+	assert.Equal(t, `mongo.database: "te.a" should not contain any of /\. "$`, problems[2])
+	assert.Contains(t, problems[3], "server.addr: ")
+	assert.Equal(t, "server.maxPageSize: should be positive, got 0", problems[4])
+	assert.Contains(t, problems[5], `log.level: unknown log level "loud"`)
+
+	//sections not used by the command are not validated
+	_, err = config.Load("", env(map[string]string{"RAYA_CRAWLER_URLS": "ftp://a"}), nil, config.SectionMongo)
+	assert.NoError(t, err)
+	_, err = config.Load("", env(map[string]string{"RAYA_CRAWLER_URLS": "ftp://a"}), nil, config.SectionCrawler)
+	assert.EqualError(t, err, "invalid configuration:\n  crawler.urls: \"ftp://a\" is not an http or https url")
+}
+
+func TestUnknownKeys(t *testing.T) {
+	path := writeFile(t, "mongo:\n  url: mongodb://localhost\n")
+	_, err := config.Load(path, env(nil), nil, config.SectionMongo)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "field url not found")
+
+	_, err = config.Load(filepath.Join(t.TempDir(), "missing.yml"), env(nil), nil)
+	assert.Error(t, err)
+}
+
+func TestExampleFile(t *testing.T) {
+	c, err := config.Load("../../config.example.yml", env(nil), nil, config.SectionMongo, config.SectionServer, config.SectionCrawler)
+	assert.NoError(t, err)
+	assert.Equal(t, config.Default(), c)
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Section groups the settings used together, a command only gets the flags of its sections.
+type Section string
+
+const (
+	SectionMongo   Section = "mongo"
+	SectionServer  Section = "server"
+	SectionLog     Section = "log"
+	SectionCrawler Section = "crawler"
+)
+
+// EnvConfig names the config file when -config is not given.
+const EnvConfig = "RAYA_CONFIG"
+
+type setting struct {
+	key   string //yaml path, mongo.maxPoolSize
+	flag  string
+	usage string
+	value func(*Config) flag.Value
+}
+
+func (s *setting) section() Section {
+	return Section(s.key[:strings.Index(s.key, ".")])
+}
+
+// env is the environment variable of the setting: mongo.maxPoolSize -> RAYA_MONGO_MAX_POOL_SIZE.
+func (s *setting) env() string {
+	var b strings.Builder
+	b.WriteString("RAYA_")
+	for i, r := range s.key {
+		switch {
+		case r == '.':
+			b.WriteByte('_')
+		case unicode.IsUpper(r) && i > 0 && s.key[i-1] != '.' && !unicode.IsUpper(rune(s.key[i-1])):
+			b.WriteByte('_')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+var settings = []*setting{
+	{"mongo.uri", "uri", "mongo connection uri", func(c *Config) flag.Value { return (*stringValue)(&c.Mongo.URI) }},
+	{"mongo.database", "db", "mongo database", func(c *Config) flag.Value { return (*stringValue)(&c.Mongo.Database) }},
+	{"mongo.maxPoolSize", "max-pool-size", "largest number of mongo connections, 0 for no limit", func(c *Config) flag.Value { return (*uintValue)(&c.Mongo.MaxPoolSize) }},
+	{"mongo.connectTimeout", "connect-timeout", "timeout of connecting to mongo", func(c *Config) flag.Value { return (*durationValue)(&c.Mongo.ConnectTimeout) }},
+	{"mongo.timeout", "timeout", "timeout of every mongo read and write", func(c *Config) flag.Value { return (*durationValue)(&c.Mongo.Timeout) }},
+	{"server.addr", "addr", "listen address", func(c *Config) flag.Value { return (*stringValue)(&c.Server.Addr) }},
+	{"server.grpcAddr", "grpc-addr", "gRPC listen address, gRPC is not served when empty", func(c *Config) flag.Value { return (*stringValue)(&c.Server.GRPCAddr) }},
+	{"server.maxPageSize", "max-page-size", "largest pageSize accepted by list requests", func(c *Config) flag.Value { return (*intValue)(&c.Server.MaxPageSize) }},
+	{"server.readHeaderTimeout", "read-header-timeout", "timeout of reading request headers", func(c *Config) flag.Value { return (*durationValue)(&c.Server.ReadHeaderTimeout) }},
+	{"server.readTimeout", "read-timeout", "timeout of reading requests", func(c *Config) flag.Value { return (*durationValue)(&c.Server.ReadTimeout) }},
+	{"server.writeTimeout", "write-timeout", "timeout of writing responses", func(c *Config) flag.Value { return (*durationValue)(&c.Server.WriteTimeout) }},
+	{"server.shutdownTimeout", "shutdown-timeout", "time left to running requests on shutdown", func(c *Config) flag.Value { return (*durationValue)(&c.Server.ShutdownTimeout) }},
+	{"log.level", "log-level", "debug, info, warn or error", func(c *Config) flag.Value { return (*stringValue)(&c.Log.Level) }},
+	{"crawler.urls", "crawler-urls", "comma separated urls to crawl", func(c *Config) flag.Value { return (*listValue)(&c.Crawler.URLs) }},
+	{"crawler.allowedDomains", "crawler-allowed-domains", "comma separated domains the crawler may visit", func(c *Config) flag.Value { return (*listValue)(&c.Crawler.AllowedDomains) }},
+	{"crawler.userAgent", "crawler-user-agent", "user agent of the crawler, random when empty", func(c *Config) flag.Value { return (*stringValue)(&c.Crawler.UserAgent) }},
+	{"crawler.parallelism", "crawler-parallelism", "largest number of concurrent requests per domain", func(c *Config) flag.Value { return (*intValue)(&c.Crawler.Parallelism) }},
+	{"crawler.delay", "crawler-delay", "delay between two requests to a domain", func(c *Config) flag.Value { return (*durationValue)(&c.Crawler.Delay) }},
+	{"crawler.timeout", "crawler-timeout", "timeout of loading a page", func(c *Config) flag.Value { return (*durationValue)(&c.Crawler.Timeout) }},
+}
+
+// withLog adds the log section every command has.
+func withLog(sections []Section) []Section {
+	for _, section := range sections {
+		if section == SectionLog {
+			return sections
+		}
+	}
+	return append(sections, SectionLog)
+}
+
+func has(sections []Section, section Section) bool {
+	for _, s := range sections {
+		if s == section {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse registers -config and the flags of sections on fs, parses args and loads the configuration,
+// the other flags of the command are registered on fs beforehand.
+func Parse(fs *flag.FlagSet, args []string, sections ...Section) (*Config, error) {
+	sections = withLog(sections)
+	defaults := Default()
+	path := fs.String("config", "", "yaml config file, $"+EnvConfig+" when empty")
+	for _, s := range settings {
+		if has(sections, s.section()) {
+			fs.Var(s.value(defaults), s.flag, s.usage+" ($"+s.env()+")")
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	flags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	if len(*path) == 0 {
+		*path = os.Getenv(EnvConfig)
+	}
+	return Load(*path, os.LookupEnv, flags, sections...)
+}
+
+// Load starts from Default, then applies the yaml file at path when given, the environment variables
+// found by lookupEnv and flags, a map of flag names to values. The settings of sections are validated.
+func Load(path string, lookupEnv func(string) (string, bool), flags map[string]string, sections ...Section) (*Config, error) {
+	sections = withLog(sections)
+	c := Default()
+	if len(path) > 0 {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+		if err := decodeYAML(data, c); err != nil {
+			return nil, fmt.Errorf("config: %s: %w", path, err)
+		}
+	}
+	var problems Error
+	for _, s := range settings {
+		if v, ok := lookupEnv(s.env()); ok {
+			if err := s.value(c).Set(v); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: $%s: %v", s.key, s.env(), err))
+			}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := flags[s.flag]; ok && has(sections, s.section()) {
+			if err := s.value(c).Set(v); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: -%s: %v", s.key, s.flag, err))
+			}
+		}
+	}
+	problems = append(problems, c.validate(sections)...)
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return c, nil
+}
+
+// decodeYAML rejects unknown keys, a misspelled setting would be silently ignored otherwise.
+func decodeYAML(data []byte, c *Config) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error {
+	*v = stringValue(s)
+	return nil
+}
+
+func (v *stringValue) String() string {
+	return string(*v)
+}
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", s)
+	}
+	*v = intValue(i)
+	return nil
+}
+
+func (v *intValue) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+type uintValue uint64
+
+func (v *uintValue) Set(s string) error {
+	i, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid unsigned integer %q", s)
+	}
+	*v = uintValue(i)
+	return nil
+}
+
+func (v *uintValue) String() string {
+	return strconv.FormatUint(uint64(*v), 10)
+}
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, expected a value like 30s or 1m", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+func (v *durationValue) String() string {
+	return time.Duration(*v).String()
+}
+
+// listValue is a comma separated list.
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+
+func (v *listValue) String() string {
+	return strings.Join(*v, ",")
+}
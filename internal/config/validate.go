@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/logging"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// Error lists every invalid setting, each prefixed by its yaml path.
+type Error []string
+
+func (e Error) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+func (c *Config) validate(sections []Section) Error {
+	var problems Error
+	invalid := func(key string, format string, args ...interface{}) {
+		problems = append(problems, key+": "+fmt.Sprintf(format, args...))
+	}
+	positive := func(key string, d time.Duration) {
+		if d <= 0 {
+			invalid(key, "should be a positive duration, got %s", d)
+		}
+	}
+	if has(sections, SectionMongo) {
+		if _, err := connstring.ParseAndValidate(c.Mongo.URI); err != nil {
+			invalid("mongo.uri", "%v", err)
+		}
+		if len(c.Mongo.Database) == 0 {
+			invalid("mongo.database", "should not be empty")
+		} else if strings.ContainsAny(c.Mongo.Database, "/\\. \"$") {
+			invalid("mongo.database", "%q should not contain any of /\\. \"$", c.Mongo.Database)
+		}
+		positive("mongo.connectTimeout", c.Mongo.ConnectTimeout)
+		positive("mongo.timeout", c.Mongo.Timeout)
+	}
+	if has(sections, SectionServer) {
+		if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+			invalid("server.addr", "%v", err)
+		}
+		if len(c.Server.GRPCAddr) > 0 {
+			if _, _, err := net.SplitHostPort(c.Server.GRPCAddr); err != nil {
+				invalid("server.grpcAddr", "%v", err)
+			}
+		}
+		if c.Server.MaxPageSize < 1 {
+			invalid("server.maxPageSize", "should be positive, got %d", c.Server.MaxPageSize)
+		}
+		positive("server.readHeaderTimeout", c.Server.ReadHeaderTimeout)
+		positive("server.readTimeout", c.Server.ReadTimeout)
+		positive("server.writeTimeout", c.Server.WriteTimeout)
+		positive("server.shutdownTimeout", c.Server.ShutdownTimeout)
+	}
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		invalid("log.level", "%v", err)
+	}
+	if has(sections, SectionCrawler) {
+		if len(c.Crawler.URLs) == 0 {
+			invalid("crawler.urls", "should not be empty")
+		}
+		for _, s := range c.Crawler.URLs {
+			if u, err := url.Parse(s); err != nil || u.Scheme != "http" && u.Scheme != "https" || len(u.Host) == 0 {
+				invalid("crawler.urls", "%q is not an http or https url", s)
+			}
+		}
+		if c.Crawler.Parallelism < 1 {
+			invalid("crawler.parallelism", "should be positive, got %d", c.Crawler.Parallelism)
+		}
+		if c.Crawler.Delay < 0 {
+			invalid("crawler.delay", "should not be negative, got %s", c.Crawler.Delay)
+		}
+		positive("crawler.timeout", c.Crawler.Timeout)
+	}
+	return problems
+}
@@ -0,0 +1,356 @@
+// Package exporter writes the records of a meta table as CSV.
+//
+// Json columns are flattened to dotted headers in metadata order: cartItems.price.amount.
+// The items of an array column are joined in one cell, cartItems.quantity holding 2;1,
+// or exploded into one row per item when the column has the exportArray attribute explode
+// or is passed to WithExplode. Exploding several columns writes every combination of their items.
+// Json columns without nested columns are written as JSON.
+//
+//	ex, err := exporter.New(service, carts, exporter.WithColumns("userId", "cartItems"), exporter.WithExplode("cartItems"))
+//	n, err := ex.Export(w)
+package exporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Exporter writes the records of one meta table.
+type Exporter struct {
+	service   meta.MetaService
+	table     *meta.MetaTable
+	columns   []string
+	explode   map[string]bool
+	separator string
+	query     meta.Query
+	batchSize int64
+	nodes     []*node
+	headers   []string
+}
+
+type Option func(*Exporter)
+
+// WithColumns selects the column paths written, a json column selects its nested columns.
+// The headers keep the order of the metadata.
+func WithColumns(paths ...string) Option {
+	return func(ex *Exporter) {
+		ex.columns = paths
+	}
+}
+
+// WithExplode writes a row per item of the array columns at paths, whatever their exportArray attribute.
+func WithExplode(paths ...string) Option {
+	return func(ex *Exporter) {
+		for _, path := range paths {
+			ex.explode[path] = true
+		}
+	}
+}
+
+// WithArraySeparator sets the separator of joined array items, ";" by default as the importer expects.
+func WithArraySeparator(separator string) Option {
+	return func(ex *Exporter) {
+		ex.separator = separator
+	}
+}
+
+// WithQuery exports the records matching query, in its order and within its skip and limit.
+func WithQuery(query *meta.Query) Option {
+	return func(ex *Exporter) {
+		ex.query = *query
+	}
+}
+
+// WithBatchSize sets the number of records read at once, 1000 by default.
+func WithBatchSize(size int64) Option {
+	return func(ex *Exporter) {
+		if size > 0 {
+			ex.batchSize = size
+		}
+	}
+}
+
+// New returns an exporter of table, the selected columns should be paths of table.
+func New(service meta.MetaService, table *meta.MetaTable, options ...Option) (*Exporter, error) {
+	ex := &Exporter{service: service, table: table, explode: map[string]bool{}, separator: ";", batchSize: 1000}
+	for _, option := range options {
+		option(ex)
+	}
+	selected := map[string]bool{}
+	for _, path := range ex.columns {
+		if table.ColumnByPath(path) == nil {
+			return nil, &meta.ValidationError{Table: table.Name, Column: path, Message: "unknown column"}
+		}
+		selected[path] = true
+	}
+	for path := range ex.explode {
+		if c := table.ColumnByPath(path); c == nil || !c.IsArray {
+			return nil, &meta.ValidationError{Table: table.Name, Column: path, Message: "column is not an array"}
+		}
+	}
+	ex.nodes = ex.plan("", table.Columns, selected, len(selected) == 0, false)
+	for _, n := range ex.nodes {
+		ex.headers = append(ex.headers, n.headers()...)
+	}
+	return ex, nil
+}
+
+// node is a column written by the export, either a leaf holding one cell or a json column flattened into children.
+type node struct {
+	path     string
+	column   *meta.MetaColumn
+	explode  bool
+	children []*node
+}
+
+func (n *node) headers() []string {
+	if len(n.children) == 0 {
+		return []string{n.path}
+	}
+	var headers []string
+	for _, child := range n.children {
+		headers = append(headers, child.headers()...)
+	}
+	return headers
+}
+
+// plan builds the nodes of columns below prefix, all selects every column. Arrays nested in joined arrays are joined.
+func (ex *Exporter) plan(prefix string, columns []*meta.MetaColumn, selected map[string]bool, all, joined bool) []*node {
+	var nodes []*node
+	for _, c := range columns {
+		path := prefix + c.Name
+		if !all && !selected[path] && !selectsBelow(selected, path) {
+			continue
+		}
+		n := &node{path: path, column: c}
+		if c.IsArray && !joined {
+			n.explode = ex.explode[path] || c.ExportArray() == meta.ExportArrayExplode
+		}
+		if c.DataType == meta.DataTypeJson && len(c.NestedColumns) > 0 {
+			n.children = ex.plan(path+".", c.NestedColumns, selected, all || selected[path], joined || c.IsArray && !n.explode)
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func selectsBelow(selected map[string]bool, path string) bool {
+	for s := range selected {
+		if strings.HasPrefix(s, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers returns the header row.
+func (ex *Exporter) Headers() []string {
+	return ex.headers
+}
+
+// Export writes the header row then the rows of the records and returns the number of records written.
+func (ex *Exporter) Export(w io.Writer) (int, error) {
+	out := csv.NewWriter(w)
+	if err := out.Write(ex.headers); err != nil {
+		return 0, err
+	}
+	query := ex.query
+	//paging needs a total order
+	query.Sort = append(append(bson.D{}, query.Sort...), bson.E{Key: "_id", Value: 1})
+	limit := query.Limit
+	count := 0
+	for {
+		query.Limit = ex.batchSize
+		if limit > 0 && limit-int64(count) < query.Limit {
+			query.Limit = limit - int64(count)
+		}
+		dors, err := ex.service.Find(ex.table, &query)
+		if err != nil {
+			return count, err
+		}
+		for _, dor := range dors {
+			rows, err := ex.Rows(dor)
+			if err != nil {
+				return count, err
+			}
+			if err := out.WriteAll(rows); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if int64(len(dors)) < query.Limit || limit > 0 && int64(count) >= limit {
+			break
+		}
+		query.Skip += int64(len(dors))
+	}
+	out.Flush()
+	return count, out.Error()
+}
+
+// Rows returns the rows of dor in the order of Headers, more than one when an array is exploded.
+func (ex *Exporter) Rows(dor *meta.DataObjectResp) ([][]string, error) {
+	//the JSON form renders decimals, object ids and times as the API does
+	b, err := json.Marshal(dor)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var m map[string]interface{}
+	if err := decoder.Decode(&m); err != nil {
+		return nil, err
+	}
+	partials, err := ex.expand(ex.nodes, m)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]string, len(partials))
+	for i, partial := range partials {
+		row := make([]string, len(ex.headers))
+		for j, header := range ex.headers {
+			row[j] = partial[header]
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// partial holds the cells of a row by header.
+type partial map[string]string
+
+// expand returns the rows of the nodes read from m, every combination of the rows of each node.
+func (ex *Exporter) expand(nodes []*node, m map[string]interface{}) ([]partial, error) {
+	rows := []partial{{}}
+	for _, n := range nodes {
+		nodeRows, err := ex.expandNode(n, m[n.column.Name])
+		if err != nil {
+			return nil, err
+		}
+		rows = combine(rows, nodeRows)
+	}
+	return rows, nil
+}
+
+func (ex *Exporter) expandNode(n *node, v interface{}) ([]partial, error) {
+	if !n.column.IsArray {
+		if len(n.children) == 0 {
+			cell, err := format(v)
+			return []partial{{n.path: cell}}, err
+		}
+		object, _ := v.(map[string]interface{})
+		return ex.expand(n.children, object)
+	}
+	items, _ := v.([]interface{})
+	if !n.explode {
+		cells := map[string][]string{}
+		if err := ex.collect(n, items, cells); err != nil {
+			return nil, err
+		}
+		row := partial{}
+		for header, values := range cells {
+			row[header] = strings.Join(values, ex.separator)
+		}
+		return []partial{row}, nil
+	}
+	if len(items) == 0 {
+		return []partial{{}}, nil
+	}
+	var rows []partial
+	for _, item := range items {
+		if len(n.children) == 0 {
+			cell, err := format(item)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, partial{n.path: cell})
+			continue
+		}
+		object, _ := item.(map[string]interface{})
+		itemRows, err := ex.expand(n.children, object)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, itemRows...)
+	}
+	return rows, nil
+}
+
+// collect appends the values of the leaves of n for every item to cells.
+func (ex *Exporter) collect(n *node, items []interface{}, cells map[string][]string) error {
+	if len(n.children) == 0 {
+		if n.column.IsArray && n.column.DataType == meta.DataTypeJson {
+			//items without nested columns are written as one JSON array
+			if len(items) == 0 {
+				return nil
+			}
+			b, err := json.Marshal(items)
+			cells[n.path] = append(cells[n.path], string(b))
+			return err
+		}
+		for _, item := range items {
+			cell, err := format(item)
+			if err != nil {
+				return err
+			}
+			cells[n.path] = append(cells[n.path], cell)
+		}
+		return nil
+	}
+	for _, item := range items {
+		object, _ := item.(map[string]interface{})
+		for _, child := range n.children {
+			v := object[child.column.Name]
+			if child.column.IsArray {
+				nested, _ := v.([]interface{})
+				if err := ex.collect(child, nested, cells); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := ex.collect(child, []interface{}{v}, cells); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func combine(rows, nodeRows []partial) []partial {
+	combined := make([]partial, 0, len(rows)*len(nodeRows))
+	for _, row := range rows {
+		for _, nodeRow := range nodeRows {
+			merged := make(partial, len(row)+len(nodeRow))
+			for k, v := range row {
+				merged[k] = v
+			}
+			for k, v := range nodeRow {
+				merged[k] = v
+			}
+			combined = append(combined, merged)
+		}
+	}
+	return combined
+}
+
+// format renders a value of the JSON form of a record as a cell, objects and arrays as JSON.
+func format(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return fmt.Sprint(v), nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
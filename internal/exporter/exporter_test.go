@@ -0,0 +1,94 @@
+package exporter_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/exporter"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/drkliu/zj-raya/internal/meta/metatest"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func newCarts(t *testing.T) (meta.MetaService, *meta.MetaTable) {
+	service, _ := metatest.NewService(t)
+	carts, err := service.FindMetaTableByName("carts")
+	assert.NoError(t, err)
+	for _, record := range []string{
+		`{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "note": "a", "tags": ["gift", "sale"], "cartItems": [
+			{"productId": "5f1d7a9b2c3e4f5a6b7c8d9f", "quantity": 2, "price": {"currency": "CNY", "amount": "1.50"}},
+			{"productId": "5f1d7a9b2c3e4f5a6b7c8da0", "quantity": 1, "price": {"currency": "CNY", "amount": "3"}}]}`,
+		`{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "note": "b, c"}`,
+	} {
+		do, err := meta.UnmarshalDataObjectJSON(carts, []byte(record))
+		assert.NoError(t, err)
+		_, err = service.InsertOne(carts, do)
+		assert.NoError(t, err)
+	}
+	return service, carts
+}
+
+func export(t *testing.T, service meta.MetaService, table *meta.MetaTable, options ...exporter.Option) string {
+	ex, err := exporter.New(service, table, options...)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = ex.Export(&buf)
+	assert.NoError(t, err)
+	return buf.String()
+}
+
+var byNote = exporter.WithQuery(&meta.Query{Sort: bson.D{{Key: "note", Value: 1}}})
+
+func TestExportJoinsArrays(t *testing.T) {
+	service, carts := newCarts(t)
+
+	out := export(t, service, carts, byNote, exporter.WithColumns("note", "cartItems", "tags", "total"))
+	assert.Equal(t, strings.Join([]string{
+		"cartItems.productId,cartItems.quantity,cartItems.price.currency,cartItems.price.amount,total,tags,note",
+		"5f1d7a9b2c3e4f5a6b7c8d9f;5f1d7a9b2c3e4f5a6b7c8da0,2;1,CNY;CNY,1.50;3.00,6.00,gift;sale,a",
+		`,,,,0.00,,"b, c"`,
+	}, "\n")+"\n", out)
+
+	out = export(t, service, carts, byNote, exporter.WithColumns("tags", "cartItems.price.amount"), exporter.WithArraySeparator("|"))
+	assert.Equal(t, "cartItems.price.amount,tags\n1.50|3.00,gift|sale\n,\n", out)
+}
+
+func TestExportExplodesArrays(t *testing.T) {
+	service, carts := newCarts(t)
+
+	out := export(t, service, carts, byNote, exporter.WithColumns("note", "cartItems.quantity", "tags"), exporter.WithExplode("cartItems"))
+	assert.Equal(t, "cartItems.quantity,tags,note\n2,gift;sale,a\n1,gift;sale,a\n,,\"b, c\"\n", out)
+
+	//every combination of the exploded columns
+	out = export(t, service, carts, byNote, exporter.WithColumns("cartItems.quantity", "tags"), exporter.WithExplode("cartItems", "tags"))
+	assert.Equal(t, "cartItems.quantity,tags\n2,gift\n2,sale\n1,gift\n1,sale\n,\n", out)
+
+	//the exportArray attribute explodes by default
+	carts.Column("tags").Attributes = append(carts.Column("tags").Attributes, meta.NewAttribute(meta.AttributeExportArray, meta.ExportArrayExplode))
+	assert.NoError(t, carts.Validate())
+	out = export(t, service, carts, byNote, exporter.WithColumns("note", "tags"))
+	assert.Equal(t, "tags,note\ngift,a\nsale,a\n,\"b, c\"\n", out)
+}
+
+func TestExportQuery(t *testing.T) {
+	service, carts := newCarts(t)
+
+	filter := &meta.Query{Filter: bson.D{{Key: "tags", Value: "gift"}}}
+	out := export(t, service, carts, exporter.WithQuery(filter), exporter.WithColumns("note"))
+	assert.Equal(t, "note\na\n", out)
+
+	//pages smaller than the limit
+	paged := &meta.Query{Sort: bson.D{{Key: "note", Value: -1}}, Skip: 0, Limit: 2}
+	out = export(t, service, carts, exporter.WithQuery(paged), exporter.WithBatchSize(1), exporter.WithColumns("note"))
+	assert.Equal(t, "note\n\"b, c\"\na\n", out)
+	paged.Skip = 1
+	out = export(t, service, carts, exporter.WithQuery(paged), exporter.WithBatchSize(1), exporter.WithColumns("note"))
+	assert.Equal(t, "note\na\n", out)
+
+	_, err := exporter.New(service, carts, exporter.WithColumns("colour"))
+	assert.Error(t, err)
+	_, err = exporter.New(service, carts, exporter.WithExplode("note"))
+	assert.Error(t, err)
+}
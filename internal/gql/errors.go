@@ -0,0 +1,58 @@
+package gql
+
+import (
+	"errors"
+
+	"github.com/drkliu/zj-raya/internal/logging"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// resolveError carries the code of the REST error bodies in the extensions of a GraphQL error:
+// {"message": "...", "extensions": {"code": "validation", "table": "carts", "column": "note"}}.
+type resolveError struct {
+	code    string
+	message string
+	table   string
+	column  string
+}
+
+func (e *resolveError) Error() string {
+	return e.message
+}
+
+func (e *resolveError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.code}
+	if e.table != "" {
+		extensions["table"] = e.table
+	}
+	if e.column != "" {
+		extensions["column"] = e.column
+	}
+	return extensions
+}
+
+// toError maps the errors of the meta package to a resolveError,
+// unexpected errors are logged and hidden from the client.
+func toError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var resolveErr *resolveError
+	var validation *meta.ValidationError
+	var conflict *meta.ConflictError
+	switch {
+	case errors.As(err, &resolveErr):
+		return resolveErr
+	case errors.As(err, &validation):
+		return &resolveError{code: "validation", message: validation.Message, table: validation.Table, column: validation.Column}
+	case errors.As(err, &conflict):
+		return &resolveError{code: "conflict", message: conflict.Error(), table: conflict.Table}
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return &resolveError{code: "notFound", message: "no such record"}
+	case mongo.IsDuplicateKeyError(err):
+		return &resolveError{code: "conflict", message: "duplicate key"}
+	}
+	logging.Errorf("gql: %v", err)
+	return &resolveError{code: "internal", message: "internal server error"}
+}
@@ -0,0 +1,170 @@
+package gql
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/drkliu/zj-raya/internal/logging"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// Handler is the http.Handler of the GraphQL API.
+type Handler struct {
+	service     meta.MetaService
+	registry    *meta.Registry
+	maxPageSize int
+	maxBodySize int64
+
+	mu     sync.RWMutex
+	schema graphql.Schema
+}
+
+type HandlerOption func(*Handler)
+
+// WithMaxPageSize bounds the pageSize argument of the list fields, 100 by default.
+func WithMaxPageSize(size int) HandlerOption {
+	return func(h *Handler) {
+		h.maxPageSize = size
+	}
+}
+
+// WithMaxBodySize bounds the size of request bodies, 1MB by default.
+func WithMaxBodySize(size int64) HandlerOption {
+	return func(h *Handler) {
+		h.maxBodySize = size
+	}
+}
+
+// NewHandler serves the schema of the tables of registry, generated again whenever they change.
+func NewHandler(service meta.MetaService, registry *meta.Registry, options ...HandlerOption) (*Handler, error) {
+	h := &Handler{service: service, registry: registry, maxPageSize: 100, maxBodySize: 1 << 20}
+	for _, option := range options {
+		option(h)
+	}
+	if err := h.rebuild(); err != nil {
+		return nil, err
+	}
+	registry.OnChange(func() {
+		//a table the schema cannot express keeps the previous schema
+		if err := h.rebuild(); err != nil {
+			logging.Warnf("gql: keeping the previous schema: %v", err)
+		}
+	})
+	return h, nil
+}
+
+func (h *Handler) rebuild() error {
+	schema, err := NewSchema(h.service, h.registry.All(), h.maxPageSize)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	h.schema = schema
+	h.mu.Unlock()
+	return nil
+}
+
+// Schema is the schema currently served.
+func (h *Handler) Schema() graphql.Schema {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.schema
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// ServeHTTP executes POST {"query": ..., "variables": ..., "operationName": ...} requests
+// and GET ?query=...&variables=... requests, which cannot run mutations.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		values := r.URL.Query()
+		req.Query, req.OperationName = values.Get("query"), values.Get("operationName")
+		if variables := values.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				writeErrors(w, http.StatusBadRequest, "invalid variables: "+err.Error())
+				return
+			}
+		}
+		if isMutation(req.Query, req.OperationName) {
+			w.Header().Set("Allow", http.MethodPost)
+			writeErrors(w, http.StatusMethodNotAllowed, "mutations need a POST request")
+			return
+		}
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, h.maxBodySize+1))
+		if err != nil {
+			writeErrors(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if int64(len(body)) > h.maxBodySize {
+			writeErrors(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeErrors(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeErrors(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if req.Query == "" {
+		writeErrors(w, http.StatusBadRequest, "missing query")
+		return
+	}
+	result := graphql.Do(graphql.Params{
+		Schema:         h.Schema(),
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        r.Context(),
+	})
+	writeJSON(w, http.StatusOK, result)
+}
+
+// isMutation tells whether the executed operation of query is a mutation,
+// queries that do not parse are left to graphql.Do to report.
+func isMutation(query, operationName string) bool {
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return false
+	}
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok || operationName != "" && (operation.Name == nil || operation.Name.Value != operationName) {
+			continue
+		}
+		if operation.Operation == ast.OperationTypeMutation {
+			return true
+		}
+	}
+	return false
+}
+
+func writeErrors(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{"errors": []map[string]string{{"message": message}}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logging.Errorf("gql: %v", err)
+		status, body = http.StatusInternalServerError, []byte(`{"errors":[{"message":"internal server error"}]}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,195 @@
+package gql_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/gql"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/drkliu/zj-raya/internal/meta/metatest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, meta.MetaService) {
+	service, registry := metatest.NewService(t)
+	handler, err := gql.NewHandler(service, registry, gql.WithMaxPageSize(50))
+	assert.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server, service
+}
+
+type result struct {
+	Data   map[string]interface{}   `json:"data"`
+	Errors []map[string]interface{} `json:"errors"`
+}
+
+// do posts query with variables and decodes the response.
+func do(t *testing.T, server *httptest.Server, query string, variables map[string]interface{}) result {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	assert.NoError(t, err)
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(string(body)))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var r result
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&r))
+	return r
+}
+
+func extensions(r result) map[string]interface{} {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	e, _ := r.Errors[0]["extensions"].(map[string]interface{})
+	return e
+}
+
+const createCart = `mutation($input: CartInput!) {
+	createCart(input: $input) { _id total itemCount tags cartItems { quantity price { currency amount } } }
+}`
+
+func cartInput(quantity int, amount string, tags ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"input": map[string]interface{}{
+			"userId":    "5f1d7a9b2c3e4f5a6b7c8d9e",
+			"cartItems": []interface{}{map[string]interface{}{"productId": "5f1d7a9b2c3e4f5a6b7c8d9f", "quantity": quantity, "price": map[string]interface{}{"currency": "CNY", "amount": amount}}},
+			"tags":      tags,
+		},
+	}
+}
+
+func TestMutations(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	r := do(t, server, createCart, cartInput(3, "19.90", "gift"))
+	assert.Empty(t, r.Errors)
+	cart := r.Data["createCart"].(map[string]interface{})
+	assert.Equal(t, "59.70", cart["total"])
+	assert.Equal(t, float64(1), cart["itemCount"])
+	assert.Equal(t, []interface{}{"gift"}, cart["tags"])
+	assert.Equal(t, "CNY", cart["cartItems"].([]interface{})[0].(map[string]interface{})["price"].(map[string]interface{})["currency"])
+	id := cart["_id"].(string)
+
+	r = do(t, server, `mutation($id: ObjectID!) { updateCart(id: $id, input: {note: "备注"}) { note total } }`, map[string]interface{}{"id": id})
+	assert.Empty(t, r.Errors)
+	assert.Equal(t, map[string]interface{}{"note": "备注", "total": "59.70"}, r.Data["updateCart"])
+
+	r = do(t, server, `mutation($id: ObjectID!) { updateCart(id: $id, input: {note: "x"}, version: 99) { note } }`, map[string]interface{}{"id": id})
+	assert.Equal(t, "conflict", extensions(r)["code"])
+
+	input := cartInput(1, "1.00")
+	input["input"].(map[string]interface{})["cartItems"].([]interface{})[0].(map[string]interface{})["price"].(map[string]interface{})["currency"] = "USD"
+	r = do(t, server, createCart, input)
+	assert.Equal(t, map[string]interface{}{"code": "validation", "table": "carts", "column": "cartItems.0.price.currency"}, extensions(r))
+
+	r = do(t, server, `mutation($id: ObjectID!) { deleteCart(id: $id) }`, map[string]interface{}{"id": id})
+	assert.Empty(t, r.Errors)
+	r = do(t, server, `query($id: ObjectID!) { cart(id: $id) { _id } }`, map[string]interface{}{"id": id})
+	assert.Empty(t, r.Errors)
+	assert.Nil(t, r.Data["cart"])
+	r = do(t, server, `mutation($id: ObjectID!) { deleteCart(id: $id) }`, map[string]interface{}{"id": id})
+	assert.Equal(t, "notFound", extensions(r)["code"])
+}
+
+func TestListFiltersSortsAndPages(t *testing.T) {
+	server, _ := newTestServer(t)
+	for i, amount := range []string{"5.00", "12.50", "30.00"} {
+		r := do(t, server, createCart, cartInput(i+1, amount, []string{"a", "b", "c"}[i]))
+		assert.Empty(t, r.Errors)
+	}
+	totals := func(query string) []interface{} {
+		r := do(t, server, query, nil)
+		assert.Empty(t, r.Errors)
+		page := r.Data["carts"].(map[string]interface{})
+		var totals []interface{}
+		for _, item := range page["items"].([]interface{}) {
+			totals = append(totals, item.(map[string]interface{})["total"])
+		}
+		return append(totals, page["total"])
+	}
+	assert.Equal(t, []interface{}{"90.00", "25.00", "5.00", float64(3)}, totals(`{ carts(sort: ["-total"]) { items { total } total } }`))
+	assert.Equal(t, []interface{}{"25.00", float64(3)}, totals(`{ carts(sort: ["total"], page: 2, pageSize: 1) { items { total } total } }`))
+	assert.Equal(t, []interface{}{"25.00", "90.00", float64(2)}, totals(`{ carts(filter: {cartItems_price_amount: {gte: "10"}}, sort: ["total"]) { items { total } total } }`))
+	assert.Equal(t, []interface{}{"5.00", "90.00", float64(2)}, totals(`{ carts(filter: {or: [{tags: {eq: "a"}}, {cartItems_quantity: {in: [3]}}]}, sort: ["total"]) { items { total } total } }`))
+	assert.Equal(t, []interface{}{float64(0)}, totals(`{ carts(filter: {note: {exists: true}}) { items { total } total } }`))
+
+	r := do(t, server, `{ carts(sort: ["itemCount"]) { total } }`, nil)
+	assert.Equal(t, "badRequest", extensions(r)["code"])
+	r = do(t, server, `{ carts(pageSize: 51) { total } }`, nil)
+	assert.Equal(t, "badRequest", extensions(r)["code"])
+	r = do(t, server, `{ carts(filter: {itemCount: {eq: 1}}) { total } }`, nil)
+	assert.NotEmpty(t, r.Errors)
+}
+
+func TestDeletedRecordsCannotBeFiltered(t *testing.T) {
+	server, service := newTestServer(t)
+	stores := &meta.MetaTable{
+		Name:       "stores",
+		PrimaryKey: &meta.PrimaryKey{Name: "stores_pk_id", ColumnNames: []string{"_id"}, IdGeneratorType: meta.IdGeneratorTypeObjectId},
+		Columns: []*meta.MetaColumn{
+			{Name: "_id", DataType: meta.DataTypeObjectId},
+			{Name: "name", DataType: meta.DataTypeString},
+			{Name: "deleted", DataType: meta.DataTypeBool, IsNullable: true},
+		},
+	}
+	_, err := service.InsertMetaTable(stores)
+	assert.NoError(t, err)
+	r := do(t, server, `mutation { createStore(input: {name: "first"}) { _id } }`, nil)
+	assert.Empty(t, r.Errors)
+	r = do(t, server, `{ stores(filter: {or: [{name: {eq: "first"}}, {deleted: {eq: true}}]}) { total } }`, nil)
+	assert.Equal(t, "validation", extensions(r)["code"])
+	assert.Equal(t, "deleted", extensions(r)["column"])
+	r = do(t, server, `{ stores(filter: {name: {eq: "first"}}) { total } }`, nil)
+	assert.Empty(t, r.Errors)
+}
+
+func TestSchemaFollowsMetaTables(t *testing.T) {
+	server, service := newTestServer(t)
+	r := do(t, server, createCart, cartInput(1, "1.00"))
+	assert.Empty(t, r.Errors)
+	r = do(t, server, `{ carts { items { carts_users { name } } } }`, nil)
+	assert.NotEmpty(t, r.Errors, "users is not a table yet")
+
+	users := &meta.MetaTable{
+		Name:       "users",
+		PrimaryKey: &meta.PrimaryKey{Name: "users_pk_id", ColumnNames: []string{"_id"}, IdGeneratorType: meta.IdGeneratorTypeObjectId},
+		Columns: []*meta.MetaColumn{
+			{Name: "_id", DataType: meta.DataTypeObjectId},
+			{Name: "name", DataType: meta.DataTypeString},
+		},
+	}
+	_, err := service.InsertMetaTable(users)
+	assert.NoError(t, err)
+	r = do(t, server, `mutation { createUser(input: {name: "lily"}) { _id } }`, nil)
+	assert.Empty(t, r.Errors)
+	userID := r.Data["createUser"].(map[string]interface{})["_id"].(string)
+	input := cartInput(2, "2.00")
+	input["input"].(map[string]interface{})["userId"] = userID
+	r = do(t, server, createCart, input)
+	assert.Empty(t, r.Errors)
+
+	r = do(t, server, `{ carts(sort: ["total"]) { items { total carts_users { name } } } }`, nil)
+	assert.Empty(t, r.Errors)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"total": "1.00", "carts_users": nil},
+		map[string]interface{}{"total": "4.00", "carts_users": map[string]interface{}{"name": "lily"}},
+	}, r.Data["carts"].(map[string]interface{})["items"])
+}
+
+func TestGetRequests(t *testing.T) {
+	server, _ := newTestServer(t)
+	resp, err := http.Get(server.URL + "?query=" + url.QueryEscape(`{ carts { total } }`))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "?query=" + url.QueryEscape(`mutation { deleteCart(id: "5f1d7a9b2c3e4f5a6b7c8d9e") }`))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
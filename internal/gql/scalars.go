@@ -0,0 +1,215 @@
+package gql
+
+import (
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The scalars below serialize values the way DataObjectResp.MarshalJSON does,
+// their parsed values are converted again by meta.ConvertValue before reaching the repository.
+
+var objectIDScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "ObjectID",
+	Description: "A mongo ObjectId as 24 hex digits.",
+	Serialize: func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case primitive.ObjectID:
+			return v.Hex()
+		case meta.ID:
+			return v.String()
+		case string:
+			return v
+		}
+		return nil
+	},
+	ParseValue:   parseObjectID,
+	ParseLiteral: literal(parseObjectID),
+})
+
+func parseObjectID(value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	id, err := primitive.ObjectIDFromHex(s)
+	if err != nil {
+		return nil
+	}
+	return id
+}
+
+var decimalScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Decimal",
+	Description: "An exact decimal number written as a string: \"59.70\".",
+	Serialize: func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case primitive.Decimal128:
+			return v.String()
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case int32, int64, int:
+			return big.NewRat(toInt64(v), 1).RatString()
+		}
+		return nil
+	},
+	ParseValue:   parseDecimal,
+	ParseLiteral: literal(parseDecimal),
+})
+
+func parseDecimal(value interface{}) interface{} {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		s = strconv.Itoa(v)
+	default:
+		return nil
+	}
+	d, err := primitive.ParseDecimal128(s)
+	if err != nil {
+		return nil
+	}
+	return d
+}
+
+var dateTimeScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "DateTime",
+	Description: "A time in RFC 3339.",
+	Serialize: func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case primitive.DateTime:
+			return v.Time().UTC().Format(time.RFC3339Nano)
+		case time.Time:
+			return v.UTC().Format(time.RFC3339Nano)
+		case primitive.Timestamp:
+			return time.Unix(int64(v.T), 0).UTC().Format(time.RFC3339Nano)
+		}
+		return nil
+	},
+	ParseValue:   parseDateTime,
+	ParseLiteral: literal(parseDateTime),
+})
+
+func parseDateTime(value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
+var longScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Long",
+	Description: "A 64 bit integer.",
+	Serialize: func(value interface{}) interface{} {
+		switch value.(type) {
+		case int, int32, int64:
+			return toInt64(value)
+		}
+		return nil
+	},
+	ParseValue:   parseLong,
+	ParseLiteral: literal(parseLong),
+})
+
+func parseLong(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+	}
+	return nil
+}
+
+var jsonScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "Any JSON value.",
+	Serialize: func(value interface{}) interface{} {
+		return plain(value)
+	},
+	ParseValue: func(value interface{}) interface{} {
+		return value
+	},
+	ParseLiteral: literalValue,
+})
+
+// literal parses the string and number literals of a query with parse.
+func literal(parse func(interface{}) interface{}) graphql.ParseLiteralFn {
+	return func(valueAST ast.Value) interface{} {
+		switch v := valueAST.(type) {
+		case *ast.StringValue:
+			return parse(v.Value)
+		case *ast.IntValue:
+			if i, err := strconv.ParseInt(v.Value, 10, 64); err == nil {
+				return parse(i)
+			}
+		case *ast.FloatValue:
+			return parse(v.Value)
+		}
+		return nil
+	}
+}
+
+func literalValue(valueAST ast.Value) interface{} {
+	switch v := valueAST.(type) {
+	case *ast.StringValue:
+		return v.Value
+	case *ast.BooleanValue:
+		return v.Value
+	case *ast.IntValue:
+		i, _ := strconv.ParseInt(v.Value, 10, 64)
+		return i
+	case *ast.FloatValue:
+		f, _ := strconv.ParseFloat(v.Value, 64)
+		return f
+	case *ast.ListValue:
+		items := make([]interface{}, len(v.Values))
+		for i, item := range v.Values {
+			items[i] = literalValue(item)
+		}
+		return items
+	case *ast.ObjectValue:
+		m := make(map[string]interface{}, len(v.Fields))
+		for _, field := range v.Fields {
+			m[field.Name.Value] = literalValue(field.Value)
+		}
+		return m
+	}
+	return nil
+}
+
+func toInt64(v interface{}) int64 {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,613 @@
+// Package gql serves a GraphQL schema generated from the registered meta tables.
+//
+// Every table gets an object type named like the go structs of codegen (products -> Product),
+// with one field per column, nested object types for json columns and one field per relationship,
+// named after the relationship. The query type has a product(id) and a products(filter, sort, page, pageSize)
+// field per table and the mutation type createProduct, updateProduct and deleteProduct.
+package gql
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/codegen"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/graphql-go/graphql"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const defaultPageSize = 20
+
+var namePattern = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// validName tells whether a column or relationship can be exposed as a field.
+func validName(name string) bool {
+	return namePattern.MatchString(name) && !strings.HasPrefix(name, "__")
+}
+
+// filterPath is the column behind a field of a <Type>Filter input.
+type filterPath struct {
+	path   string
+	column *meta.MetaColumn
+}
+
+type builder struct {
+	service     meta.MetaService
+	maxPageSize int
+	tables      map[string]*meta.MetaTable
+	objects     map[string]*graphql.Object //by table name
+	comparisons map[string]*graphql.InputObject
+	filters     map[string]map[string]filterPath //by filter type name
+}
+
+// NewSchema generates the schema of tables, resolved through service.
+func NewSchema(service meta.MetaService, tables []*meta.MetaTable, maxPageSize int) (graphql.Schema, error) {
+	b := &builder{
+		service:     service,
+		maxPageSize: maxPageSize,
+		tables:      map[string]*meta.MetaTable{},
+		objects:     map[string]*graphql.Object{},
+		comparisons: map[string]*graphql.InputObject{},
+		filters:     map[string]map[string]filterPath{},
+	}
+	sorted := append([]*meta.MetaTable(nil), tables...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, table := range sorted {
+		if validName(table.Name) {
+			b.tables[table.Name] = table
+		}
+	}
+	query := graphql.Fields{}
+	mutation := graphql.Fields{}
+	for _, table := range sorted {
+		if _, ok := b.tables[table.Name]; !ok {
+			continue
+		}
+		b.objects[table.Name] = b.tableObject(table)
+	}
+	for _, table := range sorted {
+		if _, ok := b.tables[table.Name]; !ok {
+			continue
+		}
+		b.addQueries(query, table)
+		b.addMutations(mutation, table)
+	}
+	if len(query) == 0 {
+		//a schema needs at least one query field
+		query["tables"] = &graphql.Field{
+			Type:    graphql.NewList(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) { return []string{}, nil },
+		}
+	}
+	config := graphql.SchemaConfig{Query: graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: query})}
+	if len(mutation) > 0 {
+		config.Mutation = graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: mutation})
+	}
+	return graphql.NewSchema(config)
+}
+
+func (b *builder) tableObject(table *meta.MetaTable) *graphql.Object {
+	name := codegen.TypeName(table.Name)
+	fields := b.columnFields(name, table.Columns)
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name:        name,
+		Description: table.Description,
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			//relationships refer to the other tables, added once every object exists
+			for _, r := range table.RelationShips {
+				if field := b.relationField(r); field != nil && fields[r.Name] == nil {
+					fields[r.Name] = field
+				}
+			}
+			return fields
+		}),
+	})
+}
+
+func (b *builder) columnFields(parent string, columns []*meta.MetaColumn) graphql.Fields {
+	fields := graphql.Fields{}
+	for _, c := range columns {
+		if !validName(c.Name) {
+			continue
+		}
+		key := c.Name
+		var t graphql.Output
+		if c.DataType == meta.DataTypeJson && len(c.NestedColumns) > 0 {
+			name := parent + codegen.TypeName(c.Name)
+			t = graphql.NewObject(graphql.ObjectConfig{Name: name, Fields: b.columnFields(name, c.NestedColumns)})
+		} else {
+			t = scalarOf(c.DataType)
+		}
+		if c.IsArray {
+			t = graphql.NewList(t)
+		}
+		if c.Name == "_id" {
+			t = graphql.NewNonNull(t)
+		}
+		fields[c.Name] = &graphql.Field{
+			Type:        t,
+			Description: c.Description,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return fieldOf(p.Source, key), nil
+			},
+		}
+	}
+	return fields
+}
+
+func scalarOf(dataType meta.DataType) *graphql.Scalar {
+	switch dataType {
+	case meta.DataTypeString, meta.DataTypeUrl:
+		return graphql.String
+	case meta.DataTypeInt:
+		return graphql.Int
+	case meta.DataTypeLong:
+		return longScalar
+	case meta.DataTypeFloat, meta.DataTypeDouble:
+		return graphql.Float
+	case meta.DataTypeDecimal:
+		return decimalScalar
+	case meta.DataTypeBool:
+		return graphql.Boolean
+	case meta.DataTypeDateTime, meta.DataTypeTime, meta.DataTypeTimestamp:
+		return dateTimeScalar
+	case meta.DataTypeObjectId:
+		return objectIDScalar
+	}
+	return jsonScalar
+}
+
+// fieldOf reads a key of a record or of a nested document.
+func fieldOf(source interface{}, key string) interface{} {
+	var d bson.D
+	switch v := source.(type) {
+	case *meta.DataObjectResp:
+		d = bson.D(*v)
+	case meta.DataObjectResp:
+		d = bson.D(v)
+	case bson.D:
+		d = v
+	case map[string]interface{}:
+		return v[key]
+	}
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+// relationField resolves the records referenced by r, nil when the referenced table is not registered.
+func (b *builder) relationField(r *meta.RelationShip) *graphql.Field {
+	ref, ok := b.tables[r.RefTable]
+	if !ok || !validName(r.Name) {
+		return nil
+	}
+	object := b.objects[r.RefTable]
+	value := func(p graphql.ResolveParams) interface{} {
+		if dor, ok := p.Source.(*meta.DataObjectResp); ok {
+			v, _ := dor.GetPath(r.Column)
+			return v
+		}
+		return nil
+	}
+	switch r.Type {
+	case meta.RelationShipTypeOneToOne, meta.RelationShipTypeManyToOne:
+		return &graphql.Field{
+			Type:        object,
+			Description: r.Type.String() + " reference to " + r.RefTable + "." + r.RefColumn,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				v := value(p)
+				if v == nil {
+					return nil, nil
+				}
+				service := b.service.WithContext(p.Context)
+				if id, ok := v.(primitive.ObjectID); ok && r.RefColumn == "_id" {
+					dor, err := service.FindOne(ref, meta.ID(id))
+					if errors.Is(err, mongo.ErrNoDocuments) {
+						return nil, nil
+					}
+					return dor, toError(err)
+				}
+				dors, err := service.Find(ref, &meta.Query{Filter: bson.D{{Key: r.RefColumn, Value: v}}, Limit: 1})
+				if err != nil || len(dors) == 0 {
+					return nil, toError(err)
+				}
+				return dors[0], nil
+			},
+		}
+	case meta.RelationShipTypeOneToMany, meta.RelationShipTypeManyToMany:
+		return &graphql.Field{
+			Type:        graphql.NewList(object),
+			Description: r.Type.String() + " reference to " + r.RefTable + "." + r.RefColumn,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				v := value(p)
+				if v == nil {
+					return []*meta.DataObjectResp{}, nil
+				}
+				var condition interface{} = v
+				if r.Type == meta.RelationShipTypeManyToMany {
+					condition = bson.M{"$in": v}
+				}
+				dors, err := b.service.WithContext(p.Context).Find(ref, &meta.Query{Filter: bson.D{{Key: r.RefColumn, Value: condition}}})
+				return dors, toError(err)
+			},
+		}
+	}
+	return nil
+}
+
+func lowerFirst(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func (b *builder) addQueries(query graphql.Fields, table *meta.MetaTable) {
+	name := codegen.TypeName(table.Name)
+	object := b.objects[table.Name]
+	one, many := lowerFirst(name), lowerFirst(codegen.FieldName(table.Name))
+	if one == many {
+		many += "List"
+	}
+	query[one] = &graphql.Field{
+		Type: object,
+		Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(objectIDScalar)}},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id, _ := p.Args["id"].(primitive.ObjectID)
+			dor, err := b.service.WithContext(p.Context).FindOne(table, meta.ID(id))
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, nil
+			}
+			return dor, toError(err)
+		},
+	}
+	page := graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Page",
+		Fields: graphql.Fields{
+			"items":    {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(object)))},
+			"total":    {Type: graphql.NewNonNull(longScalar)},
+			"page":     {Type: graphql.NewNonNull(graphql.Int)},
+			"pageSize": {Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+	filter := b.filterType(name+"Filter", table)
+	query[many] = &graphql.Field{
+		Type: graphql.NewNonNull(page),
+		Args: graphql.FieldConfigArgument{
+			"filter":   {Type: filter},
+			"sort":     {Type: graphql.NewList(graphql.NewNonNull(graphql.String)), Description: "column paths, prefixed by - for descending"},
+			"page":     {Type: graphql.Int, DefaultValue: 1},
+			"pageSize": {Type: graphql.Int, DefaultValue: defaultPageSize},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			query, err := b.query(filter.Name(), table, p.Args)
+			if err != nil {
+				return nil, err
+			}
+			service := b.service.WithContext(p.Context)
+			total, err := service.Count(table, query.Filter)
+			if err != nil {
+				return nil, toError(err)
+			}
+			items, err := service.Find(table, query)
+			if err != nil {
+				return nil, toError(err)
+			}
+			return map[string]interface{}{"items": items, "total": total, "page": p.Args["page"], "pageSize": p.Args["pageSize"]}, nil
+		},
+	}
+}
+
+// filterType has a comparison field per stored scalar column, nested paths joined by _,
+// and the and/or lists combining other filters.
+func (b *builder) filterType(name string, table *meta.MetaTable) *graphql.InputObject {
+	paths := map[string]filterPath{"_id": {path: "_id", column: &meta.MetaColumn{Name: "_id", DataType: meta.DataTypeObjectId}}}
+	var collect func(prefix, path string, columns []*meta.MetaColumn)
+	collect = func(prefix, path string, columns []*meta.MetaColumn) {
+		for _, c := range columns {
+			if !validName(c.Name) || c.IsComputed() && c.IsVirtual {
+				continue
+			}
+			if c.DataType == meta.DataTypeJson && len(c.NestedColumns) > 0 {
+				collect(prefix+c.Name+"_", path+c.Name+".", c.NestedColumns)
+				continue
+			}
+			paths[prefix+c.Name] = filterPath{path: path + c.Name, column: c}
+		}
+	}
+	collect("", "", table.Columns)
+	b.filters[name] = paths
+	var filter *graphql.InputObject
+	filter = graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: name,
+		Fields: graphql.InputObjectConfigFieldMapThunk(func() graphql.InputObjectConfigFieldMap {
+			fields := graphql.InputObjectConfigFieldMap{
+				"and": {Type: graphql.NewList(graphql.NewNonNull(filter))},
+				"or":  {Type: graphql.NewList(graphql.NewNonNull(filter))},
+			}
+			for key, fp := range paths {
+				fields[key] = &graphql.InputObjectFieldConfig{Type: b.comparison(scalarOf(fp.column.DataType))}
+			}
+			return fields
+		}),
+	})
+	return filter
+}
+
+// comparison is the input of the operators applicable to a scalar: {gte: 10, lt: 20}.
+func (b *builder) comparison(scalar *graphql.Scalar) *graphql.InputObject {
+	name := scalar.Name() + "Comparison"
+	if c, ok := b.comparisons[name]; ok {
+		return c
+	}
+	fields := graphql.InputObjectConfigFieldMap{
+		"eq":     {Type: scalar},
+		"ne":     {Type: scalar},
+		"in":     {Type: graphql.NewList(graphql.NewNonNull(scalar))},
+		"nin":    {Type: graphql.NewList(graphql.NewNonNull(scalar))},
+		"exists": {Type: graphql.Boolean},
+	}
+	if scalar != graphql.Boolean && scalar != jsonScalar {
+		for _, op := range []string{"gt", "gte", "lt", "lte"} {
+			fields[op] = &graphql.InputObjectFieldConfig{Type: scalar}
+		}
+	}
+	if scalar == graphql.String {
+		fields["like"] = &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "contains, ignoring case"}
+	}
+	c := graphql.NewInputObject(graphql.InputObjectConfig{Name: name, Fields: fields})
+	b.comparisons[name] = c
+	return c
+}
+
+// query converts the arguments of a list field into a meta.Query.
+func (b *builder) query(filterName string, table *meta.MetaTable, args map[string]interface{}) (*meta.Query, error) {
+	page, _ := args["page"].(int)
+	pageSize, _ := args["pageSize"].(int)
+	if page < 1 || pageSize < 1 {
+		return nil, &resolveError{code: "badRequest", message: "page and pageSize should be positive"}
+	}
+	if pageSize > b.maxPageSize {
+		return nil, &resolveError{code: "badRequest", message: "pageSize should not exceed the maximum page size"}
+	}
+	query := &meta.Query{Skip: int64((page - 1) * pageSize), Limit: int64(pageSize)}
+	if sorts, ok := args["sort"].([]interface{}); ok {
+		for _, s := range sorts {
+			key, _ := s.(string)
+			order := 1
+			if strings.HasPrefix(key, "-") {
+				key, order = key[1:], -1
+			}
+			c := table.ColumnByPath(key)
+			if key != "_id" && (c == nil || c.IsComputed() && c.IsVirtual) {
+				return nil, &resolveError{code: "badRequest", message: "cannot sort by " + key, table: table.Name, column: key}
+			}
+			query.Sort = append(query.Sort, bson.E{Key: key, Value: order})
+		}
+	}
+	if filter, ok := args["filter"].(map[string]interface{}); ok {
+		d, err := b.filter(filterName, table, filter)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.service.CheckFilter(table, d); err != nil {
+			return nil, toError(err)
+		}
+		query.Filter = d
+	}
+	return query, nil
+}
+
+var operators = map[string]string{
+	"eq": "$eq", "ne": "$ne", "gt": "$gt", "gte": "$gte", "lt": "$lt", "lte": "$lte",
+	"in": "$in", "nin": "$nin", "exists": "$exists", "like": "$regex",
+}
+
+func (b *builder) filter(name string, table *meta.MetaTable, filter map[string]interface{}) (bson.D, error) {
+	paths := b.filters[name]
+	d := bson.D{}
+	for _, key := range sortedKeys(filter) {
+		value := filter[key]
+		if key == "and" || key == "or" {
+			items, _ := value.([]interface{})
+			clauses := bson.A{}
+			for _, item := range items {
+				clause, err := b.filter(name, table, item.(map[string]interface{}))
+				if err != nil {
+					return nil, err
+				}
+				clauses = append(clauses, clause)
+			}
+			if len(clauses) > 0 {
+				d = append(d, bson.E{Key: "$" + key, Value: clauses})
+			}
+			continue
+		}
+		fp := paths[key]
+		comparison, _ := value.(map[string]interface{})
+		conditions := bson.D{}
+		for _, op := range sortedKeys(comparison) {
+			v, err := b.filterValue(table, fp, op, comparison[op])
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, bson.E{Key: operators[op], Value: v})
+			if op == "like" {
+				conditions = append(conditions, bson.E{Key: "$options", Value: "i"})
+			}
+		}
+		if len(conditions) > 0 {
+			d = append(d, bson.E{Key: fp.path, Value: conditions})
+		}
+	}
+	return d, nil
+}
+
+func (b *builder) filterValue(table *meta.MetaTable, fp filterPath, op string, v interface{}) (interface{}, error) {
+	invalid := func(err error) error {
+		return &resolveError{code: "badRequest", message: err.Error(), table: table.Name, column: fp.path}
+	}
+	switch op {
+	case "exists":
+		return v, nil
+	case "like":
+		s, _ := v.(string)
+		return regexp.QuoteMeta(s), nil
+	case "in", "nin":
+		items, _ := v.([]interface{})
+		values, err := meta.ConvertValues(fp.column.DataType, items)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		return bson.A(values), nil
+	}
+	value, err := meta.ConvertValue(fp.column.DataType, v)
+	if err != nil {
+		return nil, invalid(err)
+	}
+	return value, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (b *builder) addMutations(mutation graphql.Fields, table *meta.MetaTable) {
+	name := codegen.TypeName(table.Name)
+	object := b.objects[table.Name]
+	input := b.inputType(name+"Input", table.Columns)
+	mutation["create"+name] = &graphql.Field{
+		Type: object,
+		Args: graphql.FieldConfigArgument{"input": {Type: graphql.NewNonNull(input)}},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			do, err := dataObject(table, p.Args["input"])
+			if err != nil {
+				return nil, err
+			}
+			service := b.service.WithContext(p.Context)
+			id, err := service.InsertOne(table, do)
+			if err != nil {
+				return nil, toError(err)
+			}
+			dor, err := service.FindOne(table, *id)
+			return dor, toError(err)
+		},
+	}
+	mutation["update"+name] = &graphql.Field{
+		Type:        object,
+		Description: "sets the given columns, failing when version is given and the record is at another version",
+		Args: graphql.FieldConfigArgument{
+			"id":      {Type: graphql.NewNonNull(objectIDScalar)},
+			"input":   {Type: graphql.NewNonNull(input)},
+			"version": {Type: longScalar},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id, _ := p.Args["id"].(primitive.ObjectID)
+			do, err := dataObject(table, p.Args["input"])
+			if err != nil {
+				return nil, err
+			}
+			service := b.service.WithContext(p.Context)
+			if version, ok := p.Args["version"].(int64); ok {
+				err = service.PatchOneWithVersion(table, meta.ID(id), do, version)
+			} else {
+				err = service.PatchOne(table, meta.ID(id), do)
+			}
+			if err != nil {
+				return nil, toError(err)
+			}
+			dor, err := service.FindOne(table, meta.ID(id))
+			return dor, toError(err)
+		},
+	}
+	mutation["delete"+name] = &graphql.Field{
+		Type: graphql.NewNonNull(graphql.Boolean),
+		Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(objectIDScalar)}},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id, _ := p.Args["id"].(primitive.ObjectID)
+			if err := b.service.WithContext(p.Context).DeleteOne(table, meta.ID(id)); err != nil {
+				return nil, toError(err)
+			}
+			return true, nil
+		},
+	}
+}
+
+// inputType has a field per column written by clients, computed, track and _id columns are set by the service.
+func (b *builder) inputType(name string, columns []*meta.MetaColumn) *graphql.InputObject {
+	fields := graphql.InputObjectConfigFieldMap{}
+	for _, c := range columns {
+		if !validName(c.Name) || c.Name == "_id" || c.IsComputed() || meta.DefaultTrackColumns.Has(c.Name) {
+			continue
+		}
+		var t graphql.Input
+		if c.DataType == meta.DataTypeJson && len(c.NestedColumns) > 0 {
+			t = b.inputType(strings.TrimSuffix(name, "Input")+codegen.TypeName(c.Name)+"Input", c.NestedColumns)
+		} else {
+			t = scalarOf(c.DataType)
+		}
+		if c.IsArray {
+			t = graphql.NewList(t)
+		}
+		fields[c.Name] = &graphql.InputObjectFieldConfig{Type: t, Description: c.Description}
+	}
+	return graphql.NewInputObject(graphql.InputObjectConfig{Name: name, Fields: fields})
+}
+
+// dataObject converts a mutation input through its JSON form, so it is checked like the REST bodies.
+func dataObject(table *meta.MetaTable, input interface{}) (*meta.DataObject, error) {
+	b, err := json.Marshal(plain(input))
+	if err != nil {
+		return nil, err
+	}
+	do, err := meta.UnmarshalDataObjectJSON(table, b)
+	return do, toError(err)
+}
+
+// plain converts parsed and stored values into their JSON form.
+func plain(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = plain(item)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = plain(item)
+		}
+		return items
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.Decimal128:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case nil, string, bool, int, int32, int64, float64:
+		return v
+	}
+	//stored documents and arrays
+	b, err := json.Marshal(meta.DataObjectResp{{Key: "v", Value: v}})
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	json.Unmarshal(b, &m)
+	return m["v"]
+}
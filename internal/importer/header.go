@@ -0,0 +1,180 @@
+package importer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+)
+
+// segment is one step of a header: a column name and, for array columns, an optional item index.
+type segment struct {
+	name  string
+	index int //-1 without index
+}
+
+// field is a parsed header, column is the column its cells are written to.
+type field struct {
+	header string
+	path   []segment
+	column *meta.MetaColumn
+}
+
+var segmentPattern = regexp.MustCompile(`^(.+?)(?:\[(\d+)\])?$`)
+
+// maxItemIndex bounds the item index of a header, the items up to it are allocated for every row.
+const maxItemIndex = 999
+
+// parseHeader resolves header to a column path of table. The steps are separated by dots and
+// name a column by its name or one of its labels, array columns take an item index: price.amount,
+// medias[0].url, 备注. The path stops at a column which is not a json column with nested columns,
+// an array without index or a json column then reads the whole value from the cell.
+func parseHeader(table *meta.MetaTable, header string) (*field, *meta.ValidationError) {
+	f := &field{header: header}
+	invalid := func(message string) (*field, *meta.ValidationError) {
+		return nil, &meta.ValidationError{Table: table.Name, Column: header, Message: message}
+	}
+	columns := table.Columns
+	parts := strings.Split(strings.TrimSpace(header), ".")
+	for i, part := range parts {
+		match := segmentPattern.FindStringSubmatch(strings.TrimSpace(part))
+		if match == nil {
+			return invalid("empty column name")
+		}
+		c := columnByNameOrLabel(columns, strings.TrimSpace(match[1]))
+		if c == nil {
+			return invalid("unknown column " + match[1])
+		}
+		s := segment{name: c.Name, index: -1}
+		if len(match[2]) > 0 {
+			if !c.IsArray {
+				return invalid("column " + c.Name + " is not an array")
+			}
+			index, err := strconv.Atoi(match[2])
+			if err != nil || index > maxItemIndex {
+				return invalid("item index of " + c.Name + " should not exceed " + strconv.Itoa(maxItemIndex))
+			}
+			s.index = index
+		}
+		f.path = append(f.path, s)
+		f.column = c
+		if i == len(parts)-1 {
+			break
+		}
+		if c.DataType != meta.DataTypeJson || len(c.NestedColumns) == 0 {
+			return invalid("column " + c.Name + " has no nested columns")
+		}
+		if c.IsArray && s.index < 0 {
+			return invalid("column " + c.Name + " is an array, an index is required: " + c.Name + "[0]")
+		}
+		columns = c.NestedColumns
+	}
+	return f, nil
+}
+
+func columnByNameOrLabel(columns []*meta.MetaColumn, name string) *meta.MetaColumn {
+	for _, c := range columns {
+		if c.Name == name {
+			return c
+		}
+	}
+	for _, c := range columns {
+		if c.Label() == name {
+			return c
+		}
+		for _, label := range c.I18nLabels() {
+			if label == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// wholeArray tells whether the cell holds every item of an array column.
+func (f *field) wholeArray() bool {
+	return f.column.IsArray && f.path[len(f.path)-1].index < 0
+}
+
+// columnPath is the path of the field in the form of validation errors: cartItems.0.quantity.
+func (f *field) columnPath() string {
+	var sb strings.Builder
+	for i, s := range f.path {
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(s.name)
+		if s.index >= 0 {
+			sb.WriteByte('.')
+			sb.WriteString(strconv.Itoa(s.index))
+		}
+	}
+	return sb.String()
+}
+
+// set writes value at path into m, creating the objects and arrays on the way.
+func set(m map[string]interface{}, path []segment, value interface{}) {
+	s := path[0]
+	last := len(path) == 1
+	if s.index < 0 {
+		if last {
+			m[s.name] = value
+			return
+		}
+		child, ok := m[s.name].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			m[s.name] = child
+		}
+		set(child, path[1:], value)
+		return
+	}
+	items, _ := m[s.name].([]interface{})
+	for len(items) <= s.index {
+		items = append(items, nil)
+	}
+	m[s.name] = items
+	if last {
+		items[s.index] = value
+		return
+	}
+	child, ok := items[s.index].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		items[s.index] = child
+	}
+	set(child, path[1:], value)
+}
+
+// compact removes the items left empty by the gaps between indexes: medias[0] and medias[2].
+func compact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = compact(item)
+		}
+	case []interface{}:
+		items := v[:0]
+		for _, item := range v {
+			if item != nil {
+				items = append(items, compact(item))
+			}
+		}
+		return items
+	}
+	return v
+}
+
+// headerOf returns the header of the field holding column, a path of a validation error.
+func headerOf(fields []*field, column string) string {
+	var header string
+	longest := -1
+	for _, f := range fields {
+		path := f.columnPath()
+		if (path == column || strings.HasPrefix(column, path+".")) && len(path) > longest {
+			header, longest = f.header, len(path)
+		}
+	}
+	return header
+}
@@ -0,0 +1,289 @@
+// Package importer loads records into a meta table from CSV and XLSX sheets as well as JSON and NDJSON files.
+//
+// The headers of a sheet are column paths, see parseHeader: price.amount, medias[0].url or a label.
+// Cells are coerced to the data type of their column, every row is validated like MetaService.InsertOne
+// does before anything is written, and the outcome is a Report listing the invalid rows:
+//
+//	report, err := importer.New(service, products, importer.WithKeyColumns("sourceSkuId")).Import(f, importer.FormatXLSX)
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatXLSX   Format = "xlsx"
+	FormatJSON   Format = "json"   //an object or an array of objects
+	FormatNDJSON Format = "ndjson" //an object per line
+)
+
+// FormatOf returns the format of a file from its extension.
+func FormatOf(name string) Format {
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), ".")); ext {
+	case "jsonl":
+		return FormatNDJSON
+	default:
+		return Format(ext)
+	}
+}
+
+// Importer writes the rows of files to one meta table.
+type Importer struct {
+	service    meta.MetaService
+	table      *meta.MetaTable
+	dryRun     bool
+	keyColumns []string
+	batchSize  int
+	sheet      string
+	separator  string
+}
+
+type Option func(*Importer)
+
+// WithDryRun validates the rows and counts the records which would be inserted or updated without writing them.
+func WithDryRun(dryRun bool) Option {
+	return func(im *Importer) {
+		im.dryRun = dryRun
+	}
+}
+
+// WithKeyColumns updates the record having the same values of columns as a row instead of inserting it.
+func WithKeyColumns(columns ...string) Option {
+	return func(im *Importer) {
+		im.keyColumns = columns
+	}
+}
+
+// WithBatchSize sets the number of records inserted at once, 500 by default.
+func WithBatchSize(size int) Option {
+	return func(im *Importer) {
+		if size > 0 {
+			im.batchSize = size
+		}
+	}
+}
+
+// WithSheet reads the named sheet of XLSX files instead of the first one.
+func WithSheet(name string) Option {
+	return func(im *Importer) {
+		im.sheet = name
+	}
+}
+
+// WithArraySeparator sets the separator of the items of an array written in one cell, ";" by default.
+// Cells starting with [ are read as JSON arrays.
+func WithArraySeparator(separator string) Option {
+	return func(im *Importer) {
+		im.separator = separator
+	}
+}
+
+func New(service meta.MetaService, table *meta.MetaTable, options ...Option) *Importer {
+	im := &Importer{service: service, table: table, batchSize: 500, separator: ";"}
+	for _, option := range options {
+		option(im)
+	}
+	return im
+}
+
+// Report is the outcome of an import. Rows are numbered like the lines of the file, the header being row 1,
+// or by position for JSON arrays. When Errors is not empty nothing was written.
+type Report struct {
+	Table     string      `json:"table"`
+	Rows      int         `json:"rows"`
+	Inserted  int         `json:"inserted"`
+	Updated   int         `json:"updated"`
+	Unchanged int         `json:"unchanged"` //rows whose record already held their values
+	DryRun    bool        `json:"dryRun,omitempty"`
+	Errors    []*RowError `json:"errors"`
+}
+
+// RowError tells why a row was rejected, Header is the header of the offending cell when known.
+type RowError struct {
+	Row     int    `json:"row"`
+	Header  string `json:"header,omitempty"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *RowError) Error() string {
+	if len(e.Column) > 0 {
+		return "row:" + strconv.Itoa(e.Row) + ",column:" + e.Column + "," + e.Message
+	}
+	return "row:" + strconv.Itoa(e.Row) + "," + e.Message
+}
+
+func (r *Report) Failed() bool {
+	return len(r.Errors) > 0
+}
+
+// row is a row of the file as a JSON object.
+type row struct {
+	number int
+	data   []byte
+	err    *RowError
+	value  *meta.DataObject
+	id     *meta.ID //of the record having the same key
+}
+
+// Import reads in and writes its rows to the table. The returned error is about reading in or writing
+// to the database, invalid rows are listed by the report.
+func (im *Importer) Import(in io.Reader, format Format) (*Report, error) {
+	report := &Report{Table: im.table.Name, DryRun: im.dryRun, Errors: []*RowError{}}
+	var rows []*row
+	var fields []*field
+	var err error
+	switch format {
+	case FormatCSV:
+		rows, fields, err = im.readCSV(in)
+	case FormatXLSX:
+		rows, fields, err = im.readXLSX(in)
+	case FormatJSON:
+		rows, err = readJSON(in)
+	case FormatNDJSON:
+		rows, err = readNDJSON(in)
+	default:
+		return nil, errors.New("unsupported import format " + string(format))
+	}
+	var header *RowError
+	if errors.As(err, &header) {
+		report.Errors = append(report.Errors, header)
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	report.Rows = len(rows)
+	for _, r := range rows {
+		if r.err == nil {
+			r.err = im.decode(r)
+		}
+		if r.err == nil && len(im.keyColumns) > 0 {
+			r.err, err = im.lookup(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if r.err != nil {
+			if len(r.err.Header) == 0 {
+				r.err.Header = headerOf(fields, r.err.Column)
+			}
+			report.Errors = append(report.Errors, r.err)
+		}
+	}
+	if report.Failed() {
+		return report, nil
+	}
+	if im.dryRun {
+		for _, r := range rows {
+			if r.id != nil {
+				report.Updated++
+			} else {
+				report.Inserted++
+			}
+		}
+		return report, nil
+	}
+	return report, im.write(rows, report)
+}
+
+func (im *Importer) decode(r *row) *RowError {
+	value, err := meta.UnmarshalDataObjectJSON(im.table, r.data)
+	if err == nil {
+		err = im.service.Validate(im.table, value)
+	}
+	if err != nil {
+		return rowError(r.number, err)
+	}
+	r.value = value
+	return nil
+}
+
+// lookup finds the record of the key of r.
+func (im *Importer) lookup(r *row) (*RowError, error) {
+	filter := bson.D{}
+	for _, column := range im.keyColumns {
+		v, ok := r.value.GetPath(column)
+		if !ok || v == nil {
+			return &RowError{Row: r.number, Column: column, Message: "key column has no value"}, nil
+		}
+		filter = append(filter, bson.E{Key: column, Value: v})
+	}
+	found, err := im.service.Find(im.table, &meta.Query{Filter: filter, Limit: 2})
+	if err != nil {
+		return nil, err
+	}
+	switch len(found) {
+	case 0:
+		return nil, nil
+	case 1:
+		oid, err := found[0].GetObjectID("_id")
+		if err != nil {
+			return nil, err
+		}
+		id := meta.ID(oid)
+		r.id = &id
+		return nil, nil
+	}
+	return &RowError{Row: r.number, Message: "key matches several records"}, nil
+}
+
+// write inserts the rows in batches, rows with a key are upserted in order
+// so that a key repeated by the file updates the record inserted by its first row.
+func (im *Importer) write(rows []*row, report *Report) error {
+	for start := 0; start < len(rows); start += im.batchSize {
+		end := start + im.batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		values := make([]*meta.DataObject, 0, end-start)
+		for _, r := range rows[start:end] {
+			values = append(values, r.value)
+		}
+		if len(im.keyColumns) > 0 {
+			result, err := im.service.UpsertMany(im.table, im.keyColumns, values)
+			if result != nil {
+				report.Inserted += result.Inserted
+				report.Updated += result.Updated
+				report.Unchanged += result.Unchanged
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		ids, err := im.service.InsertMany(im.table, values)
+		report.Inserted += len(ids)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rowError(number int, err error) *RowError {
+	var validation *meta.ValidationError
+	if errors.As(err, &validation) {
+		return &RowError{Row: number, Column: validation.Column, Message: validation.Message}
+	}
+	return &RowError{Row: number, Message: err.Error()}
+}
+
+func marshalRow(number int, m map[string]interface{}) *row {
+	data, err := json.Marshal(compact(m))
+	if err != nil {
+		return &row{number: number, err: &RowError{Row: number, Message: err.Error()}}
+	}
+	return &row{number: number, data: data}
+}
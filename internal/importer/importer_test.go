@@ -0,0 +1,202 @@
+package importer_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/importer"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/drkliu/zj-raya/internal/meta/metatest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func newService(t *testing.T) meta.MetaService {
+	service, _ := metatest.NewService(t)
+	return service
+}
+
+func sortBy(path string) bson.D {
+	return bson.D{{Key: path, Value: 1}}
+}
+
+func findTable(t *testing.T, service meta.MetaService, name string) *meta.MetaTable {
+	table, err := service.FindMetaTableByName(name)
+	assert.NoError(t, err)
+	return table
+}
+
+const header = "userId,cartItems[0].productId,cartItems[0].quantity,cartItems[0].price.currency,cartItems[0].price.amount,cartItems[2].productId,cartItems[2].quantity,tags,备注\n"
+
+func TestImportCSV(t *testing.T) {
+	service := newService(t)
+	carts := findTable(t, service, "carts")
+
+	csv := header +
+		"5f1d7a9b2c3e4f5a6b7c8d9e,5f1d7a9b2c3e4f5a6b7c8d9f,2,CNY,\"1,299.50\",,,gift;sale,first\n" +
+		"\n" +
+		"5f1d7a9b2c3e4f5a6b7c8d9e,5f1d7a9b2c3e4f5a6b7c8d9f,1,CNY,3,5f1d7a9b2c3e4f5a6b7c8da0,4,,second\n"
+	report, err := importer.New(service, carts).Import(strings.NewReader(csv), importer.FormatCSV)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, 2, report.Rows)
+	assert.Equal(t, 2, report.Inserted)
+
+	dors, err := service.Find(carts, &meta.Query{Sort: sortBy("note")})
+	assert.NoError(t, err)
+	assert.Len(t, dors, 2)
+	first, second := dors[0], dors[1]
+	note, _ := first.GetString("note")
+	assert.Equal(t, "first", note)
+	tags, _ := first.GetPath("tags")
+	assert.Equal(t, bson.A{"gift", "sale"}, tags)
+	amount, err := first.GetDecimal("cartItems.0.price.amount")
+	assert.NoError(t, err)
+	assert.Equal(t, "1299.50", amount.String())
+	total, _ := first.GetDecimal("total")
+	assert.Equal(t, "2599.00", total.String())
+	//the gap between the indexes 0 and 2 is closed
+	quantity, err := second.GetInt64("cartItems.1.quantity")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), quantity)
+}
+
+func TestImportRowErrors(t *testing.T) {
+	service := newService(t)
+	carts := findTable(t, service, "carts")
+
+	csv := header +
+		"5f1d7a9b2c3e4f5a6b7c8d9e,5f1d7a9b2c3e4f5a6b7c8d9f,2,CNY,10,,,,valid\n" +
+		"5f1d7a9b2c3e4f5a6b7c8d9e,5f1d7a9b2c3e4f5a6b7c8d9f,many,CNY,10,,,,\n" +
+		"5f1d7a9b2c3e4f5a6b7c8d9e,5f1d7a9b2c3e4f5a6b7c8d9f,1,USD,10,,,,\n" +
+		"nope,,,,,,,,\n"
+	report, err := importer.New(service, carts).Import(strings.NewReader(csv), importer.FormatCSV)
+	assert.NoError(t, err)
+	assert.True(t, report.Failed())
+	assert.Equal(t, 4, report.Rows)
+	assert.Equal(t, 0, report.Inserted)
+	assert.Equal(t, []*importer.RowError{
+		{Row: 3, Header: "cartItems[0].quantity", Column: "cartItems.0.quantity", Message: "value many(string) is not a valid int"},
+		{Row: 4, Header: "cartItems[0].price.currency", Column: "cartItems.0.price.currency", Message: report.Errors[1].Message},
+		{Row: 5, Header: "userId", Column: "userId", Message: report.Errors[2].Message},
+	}, report.Errors)
+	count, err := service.Count(carts, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count, "nothing is written when a row is invalid")
+
+	for header, message := range map[string]string{
+		"colour":                     "unknown column colour",
+		"cartItems.quantity":         "column cartItems is an array, an index is required: cartItems[0]",
+		"note[0]":                    "column note is not an array",
+		"tags.name":                  "column tags has no nested columns",
+		"tags[1000]":                 "item index of tags should not exceed 999",
+		"tags[99999999999999999999]": "item index of tags should not exceed 999",
+	} {
+		report, err := importer.New(service, carts).Import(strings.NewReader(header+"\nx\n"), importer.FormatCSV)
+		assert.NoError(t, err)
+		assert.Equal(t, []*importer.RowError{{Row: 1, Header: header, Message: message}}, report.Errors)
+	}
+}
+
+func TestImportXLSX(t *testing.T) {
+	service := newService(t)
+	brands := findTable(t, service, "brands")
+
+	f := excelize.NewFile()
+	assert.NoError(t, f.SetSheetRow("Sheet1", "A1", &[]interface{}{"name", "logo", "createAt"}))
+	assert.NoError(t, f.SetSheetRow("Sheet1", "A2", &[]interface{}{"Tea", "https://example.com/tea.png", "2021-10-01 08:30:00"}))
+	assert.NoError(t, f.SetSheetRow("Sheet1", "A4", &[]interface{}{"Coffee", "", "2021/10/2"}))
+	buf, err := f.WriteToBuffer()
+	assert.NoError(t, err)
+
+	report, err := importer.New(service, brands, importer.WithDryRun(true)).Import(buf, importer.FormatXLSX)
+	assert.NoError(t, err)
+	assert.Equal(t, &importer.Report{Table: "brands", Rows: 2, Inserted: 2, DryRun: true, Errors: []*importer.RowError{}}, report)
+	count, err := service.Count(brands, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	buf, err = f.WriteToBuffer()
+	assert.NoError(t, err)
+	report, err = importer.New(service, brands).Import(buf, importer.FormatXLSX)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Inserted)
+	count, err = service.Count(brands, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	assert.NoError(t, f.SetCellValue("Sheet1", "C4", "someday"))
+	buf, err = f.WriteToBuffer()
+	assert.NoError(t, err)
+	report, err = importer.New(service, brands, importer.WithDryRun(true)).Import(buf, importer.FormatXLSX)
+	assert.NoError(t, err)
+	assert.Len(t, report.Errors, 1)
+	assert.Equal(t, 4, report.Errors[0].Row)
+	assert.Equal(t, "createAt", report.Errors[0].Header)
+
+	_, err = importer.New(service, brands, importer.WithSheet("Missing")).Import(strings.NewReader(""), importer.FormatXLSX)
+	assert.Error(t, err)
+}
+
+func TestImportUpsertByKey(t *testing.T) {
+	service := newService(t)
+	carts := findTable(t, service, "carts")
+
+	csv := "userId,note,tags\n" +
+		"5f1d7a9b2c3e4f5a6b7c8d9e,a,x\n" +
+		"5f1d7a9b2c3e4f5a6b7c8d9e,b,y\n"
+	report, err := importer.New(service, carts, importer.WithKeyColumns("note")).Import(strings.NewReader(csv), importer.FormatCSV)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Inserted)
+
+	csv = "userId,note,tags\n" +
+		"5f1d7a9b2c3e4f5a6b7c8d9e,b,z\n" +
+		"5f1d7a9b2c3e4f5a6b7c8d9e,c,z\n" +
+		"5f1d7a9b2c3e4f5a6b7c8d9e,c,w\n"
+	report, err = importer.New(service, carts, importer.WithKeyColumns("note"), importer.WithDryRun(true)).Import(strings.NewReader(csv), importer.FormatCSV)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Updated)
+	report, err = importer.New(service, carts, importer.WithKeyColumns("note")).Import(strings.NewReader(csv), importer.FormatCSV)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, 1, report.Inserted)
+	assert.Equal(t, 2, report.Updated, "the repeated key c updates the record of its first row")
+
+	dors, err := service.Find(carts, &meta.Query{Sort: sortBy("note")})
+	assert.NoError(t, err)
+	assert.Len(t, dors, 3)
+	tags, _ := dors[1].GetPath("tags")
+	assert.Equal(t, bson.A{"z"}, tags)
+	tags, _ = dors[2].GetPath("tags")
+	assert.Equal(t, bson.A{"w"}, tags)
+
+	//the daily re-import of the same rows writes nothing
+	report, err = importer.New(service, carts, importer.WithKeyColumns("note")).Import(strings.NewReader("userId,note,tags\n5f1d7a9b2c3e4f5a6b7c8d9e,b,z\n"), importer.FormatCSV)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Unchanged)
+	assert.Equal(t, 0, report.Updated)
+
+	report, err = importer.New(service, carts, importer.WithKeyColumns("note")).Import(strings.NewReader("userId\n5f1d7a9b2c3e4f5a6b7c8d9e\n"), importer.FormatCSV)
+	assert.NoError(t, err)
+	assert.Equal(t, []*importer.RowError{{Row: 2, Header: "", Column: "note", Message: "key column has no value"}}, report.Errors)
+}
+
+func TestImportJSON(t *testing.T) {
+	service := newService(t)
+	carts := findTable(t, service, "carts")
+
+	ndjson := `{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "note": "a"}` + "\n\n" + `{"userId": 3}` + "\n"
+	report, err := importer.New(service, carts).Import(strings.NewReader(ndjson), importer.FormatOf("carts.jsonl"))
+	assert.NoError(t, err)
+	assert.Len(t, report.Errors, 1)
+	assert.Equal(t, 3, report.Errors[0].Row)
+	assert.Equal(t, "userId", report.Errors[0].Column)
+
+	report, err = importer.New(service, carts).Import(strings.NewReader(`[{"note": "a"}, {"note": "b"}]`), importer.FormatJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Inserted)
+
+	_, err = importer.New(service, carts).Import(strings.NewReader(""), importer.Format("ods"))
+	assert.Error(t, err)
+}
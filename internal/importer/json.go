@@ -0,0 +1,47 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// readJSON reads an object or an array of objects, rows are numbered from 1 by position.
+func readJSON(in io.Reader) ([]*row, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if data[0] != '[' {
+		return []*row{{number: 1, data: data}}, nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, &RowError{Row: 1, Message: err.Error()}
+	}
+	rows := make([]*row, len(items))
+	for i, item := range items {
+		rows[i] = &row{number: i + 1, data: item}
+	}
+	return rows, nil
+}
+
+// readNDJSON reads an object per line, blank lines are skipped.
+func readNDJSON(in io.Reader) ([]*row, error) {
+	var rows []*row
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 16<<20)
+	for number := 1; scanner.Scan(); number++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		rows = append(rows, &row{number: number, data: append([]byte(nil), line...)})
+	}
+	return rows, scanner.Err()
+}
@@ -0,0 +1,207 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/xuri/excelize/v2"
+)
+
+// dateLayouts are the forms of dates found in spreadsheets, besides RFC 3339.
+var dateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/1/2 15:04:05",
+	"2006/01/02",
+	"2006/1/2",
+}
+
+func (im *Importer) readCSV(in io.Reader) ([]*row, []*field, error) {
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	var records [][]string
+	var numbers []int
+	for {
+		cells, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parse *csv.ParseError
+			if errors.As(err, &parse) {
+				return nil, nil, &RowError{Row: parse.StartLine, Message: parse.Err.Error()}
+			}
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, cells)
+		numbers = append(numbers, line)
+	}
+	if len(records) > 0 && len(records[0]) > 0 {
+		//excel writes utf-8 csv with a byte order mark
+		records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+	}
+	return im.readSheet(records, numbers)
+}
+
+func (im *Importer) readXLSX(in io.Reader) ([]*row, []*field, error) {
+	f, err := excelize.OpenReader(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	sheet := im.sheet
+	if len(sheet) == 0 {
+		sheet = f.GetSheetList()[0]
+	} else if f.GetSheetIndex(sheet) < 0 {
+		return nil, nil, errors.New("no sheet " + sheet)
+	}
+	records, err := f.GetRows(sheet)
+	if err != nil {
+		return nil, nil, err
+	}
+	numbers := make([]int, len(records))
+	for i := range records {
+		numbers[i] = i + 1
+	}
+	return im.readSheet(records, numbers)
+}
+
+// readSheet reads the rows following the first non blank row, which holds the headers.
+// Columns without header are ignored, as well as blank rows.
+func (im *Importer) readSheet(records [][]string, numbers []int) ([]*row, []*field, error) {
+	start := 0
+	for start < len(records) && blank(records[start]) {
+		start++
+	}
+	if start == len(records) {
+		return nil, nil, nil
+	}
+	fields := make([]*field, len(records[start]))
+	seen := map[string]bool{}
+	for i, header := range records[start] {
+		if len(strings.TrimSpace(header)) == 0 {
+			continue
+		}
+		f, err := parseHeader(im.table, header)
+		if err != nil {
+			return nil, nil, &RowError{Row: numbers[start], Header: header, Message: err.Message}
+		}
+		path := f.columnPath()
+		if seen[path] {
+			return nil, nil, &RowError{Row: numbers[start], Header: header, Column: path, Message: "duplicate column"}
+		}
+		seen[path] = true
+		fields[i] = f
+	}
+	var rows []*row
+	for i := start + 1; i < len(records); i++ {
+		if blank(records[i]) {
+			continue
+		}
+		rows = append(rows, im.sheetRow(numbers[i], fields, records[i]))
+	}
+	return rows, fields, nil
+}
+
+func (im *Importer) sheetRow(number int, fields []*field, cells []string) *row {
+	m := map[string]interface{}{}
+	for i, cell := range cells {
+		cell = strings.TrimSpace(cell)
+		if i >= len(fields) || fields[i] == nil || len(cell) == 0 {
+			continue
+		}
+		f := fields[i]
+		value, err := im.cellValue(f, cell)
+		if err != nil {
+			return &row{number: number, err: &RowError{Row: number, Header: f.header, Column: f.columnPath(), Message: err.Error()}}
+		}
+		set(m, f.path, value)
+	}
+	return marshalRow(number, m)
+}
+
+// cellValue reads cell as the value of f, json columns and whole arrays are read from JSON.
+// Scalar arrays may also be written as items separated by the array separator: red;green.
+func (im *Importer) cellValue(f *field, cell string) (interface{}, error) {
+	c := f.column
+	if f.wholeArray() {
+		if strings.HasPrefix(cell, "[") {
+			return decodeJSON(cell)
+		}
+		if c.DataType == meta.DataTypeJson {
+			return nil, errors.New("value should be a JSON array")
+		}
+		var items []interface{}
+		for _, item := range strings.Split(cell, im.separator) {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				items = append(items, coerce(c.DataType, item))
+			}
+		}
+		return items, nil
+	}
+	if c.DataType == meta.DataTypeJson {
+		v, err := decodeJSON(cell)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := v.(map[string]interface{}); !ok {
+			return nil, errors.New("value should be a JSON object")
+		}
+		return v, nil
+	}
+	return coerce(c.DataType, cell), nil
+}
+
+// coerce rewrites the spreadsheet form of a value to the form meta.ConvertValue parses:
+// thousands separators are dropped from numbers, 是 and yes are true, dates are read in local time.
+// Values it does not recognize are returned unchanged and rejected by ConvertValue.
+func coerce(dataType meta.DataType, s string) interface{} {
+	switch dataType {
+	case meta.DataTypeInt, meta.DataTypeLong, meta.DataTypeFloat, meta.DataTypeDouble, meta.DataTypeDecimal:
+		return strings.ReplaceAll(s, ",", "")
+	case meta.DataTypeBool:
+		switch strings.ToLower(s) {
+		case "是", "yes", "y", "√":
+			return "true"
+		case "否", "no", "n", "×":
+			return "false"
+		}
+	case meta.DataTypeDateTime, meta.DataTypeTime, meta.DataTypeTimestamp:
+		if _, err := time.Parse(time.RFC3339, s); err == nil {
+			return s
+		}
+		for _, layout := range dateLayouts {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return t.Format(time.RFC3339)
+			}
+		}
+	}
+	return s
+}
+
+func decodeJSON(s string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, errors.New("invalid JSON: " + err.Error())
+	}
+	return v, nil
+}
+
+func blank(cells []string) bool {
+	for _, cell := range cells {
+		if len(strings.TrimSpace(cell)) > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+// Package logging filters the messages written to the standard logger by level.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = [...]string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("Level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, expected one of %s", s, strings.Join(levelNames[:], ", "))
+}
+
+var level = int32(LevelInfo)
+
+// SetLevel drops the messages below l, info by default.
+func SetLevel(l Level) {
+	atomic.StoreInt32(&level, int32(l))
+}
+
+func Enabled(l Level) bool {
+	return int32(l) >= atomic.LoadInt32(&level)
+}
+
+func Debugf(format string, args ...interface{}) {
+	output(LevelDebug, format, args)
+}
+
+func Infof(format string, args ...interface{}) {
+	output(LevelInfo, format, args)
+}
+
+func Warnf(format string, args ...interface{}) {
+	output(LevelWarn, format, args)
+}
+
+func Errorf(format string, args ...interface{}) {
+	output(LevelError, format, args)
+}
+
+func output(l Level, format string, args []interface{}) {
+	if Enabled(l) {
+		log.Output(3, strings.ToUpper(l.String())+" "+fmt.Sprintf(format, args...))
+	}
+}
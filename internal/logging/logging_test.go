@@ -0,0 +1,30 @@
+package logging_test
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevels(t *testing.T) {
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	defer log.SetFlags(log.Flags())
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer logging.SetLevel(logging.LevelInfo)
+
+	level, err := logging.ParseLevel("WARN")
+	assert.NoError(t, err)
+	logging.SetLevel(level)
+	logging.Infof("skipped %d", 1)
+	logging.Warnf("kept %d", 2)
+	logging.Errorf("kept %d", 3)
+	assert.Equal(t, "WARN kept 2\nERROR kept 3\n", buf.String())
+
+	_, err = logging.ParseLevel("verbose")
+	assert.EqualError(t, err, `unknown log level "verbose", expected one of debug, info, warn, error`)
+}
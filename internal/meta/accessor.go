@@ -0,0 +1,266 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNoValue is returned by the typed getters when the path is missing or null.
+var ErrNoValue = errors.New("no value")
+
+// lookupPath follows a dotted path, numeric segments index arrays: medias.0.url
+func lookupPath(v interface{}, path string) (interface{}, bool) {
+	for _, segment := range strings.Split(path, ".") {
+		if items := itemsOf(v); items != nil {
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(items) {
+				return nil, false
+			}
+			v = items[i]
+			continue
+		}
+		if d, ok := asDocument(v); ok {
+			if v, ok = lookupKey(d, segment); !ok {
+				return nil, false
+			}
+			continue
+		}
+		m, ok := asMap(v)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[segment]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func asMap(v interface{}) (map[string]interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return v, true
+	case bson.M:
+		return v, true
+	case DataObject:
+		return v, true
+	case *DataObject:
+		return *v, true
+	}
+	return nil, false
+}
+
+// setPath sets value at path below container and returns the container,
+// missing documents are created by newDocument, an array index may append one item.
+func setPath(container interface{}, path []string, value interface{}, newDocument func() interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	if container == nil {
+		container = newDocument()
+	}
+	key := path[0]
+	if d, ok := asDocument(container); ok {
+		child, _ := lookupKey(d, key)
+		child, err := setPath(child, path[1:], value, newDocument)
+		if err != nil {
+			return nil, err
+		}
+		d = setKey(d, key, child)
+		if _, ok := container.(bson.D); ok {
+			return d, nil
+		}
+		return DataObjectResp(d), nil
+	}
+	if m, ok := asMap(container); ok {
+		child, err := setPath(m[key], path[1:], value, newDocument)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = child
+		return container, nil
+	}
+	if items := itemsOf(container); items != nil || isArray(container) {
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i > len(items) {
+			return nil, errors.New("index " + key + " is out of range")
+		}
+		var child interface{}
+		if i < len(items) {
+			child = items[i]
+		}
+		child, err = setPath(child, path[1:], value, newDocument)
+		if err != nil {
+			return nil, err
+		}
+		if i == len(items) {
+			items = append(items, child)
+		} else {
+			items[i] = child
+		}
+		if _, ok := container.(bson.A); ok {
+			return bson.A(items), nil
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("value %v(%T) at %s is not a document", container, container, key)
+}
+
+func isArray(v interface{}) bool {
+	switch v.(type) {
+	case []interface{}, bson.A:
+		return true
+	}
+	return false
+}
+
+type pathGetter interface {
+	GetPath(path string) (interface{}, bool)
+}
+
+func typedValue(g pathGetter, path string, dataType DataType) (interface{}, error) {
+	v, ok := g.GetPath(path)
+	if !ok || v == nil {
+		return nil, fmt.Errorf("path:%s,%w", path, ErrNoValue)
+	}
+	value, err := ConvertValue(dataType, v)
+	if err != nil {
+		return nil, errors.New("path:" + path + "," + err.Error())
+	}
+	return value, nil
+}
+
+func getString(g pathGetter, path string) (string, error) {
+	v, err := typedValue(g, path, DataTypeString)
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+func getInt64(g pathGetter, path string) (int64, error) {
+	v, err := typedValue(g, path, DataTypeLong)
+	if err != nil {
+		return 0, err
+	}
+	return v.(int64), nil
+}
+
+func getBool(g pathGetter, path string) (bool, error) {
+	v, err := typedValue(g, path, DataTypeBool)
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+func getDecimal(g pathGetter, path string) (primitive.Decimal128, error) {
+	v, err := typedValue(g, path, DataTypeDecimal)
+	if err != nil {
+		return primitive.Decimal128{}, err
+	}
+	return v.(primitive.Decimal128), nil
+}
+
+func getTime(g pathGetter, path string) (time.Time, error) {
+	v, err := typedValue(g, path, DataTypeDateTime)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return v.(time.Time), nil
+}
+
+func getObjectID(g pathGetter, path string) (primitive.ObjectID, error) {
+	v, err := typedValue(g, path, DataTypeObjectId)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return v.(primitive.ObjectID), nil
+}
+
+// GetPath returns the value at a dotted path, medias.0.url
+func (do *DataObject) GetPath(path string) (interface{}, bool) {
+	return lookupPath(map[string]interface{}(*do), path)
+}
+
+// Set puts value at a dotted path, creating the intermediate objects
+func (do *DataObject) Set(path string, value interface{}) error {
+	if *do == nil {
+		*do = DataObject{}
+	}
+	_, err := setPath(map[string]interface{}(*do), strings.Split(path, "."), value, func() interface{} {
+		return map[string]interface{}{}
+	})
+	return err
+}
+
+func (do *DataObject) GetString(path string) (string, error) {
+	return getString(do, path)
+}
+
+func (do *DataObject) GetInt64(path string) (int64, error) {
+	return getInt64(do, path)
+}
+
+func (do *DataObject) GetBool(path string) (bool, error) {
+	return getBool(do, path)
+}
+
+func (do *DataObject) GetDecimal(path string) (primitive.Decimal128, error) {
+	return getDecimal(do, path)
+}
+
+func (do *DataObject) GetTime(path string) (time.Time, error) {
+	return getTime(do, path)
+}
+
+func (do *DataObject) GetObjectID(path string) (primitive.ObjectID, error) {
+	return getObjectID(do, path)
+}
+
+// GetPath returns the value at a dotted path, medias.0.url
+func (do *DataObjectResp) GetPath(path string) (interface{}, bool) {
+	return lookupPath(bson.D(*do), path)
+}
+
+// Set puts value at a dotted path, creating the intermediate documents
+func (do *DataObjectResp) Set(path string, value interface{}) error {
+	d, err := setPath(*do, strings.Split(path, "."), value, func() interface{} {
+		return DataObjectResp{}
+	})
+	if err != nil {
+		return err
+	}
+	*do = d.(DataObjectResp)
+	return nil
+}
+
+func (do *DataObjectResp) GetString(path string) (string, error) {
+	return getString(do, path)
+}
+
+func (do *DataObjectResp) GetInt64(path string) (int64, error) {
+	return getInt64(do, path)
+}
+
+func (do *DataObjectResp) GetBool(path string) (bool, error) {
+	return getBool(do, path)
+}
+
+func (do *DataObjectResp) GetDecimal(path string) (primitive.Decimal128, error) {
+	return getDecimal(do, path)
+}
+
+func (do *DataObjectResp) GetTime(path string) (time.Time, error) {
+	return getTime(do, path)
+}
+
+func (do *DataObjectResp) GetObjectID(path string) (primitive.ObjectID, error) {
+	return getObjectID(do, path)
+}
@@ -0,0 +1,116 @@
+package meta_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func insertProduct(t *testing.T) (meta.MetaService, *meta.MetaTable, *meta.DataObjectResp) {
+	metaService := newMemoryService(t)
+	products, err := metaService.FindMetaTableByName("products")
+	assert.NoError(t, err)
+	id, err := metaService.InsertOne(products, &meta.DataObject{
+		"name": "Apple iPhone 13",
+		"medias": []interface{}{
+			map[string]interface{}{"name": "front", "url": "https://img.example.com/front.jpg"},
+			map[string]interface{}{"name": "back", "url": "https://img.example.com/back.jpg"},
+		},
+		"price": map[string]interface{}{"currency": "CNY", "amount": 5999},
+	})
+	assert.NoError(t, err)
+	product, err := metaService.FindOne(products, *id)
+	assert.NoError(t, err)
+	return metaService, products, product
+}
+
+func TestDataObjectRespTypedGetters(t *testing.T) {
+	_, _, product := insertProduct(t)
+
+	url, err := product.GetString("medias.1.url")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://img.example.com/back.jpg", url)
+	amount, err := product.GetDecimal("price.amount")
+	assert.NoError(t, err)
+	assert.Equal(t, "5999.00", amount.String())
+	createAt, err := product.GetTime("createAt")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), createAt, time.Minute)
+	id, err := product.GetObjectID("_id")
+	assert.NoError(t, err)
+	assert.False(t, id.IsZero())
+
+	_, err = product.GetString("medias.2.url")
+	assert.True(t, errors.Is(err, meta.ErrNoValue))
+	_, err = product.GetTime("name")
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, meta.ErrNoValue))
+}
+
+func TestSettersCreateIntermediateDocuments(t *testing.T) {
+	_, _, product := insertProduct(t)
+	assert.NoError(t, product.Set("brand.media.url", "https://img.example.com/logo.png"))
+	assert.NoError(t, product.Set("medias.2.name", "side"))
+	assert.Error(t, product.Set("medias.5.name", "far"))
+	assert.Error(t, product.Set("name.first", "Apple"))
+
+	url, err := product.GetString("brand.media.url")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://img.example.com/logo.png", url)
+	name, err := product.GetString("medias.2.name")
+	assert.NoError(t, err)
+	assert.Equal(t, "side", name)
+
+	var value meta.DataObject
+	assert.NoError(t, value.Set("price.amount", "12.50"))
+	assert.NoError(t, value.Set("price.currency", "CNY"))
+	assert.Equal(t, meta.DataObject{"price": map[string]interface{}{"amount": "12.50", "currency": "CNY"}}, value)
+	amount, err := value.GetDecimal("price.amount")
+	assert.NoError(t, err)
+	assert.Equal(t, "12.50", amount.String())
+}
+
+type productMedia struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+}
+
+type product struct {
+	Id     meta.ID         `bson:"_id"`
+	Name   string          `json:"name"`
+	Medias []*productMedia `json:"medias"`
+	Price  struct {
+		Currency string  `json:"currency"`
+		Amount   float64 `json:"amount"`
+	} `json:"price"`
+	CreateAt time.Time `json:"createAt"`
+}
+
+func TestDecodeIntoStruct(t *testing.T) {
+	_, products, dor := insertProduct(t)
+	var p product
+	assert.NoError(t, dor.Decode(products, &p))
+	id, _ := dor.GetObjectID("_id")
+	assert.Equal(t, meta.ID(id), p.Id)
+	assert.Equal(t, "Apple iPhone 13", p.Name)
+	assert.Equal(t, 2, len(p.Medias))
+	assert.Equal(t, "front", p.Medias[0].Name)
+	assert.Equal(t, 5999.0, p.Price.Amount)
+	assert.False(t, p.CreateAt.IsZero())
+
+	//a record written before the amount became a decimal
+	legacy := meta.DataObjectResp{{Key: "price", Value: bson.D{{Key: "currency", Value: "CNY"}, {Key: "amount", Value: 19.9}}}}
+	var price struct {
+		Price struct {
+			Amount primitive.Decimal128 `json:"amount"`
+		} `json:"price"`
+	}
+	assert.NoError(t, legacy.Decode(products, &price))
+	assert.Equal(t, "19.9", price.Price.Amount.String())
+	assert.Error(t, legacy.Decode(nil, &price))
+}
@@ -0,0 +1,531 @@
+package meta
+
+import (
+	"context"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type MetricOperator string
+
+const (
+	MetricCount         MetricOperator = "count" //records of the group, takes no path
+	MetricSum           MetricOperator = "sum"
+	MetricAvg           MetricOperator = "avg"
+	MetricMin           MetricOperator = "min"
+	MetricMax           MetricOperator = "max"
+	MetricDistinctCount MetricOperator = "distinctCount" //distinct values other than null
+)
+
+// Metric is a value computed over the records of a group, Name is its key in the result.
+type Metric struct {
+	Name     string         `json:"name"`
+	Operator MetricOperator `json:"operator"`
+	Path     string         `json:"path,omitempty"`
+}
+
+// Aggregation groups the records of a table, paths refer to columns like the ones of Query:
+//
+//	&Aggregation{
+//		Unwind:  []string{"cartItems"},
+//		GroupBy: []string{"cartItems.price.currency"},
+//		Metrics: []*Metric{{Name: "amount", Operator: MetricSum, Path: "cartItems.price.amount"}},
+//		Having:  bson.D{{Key: "amount", Value: bson.D{{Key: "$gt", Value: 100}}}},
+//	}
+//
+// A path inside an array column needs the array to be unwound, which turns a record into one record per item.
+// Every group is returned as a record holding the values of the GroupBy paths then the metrics.
+type Aggregation struct {
+	Filter  bson.D   //the records aggregated, see Query.Filter
+	Unwind  []string //array columns, a nested array after the array holding it
+	GroupBy []string //no path groups every record together
+	Metrics []*Metric
+	Having  bson.D //filters the groups by GroupBy path and metric name
+	Sort    bson.D //orders the groups by GroupBy path and metric name, by GroupBy paths by default
+	Skip    int64
+	Limit   int64
+}
+
+// validateAggregation checks the paths of a against the columns of table and the fields of Having and Sort
+// against the paths and metrics of a.
+func validateAggregation(table *MetaTable, a *Aggregation) error {
+	invalid := func(column, message string) error {
+		return &ValidationError{Table: table.Name, Column: column, Message: message}
+	}
+	unwound := map[string]bool{}
+	for _, path := range a.Unwind {
+		c, err := queryColumn(table, path)
+		if err != nil {
+			return err
+		}
+		if !c.IsArray {
+			return invalid(path, "only array columns can be unwound")
+		}
+		if err := checkUnwound(table, path, unwound, true); err != nil {
+			return err
+		}
+		unwound[path] = true
+	}
+	fields := map[string]bool{}
+	roots := map[string]bool{"_id": true}
+	for _, path := range a.GroupBy {
+		c, err := queryColumn(table, path)
+		if err != nil {
+			return err
+		}
+		if c.DataType == DataTypeJson {
+			return invalid(path, "only scalar columns can be grouped by")
+		}
+		if err := checkUnwound(table, path, unwound, false); err != nil {
+			return err
+		}
+		if fields[path] {
+			return invalid(path, "column is grouped by twice")
+		}
+		fields[path] = true
+		roots[strings.Split(path, ".")[0]] = true
+	}
+	if len(a.Metrics) == 0 && len(a.GroupBy) == 0 {
+		return invalid("", "an aggregation needs a group by or a metric")
+	}
+	for _, m := range a.Metrics {
+		if m.Name == "" || strings.ContainsAny(m.Name, ".$") {
+			return invalid(m.Path, "metric name "+m.Name+" should be a non empty name without . or $")
+		}
+		if roots[m.Name] || fields[m.Name] {
+			return invalid(m.Path, "metric name "+m.Name+" is already used")
+		}
+		fields[m.Name] = true
+		switch m.Operator {
+		case MetricCount:
+			if m.Path != "" {
+				return invalid(m.Path, "count takes no path")
+			}
+			continue
+		case MetricSum, MetricAvg, MetricMin, MetricMax, MetricDistinctCount:
+		default:
+			return invalid(m.Path, "unknown metric operator "+string(m.Operator))
+		}
+		c, err := queryColumn(table, m.Path)
+		if err != nil {
+			return err
+		}
+		if err := checkUnwound(table, m.Path, unwound, false); err != nil {
+			return err
+		}
+		if (m.Operator == MetricSum || m.Operator == MetricAvg) && columnExprType(c) != exprNumber {
+			return invalid(m.Path, string(m.Operator)+" needs a number column")
+		}
+		if c.DataType == DataTypeJson {
+			return invalid(m.Path, string(m.Operator)+" needs a scalar column")
+		}
+	}
+	if err := checkGroupFilter(table, a.Having, fields); err != nil {
+		return err
+	}
+	for _, e := range a.Sort {
+		if !fields[e.Key] {
+			return invalid(e.Key, "sort by an unknown group by path or metric "+e.Key)
+		}
+	}
+	return nil
+}
+
+// checkUnwound checks that the arrays holding path are unwound, path itself as well unless it is unwound.
+func checkUnwound(table *MetaTable, path string, unwound map[string]bool, unwinding bool) error {
+	parts := strings.Split(path, ".")
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], ".")
+		if unwinding && prefix == path {
+			break
+		}
+		if c := table.ColumnByPath(prefix); c != nil && c.IsArray && !unwound[prefix] {
+			return &ValidationError{Table: table.Name, Column: path, Message: "array column " + prefix + " should be unwound first"}
+		}
+	}
+	return nil
+}
+
+func checkGroupFilter(table *MetaTable, filter bson.D, fields map[string]bool) error {
+	for _, e := range filter {
+		switch e.Key {
+		case "$and", "$or", "$nor":
+			clauses := itemsOf(e.Value)
+			if len(clauses) == 0 {
+				return &ValidationError{Table: table.Name, Column: e.Key, Message: e.Key + " expects a non empty list of filters"}
+			}
+			for _, clause := range clauses {
+				d, _ := queryDocument(clause)
+				if err := checkGroupFilter(table, d, fields); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !fields[e.Key] {
+			return &ValidationError{Table: table.Name, Column: e.Key, Message: "having filters an unknown group by path or metric " + e.Key}
+		}
+		if operators, ok := queryDocument(e.Value); ok && isOperatorDocument(operators) {
+			for _, o := range operators {
+				if !filterOperators[o.Key] {
+					return &ValidationError{Table: table.Name, Column: e.Key, Message: "unknown filter operator " + o.Key}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// groupKey is the field of the i-th GroupBy path in the _id of a group, field names cannot hold dots.
+func groupKey(i int) string {
+	return "g" + strconv.Itoa(i)
+}
+
+// groupFields renames the GroupBy paths of a filter or sort to the fields of the groups.
+func (a *Aggregation) groupFields(d bson.D) bson.D {
+	renamed := make(bson.D, 0, len(d))
+	for _, e := range d {
+		switch e.Key {
+		case "$and", "$or", "$nor":
+			clauses := bson.A{}
+			for _, clause := range itemsOf(e.Value) {
+				sub, _ := queryDocument(clause)
+				clauses = append(clauses, a.groupFields(sub))
+			}
+			renamed = append(renamed, bson.E{Key: e.Key, Value: clauses})
+			continue
+		}
+		key := e.Key
+		for i, path := range a.GroupBy {
+			if path == key {
+				key = "_id." + groupKey(i)
+			}
+		}
+		renamed = append(renamed, bson.E{Key: key, Value: e.Value})
+	}
+	return renamed
+}
+
+func (a *Aggregation) groupSort() bson.D {
+	if len(a.Sort) > 0 {
+		return a.groupFields(a.Sort)
+	}
+	sort := bson.D{}
+	for i := range a.GroupBy {
+		sort = append(sort, bson.E{Key: "_id." + groupKey(i), Value: 1})
+	}
+	return sort
+}
+
+// Pipeline compiles a to a mongo aggregation pipeline. The groups it outputs hold the GroupBy values
+// in an _id document, the result records are built by aggregateRows.
+func (a *Aggregation) Pipeline() mongo.Pipeline {
+	pipeline := mongo.Pipeline{}
+	if len(a.Filter) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: a.Filter}})
+	}
+	for _, path := range a.Unwind {
+		pipeline = append(pipeline, bson.D{{Key: "$unwind", Value: "$" + path}})
+	}
+	var id interface{}
+	if len(a.GroupBy) > 0 {
+		keys := bson.D{}
+		for i, path := range a.GroupBy {
+			keys = append(keys, bson.E{Key: groupKey(i), Value: "$" + path})
+		}
+		id = keys
+	}
+	group := bson.D{{Key: "_id", Value: id}}
+	sizes := bson.D{}
+	for _, m := range a.Metrics {
+		var accumulator bson.D
+		switch m.Operator {
+		case MetricCount:
+			accumulator = bson.D{{Key: "$sum", Value: 1}}
+		case MetricDistinctCount:
+			accumulator = bson.D{{Key: "$addToSet", Value: "$" + m.Path}}
+			//null is a value of $addToSet
+			sizes = append(sizes, bson.E{Key: m.Name, Value: bson.D{{Key: "$size", Value: bson.D{{Key: "$filter", Value: bson.D{
+				{Key: "input", Value: "$" + m.Name},
+				{Key: "cond", Value: bson.D{{Key: "$ne", Value: bson.A{"$$this", nil}}}},
+			}}}}}})
+		default:
+			accumulator = bson.D{{Key: "$" + string(m.Operator), Value: "$" + m.Path}}
+		}
+		group = append(group, bson.E{Key: m.Name, Value: accumulator})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$group", Value: group}})
+	if len(sizes) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: sizes}})
+	}
+	if len(a.Having) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: a.groupFields(a.Having)}})
+	}
+	if sort := a.groupSort(); len(sort) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sort}})
+	}
+	if a.Skip > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: a.Skip}})
+	}
+	if a.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: a.Limit}})
+	}
+	return pipeline
+}
+
+// aggregateRows turns the groups output by the pipeline into records, the GroupBy values nested by path
+// then the metrics, counts as int64 whatever the size mongo picked.
+func aggregateRows(a *Aggregation, groups []*DataObjectResp) []*DataObjectResp {
+	rows := make([]*DataObjectResp, 0, len(groups))
+	for _, g := range groups {
+		var row interface{} = bson.D{}
+		id, _ := g.Get("_id")
+		keys, _ := queryDocument(id)
+		for i, path := range a.GroupBy {
+			v, _ := lookupKey(keys, groupKey(i))
+			//the paths of columns hold no array index
+			row, _ = setPath(row, strings.Split(path, "."), v, func() interface{} { return bson.D{} })
+		}
+		d := row.(bson.D)
+		for _, m := range a.Metrics {
+			v, _ := g.Get(m.Name)
+			if i, ok := v.(int32); ok {
+				v = int64(i)
+			}
+			d = append(d, bson.E{Key: m.Name, Value: v})
+		}
+		dor := DataObjectResp(d)
+		rows = append(rows, &dor)
+	}
+	return rows
+}
+
+func (s *service) Aggregate(table *MetaTable, aggregation *Aggregation) ([]*DataObjectResp, error) {
+	if err := validateAggregation(table, aggregation); err != nil {
+		return nil, err
+	}
+	live := *aggregation
+	live.Filter = s.live(table, aggregation.Filter)
+	return s.Repository.Aggregate(table, &live)
+}
+
+func (r *repository) Aggregate(table *MetaTable, aggregation *Aggregation) ([]*DataObjectResp, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	cursor, err := db.Collection(table.Name).Aggregate(ctx, aggregation.Pipeline())
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	groups := []*DataObjectResp{}
+	for cursor.Next(ctx) {
+		var dor DataObjectResp
+		if err := cursor.Decode(&dor); err != nil {
+			return nil, err
+		}
+		groups = append(groups, &dor)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return aggregateRows(aggregation, groups), nil
+}
+
+// Aggregate evaluates the stages of the pipeline of aggregation the way mongo would.
+func (r *memoryRepository) Aggregate(table *MetaTable, aggregation *Aggregation) ([]*DataObjectResp, error) {
+	dors, err := r.Find(table, &Query{Filter: aggregation.Filter})
+	if err != nil {
+		return nil, err
+	}
+	records := make([]bson.D, len(dors))
+	for i, dor := range dors {
+		records[i] = bson.D(*dor)
+	}
+	for _, path := range aggregation.Unwind {
+		var unwound []bson.D
+		for _, d := range records {
+			unwound = append(unwound, unwindPath(d, strings.Split(path, "."))...)
+		}
+		records = unwound
+	}
+	groups := groupRecords(aggregation, records)
+	groups, err = findRecords(groups, &Query{
+		Filter: aggregation.groupFields(aggregation.Having),
+		Sort:   aggregation.groupSort(),
+		Skip:   aggregation.Skip,
+		Limit:  aggregation.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return aggregateRows(aggregation, groups), nil
+}
+
+// unwindPath returns a copy of d per item of the array at path, none when the array is missing or empty.
+func unwindPath(d bson.D, parts []string) []bson.D {
+	v, ok := lookupKey(d, parts[0])
+	if !ok || v == nil {
+		return nil
+	}
+	var values []interface{}
+	if len(parts) > 1 {
+		nested, ok := queryDocument(v)
+		if !ok {
+			return nil
+		}
+		for _, u := range unwindPath(nested, parts[1:]) {
+			values = append(values, u)
+		}
+	} else if items := itemsOf(v); items != nil {
+		values = items
+	} else if !isArray(v) {
+		//a scalar unwinds to itself
+		values = []interface{}{v}
+	}
+	unwound := make([]bson.D, 0, len(values))
+	for _, value := range values {
+		u := make(bson.D, len(d))
+		copy(u, d)
+		for i := range u {
+			if u[i].Key == parts[0] {
+				u[i].Value = value
+			}
+		}
+		unwound = append(unwound, u)
+	}
+	return unwound
+}
+
+// groupRecords outputs the groups of records like the $group stage of the pipeline.
+func groupRecords(a *Aggregation, records []bson.D) []*DataObjectResp {
+	type group struct {
+		keys    bson.D
+		records []bson.D
+	}
+	var groups []*group
+	for _, d := range records {
+		keys := bson.D{}
+		for i, path := range a.GroupBy {
+			keys = append(keys, bson.E{Key: groupKey(i), Value: pathValue(d, path)})
+		}
+		var g *group
+		for _, candidate := range groups {
+			if sameKeys(candidate.keys, keys) {
+				g = candidate
+				break
+			}
+		}
+		if g == nil {
+			g = &group{keys: keys}
+			groups = append(groups, g)
+		}
+		g.records = append(g.records, d)
+	}
+	result := make([]*DataObjectResp, 0, len(groups))
+	for _, g := range groups {
+		var id interface{}
+		if len(a.GroupBy) > 0 {
+			id = g.keys
+		}
+		d := bson.D{{Key: "_id", Value: id}}
+		for _, m := range a.Metrics {
+			d = append(d, bson.E{Key: m.Name, Value: metricValue(m, g.records)})
+		}
+		dor := DataObjectResp(d)
+		result = append(result, &dor)
+	}
+	return result
+}
+
+func sameKeys(a, b bson.D) bool {
+	for i := range a {
+		if compareSortValues(a[i].Value, b[i].Value) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func metricValue(m *Metric, records []bson.D) interface{} {
+	if m.Operator == MetricCount {
+		return int64(len(records))
+	}
+	var values []interface{}
+	for _, d := range records {
+		if v := pathValue(d, m.Path); v != nil {
+			values = append(values, v)
+		}
+	}
+	switch m.Operator {
+	case MetricSum, MetricAvg:
+		sum, kind, n := new(big.Rat), DataTypeLong, 0
+		for _, v := range values {
+			class, r := classOf(v)
+			if class != classNumber {
+				continue
+			}
+			sum.Add(sum, r.(*big.Rat))
+			n++
+			switch v.(type) {
+			case primitive.Decimal128:
+				kind = DataTypeDecimal
+			case float32, float64:
+				if kind != DataTypeDecimal {
+					kind = DataTypeDouble
+				}
+			}
+		}
+		if m.Operator == MetricSum {
+			return ratNumber(sum, kind)
+		}
+		if n == 0 {
+			return nil
+		}
+		if kind == DataTypeLong {
+			kind = DataTypeDouble
+		}
+		return ratNumber(sum.Quo(sum, new(big.Rat).SetInt64(int64(n))), kind)
+	case MetricMin, MetricMax:
+		var result interface{}
+		for _, v := range values {
+			c := compareSortValues(v, result)
+			if result == nil || m.Operator == MetricMin && c < 0 || m.Operator == MetricMax && c > 0 {
+				result = v
+			}
+		}
+		return result
+	}
+	var distinct []interface{}
+	for _, v := range values {
+		seen := false
+		for _, d := range distinct {
+			if compareSortValues(d, v) == 0 {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			distinct = append(distinct, v)
+		}
+	}
+	return int64(len(distinct))
+}
+
+// ratNumber converts r to the number type mongo returns for numbers of kind.
+func ratNumber(r *big.Rat, kind DataType) interface{} {
+	switch kind {
+	case DataTypeDecimal:
+		d, _ := primitive.ParseDecimal128(ratString(r))
+		return d
+	case DataTypeDouble:
+		f, _ := r.Float64()
+		return f
+	}
+	return r.Num().Int64()
+}
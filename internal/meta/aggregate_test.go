@@ -0,0 +1,149 @@
+package meta_test
+
+import (
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func aggregateCarts(t *testing.T) (meta.MetaService, *meta.MetaTable) {
+	repository := meta.NewMemoryRepository()
+	service := meta.NewService(&repository)
+	carts := fixtureCarts(t)
+	_, err := service.InsertMetaTable(carts)
+	assert.NoError(t, err)
+	_, err = service.InsertDictionary(&meta.Dictionary{Group: "currencies", Name: "CNY", DataType: meta.DataTypeString})
+	assert.NoError(t, err)
+	_, err = service.InsertDictionary(&meta.Dictionary{Group: "currencies", Name: "USD", DataType: meta.DataTypeString})
+	assert.NoError(t, err)
+	for _, record := range []string{
+		`{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "tags": ["gift"], "cartItems": [
+			{"productId": "5f1d7a9b2c3e4f5a6b7c8d9f", "quantity": 2, "price": {"currency": "CNY", "amount": "1.50"}},
+			{"productId": "5f1d7a9b2c3e4f5a6b7c8da0", "quantity": 1, "price": {"currency": "USD", "amount": "3"}}]}`,
+		`{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "cartItems": [
+			{"productId": "5f1d7a9b2c3e4f5a6b7c8d9f", "quantity": 6, "price": {"currency": "CNY", "amount": "1.50"}}]}`,
+		`{"userId": "5f1d7a9b2c3e4f5a6b7c8da1", "tags": ["gift", "sale"]}`,
+	} {
+		_, err := service.InsertOne(carts, cart(t, carts, record))
+		assert.NoError(t, err)
+	}
+	return service, carts
+}
+
+func TestAggregate(t *testing.T) {
+	service, carts := aggregateCarts(t)
+
+	rows, err := service.Aggregate(carts, &meta.Aggregation{
+		GroupBy: []string{"userId"},
+		Metrics: []*meta.Metric{
+			{Name: "carts", Operator: meta.MetricCount},
+			{Name: "average", Operator: meta.MetricAvg, Path: "total"},
+			{Name: "largest", Operator: meta.MetricMax, Path: "total"},
+		},
+		Sort: bson.D{{Key: "carts", Value: -1}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	userId, _ := rows[0].GetObjectID("userId")
+	assert.Equal(t, "5f1d7a9b2c3e4f5a6b7c8d9e", userId.Hex())
+	carts0, _ := rows[0].Get("carts")
+	assert.Equal(t, int64(2), carts0)
+	average, _ := rows[0].Get("average")
+	assert.Equal(t, "7.5", average.(primitive.Decimal128).String())
+	largest, _ := rows[0].Get("largest")
+	assert.Equal(t, "9.00", largest.(primitive.Decimal128).String())
+
+	//the items of every cart by currency
+	rows, err = service.Aggregate(carts, &meta.Aggregation{
+		Unwind:  []string{"cartItems"},
+		GroupBy: []string{"cartItems.price.currency"},
+		Metrics: []*meta.Metric{
+			{Name: "quantity", Operator: meta.MetricSum, Path: "cartItems.quantity"},
+			{Name: "products", Operator: meta.MetricDistinctCount, Path: "cartItems.productId"},
+		},
+		Having: bson.D{{Key: "quantity", Value: bson.D{{Key: "$gt", Value: 1}}}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, meta.DataObjectResp{
+		{Key: "cartItems", Value: bson.D{{Key: "price", Value: bson.D{{Key: "currency", Value: "CNY"}}}}},
+		{Key: "quantity", Value: int64(8)},
+		{Key: "products", Value: int64(1)},
+	}, *rows[0])
+	currency, _ := rows[0].GetPath("cartItems.price.currency")
+	assert.Equal(t, "CNY", currency)
+
+	//every record together, carts without tags are dropped by the unwind
+	rows, err = service.Aggregate(carts, &meta.Aggregation{
+		Filter:  bson.D{{Key: "userId", Value: meta.ParseID("5f1d7a9b2c3e4f5a6b7c8d9e").ToObjectId()}},
+		Unwind:  []string{"tags"},
+		Metrics: []*meta.Metric{{Name: "tags", Operator: meta.MetricDistinctCount, Path: "tags"}, {Name: "n", Operator: meta.MetricCount}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*meta.DataObjectResp{{{Key: "tags", Value: int64(1)}, {Key: "n", Value: int64(1)}}}, rows)
+}
+
+func TestAggregateValidation(t *testing.T) {
+	service, carts := aggregateCarts(t)
+
+	for _, aggregation := range []*meta.Aggregation{
+		{},
+		{GroupBy: []string{"colour"}},
+		{GroupBy: []string{"cartItems.price.currency"}},
+		{GroupBy: []string{"cartItems"}, Unwind: []string{"cartItems"}},
+		{GroupBy: []string{"itemCount"}},
+		{Unwind: []string{"note"}, Metrics: []*meta.Metric{{Name: "n", Operator: meta.MetricCount}}},
+		{Metrics: []*meta.Metric{{Name: "n", Operator: meta.MetricCount, Path: "note"}}},
+		{Metrics: []*meta.Metric{{Name: "n", Operator: meta.MetricSum, Path: "note"}}},
+		{Metrics: []*meta.Metric{{Name: "n", Operator: "median", Path: "total"}}},
+		{Metrics: []*meta.Metric{{Name: "a.b", Operator: meta.MetricCount}}},
+		{GroupBy: []string{"userId"}, Metrics: []*meta.Metric{{Name: "userId", Operator: meta.MetricCount}}},
+		{GroupBy: []string{"userId"}, Having: bson.D{{Key: "total", Value: 1}}},
+		{GroupBy: []string{"userId"}, Having: bson.D{{Key: "userId", Value: bson.D{{Key: "$where", Value: "1"}}}}},
+		{GroupBy: []string{"userId"}, Sort: bson.D{{Key: "note", Value: 1}}},
+	} {
+		_, err := service.Aggregate(carts, aggregation)
+		_, ok := err.(*meta.ValidationError)
+		assert.True(t, ok, "%+v: %v", aggregation, err)
+	}
+}
+
+func TestAggregationPipeline(t *testing.T) {
+	aggregation := &meta.Aggregation{
+		Filter:  bson.D{{Key: "note", Value: "a"}},
+		Unwind:  []string{"cartItems"},
+		GroupBy: []string{"cartItems.price.currency"},
+		Metrics: []*meta.Metric{
+			{Name: "amount", Operator: meta.MetricSum, Path: "cartItems.price.amount"},
+			{Name: "products", Operator: meta.MetricDistinctCount, Path: "cartItems.productId"},
+		},
+		Having: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "cartItems.price.currency", Value: "CNY"}},
+			bson.D{{Key: "amount", Value: bson.D{{Key: "$gt", Value: 100}}}},
+		}}},
+		Limit: 10,
+	}
+	assert.Equal(t, mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "note", Value: "a"}}}},
+		{{Key: "$unwind", Value: "$cartItems"}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "g0", Value: "$cartItems.price.currency"}}},
+			{Key: "amount", Value: bson.D{{Key: "$sum", Value: "$cartItems.price.amount"}}},
+			{Key: "products", Value: bson.D{{Key: "$addToSet", Value: "$cartItems.productId"}}},
+		}}},
+		{{Key: "$addFields", Value: bson.D{{Key: "products", Value: bson.D{{Key: "$size", Value: bson.D{{Key: "$filter", Value: bson.D{
+			{Key: "input", Value: "$products"},
+			{Key: "cond", Value: bson.D{{Key: "$ne", Value: bson.A{"$$this", nil}}}},
+		}}}}}}}}},
+		{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "_id.g0", Value: "CNY"}},
+			bson.D{{Key: "amount", Value: bson.D{{Key: "$gt", Value: 100}}}},
+		}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id.g0", Value: 1}}}},
+		{{Key: "$limit", Value: int64(10)}},
+	}, aggregation.Pipeline())
+}
@@ -0,0 +1,265 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// well known attributes of MetaColumn
+const (
+	AttributeLabel        = "label"
+	AttributePlaceholder  = "placeholder"
+	AttributeI18nLabels   = "i18nLabels" //json object of language to label
+	AttributeHelpText     = "helpText"
+	AttributeHiddenInList = "hiddenInList"
+	AttributeSortable     = "sortable"
+	AttributeSearchable   = "searchable"
+	AttributeReadOnly     = "readOnly"
+	AttributeSensitive    = "sensitive"
+	AttributeRoundingMode = "roundingMode" //RoundingMode of decimal columns
+	AttributeExportArray  = "exportArray"  //ExportArrayJoin or ExportArrayExplode, for array columns
+)
+
+// how CSV exports write the items of an array column
+const (
+	ExportArrayJoin    = "join"    //in one cell, separated
+	ExportArrayExplode = "explode" //one row per item
+)
+
+func (a AttributeType) String() string {
+	switch a {
+	case AttributeTypeInputType:
+		return "inputType"
+	case AttributeTypeNormal:
+		return "normal"
+	default:
+		return "unknown"
+	}
+}
+func ParseAttributeType(i int8) AttributeType {
+	switch i {
+	case 1:
+		return AttributeTypeInputType
+	case 2:
+		return AttributeTypeNormal
+	default:
+		return AttributeTypeUnknown
+	}
+}
+
+// AttributeKind declares the data type of a named attribute, Validate optionally checks the converted value.
+type AttributeKind struct {
+	Name     string
+	DataType DataType
+	Validate func(value interface{}) error
+}
+
+var (
+	attributeKindsMu sync.RWMutex
+	attributeKinds   = map[string]*AttributeKind{}
+)
+
+func init() {
+	for _, kind := range []*AttributeKind{
+		{Name: AttributeLabel, DataType: DataTypeString},
+		{Name: AttributePlaceholder, DataType: DataTypeString},
+		{Name: AttributeI18nLabels, DataType: DataTypeJson, Validate: validateI18nLabels},
+		{Name: AttributeHelpText, DataType: DataTypeString},
+		{Name: AttributeHiddenInList, DataType: DataTypeBool},
+		{Name: AttributeSortable, DataType: DataTypeBool},
+		{Name: AttributeSearchable, DataType: DataTypeBool},
+		{Name: AttributeReadOnly, DataType: DataTypeBool},
+		{Name: AttributeSensitive, DataType: DataTypeBool},
+		{Name: AttributeRoundingMode, DataType: DataTypeString, Validate: validateRoundingMode},
+		{Name: AttributeExportArray, DataType: DataTypeString, Validate: validateExportArray},
+	} {
+		attributeKinds[kind.Name] = kind
+	}
+}
+
+// RegisterAttributeKind adds a custom attribute, names must be unique.
+func RegisterAttributeKind(kind AttributeKind) error {
+	if len(kind.Name) == 0 {
+		return errors.New("attribute kind name is required")
+	}
+	attributeKindsMu.Lock()
+	defer attributeKindsMu.Unlock()
+	if _, exists := attributeKinds[kind.Name]; exists {
+		return errors.New("attribute kind " + kind.Name + " is already registered")
+	}
+	attributeKinds[kind.Name] = &kind
+	return nil
+}
+
+func LookupAttributeKind(name string) (*AttributeKind, bool) {
+	attributeKindsMu.RLock()
+	defer attributeKindsMu.RUnlock()
+	kind, ok := attributeKinds[name]
+	return kind, ok
+}
+
+// NewAttribute creates a normal attribute typed after its registered kind.
+func NewAttribute(name string, value interface{}) *Attribute {
+	a := &Attribute{Name: name, Type: AttributeTypeNormal, Value: value}
+	if kind, ok := LookupAttributeKind(name); ok {
+		a.DataType = kind.DataType
+	}
+	return a
+}
+
+// Validate checks the value against the declared data type and the registered kind of the attribute.
+func (a *Attribute) Validate() error {
+	if a.Type == AttributeTypeInputType {
+		return nil
+	}
+	dataType := a.DataType
+	kind, registered := LookupAttributeKind(a.Name)
+	if registered {
+		if dataType == DataTypeUnknown {
+			dataType = kind.DataType
+		} else if dataType != kind.DataType {
+			return fmt.Errorf("attribute:%s,data type should be %s but is %s", a.Name, kind.DataType, dataType)
+		}
+	}
+	value, err := ConvertValue(dataType, a.Value)
+	if err != nil {
+		return errors.New("attribute:" + a.Name + "," + err.Error())
+	}
+	if registered && kind.Validate != nil {
+		if err := kind.Validate(value); err != nil {
+			return errors.New("attribute:" + a.Name + "," + err.Error())
+		}
+	}
+	return nil
+}
+
+func validateRoundingMode(value interface{}) error {
+	v, ok := value.(string)
+	if !ok {
+		return errors.New("value should be a rounding mode")
+	}
+	_, err := ParseRoundingMode(v)
+	return err
+}
+
+func validateExportArray(value interface{}) error {
+	if v, ok := value.(string); !ok || v != ExportArrayJoin && v != ExportArrayExplode {
+		return errors.New("value should be " + ExportArrayJoin + " or " + ExportArrayExplode)
+	}
+	return nil
+}
+
+func validateI18nLabels(value interface{}) error {
+	labels, _ := value.(bson.M)
+	for lang, label := range labels {
+		if _, ok := label.(string); !ok {
+			return errors.New("label of " + lang + " is not a string")
+		}
+	}
+	return nil
+}
+
+// Attribute returns the attribute with the given name.
+func (c *MetaColumn) Attribute(name string) (*Attribute, bool) {
+	for _, a := range c.Attributes {
+		if a.Name == name && a.Type != AttributeTypeInputType {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+func (c *MetaColumn) stringAttribute(name string) string {
+	if a, ok := c.Attribute(name); ok {
+		if s, ok := a.Value.(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+func (c *MetaColumn) boolAttribute(name string) bool {
+	if a, ok := c.Attribute(name); ok {
+		if v, err := ConvertValue(DataTypeBool, a.Value); err == nil && v != nil {
+			return v.(bool)
+		}
+	}
+	return false
+}
+
+// Label returns the label attribute, falling back to the description and then the name.
+func (c *MetaColumn) Label() string {
+	if label := c.stringAttribute(AttributeLabel); len(label) > 0 {
+		return label
+	}
+	if len(c.Description) > 0 {
+		return c.Description
+	}
+	return c.Name
+}
+
+// I18nLabels returns the labels by language.
+func (c *MetaColumn) I18nLabels() map[string]string {
+	a, ok := c.Attribute(AttributeI18nLabels)
+	if !ok {
+		return nil
+	}
+	value, err := ConvertValue(DataTypeJson, a.Value)
+	if err != nil || value == nil {
+		return nil
+	}
+	labels := map[string]string{}
+	for lang, label := range value.(bson.M) {
+		if s, ok := label.(string); ok {
+			labels[lang] = s
+		}
+	}
+	return labels
+}
+
+// I18nLabel returns the label in lang, Label when there is no translation.
+func (c *MetaColumn) I18nLabel(lang string) string {
+	if label, ok := c.I18nLabels()[lang]; ok {
+		return label
+	}
+	return c.Label()
+}
+
+func (c *MetaColumn) Placeholder() string {
+	return c.stringAttribute(AttributePlaceholder)
+}
+
+func (c *MetaColumn) HelpText() string {
+	return c.stringAttribute(AttributeHelpText)
+}
+
+func (c *MetaColumn) HiddenInList() bool {
+	return c.boolAttribute(AttributeHiddenInList)
+}
+
+func (c *MetaColumn) Sortable() bool {
+	return c.boolAttribute(AttributeSortable)
+}
+
+func (c *MetaColumn) Searchable() bool {
+	return c.boolAttribute(AttributeSearchable)
+}
+
+func (c *MetaColumn) ReadOnly() bool {
+	return c.boolAttribute(AttributeReadOnly)
+}
+
+func (c *MetaColumn) Sensitive() bool {
+	return c.boolAttribute(AttributeSensitive)
+}
+
+// ExportArray tells how CSV exports write the items of the column, ExportArrayJoin by default.
+func (c *MetaColumn) ExportArray() string {
+	if c.stringAttribute(AttributeExportArray) == ExportArrayExplode {
+		return ExportArrayExplode
+	}
+	return ExportArrayJoin
+}
@@ -0,0 +1,69 @@
+package meta_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedAttributes(t *testing.T) {
+	column := &meta.MetaColumn{
+		Name:        "name",
+		Description: "product name",
+		DataType:    meta.DataTypeString,
+		Attributes: []*meta.Attribute{
+			meta.NewAttribute(meta.AttributeLabel, "名称"),
+			meta.NewAttribute(meta.AttributeI18nLabels, map[string]interface{}{"en": "Name"}),
+			meta.NewAttribute(meta.AttributeSearchable, true),
+			meta.NewAttribute(meta.AttributeSortable, "true"),
+			{Type: meta.AttributeTypeInputType, Value: meta.InputTypeText},
+		},
+	}
+	assert.Equal(t, "名称", column.Label())
+	assert.Equal(t, "Name", column.I18nLabel("en"))
+	assert.Equal(t, "名称", column.I18nLabel("fr"))
+	assert.True(t, column.Searchable())
+	assert.True(t, column.Sortable())
+	assert.False(t, column.Sensitive())
+	assert.Equal(t, "", column.Placeholder())
+}
+
+func TestAttributeValidation(t *testing.T) {
+	assert.NoError(t, meta.NewAttribute(meta.AttributeReadOnly, false).Validate())
+	assert.Error(t, meta.NewAttribute(meta.AttributeReadOnly, "sometimes").Validate())
+	assert.Error(t, (&meta.Attribute{Name: meta.AttributeLabel, DataType: meta.DataTypeInt, Value: 1}).Validate())
+	assert.Error(t, meta.NewAttribute(meta.AttributeI18nLabels, map[string]interface{}{"en": 1.0}).Validate())
+	assert.Error(t, meta.NewAttribute(meta.AttributeExportArray, nil).Validate())
+	assert.NoError(t, meta.NewAttribute(meta.AttributeExportArray, meta.ExportArrayJoin).Validate())
+	assert.NoError(t, (&meta.Attribute{Name: "maxUploadSize", DataType: meta.DataTypeInt, Value: 1024.0}).Validate())
+
+	err := meta.RegisterAttributeKind(meta.AttributeKind{
+		Name:     "mediaType",
+		DataType: meta.DataTypeString,
+		Validate: func(value interface{}) error {
+			if !strings.Contains(value.(string), "/") {
+				return errors.New("not a media type")
+			}
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.Error(t, meta.RegisterAttributeKind(meta.AttributeKind{Name: "mediaType"}))
+	assert.NoError(t, meta.NewAttribute("mediaType", "image/png").Validate())
+	assert.Error(t, meta.NewAttribute("mediaType", "png").Validate())
+
+	repository := meta.NewMemoryRepository()
+	metaService := meta.NewService(&repository)
+	_, err = metaService.InsertMetaTable(&meta.MetaTable{
+		Name: "medias",
+		Columns: []*meta.MetaColumn{
+			{Name: "url", DataType: meta.DataTypeUrl, Attributes: []*meta.Attribute{meta.NewAttribute(meta.AttributeSensitive, "no")}},
+		},
+	})
+	validation, ok := err.(*meta.ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, "url", validation.Column)
+}
@@ -0,0 +1,259 @@
+package meta
+
+import (
+	"errors"
+	"math/big"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Computed columns hold an Expression over the other columns of the object declaring them,
+// columns nested in an array item are computed per item. They are evaluated in declaration order,
+// stored ones when the record is written and virtual ones when it is read.
+
+func (c *MetaColumn) IsComputed() bool {
+	return len(c.Expression) > 0
+}
+
+// validateExpressions type checks the expression of every computed column against the columns in its scope.
+func validateExpressions(table *MetaTable, prefix string, columns []*MetaColumn) error {
+	for _, c := range columns {
+		if c.IsComputed() {
+			if err := checkExpression(c, columns); err != nil {
+				return &ValidationError{Table: table.Name, Column: prefix + c.Name, Message: err.Error()}
+			}
+		}
+		if err := validateExpressions(table, prefix+c.Name+".", c.NestedColumns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkExpression(c *MetaColumn, scope []*MetaColumn) error {
+	if c.IsArray || c.DataType == DataTypeJson {
+		return errors.New("computed column must be a scalar")
+	}
+	node, err := parseExpression(c.Expression)
+	if err != nil {
+		return err
+	}
+	t, _, err := node.check(scope)
+	if err != nil {
+		return err
+	}
+	if expected := columnExprType(c); t != exprAny && expected != exprAny && t != expected {
+		return errors.New("expression is a " + t.String() + " but column is a " + c.DataType.String())
+	}
+	return nil
+}
+
+func hasExpressions(columns []*MetaColumn) bool {
+	for _, c := range columns {
+		if c.IsComputed() || hasExpressions(c.NestedColumns) {
+			return true
+		}
+	}
+	return false
+}
+
+// computeColumns sets the stored computed columns of a written value and drops the virtual ones.
+func computeColumns(columns []*MetaColumn, value map[string]interface{}) error {
+	for _, c := range columns {
+		if c.IsComputed() {
+			if c.IsVirtual {
+				delete(value, c.Name)
+				continue
+			}
+			v, err := evalColumn(c, value)
+			if err != nil {
+				return err
+			}
+			value[c.Name] = v
+			continue
+		}
+		if len(c.NestedColumns) == 0 {
+			continue
+		}
+		switch nested := value[c.Name].(type) {
+		case map[string]interface{}:
+			if err := computeColumns(c.NestedColumns, nested); err != nil {
+				return err
+			}
+		case []interface{}:
+			for _, item := range nested {
+				if item, ok := item.(map[string]interface{}); ok {
+					if err := computeColumns(c.NestedColumns, item); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// computeVirtualColumns adds the virtual computed columns to a read record.
+func computeVirtualColumns(columns []*MetaColumn, d bson.D) (bson.D, error) {
+	for _, c := range columns {
+		if c.IsComputed() {
+			if !c.IsVirtual {
+				continue
+			}
+			v, err := evalColumn(c, d)
+			if err != nil {
+				return nil, err
+			}
+			d = setKey(d, c.Name, v)
+			continue
+		}
+		if len(c.NestedColumns) == 0 {
+			continue
+		}
+		value, _ := lookupKey(d, c.Name)
+		if nested, ok := asDocument(value); ok {
+			nested, err := computeVirtualColumns(c.NestedColumns, nested)
+			if err != nil {
+				return nil, err
+			}
+			d = setKey(d, c.Name, DataObjectResp(nested))
+			continue
+		}
+		items := itemsOf(value)
+		for i, item := range items {
+			if nested, ok := asDocument(item); ok {
+				nested, err := computeVirtualColumns(c.NestedColumns, nested)
+				if err != nil {
+					return nil, err
+				}
+				items[i] = DataObjectResp(nested)
+			}
+		}
+	}
+	return d, nil
+}
+
+func evalColumn(c *MetaColumn, scope interface{}) (interface{}, error) {
+	node, err := parseExpression(c.Expression)
+	if err != nil {
+		return nil, errors.New("column:" + c.Name + "," + err.Error())
+	}
+	v, err := node.eval(scope)
+	if err != nil {
+		return nil, errors.New("column:" + c.Name + "," + err.Error())
+	}
+	v, err = computedValue(c, v)
+	if err != nil {
+		return nil, errors.New("column:" + c.Name + "," + err.Error())
+	}
+	return v, nil
+}
+
+// computedValue converts the result of an expression to the data type of its column,
+// numbers are rounded to the scale of decimal columns and to integers for integer columns.
+func computedValue(c *MetaColumn, v interface{}) (interface{}, error) {
+	r, ok := v.(*big.Rat)
+	if !ok {
+		return ConvertValue(c.DataType, v)
+	}
+	switch c.DataType {
+	case DataTypeInt, DataTypeLong:
+		return roundRat(r, c.RoundingMode()).Int64(), nil
+	case DataTypeDecimal:
+		return columnDecimal(c, r)
+	case DataTypeFloat, DataTypeDouble:
+		f, _ := r.Float64()
+		return f, nil
+	}
+	return ConvertValue(c.DataType, ratString(r))
+}
+
+// computeRecords hides the search terms of read records and adds their virtual computed columns.
+func (s *service) computeRecords(table *MetaTable, dors ...*DataObjectResp) error {
+	hideSearch(dors...)
+	if !hasExpressions(table.Columns) {
+		return nil
+	}
+	for _, dor := range dors {
+		d, err := computeVirtualColumns(table.Columns, bson.D(*dor))
+		if err != nil {
+			return err
+		}
+		*dor = DataObjectResp(d)
+	}
+	return nil
+}
+
+// computePatch evaluates the stored computed columns of a patched record over the existing one.
+func (s *service) computePatch(table *MetaTable, id ID, value *DataObject) error {
+	if !hasExpressions(table.Columns) {
+		return nil
+	}
+	existing, err := s.Repository.FindOne(table, id)
+	if err != nil {
+		return err
+	}
+	merged := bson.D(*existing).Map()
+	for k, v := range *value {
+		merged[k] = v
+	}
+	if err := computeColumns(table.Columns, merged); err != nil {
+		return err
+	}
+	for _, c := range table.Columns {
+		if c.IsComputed() && c.IsVirtual {
+			delete(*value, c.Name)
+		} else if _, patched := (*value)[c.Name]; patched || c.IsComputed() {
+			(*value)[c.Name] = merged[c.Name]
+		}
+	}
+	return nil
+}
+
+// FindAll returns the records of table, but those flagged as deleted.
+func (s *service) FindAll(table *MetaTable) ([]*DataObjectResp, error) {
+	if s.trackColumns.softDelete(table) {
+		return s.Find(table, &Query{})
+	}
+	dors, err := s.Repository.FindAll(table)
+	if err != nil {
+		return nil, err
+	}
+	return dors, s.computeRecords(table, dors...)
+}
+
+// Find returns the records matching query, those flagged as deleted only on a service made WithDeleted.
+func (s *service) Find(table *MetaTable, query *Query) ([]*DataObjectResp, error) {
+	if query == nil {
+		query = &Query{}
+	}
+	live := *query
+	live.Filter = s.live(table, query.Filter)
+	return s.find(table, &live)
+}
+
+// find returns the records matching query, deleted or not.
+func (s *service) find(table *MetaTable, query *Query) ([]*DataObjectResp, error) {
+	dors, err := s.Repository.Find(table, query)
+	if err != nil {
+		return nil, err
+	}
+	return dors, s.computeRecords(table, dors...)
+}
+
+func (s *service) Count(table *MetaTable, filter bson.D) (int64, error) {
+	return s.Repository.Count(table, s.live(table, filter))
+}
+
+// FindOne returns a record, a record flagged as deleted is not found unless the service is made WithDeleted.
+func (s *service) FindOne(table *MetaTable, id ID) (*DataObjectResp, error) {
+	dor, err := s.Repository.FindOne(table, id)
+	if err != nil {
+		return nil, err
+	}
+	if !s.deleted && s.trackColumns.isDeleted(table, dor) {
+		return nil, mongo.ErrNoDocuments
+	}
+	return dor, s.computeRecords(table, dor)
+}
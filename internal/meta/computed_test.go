@@ -0,0 +1,115 @@
+package meta_test
+
+import (
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func pricedCartsMetaTable() *meta.MetaTable {
+	return &meta.MetaTable{
+		Name:       "pricedCarts",
+		PrimaryKey: meta.NewObjectIdPrimaryKey("pricedCarts_pk_id", []string{"_id"}),
+		Columns: []*meta.MetaColumn{
+			{Name: "_id", DataType: meta.DataTypeObjectId},
+			{Name: "owner", DataType: meta.DataTypeString},
+			{
+				Name:     "cartItems",
+				DataType: meta.DataTypeJson,
+				IsArray:  true,
+				NestedColumns: []*meta.MetaColumn{
+					{Name: "quantity", DataType: meta.DataTypeInt},
+					{
+						Name:     "price",
+						DataType: meta.DataTypeJson,
+						NestedColumns: []*meta.MetaColumn{
+							{Name: "amount", DataType: meta.DataTypeDecimal, Length: 19, Precision: 2},
+						},
+					},
+					{Name: "subtotal", DataType: meta.DataTypeDecimal, Length: 19, Precision: 2, Expression: "price.amount * quantity"},
+				},
+			},
+			{Name: "total", DataType: meta.DataTypeDecimal, Length: 19, Precision: 2, Expression: "sum(cartItems, price.amount * quantity)"},
+			{Name: "itemCount", DataType: meta.DataTypeInt, Expression: "count(cartItems)", IsVirtual: true},
+			{Name: "title", DataType: meta.DataTypeString, Expression: "'cart of ' + owner", IsVirtual: true},
+		},
+	}
+}
+
+func decimal(t *testing.T, s string) primitive.Decimal128 {
+	d, err := primitive.ParseDecimal128(s)
+	assert.NoError(t, err)
+	return d
+}
+
+func TestComputedColumnsOnWriteAndRead(t *testing.T) {
+	repository := meta.NewMemoryRepository()
+	metaService := meta.NewService(&repository)
+	carts := pricedCartsMetaTable()
+	_, err := metaService.InsertMetaTable(carts)
+	assert.NoError(t, err)
+
+	id, err := metaService.InsertOne(carts, &meta.DataObject{
+		"owner": "alice",
+		"total": "1.00",
+		"cartItems": []interface{}{
+			map[string]interface{}{"quantity": 3, "price": map[string]interface{}{"amount": "19.90"}},
+			map[string]interface{}{"quantity": 1, "price": map[string]interface{}{"amount": "5.05"}},
+		},
+		"itemCount": 10,
+	})
+	assert.NoError(t, err)
+
+	stored, err := repository.FindOne(carts, *id)
+	assert.NoError(t, err)
+	total, _ := stored.Get("total")
+	assert.Equal(t, decimal(t, "64.75"), total)
+	_, ok := stored.Get("itemCount")
+	assert.False(t, ok, "virtual columns are not stored")
+	items, _ := stored.Get("cartItems")
+	item := items.(bson.A)[0].(meta.DataObjectResp)
+	subtotal, _ := item.Get("subtotal")
+	assert.Equal(t, decimal(t, "59.70"), subtotal)
+
+	cart, err := metaService.FindOne(carts, *id)
+	assert.NoError(t, err)
+	count, _ := cart.Get("itemCount")
+	assert.Equal(t, int64(2), count)
+	title, _ := cart.Get("title")
+	assert.Equal(t, "cart of alice", title)
+
+	assert.NoError(t, metaService.PatchOne(carts, *id, &meta.DataObject{
+		"cartItems": []interface{}{
+			map[string]interface{}{"quantity": 2, "price": map[string]interface{}{"amount": "0.10"}},
+		},
+	}))
+	cart, err = metaService.FindOne(carts, *id)
+	assert.NoError(t, err)
+	total, _ = cart.Get("total")
+	assert.Equal(t, decimal(t, "0.20"), total)
+	owner, _ := cart.Get("owner")
+	assert.Equal(t, "alice", owner)
+}
+
+func TestComputedColumnsAreTypeChecked(t *testing.T) {
+	for expression, column := range map[string]*meta.MetaColumn{
+		"unknown column":   {Name: "total", DataType: meta.DataTypeDecimal, Expression: "sum(cartItems, discount)"},
+		"array path":       {Name: "total", DataType: meta.DataTypeDecimal, Expression: "cartItems.quantity * 2"},
+		"not an array":     {Name: "total", DataType: meta.DataTypeDecimal, Expression: "sum(owner)"},
+		"string as number": {Name: "total", DataType: meta.DataTypeDecimal, Expression: "owner * 2"},
+		"result type":      {Name: "total", DataType: meta.DataTypeDecimal, Expression: "owner + '!'"},
+		"syntax":           {Name: "total", DataType: meta.DataTypeDecimal, Expression: "(1 + 2"},
+	} {
+		carts := pricedCartsMetaTable()
+		carts.Columns[3] = column
+		err := carts.Validate()
+		validation, ok := err.(*meta.ValidationError)
+		if assert.True(t, ok, expression) {
+			assert.Equal(t, "total", validation.Column, expression)
+		}
+	}
+	assert.NoError(t, pricedCartsMetaTable().Validate())
+}
@@ -0,0 +1,21 @@
+package meta
+
+import "context"
+
+type actorKey struct{}
+
+// WithActor returns a context carrying the id of the user performing the operation.
+func WithActor(ctx context.Context, actor ID) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored by WithActor, or nil when there is none.
+func ActorFromContext(ctx context.Context) *ID {
+	if ctx == nil {
+		return nil
+	}
+	if actor, ok := ctx.Value(actorKey{}).(ID); ok {
+		return &actor
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ConvertValue coerces v into the go type stored for dataType:
+// string, int64, float64, primitive.Decimal128, bool, time.Time, primitive.ObjectID or bson.M.
+// Values decoded from JSON (strings and float64) as well as from bson are accepted.
+func ConvertValue(dataType DataType, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch dataType {
+	case DataTypeString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		//numbers and the like are printed, documents and arrays are not strings
+		switch reflect.ValueOf(v).Kind() {
+		case reflect.Map, reflect.Slice:
+			return nil, typeError(dataType, v)
+		}
+		return fmt.Sprint(v), nil
+	case DataTypeUrl:
+		s, ok := v.(string)
+		if !ok {
+			return nil, typeError(dataType, v)
+		}
+		if _, err := url.ParseRequestURI(s); err != nil {
+			return nil, typeError(dataType, v)
+		}
+		return s, nil
+	case DataTypeInt, DataTypeLong:
+		return toInt64(dataType, v)
+	case DataTypeFloat, DataTypeDouble:
+		return toFloat64(dataType, v)
+	case DataTypeDecimal:
+		return toDecimal(v)
+	case DataTypeBool:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, typeError(dataType, v)
+			}
+			return b, nil
+		}
+	case DataTypeDateTime, DataTypeTime, DataTypeTimestamp:
+		return toTime(dataType, v)
+	case DataTypeObjectId:
+		switch v := v.(type) {
+		case primitive.ObjectID:
+			return v, nil
+		case ID:
+			return v.ToObjectId(), nil
+		case string:
+			id, err := primitive.ObjectIDFromHex(v)
+			if err != nil {
+				return nil, typeError(dataType, v)
+			}
+			return id, nil
+		}
+	case DataTypeJson, DataTypeObject:
+		switch v := v.(type) {
+		case map[string]interface{}:
+			return bson.M(v), nil
+		case bson.M:
+			return v, nil
+		case bson.D:
+			return v.Map(), nil
+		case DataObjectResp:
+			return bson.D(v).Map(), nil
+		case DataObject:
+			return bson.M(v), nil
+		}
+		if dataType == DataTypeObject {
+			return v, nil
+		}
+	default:
+		return v, nil
+	}
+	return nil, typeError(dataType, v)
+}
+
+// ConvertValues converts every item of an array value.
+func ConvertValues(dataType DataType, v interface{}) ([]interface{}, error) {
+	var items []interface{}
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		items = v
+	case bson.A:
+		items = v
+	case []string:
+		for _, s := range v {
+			items = append(items, s)
+		}
+	default:
+		return nil, errors.New("value " + fmt.Sprint(v) + " is not an array")
+	}
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		value, err := ConvertValue(dataType, item)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// asDocument unwraps a nested document, records decoded into DataObjectResp
+// decode their nested documents as DataObjectResp as well.
+func asDocument(v interface{}) (bson.D, bool) {
+	switch v := v.(type) {
+	case bson.D:
+		return v, true
+	case DataObjectResp:
+		return bson.D(v), true
+	case *DataObjectResp:
+		return bson.D(*v), true
+	}
+	return nil, false
+}
+
+func typeError(dataType DataType, v interface{}) error {
+	return fmt.Errorf("value %v(%T) is not a valid %s", v, v, dataType)
+}
+
+func toInt64(dataType DataType, v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		if v != math.Trunc(v) {
+			return nil, typeError(dataType, v)
+		}
+		return int64(v), nil
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, typeError(dataType, v)
+		}
+		return i, nil
+	}
+	return nil, typeError(dataType, v)
+}
+
+func toFloat64(dataType DataType, v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return nil, typeError(dataType, v)
+		}
+		return f, nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, typeError(dataType, v)
+		}
+		return f, nil
+	}
+	return nil, typeError(dataType, v)
+}
+
+func toDecimal(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case primitive.Decimal128:
+		return v, nil
+	case string:
+		d, err := primitive.ParseDecimal128(v)
+		if err != nil {
+			return nil, typeError(DataTypeDecimal, v)
+		}
+		return d, nil
+	case int, int32, int64:
+		return primitive.ParseDecimal128(fmt.Sprint(v))
+	case float64:
+		return primitive.ParseDecimal128(strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return nil, typeError(DataTypeDecimal, v)
+}
+
+func toTime(dataType DataType, v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case primitive.DateTime:
+		return v.Time(), nil
+	case primitive.Timestamp:
+		return time.Unix(int64(v.T), 0), nil
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, typeError(dataType, v)
+		}
+		return t, nil
+	case int64:
+		return time.Unix(0, v*int64(time.Millisecond)), nil
+	case float64:
+		return time.Unix(0, int64(v)*int64(time.Millisecond)), nil
+	}
+	return nil, typeError(dataType, v)
+}
@@ -0,0 +1,27 @@
+package meta_test
+
+import (
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestConvertValueToString(t *testing.T) {
+	for _, v := range []interface{}{"gift", 42.0, int64(7), true} {
+		_, err := meta.ConvertValue(meta.DataTypeString, v)
+		assert.NoError(t, err, v)
+	}
+	s, err := meta.ConvertValue(meta.DataTypeString, 42.5)
+	assert.NoError(t, err)
+	assert.Equal(t, "42.5", s)
+
+	for _, v := range []interface{}{
+		map[string]interface{}{"a": 1}, bson.M{"a": 1}, bson.D{{Key: "a", Value: 1}},
+		[]interface{}{"a"}, bson.A{"a"}, []string{"a"},
+	} {
+		_, err := meta.ConvertValue(meta.DataTypeString, v)
+		assert.Error(t, err, v)
+	}
+}
@@ -0,0 +1,192 @@
+package meta
+
+import (
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// decodeRegistry maps structs to records: fields fall back to their json name,
+// decimals decode into floats and strings, ID is an object id.
+var decodeRegistry = newDecodeRegistry()
+
+func newDecodeRegistry() *bsoncodec.Registry {
+	rb := bson.NewRegistryBuilder()
+	structCodec, err := bsoncodec.NewStructCodec(bsoncodec.JSONFallbackStructTagParser)
+	if err != nil {
+		panic(err)
+	}
+	rb.RegisterDefaultDecoder(reflect.Struct, structCodec)
+	rb.RegisterDefaultEncoder(reflect.Struct, structCodec)
+	rb.RegisterDefaultDecoder(reflect.Float32, bsoncodec.ValueDecoderFunc(decodeFloat))
+	rb.RegisterDefaultDecoder(reflect.Float64, bsoncodec.ValueDecoderFunc(decodeFloat))
+	rb.RegisterDefaultDecoder(reflect.String, bsoncodec.ValueDecoderFunc(decodeString))
+	rb.RegisterTypeDecoder(reflect.TypeOf(ID{}), bsoncodec.ValueDecoderFunc(decodeID))
+	rb.RegisterTypeEncoder(reflect.TypeOf(ID{}), bsoncodec.ValueEncoderFunc(encodeID))
+	return rb.Build()
+}
+
+func decodeFloat(dc bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if vr.Type() != bsontype.Decimal128 {
+		return bsoncodec.DefaultValueDecoders{}.FloatDecodeValue(dc, vr, val)
+	}
+	d, err := vr.ReadDecimal128()
+	if err != nil {
+		return err
+	}
+	r, err := toRat(d)
+	if err != nil {
+		return err
+	}
+	f, _ := r.Float64()
+	val.SetFloat(f)
+	return nil
+}
+
+func decodeString(dc bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if vr.Type() != bsontype.Decimal128 {
+		return bsoncodec.NewStringCodec().DecodeValue(dc, vr, val)
+	}
+	d, err := vr.ReadDecimal128()
+	if err != nil {
+		return err
+	}
+	val.SetString(d.String())
+	return nil
+}
+
+func decodeID(dc bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	var id primitive.ObjectID
+	var err error
+	switch vr.Type() {
+	case bsontype.ObjectID:
+		id, err = vr.ReadObjectID()
+	case bsontype.String:
+		var s string
+		if s, err = vr.ReadString(); err == nil {
+			id, err = primitive.ObjectIDFromHex(s)
+		}
+	case bsontype.Null:
+		err = vr.ReadNull()
+	default:
+		return fmt.Errorf("cannot decode %v into an ID", vr.Type())
+	}
+	if err != nil {
+		return err
+	}
+	val.Set(reflect.ValueOf(ID(id)))
+	return nil
+}
+
+func encodeID(ec bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	return vw.WriteObjectID(primitive.ObjectID(val.Interface().(ID)))
+}
+
+// Decode decodes the record into out, a pointer to a struct. Values are first converted to the
+// data types of the columns of table, so records written before a schema change decode as well.
+func (do *DataObjectResp) Decode(table *MetaTable, out interface{}) error {
+	d := bson.D(*do)
+	if table != nil {
+		var err error
+		if d, err = normalizeDocument(table.Columns, d); err != nil {
+			return err
+		}
+	}
+	b, err := bson.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return bson.UnmarshalWithRegistry(decodeRegistry, b, out)
+}
+
+// normalizeDocument converts the values of d to the data types of columns, other keys are kept as is.
+func normalizeDocument(columns []*MetaColumn, d bson.D) (bson.D, error) {
+	normalized := make(bson.D, 0, len(d))
+	for _, e := range d {
+		value, err := normalizeValue(findColumn(columns, e.Key), e.Value)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, bson.E{Key: e.Key, Value: value})
+	}
+	return normalized, nil
+}
+
+func normalizeValue(c *MetaColumn, v interface{}) (interface{}, error) {
+	if c == nil || v == nil {
+		return v, nil
+	}
+	if c.DataType == DataTypeJson {
+		if nested, ok := asDocument(v); ok {
+			return normalizeDocument(c.NestedColumns, nested)
+		}
+		if items := itemsOf(v); items != nil {
+			normalized := make(bson.A, len(items))
+			for i, item := range items {
+				nested, ok := asDocument(item)
+				if !ok {
+					normalized[i] = item
+					continue
+				}
+				nd, err := normalizeDocument(c.NestedColumns, nested)
+				if err != nil {
+					return nil, err
+				}
+				normalized[i] = nd
+			}
+			return normalized, nil
+		}
+		return v, nil
+	}
+	if c.IsArray {
+		values, err := ConvertValues(c.DataType, v)
+		if err != nil {
+			return nil, fmt.Errorf("column:%s,%w", c.Name, err)
+		}
+		return bson.A(values), nil
+	}
+	value, err := ConvertValue(c.DataType, v)
+	if err != nil {
+		return nil, fmt.Errorf("column:%s,%w", c.Name, err)
+	}
+	return value, nil
+}
+
+// EncodeDataObject converts a struct into a DataObject, nested documents become
+// map[string]interface{} and arrays []interface{} as the repository expects.
+func EncodeDataObject(v interface{}) (*DataObject, error) {
+	b, err := bson.MarshalWithRegistry(decodeRegistry, v)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	if err := bson.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	do := DataObject(plainValue(d).(map[string]interface{}))
+	return &do, nil
+}
+
+func plainValue(v interface{}) interface{} {
+	if d, ok := asDocument(v); ok {
+		m := make(map[string]interface{}, len(d))
+		for _, e := range d {
+			m[e.Key] = plainValue(e.Value)
+		}
+		return m
+	}
+	if isArray(v) {
+		items := itemsOf(v)
+		values := make([]interface{}, len(items))
+		for i, item := range items {
+			values[i] = plainValue(item)
+		}
+		return values
+	}
+	return v
+}
@@ -0,0 +1,235 @@
+package meta
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const dictionary_table_name = "dictionaries"
+
+var ErrDictionaryExists = errors.New("dictionary already exists")
+
+// DecodeValue returns the value converted according to DataType,
+// a []interface{} of converted items when the dictionary is an array.
+func (d *Dictionary) DecodeValue() (interface{}, error) {
+	if d.IsArray {
+		return ConvertValues(d.DataType, d.Value)
+	}
+	return ConvertValue(d.DataType, d.Value)
+}
+
+func (d *Dictionary) StringValue() (string, error) {
+	v, err := ConvertValue(DataTypeString, d.Value)
+	if err != nil || v == nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+func (d *Dictionary) validate() error {
+	if len(d.Group) == 0 || len(d.Name) == 0 {
+		return errors.New("dictionary group and name are required")
+	}
+	value, err := d.DecodeValue()
+	if err != nil {
+		return errors.New("dictionary:" + d.Group + "." + d.Name + "," + err.Error())
+	}
+	d.Value = value
+	return nil
+}
+
+// DictionaryCache keeps dictionaries by group in memory, a group is loaded on first use
+// and reloaded once older than ttl, a ttl of 0 never expires.
+type DictionaryCache struct {
+	repository Repository
+	ttl        time.Duration
+	mu         sync.RWMutex
+	groups     map[string]*dictionaryGroup
+}
+
+type dictionaryGroup struct {
+	loadedAt time.Time
+	items    []*Dictionary
+	byName   map[string]*Dictionary
+}
+
+func NewDictionaryCache(repository Repository, ttl time.Duration) *DictionaryCache {
+	return &DictionaryCache{
+		repository: repository,
+		ttl:        ttl,
+		groups:     map[string]*dictionaryGroup{},
+	}
+}
+
+func (c *DictionaryCache) group(group string) (*dictionaryGroup, error) {
+	if g, ok := c.cached(group); ok {
+		return g, nil
+	}
+	g, err := loadDictionaryGroup(c.repository, group)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.groups[group] = g
+	c.mu.Unlock()
+	return g, nil
+}
+
+func (c *DictionaryCache) cached(group string) (*dictionaryGroup, bool) {
+	c.mu.RLock()
+	g, ok := c.groups[group]
+	c.mu.RUnlock()
+	return g, ok && (c.ttl == 0 || time.Since(g.loadedAt) < c.ttl)
+}
+
+// within reads a group inside a transaction, a group missing from the cache is loaded through
+// the repository of the transaction and not kept, as the transaction may still roll back.
+func (c *DictionaryCache) within(repository Repository, group string) (*dictionaryGroup, error) {
+	if g, ok := c.cached(group); ok {
+		return g, nil
+	}
+	return loadDictionaryGroup(repository, group)
+}
+
+func loadDictionaryGroup(repository Repository, group string) (*dictionaryGroup, error) {
+	items, err := repository.FindDictionariesByGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	g := &dictionaryGroup{loadedAt: time.Now(), items: items, byName: map[string]*Dictionary{}}
+	for _, item := range items {
+		g.byName[item.Name] = item
+	}
+	return g, nil
+}
+
+// Group returns the dictionaries of a group ordered by name.
+func (c *DictionaryCache) Group(group string) ([]*Dictionary, error) {
+	g, err := c.group(group)
+	if err != nil {
+		return nil, err
+	}
+	return g.items, nil
+}
+
+// Get returns a single dictionary, false when the group has no such name.
+func (c *DictionaryCache) Get(group, name string) (*Dictionary, bool, error) {
+	g, err := c.group(group)
+	if err != nil {
+		return nil, false, err
+	}
+	d, ok := g.byName[name]
+	return d, ok, nil
+}
+
+// Invalidate drops a group, or every group when none is given.
+func (c *DictionaryCache) Invalidate(groups ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(groups) == 0 {
+		c.groups = map[string]*dictionaryGroup{}
+		return
+	}
+	for _, group := range groups {
+		delete(c.groups, group)
+	}
+}
+
+func sortDictionaries(items []*Dictionary) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+}
+
+func (s *service) FindDictionariesByGroup(group string) ([]*Dictionary, error) {
+	if s.dictionaries != nil {
+		g, err := s.dictionaryGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		return g.items, nil
+	}
+	return s.Repository.FindDictionariesByGroup(group)
+}
+
+func (s *service) FindDictionary(group, name string) (*Dictionary, error) {
+	if s.dictionaries != nil {
+		g, err := s.dictionaryGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		if d, ok := g.byName[name]; ok {
+			return d, nil
+		}
+	}
+	return s.Repository.FindDictionary(group, name)
+}
+
+// dictionaryGroup reads a group from the cache, through the repository of the transaction when inside one.
+func (s *service) dictionaryGroup(group string) (*dictionaryGroup, error) {
+	if s.pending != nil {
+		return s.dictionaries.within(s.Repository, group)
+	}
+	return s.dictionaries.group(group)
+}
+
+func (s *service) InsertDictionary(d *Dictionary) (*ID, error) {
+	if err := d.validate(); err != nil {
+		return nil, err
+	}
+	if _, err := s.Repository.FindDictionary(d.Group, d.Name); err == nil {
+		return nil, ErrDictionaryExists
+	}
+	now := time.Now()
+	d.CreatedAt, d.UpdatedAt = now, now
+	d.CreatedBy, d.UpdatedBy = s.actor(), s.actor()
+	id, err := s.Repository.InsertDictionary(d)
+	if err != nil {
+		return nil, err
+	}
+	d.Id = id.ToObjectId()
+	s.invalidateDictionaries(d.Group)
+	return id, nil
+}
+
+func (s *service) UpdateDictionary(d *Dictionary) error {
+	if err := d.validate(); err != nil {
+		return err
+	}
+	existing, err := s.Repository.FindDictionaryById(ID(d.Id))
+	if err != nil {
+		return err
+	}
+	if existing.Group != d.Group || existing.Name != d.Name {
+		if _, err := s.Repository.FindDictionary(d.Group, d.Name); err == nil {
+			return ErrDictionaryExists
+		}
+	}
+	d.CreatedAt, d.CreatedBy = existing.CreatedAt, existing.CreatedBy
+	d.UpdatedAt, d.UpdatedBy = time.Now(), s.actor()
+	if err := s.Repository.UpdateDictionary(d); err != nil {
+		return err
+	}
+	s.invalidateDictionaries(existing.Group, d.Group)
+	return nil
+}
+
+func (s *service) DeleteDictionary(id ID) error {
+	existing, err := s.Repository.FindDictionaryById(id)
+	if err != nil {
+		return err
+	}
+	if err := s.Repository.DeleteDictionary(id); err != nil {
+		return err
+	}
+	s.invalidateDictionaries(existing.Group)
+	return nil
+}
+
+func (s *service) invalidateDictionaries(groups ...string) {
+	if s.dictionaries != nil {
+		s.dictionaries.Invalidate(groups...)
+	}
+}
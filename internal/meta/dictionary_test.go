@@ -0,0 +1,68 @@
+package meta_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDictionaryCrudAndLookup(t *testing.T) {
+	repository := meta.NewMemoryRepository()
+	metaService := meta.NewService(&repository, meta.WithDictionaryCache(meta.NewDictionaryCache(repository, 0)))
+
+	cny := &meta.Dictionary{Group: "currencies", Name: "CNY", DataType: meta.DataTypeString, Value: "人民币"}
+	_, err := metaService.InsertDictionary(cny)
+	assert.NoError(t, err)
+	_, err = metaService.InsertDictionary(&meta.Dictionary{Group: "currencies", Name: "USD", DataType: meta.DataTypeString, Value: "US Dollar"})
+	assert.NoError(t, err)
+	_, err = metaService.InsertDictionary(&meta.Dictionary{Group: "currencies", Name: "CNY", DataType: meta.DataTypeString, Value: "Yuan"})
+	assert.Equal(t, meta.ErrDictionaryExists, err)
+
+	currencies, err := metaService.FindDictionariesByGroup("currencies")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(currencies))
+	assert.Equal(t, "CNY", currencies[0].Name)
+
+	cny.Value = "Chinese Yuan"
+	assert.NoError(t, metaService.UpdateDictionary(cny))
+	found, err := metaService.FindDictionary("currencies", "CNY")
+	assert.NoError(t, err)
+	label, err := found.StringValue()
+	assert.NoError(t, err)
+	assert.Equal(t, "Chinese Yuan", label)
+
+	assert.NoError(t, metaService.DeleteDictionary(meta.ID(cny.Id)))
+	currencies, err = metaService.FindDictionariesByGroup("currencies")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(currencies))
+}
+
+func TestDictionaryDecodeValue(t *testing.T) {
+	repository := meta.NewMemoryRepository()
+	metaService := meta.NewService(&repository)
+
+	_, err := metaService.InsertDictionary(&meta.Dictionary{Group: "shipping", Name: "freeThresholds", DataType: meta.DataTypeInt, IsArray: true, Value: []interface{}{99.0, 199.0}})
+	assert.NoError(t, err)
+	_, err = metaService.InsertDictionary(&meta.Dictionary{Group: "shipping", Name: "cutoff", DataType: meta.DataTypeDateTime, Value: "2021-11-11T00:00:00Z"})
+	assert.NoError(t, err)
+	_, err = metaService.InsertDictionary(&meta.Dictionary{Group: "shipping", Name: "broken", DataType: meta.DataTypeObjectId, Value: "not an id"})
+	assert.Error(t, err)
+
+	thresholds, err := metaService.FindDictionary("shipping", "freeThresholds")
+	assert.NoError(t, err)
+	value, err := thresholds.DecodeValue()
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(99), int64(199)}, value)
+
+	cutoff, err := metaService.FindDictionary("shipping", "cutoff")
+	assert.NoError(t, err)
+	value, err = cutoff.DecodeValue()
+	assert.NoError(t, err)
+	assert.True(t, time.Date(2021, 11, 11, 0, 0, 0, 0, time.UTC).Equal(value.(time.Time)))
+
+	_, err = meta.ConvertValue(meta.DataTypeObjectId, primitive.NewObjectID().Hex())
+	assert.NoError(t, err)
+}
@@ -0,0 +1,141 @@
+package meta
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+const (
+	ChangeAdd    = "add"
+	ChangeRemove = "remove"
+	ChangeChange = "change"
+)
+
+// MetaTableChange is a difference between two definitions of a meta table. Path is the path of the yaml form,
+// lists of named elements are keyed by name: columns.cartItems.nestedColumns.quantity.dataType.
+type MetaTableChange struct {
+	Op   string      `json:"op"`
+	Path string      `json:"path"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// DiffMetaTables lists the changes turning from into to, the id and the track columns are ignored.
+func DiffMetaTables(from, to *MetaTable) ([]*MetaTableChange, error) {
+	a, err := plainDocument(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := plainDocument(to)
+	if err != nil {
+		return nil, err
+	}
+	changes := []*MetaTableChange{}
+	diffValues("", a, b, &changes)
+	return changes, nil
+}
+
+func plainDocument(table *MetaTable) (interface{}, error) {
+	yt := documentOf(table)
+	yt.Id = ""
+	b, err := json.Marshal(yt)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	return v, json.Unmarshal(b, &v)
+}
+
+func joinPath(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+func diffValues(path string, a, b interface{}, changes *[]*MetaTableChange) {
+	switch {
+	case a == nil && b == nil:
+		return
+	case a == nil:
+		*changes = append(*changes, &MetaTableChange{Op: ChangeAdd, Path: path, To: b})
+		return
+	case b == nil:
+		*changes = append(*changes, &MetaTableChange{Op: ChangeRemove, Path: path, From: a})
+		return
+	}
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if aok && bok {
+		keys := map[string]bool{}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diffValues(joinPath(path, k), am[k], bm[k], changes)
+		}
+		return
+	}
+	if an, ok := namedItems(a); ok {
+		if bn, ok := namedItems(b); ok {
+			diffNamed(path, an, bn, changes)
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, &MetaTableChange{Op: ChangeChange, Path: path, From: a, To: b})
+	}
+}
+
+type namedItem struct {
+	name  string
+	value interface{}
+}
+
+// namedItems returns the items of a list of objects having a name: columns, relationships, indexes.
+func namedItems(v interface{}) ([]namedItem, bool) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	named := make([]namedItem, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"].(string)
+		if !ok {
+			return nil, false
+		}
+		named = append(named, namedItem{name: name, value: item})
+	}
+	return named, true
+}
+
+// diffNamed matches the items by name, in the order of a then the order of the items added by b.
+func diffNamed(path string, a, b []namedItem, changes *[]*MetaTableChange) {
+	bByName := map[string]interface{}{}
+	for _, item := range b {
+		bByName[item.name] = item.value
+	}
+	seen := map[string]bool{}
+	for _, item := range a {
+		seen[item.name] = true
+		diffValues(joinPath(path, item.name), item.value, bByName[item.name], changes)
+	}
+	for _, item := range b {
+		if !seen[item.name] {
+			diffValues(joinPath(path, item.name), nil, item.value, changes)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package meta
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// LabelSuffix is appended to a column name to hold the dictionary label of its value on reads.
+const LabelSuffix = "_label"
+
+// Label is the text shown for the dictionary: a string value, else the description, else the name.
+func (d *Dictionary) Label() string {
+	if s, ok := d.Value.(string); ok && d.DataType == DataTypeString && len(s) > 0 {
+		return s
+	}
+	if len(d.Description) > 0 {
+		return d.Description
+	}
+	return d.Name
+}
+
+func (s *service) dictionaryByName(group string) (map[string]*Dictionary, error) {
+	items, err := s.FindDictionariesByGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Dictionary, len(items))
+	for _, item := range items {
+		byName[item.Name] = item
+	}
+	return byName, nil
+}
+
+// validateEnums rejects values of dictionary columns that are not names of their group.
+func (s *service) validateEnums(table *MetaTable, do *DataObject) error {
+	return s.validateEnumColumns(table, "", table.Columns, map[string]interface{}(*do))
+}
+
+func (s *service) validateEnumColumns(table *MetaTable, prefix string, columns []*MetaColumn, values map[string]interface{}) error {
+	for _, c := range columns {
+		v, ok := values[c.Name]
+		if !ok || v == nil {
+			continue
+		}
+		path := prefix + c.Name
+		if len(c.NestedColumns) > 0 {
+			if err := s.validateNestedEnums(table, path, c, v); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(c.Dictionary) == 0 {
+			continue
+		}
+		allowed, err := s.dictionaryByName(c.Dictionary)
+		if err != nil {
+			return err
+		}
+		items := []interface{}{v}
+		if c.IsArray {
+			items, err = ConvertValues(DataTypeUnknown, v)
+			if err != nil {
+				return &ValidationError{Table: table.Name, Column: path, Message: "value is not an array"}
+			}
+		}
+		for _, item := range items {
+			if _, ok := allowed[fmt.Sprint(item)]; !ok {
+				return &ValidationError{Table: table.Name, Column: path, Message: fmt.Sprintf("value %v is not in dictionary %s", item, c.Dictionary)}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *service) validateNestedEnums(table *MetaTable, path string, c *MetaColumn, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return s.validateEnumColumns(table, path+".", c.NestedColumns, v)
+	case []interface{}:
+		for i, item := range v {
+			if m, ok := item.(map[string]interface{}); ok {
+				if err := s.validateEnumColumns(table, path+"."+strconv.Itoa(i)+".", c.NestedColumns, m); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ResolveLabels adds <column>_label next to every dictionary column holding the label of its value,
+// arrays get an array of labels, unknown values are left without label.
+func (s *service) ResolveLabels(table *MetaTable, dors ...*DataObjectResp) error {
+	for _, dor := range dors {
+		d, err := s.resolveLabels(table.Columns, bson.D(*dor))
+		if err != nil {
+			return err
+		}
+		*dor = DataObjectResp(d)
+	}
+	return nil
+}
+
+func (s *service) resolveLabels(columns []*MetaColumn, d bson.D) (bson.D, error) {
+	result := make(bson.D, 0, len(d))
+	for _, e := range d {
+		result = append(result, e)
+		c := findColumn(columns, e.Key)
+		if c == nil {
+			continue
+		}
+		if len(c.NestedColumns) > 0 {
+			nested, err := s.resolveNestedLabels(c, e.Value)
+			if err != nil {
+				return nil, err
+			}
+			result[len(result)-1].Value = nested
+			continue
+		}
+		if len(c.Dictionary) == 0 {
+			continue
+		}
+		byName, err := s.dictionaryByName(c.Dictionary)
+		if err != nil {
+			return nil, err
+		}
+		if items, ok := e.Value.(bson.A); ok {
+			labels := bson.A{}
+			for _, item := range items {
+				if dictionary, ok := byName[fmt.Sprint(item)]; ok {
+					labels = append(labels, dictionary.Label())
+				} else {
+					labels = append(labels, nil)
+				}
+			}
+			result = append(result, bson.E{Key: e.Key + LabelSuffix, Value: labels})
+		} else if dictionary, ok := byName[fmt.Sprint(e.Value)]; ok {
+			result = append(result, bson.E{Key: e.Key + LabelSuffix, Value: dictionary.Label()})
+		}
+	}
+	return result, nil
+}
+
+func (s *service) resolveNestedLabels(c *MetaColumn, v interface{}) (interface{}, error) {
+	if d, ok := asDocument(v); ok {
+		return s.resolveLabels(c.NestedColumns, d)
+	}
+	switch v := v.(type) {
+	case bson.A:
+		items := make(bson.A, len(v))
+		for i, item := range v {
+			if d, ok := asDocument(item); ok {
+				nested, err := s.resolveLabels(c.NestedColumns, d)
+				if err != nil {
+					return nil, err
+				}
+				items[i] = nested
+			} else {
+				items[i] = item
+			}
+		}
+		return items, nil
+	}
+	return v, nil
+}
+
+func findColumn(columns []*MetaColumn, name string) *MetaColumn {
+	for _, c := range columns {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
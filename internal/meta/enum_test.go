@@ -0,0 +1,103 @@
+package meta_test
+
+import (
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ordersMetaTable = meta.MetaTable{
+	Name:       "orders",
+	PrimaryKey: meta.NewObjectIdPrimaryKey("orders_pk_id", []string{"_id"}),
+	Columns: []*meta.MetaColumn{
+		{
+			Name:     "_id",
+			DataType: meta.DataTypeObjectId,
+		},
+		{
+			Name:       "status",
+			DataType:   meta.DataTypeString,
+			Dictionary: "orderStatus",
+		},
+		{
+			Name:       "regions",
+			DataType:   meta.DataTypeString,
+			IsArray:    true,
+			Dictionary: "shippingRegions",
+		},
+		{
+			Name:     "price",
+			DataType: meta.DataTypeJson,
+			NestedColumns: []*meta.MetaColumn{
+				{
+					Name:       "currency",
+					DataType:   meta.DataTypeString,
+					Dictionary: "currencies",
+				},
+				{
+					Name:      "amount",
+					DataType:  meta.DataTypeDecimal,
+					Length:    19,
+					Precision: 2,
+				},
+			},
+		},
+	},
+}
+
+func newEnumService(t *testing.T) meta.MetaService {
+	repository := meta.NewMemoryRepository()
+	metaService := meta.NewService(&repository, meta.WithDictionaryCache(meta.NewDictionaryCache(repository, 0)))
+	for _, d := range []*meta.Dictionary{
+		{Group: "orderStatus", Name: "created", DataType: meta.DataTypeString, Value: "已创建"},
+		{Group: "orderStatus", Name: "paid", DataType: meta.DataTypeString, Value: "已支付"},
+		{Group: "shippingRegions", Name: "north", DataType: meta.DataTypeString, Description: "华北"},
+		{Group: "shippingRegions", Name: "south", DataType: meta.DataTypeString, Description: "华南"},
+		{Group: "currencies", Name: "CNY", DataType: meta.DataTypeString, Value: "人民币"},
+	} {
+		_, err := metaService.InsertDictionary(d)
+		assert.NoError(t, err)
+	}
+	return metaService
+}
+
+func TestEnumColumnsRejectUnknownValues(t *testing.T) {
+	metaService := newEnumService(t)
+
+	_, err := metaService.InsertOne(&ordersMetaTable, &meta.DataObject{"status": "shipped"})
+	validation, ok := err.(*meta.ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, "status", validation.Column)
+
+	_, err = metaService.InsertOne(&ordersMetaTable, &meta.DataObject{"status": "paid", "regions": []interface{}{"north", "west"}})
+	validation, ok = err.(*meta.ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, "regions", validation.Column)
+
+	_, err = metaService.InsertOne(&ordersMetaTable, &meta.DataObject{"price": map[string]interface{}{"currency": "USD", "amount": 1.0}})
+	validation, ok = err.(*meta.ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, "price.currency", validation.Column)
+}
+
+func TestEnumColumnsResolveLabels(t *testing.T) {
+	metaService := newEnumService(t)
+	id, err := metaService.InsertOne(&ordersMetaTable, &meta.DataObject{
+		"status":  "paid",
+		"regions": []interface{}{"north", "south"},
+		"price":   map[string]interface{}{"currency": "CNY", "amount": 1.0},
+	})
+	assert.NoError(t, err)
+
+	order, err := metaService.FindOne(&ordersMetaTable, *id)
+	assert.NoError(t, err)
+	assert.NoError(t, metaService.ResolveLabels(&ordersMetaTable, order))
+	label, _ := order.Get("status_label")
+	assert.Equal(t, "已支付", label)
+	labels, _ := order.Get("regions_label")
+	assert.Equal(t, bson.A{"华北", "华南"}, labels)
+	price, _ := order.Get("price")
+	assert.Equal(t, "人民币", price.(bson.D).Map()["currency_label"])
+}
@@ -0,0 +1,591 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Expressions of computed columns:
+//
+//	price.amount * quantity
+//	name + ' ' + brand.name
+//	sum(cartItems, price.amount * quantity)
+//	count(cartItems)
+//
+// Paths are resolved against the record, or against the item inside an aggregate.
+// Aggregates are sum, avg, min, max and count, concat joins its arguments as strings.
+
+type exprType int8
+
+const (
+	exprAny exprType = iota
+	exprNumber
+	exprString
+	exprBool
+	exprArray
+	exprObject
+)
+
+func (t exprType) String() string {
+	switch t {
+	case exprNumber:
+		return "number"
+	case exprString:
+		return "string"
+	case exprBool:
+		return "bool"
+	case exprArray:
+		return "array"
+	case exprObject:
+		return "object"
+	default:
+		return "any"
+	}
+}
+
+type exprNode interface {
+	// check returns the type of the node, columns are the ones in scope
+	check(columns []*MetaColumn) (exprType, []*MetaColumn, error)
+	eval(scope interface{}) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+type pathNode struct {
+	path []string
+}
+
+type unaryNode struct {
+	operand exprNode
+}
+
+type binaryNode struct {
+	op          byte
+	left, right exprNode
+}
+
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+var aggregates = map[string]bool{"sum": true, "avg": true, "min": true, "max": true, "count": true}
+
+var exprCache sync.Map
+
+// parseExpression parses an expression, parsed expressions are cached.
+func parseExpression(expression string) (exprNode, error) {
+	if node, ok := exprCache.Load(expression); ok {
+		return node.(exprNode), nil
+	}
+	p := &exprParser{input: expression}
+	p.next()
+	node, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	exprCache.Store(expression, node)
+	return node, nil
+}
+
+type tokenKind int8
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type exprParser struct {
+	input string
+	pos   int
+	tok   token
+	err   error
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expression %q at %d: %s", p.input, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) next() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.input) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+	c := p.input[p.pos]
+	switch {
+	case c >= '0' && c <= '9':
+		for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, text: p.input[start:p.pos], pos: start}
+	case c == '\'' || c == '"':
+		p.pos++
+		for p.pos < len(p.input) && p.input[p.pos] != c {
+			p.pos++
+		}
+		if p.pos >= len(p.input) {
+			p.err = fmt.Errorf("expression %q at %d: unterminated string", p.input, start)
+			p.tok = token{kind: tokEOF, pos: start}
+			return
+		}
+		p.pos++
+		p.tok = token{kind: tokString, text: p.input[start+1 : p.pos-1], pos: start}
+	case c == '_' || c == '$' || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.input) {
+			r := rune(p.input[p.pos])
+			if r != '_' && r != '$' && r != '.' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.input[start:p.pos], pos: start}
+	default:
+		p.pos++
+		p.tok = token{kind: tokOp, text: string(c), pos: start}
+	}
+}
+
+func (p *exprParser) isOp(ops string) bool {
+	return p.tok.kind == tokOp && strings.Contains(ops, p.tok.text)
+}
+
+// parseExpr handles + and -, the lowest precedence.
+func (p *exprParser) parseExpr() (exprNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+-") {
+		op := p.tok.text[0]
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseTerm() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*/") {
+		op := p.tok.text[0]
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isOp("-") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		r, ok := new(big.Rat).SetString(tok.text)
+		if !ok {
+			return nil, p.errorf("invalid number %q", tok.text)
+		}
+		return &literalNode{value: r}, nil
+	case tokString:
+		p.next()
+		return &literalNode{value: tok.text}, nil
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true", "false":
+			return &literalNode{value: tok.text == "true"}, nil
+		case "null":
+			return &literalNode{}, nil
+		}
+		if p.isOp("(") {
+			return p.parseCall(tok.text)
+		}
+		return &pathNode{path: strings.Split(tok.text, ".")}, nil
+	case tokOp:
+		if tok.text == "(" {
+			p.next()
+			node, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.isOp(")") {
+				return nil, p.errorf("missing )")
+			}
+			p.next()
+			return node, nil
+		}
+	}
+	if tok.kind == tokEOF {
+		return nil, p.errorf("unexpected end")
+	}
+	return nil, p.errorf("unexpected %q", tok.text)
+}
+
+func (p *exprParser) parseCall(name string) (exprNode, error) {
+	if !aggregates[name] && name != "concat" {
+		return nil, p.errorf("unknown function %s", name)
+	}
+	p.next()
+	call := &callNode{name: name}
+	for !p.isOp(")") {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if p.isOp(",") {
+			p.next()
+		} else if !p.isOp(")") {
+			return nil, p.errorf("missing ) after arguments of %s", name)
+		}
+	}
+	p.next()
+	return call, nil
+}
+
+func columnExprType(c *MetaColumn) exprType {
+	if c.IsArray {
+		return exprArray
+	}
+	switch c.DataType {
+	case DataTypeInt, DataTypeLong, DataTypeFloat, DataTypeDouble, DataTypeDecimal:
+		return exprNumber
+	case DataTypeString, DataTypeUrl, DataTypeObjectId:
+		return exprString
+	case DataTypeBool:
+		return exprBool
+	case DataTypeJson:
+		return exprObject
+	default:
+		return exprAny
+	}
+}
+
+func (n *literalNode) check(columns []*MetaColumn) (exprType, []*MetaColumn, error) {
+	switch n.value.(type) {
+	case *big.Rat:
+		return exprNumber, nil, nil
+	case string:
+		return exprString, nil, nil
+	case bool:
+		return exprBool, nil, nil
+	}
+	return exprAny, nil, nil
+}
+
+func (n *literalNode) eval(scope interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *pathNode) check(columns []*MetaColumn) (exprType, []*MetaColumn, error) {
+	for i, name := range n.path {
+		c := findColumn(columns, name)
+		if c == nil {
+			return exprAny, nil, errors.New("unknown column " + strings.Join(n.path[:i+1], "."))
+		}
+		if i == len(n.path)-1 {
+			return columnExprType(c), c.NestedColumns, nil
+		}
+		if c.IsArray {
+			return exprAny, nil, errors.New("column " + strings.Join(n.path[:i+1], ".") + " is an array, use an aggregate")
+		}
+		if c.DataType != DataTypeJson {
+			return exprAny, nil, errors.New("column " + strings.Join(n.path[:i+1], ".") + " has no nested columns")
+		}
+		columns = c.NestedColumns
+	}
+	return exprAny, nil, nil
+}
+
+func (n *pathNode) eval(scope interface{}) (interface{}, error) {
+	v := scope
+	for _, name := range n.path {
+		v = fieldOf(v, name)
+		if v == nil {
+			return nil, nil
+		}
+	}
+	return v, nil
+}
+
+// fieldOf reads a field of any of the document representations.
+func fieldOf(v interface{}, name string) interface{} {
+	if d, ok := asDocument(v); ok {
+		value, _ := lookupKey(d, name)
+		return value
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return v[name]
+	case bson.M:
+		return v[name]
+	case DataObject:
+		return v[name]
+	case *DataObject:
+		return (*v)[name]
+	}
+	return nil
+}
+
+func itemsOf(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return v
+	case bson.A:
+		return v
+	case []bson.D:
+		items := make([]interface{}, len(v))
+		for i, d := range v {
+			items[i] = d
+		}
+		return items
+	}
+	return nil
+}
+
+func (n *unaryNode) check(columns []*MetaColumn) (exprType, []*MetaColumn, error) {
+	t, _, err := n.operand.check(columns)
+	if err != nil {
+		return exprAny, nil, err
+	}
+	if t != exprNumber && t != exprAny {
+		return exprAny, nil, errors.New("cannot negate a " + t.String())
+	}
+	return exprNumber, nil, nil
+}
+
+func (n *unaryNode) eval(scope interface{}) (interface{}, error) {
+	v, err := n.operand.eval(scope)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	r, err := toRat(v)
+	if err != nil {
+		return nil, err
+	}
+	return r.Neg(r), nil
+}
+
+func (n *binaryNode) check(columns []*MetaColumn) (exprType, []*MetaColumn, error) {
+	left, _, err := n.left.check(columns)
+	if err != nil {
+		return exprAny, nil, err
+	}
+	right, _, err := n.right.check(columns)
+	if err != nil {
+		return exprAny, nil, err
+	}
+	if n.op == '+' && (left == exprString || right == exprString) {
+		if left == exprArray || left == exprObject || right == exprArray || right == exprObject {
+			return exprAny, nil, errors.New("cannot concat a " + left.String() + " and a " + right.String())
+		}
+		return exprString, nil, nil
+	}
+	for _, t := range []exprType{left, right} {
+		if t != exprNumber && t != exprAny {
+			return exprAny, nil, fmt.Errorf("operator %c needs numbers but got a %s", n.op, t)
+		}
+	}
+	return exprNumber, nil, nil
+}
+
+func (n *binaryNode) eval(scope interface{}) (interface{}, error) {
+	left, err := n.left.eval(scope)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(scope)
+	if err != nil {
+		return nil, err
+	}
+	_, leftIsString := left.(string)
+	_, rightIsString := right.(string)
+	if n.op == '+' && (leftIsString || rightIsString) {
+		return stringOf(left) + stringOf(right), nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	a, err := toRat(left)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toRat(right)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case '+':
+		return a.Add(a, b), nil
+	case '-':
+		return a.Sub(a, b), nil
+	case '*':
+		return a.Mul(a, b), nil
+	default:
+		if b.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return a.Quo(a, b), nil
+	}
+}
+
+func stringOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case *big.Rat:
+		return ratString(v)
+	default:
+		if id, err := ConvertValue(DataTypeObjectId, v); err == nil {
+			return ParseID(id).String()
+		}
+		return fmt.Sprint(v)
+	}
+}
+
+func (n *callNode) check(columns []*MetaColumn) (exprType, []*MetaColumn, error) {
+	if n.name == "concat" {
+		for _, arg := range n.args {
+			t, _, err := arg.check(columns)
+			if err != nil {
+				return exprAny, nil, err
+			}
+			if t == exprArray || t == exprObject {
+				return exprAny, nil, errors.New("cannot concat a " + t.String())
+			}
+		}
+		return exprString, nil, nil
+	}
+	if len(n.args) == 0 || len(n.args) > 2 || (n.name == "count" && len(n.args) != 1) {
+		return exprAny, nil, errors.New("wrong number of arguments for " + n.name)
+	}
+	t, itemColumns, err := n.args[0].check(columns)
+	if err != nil {
+		return exprAny, nil, err
+	}
+	if t != exprArray {
+		return exprAny, nil, errors.New(n.name + " needs an array column")
+	}
+	if len(n.args) == 2 {
+		t, _, err := n.args[1].check(itemColumns)
+		if err != nil {
+			return exprAny, nil, err
+		}
+		if t != exprNumber && t != exprAny {
+			return exprAny, nil, errors.New(n.name + " needs a number but got a " + t.String())
+		}
+	}
+	return exprNumber, nil, nil
+}
+
+func (n *callNode) eval(scope interface{}) (interface{}, error) {
+	if n.name == "concat" {
+		var b strings.Builder
+		for _, arg := range n.args {
+			v, err := arg.eval(scope)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(stringOf(v))
+		}
+		return b.String(), nil
+	}
+	v, err := n.args[0].eval(scope)
+	if err != nil {
+		return nil, err
+	}
+	items := itemsOf(v)
+	if n.name == "count" {
+		return new(big.Rat).SetInt64(int64(len(items))), nil
+	}
+	var values []*big.Rat
+	for _, item := range items {
+		if len(n.args) == 2 {
+			if item, err = n.args[1].eval(item); err != nil {
+				return nil, err
+			}
+		}
+		if item == nil {
+			continue
+		}
+		r, err := toRat(item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, r)
+	}
+	if len(values) == 0 {
+		if n.name == "sum" {
+			return new(big.Rat), nil
+		}
+		return nil, nil
+	}
+	result := values[0]
+	for _, r := range values[1:] {
+		switch n.name {
+		case "sum", "avg":
+			result.Add(result, r)
+		case "min":
+			if r.Cmp(result) < 0 {
+				result = r
+			}
+		case "max":
+			if r.Cmp(result) > 0 {
+				result = r
+			}
+		}
+	}
+	if n.name == "avg" {
+		result.Quo(result, new(big.Rat).SetInt64(int64(len(values))))
+	}
+	return result, nil
+}
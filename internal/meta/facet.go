@@ -0,0 +1,373 @@
+package meta
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Facet counts the records of a result set by the values of a column, Name is its key in the result.
+//
+// A terms facet has a bucket per value, the most frequent first. With Key it has a bucket per pair
+// of values of the same array item, per specification name and value for instance:
+//
+//	&Facet{Name: "specs", Path: "specifications.value", Key: "specifications.name"}
+//
+// A range facet has a bucket per interval between two Boundaries, the upper one excluded:
+//
+//	&Facet{Name: "price", Path: "price.amount", Boundaries: []interface{}{0, 50, 100, 500}}
+//
+// A record holding a value in several array items counts once.
+type Facet struct {
+	Name       string        `json:"name"`
+	Path       string        `json:"path"`
+	Key        string        `json:"key,omitempty"`
+	Boundaries []interface{} `json:"boundaries,omitempty"` //ascending numbers
+	Limit      int64         `json:"limit,omitempty"`      //the buckets of a terms facet, all of them when 0
+}
+
+// FacetBucket is a value or an interval of a facet and the number of records holding it.
+type FacetBucket struct {
+	Key   interface{} `json:"key,omitempty"` //the value of Facet.Key
+	Value interface{} `json:"value"`         //the value or the lower boundary of the interval
+	To    interface{} `json:"to,omitempty"`  //the upper boundary of the interval
+	Count int64       `json:"count"`
+}
+
+func (f *Facet) isRange() bool {
+	return len(f.Boundaries) > 0
+}
+
+// validateFacets checks the paths of facets against the columns of table.
+func validateFacets(table *MetaTable, facets []*Facet) error {
+	if len(facets) == 0 {
+		return &ValidationError{Table: table.Name, Message: "facets are required"}
+	}
+	names := map[string]bool{}
+	for _, f := range facets {
+		invalid := func(message string) error {
+			return &ValidationError{Table: table.Name, Column: f.Path, Message: message}
+		}
+		if f.Name == "" || strings.ContainsAny(f.Name, ".$") {
+			return invalid("facet name " + f.Name + " should be a non empty name without . or $")
+		}
+		if names[f.Name] {
+			return invalid("duplicate facet name " + f.Name)
+		}
+		names[f.Name] = true
+		c, err := queryColumn(table, f.Path)
+		if err != nil {
+			return err
+		}
+		if c.DataType == DataTypeJson {
+			return invalid("facets need a scalar column")
+		}
+		if f.Limit < 0 {
+			return invalid("limit should not be negative")
+		}
+		if f.Key != "" {
+			k, err := queryColumn(table, f.Key)
+			if err != nil {
+				return err
+			}
+			if k.DataType == DataTypeJson || f.isRange() {
+				return &ValidationError{Table: table.Name, Column: f.Key, Message: "the key of a terms facet should be a scalar column"}
+			}
+			arrays := map[string]bool{}
+			for _, prefix := range arrayPrefixes(table, f.Path) {
+				arrays[prefix] = true
+			}
+			for _, prefix := range arrayPrefixes(table, f.Key) {
+				if !arrays[prefix] {
+					return &ValidationError{Table: table.Name, Column: f.Key, Message: "the key should be in the array items of " + f.Path}
+				}
+			}
+		}
+		if !f.isRange() {
+			continue
+		}
+		switch c.DataType {
+		case DataTypeInt, DataTypeLong, DataTypeFloat, DataTypeDouble, DataTypeDecimal:
+		default:
+			return invalid("range facets need a number column")
+		}
+		if len(f.Boundaries) < 2 {
+			return invalid("range facets need at least 2 boundaries")
+		}
+		for i, b := range f.Boundaries {
+			if class, _ := classOf(b); class != classNumber {
+				return invalid("boundaries should be numbers")
+			}
+			if i > 0 && compareSortValues(f.Boundaries[i-1], b) >= 0 {
+				return invalid("boundaries should be ascending")
+			}
+		}
+	}
+	return nil
+}
+
+// arrayPrefixes returns the array columns holding path, path itself included, outermost first.
+func arrayPrefixes(table *MetaTable, path string) []string {
+	var prefixes []string
+	parts := strings.Split(path, ".")
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], ".")
+		if c := table.ColumnByPath(prefix); c != nil && c.IsArray {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// facetPipeline compiles f to the sub-pipeline of a $facet stage. It outputs a document per bucket
+// holding the value, or the key and value, in _id and the count.
+func facetPipeline(table *MetaTable, f *Facet) bson.A {
+	stages := bson.A{}
+	for _, prefix := range arrayPrefixes(table, f.Path) {
+		stages = append(stages, bson.D{{Key: "$unwind", Value: "$" + prefix}})
+	}
+	if f.isRange() {
+		return append(stages,
+			bson.D{{Key: "$match", Value: bson.D{{Key: f.Path, Value: bson.D{
+				{Key: "$gte", Value: f.Boundaries[0]},
+				{Key: "$lt", Value: f.Boundaries[len(f.Boundaries)-1]},
+			}}}}},
+			bson.D{{Key: "$bucket", Value: bson.D{
+				{Key: "groupBy", Value: "$" + f.Path},
+				{Key: "boundaries", Value: bson.A(f.Boundaries)},
+				{Key: "output", Value: bson.D{{Key: "records", Value: bson.D{{Key: "$addToSet", Value: "$_id"}}}}},
+			}}},
+			bson.D{{Key: "$project", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$size", Value: "$records"}}}}}},
+		)
+	}
+	value := bson.D{{Key: "v", Value: "$" + f.Path}}
+	if f.Key != "" {
+		value = append(value, bson.E{Key: "k", Value: "$" + f.Key})
+	}
+	stages = append(stages,
+		bson.D{{Key: "$match", Value: bson.D{{Key: f.Path, Value: bson.D{{Key: "$ne", Value: nil}}}}}},
+		//once per record
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: append(value, bson.E{Key: "r", Value: "$_id"})}}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: facetGroupKey(f)},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id.k", Value: 1}, {Key: "_id.v", Value: 1}}}},
+	)
+	if f.Limit > 0 {
+		stages = append(stages, bson.D{{Key: "$limit", Value: f.Limit}})
+	}
+	return stages
+}
+
+func facetGroupKey(f *Facet) bson.D {
+	key := bson.D{{Key: "v", Value: "$_id.v"}}
+	if f.Key != "" {
+		key = append(key, bson.E{Key: "k", Value: "$_id.k"})
+	}
+	return key
+}
+
+// facetBuckets turns the documents output for f into buckets, a range facet has a bucket per interval
+// even when empty.
+func facetBuckets(f *Facet, groups []bson.D) []*FacetBucket {
+	if f.isRange() {
+		buckets := make([]*FacetBucket, 0, len(f.Boundaries)-1)
+		for i := 0; i+1 < len(f.Boundaries); i++ {
+			bucket := &FacetBucket{Value: f.Boundaries[i], To: f.Boundaries[i+1]}
+			for _, g := range groups {
+				lower, _ := lookupKey(g, "_id")
+				if c, ok := compareValues(lower, f.Boundaries[i]); ok && c == 0 {
+					count, _ := lookupKey(g, "count")
+					bucket.Count = toVersion(count)
+				}
+			}
+			buckets = append(buckets, bucket)
+		}
+		return buckets
+	}
+	buckets := make([]*FacetBucket, 0, len(groups))
+	for _, g := range groups {
+		id, _ := lookupKey(g, "_id")
+		d, _ := queryDocument(id)
+		bucket := &FacetBucket{}
+		bucket.Value, _ = lookupKey(d, "v")
+		bucket.Key, _ = lookupKey(d, "k")
+		count, _ := lookupKey(g, "count")
+		bucket.Count = toVersion(count)
+		buckets = append(buckets, bucket)
+	}
+	sort.SliceStable(buckets, func(i, j int) bool {
+		if buckets[i].Count != buckets[j].Count {
+			return buckets[i].Count > buckets[j].Count
+		}
+		if c := compareSortValues(buckets[i].Key, buckets[j].Key); c != 0 {
+			return c < 0
+		}
+		return compareSortValues(buckets[i].Value, buckets[j].Value) < 0
+	})
+	if f.Limit > 0 && int64(len(buckets)) > f.Limit {
+		buckets = buckets[:f.Limit]
+	}
+	return buckets
+}
+
+// Facets counts the records matching filter and the terms of query by the facets, see Search.
+// An empty query counts every record matching filter.
+func (s *service) Facets(table *MetaTable, query string, filter bson.D, facets []*Facet) (map[string][]*FacetBucket, error) {
+	if err := validateFacets(table, facets); err != nil {
+		return nil, err
+	}
+	filter = s.live(table, filter)
+	if strings.TrimSpace(query) == "" {
+		return s.Repository.Facets(table, "", filter, facets)
+	}
+	if len(searchablePaths(table)) == 0 {
+		return nil, &ValidationError{Table: table.Name, Message: "table has no searchable column"}
+	}
+	tokens := distinctTokens(s.tokenizer.Tokens(query))
+	if len(tokens) == 0 {
+		//no term, no record
+		result := map[string][]*FacetBucket{}
+		for _, f := range facets {
+			result[f.Name] = facetBuckets(f, nil)
+		}
+		return result, nil
+	}
+	return s.Repository.Facets(table, strings.Join(tokens, " "), filter, facets)
+}
+
+// Facets computes every facet with a $facet stage in one aggregation.
+func (r *repository) Facets(table *MetaTable, query string, filter bson.D, facets []*Facet) (map[string][]*FacetBucket, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	if query != "" {
+		filter = append(bson.D{{Key: "$text", Value: bson.D{{Key: "$search", Value: query}}}}, filter...)
+	}
+	pipeline := mongo.Pipeline{}
+	if len(filter) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filter}})
+	}
+	stages := bson.D{}
+	for _, f := range facets {
+		stages = append(stages, bson.E{Key: f.Name, Value: facetPipeline(table, f)})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$facet", Value: stages}})
+	cursor, err := db.Collection(table.Name).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var output bson.D
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&output); err != nil {
+			return nil, err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	result := map[string][]*FacetBucket{}
+	for _, f := range facets {
+		v, _ := lookupKey(output, f.Name)
+		var groups []bson.D
+		for _, item := range itemsOf(v) {
+			if d, ok := queryDocument(item); ok {
+				groups = append(groups, d)
+			}
+		}
+		result[f.Name] = facetBuckets(f, groups)
+	}
+	return result, nil
+}
+
+// Facets evaluates the sub-pipelines of the facets the way mongo would.
+func (r *memoryRepository) Facets(table *MetaTable, query string, filter bson.D, facets []*Facet) (map[string][]*FacetBucket, error) {
+	hits, err := r.searchHits(table, query, filter)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string][]*FacetBucket{}
+	for _, f := range facets {
+		type count struct {
+			id    bson.D
+			count int64
+		}
+		var counts []*count
+		for _, hit := range hits {
+			items := []bson.D{bson.D(*hit.Record)}
+			for _, prefix := range arrayPrefixes(table, f.Path) {
+				var unwound []bson.D
+				for _, d := range items {
+					unwound = append(unwound, unwindPath(d, strings.Split(prefix, "."))...)
+				}
+				items = unwound
+			}
+			//the buckets of the record, once each
+			var ids []bson.D
+			for _, d := range items {
+				v := pathValue(d, f.Path)
+				if v == nil {
+					continue
+				}
+				id := bson.D{{Key: "v", Value: v}}
+				if f.isRange() {
+					lower := rangeOf(f, v)
+					if lower == nil {
+						continue
+					}
+					id = bson.D{{Key: "v", Value: lower}}
+				} else if f.Key != "" {
+					id = append(id, bson.E{Key: "k", Value: pathValue(d, f.Key)})
+				}
+				seen := false
+				for _, other := range ids {
+					seen = seen || sameKeys(other, id)
+				}
+				if !seen {
+					ids = append(ids, id)
+				}
+			}
+			for _, id := range ids {
+				var c *count
+				for _, candidate := range counts {
+					if sameKeys(candidate.id, id) {
+						c = candidate
+						break
+					}
+				}
+				if c == nil {
+					c = &count{id: id}
+					counts = append(counts, c)
+				}
+				c.count++
+			}
+		}
+		groups := make([]bson.D, 0, len(counts))
+		for _, c := range counts {
+			var id interface{} = c.id
+			if f.isRange() {
+				id, _ = lookupKey(c.id, "v")
+			}
+			groups = append(groups, bson.D{{Key: "_id", Value: id}, {Key: "count", Value: c.count}})
+		}
+		result[f.Name] = facetBuckets(f, groups)
+	}
+	return result, nil
+}
+
+// rangeOf returns the lower boundary of the interval of f holding v, nil when v is out of the boundaries.
+func rangeOf(f *Facet, v interface{}) interface{} {
+	for i := 0; i+1 < len(f.Boundaries); i++ {
+		lower, okLower := compareValues(v, f.Boundaries[i])
+		upper, okUpper := compareValues(v, f.Boundaries[i+1])
+		if okLower && okUpper && lower >= 0 && upper < 0 {
+			return f.Boundaries[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package meta_test
+
+import (
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFacets(t *testing.T) {
+	tables, err := meta.UnmarshalMetaTablesYAML([]byte(productsYAML))
+	assert.NoError(t, err)
+	products := tables[0]
+	repository := meta.NewMemoryRepository()
+	service := meta.NewService(&repository)
+	_, err = service.InsertMetaTable(products)
+	assert.NoError(t, err)
+	for _, record := range []string{
+		`{"name": "龙井绿茶", "brand": "a", "price": "45", "specifications": [{"name": "产地", "value": "杭州"}, {"name": "净含量", "value": "250g"}]}`,
+		`{"name": "碧螺春绿茶", "brand": "b", "price": "120", "specifications": [{"name": "产地", "value": "苏州"}, {"name": "产地", "value": "苏州"}]}`,
+		`{"name": "铁观音", "brand": "a", "price": "80", "specifications": [{"name": "产地", "value": "安溪"}, {"name": "净含量", "value": "250g"}]}`,
+		`{"name": "普洱", "brand": "a"}`,
+	} {
+		_, err := service.InsertOne(products, cart(t, products, record))
+		assert.NoError(t, err)
+	}
+	facets := []*meta.Facet{
+		{Name: "brand", Path: "brand"},
+		{Name: "price", Path: "price", Boundaries: []interface{}{0, 50, 100, 200}},
+		{Name: "specs", Path: "specifications.value", Key: "specifications.name"},
+	}
+
+	result, err := service.Facets(products, "", nil, facets)
+	assert.NoError(t, err)
+	assert.Equal(t, []*meta.FacetBucket{{Value: "a", Count: 3}, {Value: "b", Count: 1}}, result["brand"])
+	assert.Equal(t, []*meta.FacetBucket{
+		{Value: 0, To: 50, Count: 1},
+		{Value: 50, To: 100, Count: 1},
+		{Value: 100, To: 200, Count: 1},
+	}, result["price"])
+	assert.Equal(t, []*meta.FacetBucket{
+		{Key: "净含量", Value: "250g", Count: 2},
+		{Key: "产地", Value: "安溪", Count: 1},
+		{Key: "产地", Value: "杭州", Count: 1},
+		{Key: "产地", Value: "苏州", Count: 1},
+	}, result["specs"], "a record repeating a value counts once")
+
+	//the result set of a search
+	result, err = service.Facets(products, "绿茶", bson.D{{Key: "brand", Value: "a"}}, facets)
+	assert.NoError(t, err)
+	assert.Equal(t, []*meta.FacetBucket{{Value: "a", Count: 1}}, result["brand"])
+	assert.Equal(t, int64(1), result["price"][0].Count)
+	assert.Equal(t, int64(0), result["price"][2].Count)
+
+	result, err = service.Facets(products, "", nil, []*meta.Facet{{Name: "brand", Path: "brand", Limit: 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, []*meta.FacetBucket{{Value: "a", Count: 3}}, result["brand"])
+
+	for _, facet := range []*meta.Facet{
+		{Name: "colour", Path: "colour"},
+		{Name: "specs", Path: "specifications"},
+		{Name: "price", Path: "brand", Boundaries: []interface{}{0, 10}},
+		{Name: "price", Path: "price", Boundaries: []interface{}{10}},
+		{Name: "price", Path: "price", Boundaries: []interface{}{10, 5}},
+		{Name: "price", Path: "price", Boundaries: []interface{}{"0", "10"}},
+		{Name: "specs", Path: "specifications.value", Key: "medias.caption"},
+		{Name: "a.b", Path: "brand"},
+	} {
+		_, err := service.Facets(products, "", nil, []*meta.Facet{facet})
+		_, ok := err.(*meta.ValidationError)
+		assert.True(t, ok, "%+v: %v", facet, err)
+	}
+}
@@ -0,0 +1,156 @@
+package meta
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// the operators accepted by ConvertFilter
+var filterOperators = map[string]bool{
+	"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true,
+	"$in": true, "$nin": true, "$exists": true, "$regex": true, "$options": true,
+}
+
+// ConvertFilter checks the paths of a filter decoded from JSON against table
+// and converts its values to the data type of their column:
+//
+//	{"cartItems.quantity": {"$gte": 2}, "$or": [{"tags": "gift"}, {"note": {"$exists": true}}]}
+//
+// Invalid paths and values are reported as a ValidationError.
+func ConvertFilter(table *MetaTable, filter map[string]interface{}) (bson.D, error) {
+	d := bson.D{}
+	//a stable filter keeps the mongo query plans cacheable
+	for _, key := range sortedKeys(filter) {
+		value := filter[key]
+		switch key {
+		case "$and", "$or", "$nor":
+			items, _ := value.([]interface{})
+			if len(items) == 0 {
+				return nil, &ValidationError{Table: table.Name, Column: key, Message: key + " expects a non empty list of filters"}
+			}
+			clauses := bson.A{}
+			for _, item := range items {
+				sub, ok := item.(map[string]interface{})
+				if !ok {
+					return nil, &ValidationError{Table: table.Name, Column: key, Message: key + " expects a non empty list of filters"}
+				}
+				clause, err := ConvertFilter(table, sub)
+				if err != nil {
+					return nil, err
+				}
+				clauses = append(clauses, clause)
+			}
+			d = append(d, bson.E{Key: key, Value: clauses})
+			continue
+		}
+		c, err := queryColumn(table, key)
+		if err != nil {
+			return nil, err
+		}
+		conditions, ok := value.(map[string]interface{})
+		if !ok {
+			v, err := filterValue(table, key, c, "$eq", value)
+			if err != nil {
+				return nil, err
+			}
+			d = append(d, bson.E{Key: key, Value: v})
+			continue
+		}
+		converted := bson.D{}
+		for _, operator := range sortedKeys(conditions) {
+			if !filterOperators[operator] {
+				return nil, &ValidationError{Table: table.Name, Column: key, Message: "unknown filter operator " + operator}
+			}
+			v, err := filterValue(table, key, c, operator, conditions[operator])
+			if err != nil {
+				return nil, err
+			}
+			converted = append(converted, bson.E{Key: operator, Value: v})
+		}
+		d = append(d, bson.E{Key: key, Value: converted})
+	}
+	return d, nil
+}
+
+// ConvertSort checks column paths prefixed by - for descending: ["-total", "userId"].
+func ConvertSort(table *MetaTable, keys []string) (bson.D, error) {
+	var d bson.D
+	for _, key := range keys {
+		order := 1
+		if strings.HasPrefix(key, "-") {
+			key, order = key[1:], -1
+		}
+		if _, err := queryColumn(table, key); err != nil {
+			return nil, err
+		}
+		d = append(d, bson.E{Key: key, Value: order})
+	}
+	return d, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// queryColumn finds the column of a filter or sort path, computed on read columns are not stored.
+func queryColumn(table *MetaTable, path string) (*MetaColumn, error) {
+	c := table.ColumnByPath(path)
+	if c == nil && path == "_id" {
+		return &MetaColumn{Name: "_id", DataType: DataTypeObjectId}, nil
+	}
+	if c == nil {
+		return nil, &ValidationError{Table: table.Name, Column: path, Message: "unknown column " + path}
+	}
+	if c.IsComputed() && c.IsVirtual {
+		return nil, &ValidationError{Table: table.Name, Column: path, Message: "column is computed on read"}
+	}
+	return c, nil
+}
+
+func filterValue(table *MetaTable, path string, c *MetaColumn, operator string, v interface{}) (interface{}, error) {
+	invalid := func(message string) error {
+		return &ValidationError{Table: table.Name, Column: path, Message: message}
+	}
+	switch operator {
+	case "$exists":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, invalid("$exists expects true or false")
+		}
+		return b, nil
+	case "$regex":
+		s, ok := v.(string)
+		if _, err := regexp.Compile(s); !ok || err != nil {
+			return nil, invalid("$regex expects a regular expression")
+		}
+		return s, nil
+	case "$options":
+		s, ok := v.(string)
+		if !ok || strings.Trim(s, "imsx") != "" {
+			return nil, invalid("$options expects a combination of i, m, s and x")
+		}
+		return s, nil
+	case "$in", "$nin":
+		values, err := ConvertValues(c.DataType, v)
+		if err != nil {
+			return nil, invalid(err.Error())
+		}
+		return bson.A(values), nil
+	}
+	if c.DataType == DataTypeJson {
+		return nil, invalid("json columns can only be filtered with $exists")
+	}
+	value, err := ConvertValue(c.DataType, v)
+	if err != nil {
+		return nil, invalid(err.Error())
+	}
+	return value, nil
+}
@@ -0,0 +1,195 @@
+package meta
+
+const widgetGroup = "group"
+
+// Form describes an editor for a meta table, to be rendered generically by the admin frontend.
+type Form struct {
+	Table  string       `json:"table"`
+	Title  string       `json:"title"`
+	Fields []*FormField `json:"fields"`
+}
+
+// FormField is an input, or a group of inputs for json columns.
+type FormField struct {
+	Name        string            `json:"name"`
+	Path        string            `json:"path"`
+	Label       string            `json:"label"`
+	Widget      string            `json:"widget"`
+	DataType    string            `json:"dataType"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Placeholder string            `json:"placeholder,omitempty"`
+	HelpText    string            `json:"helpText,omitempty"`
+	Required    bool              `json:"required"`
+	ReadOnly    bool              `json:"readOnly,omitempty"`
+	Multiple    bool              `json:"multiple,omitempty"`   //array of scalar values
+	Repeatable  bool              `json:"repeatable,omitempty"` //array of groups
+	Default     interface{}       `json:"default,omitempty"`
+	Rules       []*FormRule       `json:"rules,omitempty"`
+	Options     []*FormOption     `json:"options,omitempty"`
+	Fields      []*FormField      `json:"fields,omitempty"`
+}
+
+type FormRule struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+type FormOption struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// RenderForm builds the form descriptor of a table, options of dictionary columns are loaded from their group.
+func (s *service) RenderForm(table *MetaTable) (*Form, error) {
+	fields, err := s.formFields(table.Columns, "", true)
+	if err != nil {
+		return nil, err
+	}
+	title := table.Description
+	if len(title) == 0 {
+		title = table.Name
+	}
+	return &Form{Table: table.Name, Title: title, Fields: fields}, nil
+}
+
+func (s *service) formFields(columns []*MetaColumn, prefix string, root bool) ([]*FormField, error) {
+	fields := make([]*FormField, 0, len(columns))
+	for _, c := range columns {
+		field, err := s.formField(c, prefix, root)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func (s *service) formField(c *MetaColumn, prefix string, root bool) (*FormField, error) {
+	field := &FormField{
+		Name:        c.Name,
+		Path:        prefix + c.Name,
+		Label:       c.Label(),
+		Labels:      c.I18nLabels(),
+		Placeholder: c.Placeholder(),
+		HelpText:    c.HelpText(),
+		Widget:      defaultInputType(c).String(),
+		DataType:    c.DataType.String(),
+		Required:    !c.IsNullable,
+		ReadOnly:    c.ReadOnly(),
+		Default:     c.DefaultValue,
+		Rules:       formRules(c),
+	}
+	if inputType, ok := c.InputType(); ok {
+		field.Widget = inputType.String()
+	}
+	if root && (c.Name == "_id" || s.isTrackColumn(c.Name)) {
+		field.Widget = InputTypeHidden.String()
+		field.Required = false
+		field.ReadOnly = true
+	}
+	if c.DataType == DataTypeJson {
+		nested, err := s.formFields(c.NestedColumns, field.Path+".", false)
+		if err != nil {
+			return nil, err
+		}
+		field.Widget = widgetGroup
+		field.Fields = nested
+		field.Repeatable = c.IsArray
+		return field, nil
+	}
+	field.Multiple = c.IsArray
+	if len(c.Dictionary) > 0 {
+		items, err := s.FindDictionariesByGroup(c.Dictionary)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			field.Options = append(field.Options, &FormOption{Value: item.Name, Label: item.Label()})
+		}
+	}
+	return field, nil
+}
+
+func (s *service) isTrackColumn(name string) bool {
+	return s.trackColumns.Has(name)
+}
+
+// InputType returns the input type set by an AttributeTypeInputType attribute.
+func (c *MetaColumn) InputType() (InputType, bool) {
+	for _, a := range c.Attributes {
+		if a.Type != AttributeTypeInputType {
+			continue
+		}
+		switch v := a.Value.(type) {
+		case InputType:
+			return v, true
+		case string:
+			for i := InputTypeText; i <= InputTypePassword; i++ {
+				if i.String() == v {
+					return i, true
+				}
+			}
+		default:
+			if i, err := toInt64(DataTypeInt, v); err == nil {
+				return ParseInputType(int8(i.(int64))), true
+			}
+		}
+	}
+	return InputTypeUnknown, false
+}
+
+func defaultInputType(c *MetaColumn) InputType {
+	if len(c.Dictionary) > 0 {
+		if c.IsArray {
+			return InputTypeCheckbox
+		}
+		return InputTypeSelect
+	}
+	switch c.DataType {
+	case DataTypeInt, DataTypeLong, DataTypeFloat, DataTypeDouble, DataTypeDecimal:
+		return InputTypeNumber
+	case DataTypeBool:
+		return InputTypeCheckbox
+	case DataTypeDateTime, DataTypeTime, DataTypeTimestamp:
+		return InputTypeDate
+	case DataTypeObject:
+		return InputTypeTextArea
+	default:
+		return InputTypeText
+	}
+}
+
+func formRules(c *MetaColumn) []*FormRule {
+	var rules []*FormRule
+	switch c.DataType {
+	case DataTypeString:
+		if c.Length > 0 {
+			rules = append(rules, &FormRule{Type: "maxLength", Value: c.Length})
+		}
+	case DataTypeInt, DataTypeLong:
+		rules = append(rules, &FormRule{Type: "integer"})
+	case DataTypeDecimal:
+		if c.Length > 0 {
+			rules = append(rules, &FormRule{Type: "precision", Value: c.Length})
+		}
+		if scale := c.scale(); scale > 0 {
+			rules = append(rules, &FormRule{Type: "scale", Value: scale})
+		}
+	case DataTypeUrl:
+		rules = append(rules, &FormRule{Type: "url"})
+	case DataTypeObjectId:
+		rules = append(rules, &FormRule{Type: "pattern", Value: "^[0-9a-fA-F]{24}$"})
+	}
+	for _, v := range c.Validators {
+		rules = append(rules, &FormRule{Type: "validator", Value: v})
+	}
+	return rules
+}
+
+// scale is the number of decimals, the schemas declare it as Precision alongside Length for the total digits.
+func (c *MetaColumn) scale() int {
+	if c.Scale > 0 {
+		return c.Scale
+	}
+	return c.Precision
+}
@@ -0,0 +1,58 @@
+package meta_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderForm(t *testing.T) {
+	metaService := newEnumService(t)
+	products := productMetaTable
+	products.Columns = append([]*meta.MetaColumn{}, productMetaTable.Columns...)
+	products.Columns[3] = &meta.MetaColumn{
+		Name:        "longDescription",
+		Description: "详细描述",
+		DataType:    meta.DataTypeString,
+		IsNullable:  true,
+		Attributes:  []*meta.Attribute{{Type: meta.AttributeTypeInputType, Value: meta.InputTypeTextArea}},
+	}
+
+	form, err := metaService.RenderForm(&products)
+	assert.NoError(t, err)
+	assert.Equal(t, len(products.Columns), len(form.Fields))
+
+	id := form.Fields[0]
+	assert.Equal(t, "hidden", id.Widget)
+	assert.False(t, id.Required)
+
+	description := form.Fields[3]
+	assert.Equal(t, "textArea", description.Widget)
+	assert.Equal(t, "详细描述", description.Label)
+	assert.False(t, description.Required)
+
+	medias := form.Fields[5]
+	assert.Equal(t, "group", medias.Widget)
+	assert.True(t, medias.Repeatable)
+	assert.Equal(t, "medias.url", medias.Fields[2].Path)
+
+	price := form.Fields[11]
+	assert.Equal(t, "price", price.Name)
+	amount := price.Fields[1]
+	assert.Equal(t, "number", amount.Widget)
+	assert.Equal(t, []*meta.FormRule{{Type: "precision", Value: 19}, {Type: "scale", Value: 2}}, amount.Rules)
+
+	orders, err := metaService.RenderForm(&ordersMetaTable)
+	assert.NoError(t, err)
+	status := orders.Fields[1]
+	assert.Equal(t, "select", status.Widget)
+	assert.Equal(t, []*meta.FormOption{{Value: "created", Label: "已创建"}, {Value: "paid", Label: "已支付"}}, status.Options)
+	regions := orders.Fields[2]
+	assert.Equal(t, "checkbox", regions.Widget)
+	assert.True(t, regions.Multiple)
+
+	_, err = json.Marshal(form)
+	assert.NoError(t, err)
+}
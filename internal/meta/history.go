@@ -0,0 +1,262 @@
+package meta
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const historyTableSuffix = "_history"
+
+type HistoryOperation int8
+
+const (
+	HistoryOperationUnknown HistoryOperation = iota
+	HistoryOperationInsert
+	HistoryOperationUpdate
+	HistoryOperationDelete
+)
+
+func (o HistoryOperation) String() string {
+	switch o {
+	case HistoryOperationInsert:
+		return "insert"
+	case HistoryOperationUpdate:
+		return "update"
+	case HistoryOperationDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+func ParseHistoryOperation(i int8) HistoryOperation {
+	switch i {
+	case 1:
+		return HistoryOperationInsert
+	case 2:
+		return HistoryOperationUpdate
+	case 3:
+		return HistoryOperationDelete
+	default:
+		return HistoryOperationUnknown
+	}
+}
+
+// HistoryEntry is one write on a record, stored in the <table>_history collection.
+type HistoryEntry struct {
+	Id        primitive.ObjectID `bson:"_id,omitempty"`
+	RecordId  primitive.ObjectID
+	Operation HistoryOperation
+	Actor     *ID
+	Timestamp time.Time
+	Changes   []*FieldChange
+	Removed   bool //the record itself was removed
+}
+
+// FieldChange is the change of a single field, nested documents use dotted paths.
+type FieldChange struct {
+	Path  string
+	Old   interface{}
+	New   interface{}
+	Unset bool //the field does not exist anymore
+}
+
+func historyTableName(table *MetaTable) string {
+	return table.Name + historyTableSuffix
+}
+
+// diffDocuments returns the field level changes turning before into after.
+func diffDocuments(before, after bson.D) []*FieldChange {
+	changes := []*FieldChange{}
+	diffInto(&changes, "", before, after)
+	return changes
+}
+
+func diffInto(changes *[]*FieldChange, prefix string, before, after bson.D) {
+	old := before.Map()
+	keys := []string{}
+	for _, e := range after {
+		keys = append(keys, e.Key)
+	}
+	for _, e := range before {
+		if _, ok := lookupKey(after, e.Key); !ok {
+			keys = append(keys, e.Key)
+		}
+	}
+	for _, key := range keys {
+		path := prefix + key
+		if path == SearchColumn {
+			//derived from the searchable columns
+			continue
+		}
+		ov, oldExists := old[key]
+		nv, newExists := lookupKey(after, key)
+		switch {
+		case !newExists:
+			*changes = append(*changes, &FieldChange{Path: path, Old: ov, Unset: true})
+		case !oldExists:
+			*changes = append(*changes, &FieldChange{Path: path, New: nv})
+		default:
+			od, oldIsDoc := asDocument(ov)
+			nd, newIsDoc := asDocument(nv)
+			if oldIsDoc && newIsDoc {
+				diffInto(changes, path+".", od, nd)
+			} else if !reflect.DeepEqual(ov, nv) {
+				*changes = append(*changes, &FieldChange{Path: path, Old: ov, New: nv})
+			}
+		}
+	}
+}
+
+func lookupKey(d bson.D, key string) (interface{}, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// applyChanges replays changes on document, creating intermediate documents as needed.
+func applyChanges(document bson.D, changes []*FieldChange) bson.D {
+	for _, change := range changes {
+		document = applyChange(document, strings.Split(change.Path, "."), change)
+	}
+	return document
+}
+
+func applyChange(document bson.D, path []string, change *FieldChange) bson.D {
+	key := path[0]
+	for i, e := range document {
+		if e.Key != key {
+			continue
+		}
+		if len(path) == 1 {
+			if change.Unset {
+				return append(document[:i:i], document[i+1:]...)
+			}
+			document[i].Value = cloneValue(change.New)
+			return document
+		}
+		nested, _ := asDocument(e.Value)
+		document[i].Value = applyChange(nested, path[1:], change)
+		return document
+	}
+	if change.Unset {
+		return document
+	}
+	if len(path) == 1 {
+		return append(document, bson.E{Key: key, Value: cloneValue(change.New)})
+	}
+	return append(document, bson.E{Key: key, Value: applyChange(bson.D{}, path[1:], change)})
+}
+
+// cloneValue copies nested documents so replaying never alters the history entries.
+func cloneValue(v interface{}) interface{} {
+	if doc, ok := asDocument(v); ok {
+		d := make(bson.D, len(doc))
+		for i, e := range doc {
+			d[i] = bson.E{Key: e.Key, Value: cloneValue(e.Value)}
+		}
+		return d
+	}
+	switch v := v.(type) {
+	case bson.A:
+		a := make(bson.A, len(v))
+		for i, e := range v {
+			a[i] = cloneValue(e)
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+// recordAsOf rebuilds a record from its history, nil when it did not exist at that time.
+func recordAsOf(entries []*HistoryEntry, at time.Time) *DataObjectResp {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	var document bson.D
+	exists := false
+	for _, entry := range entries {
+		if entry.Timestamp.After(at) {
+			break
+		}
+		if entry.Operation == HistoryOperationInsert {
+			document = bson.D{}
+		}
+		document = applyChanges(document, entry.Changes)
+		exists = !entry.Removed
+	}
+	if !exists {
+		return nil
+	}
+	dor := DataObjectResp(document)
+	return &dor
+}
+
+func (s *service) recordHistory(table *MetaTable, operation HistoryOperation, id ID, before *DataObjectResp) error {
+	if !table.History {
+		return nil
+	}
+	var old, current bson.D
+	if before != nil {
+		old = bson.D(*before)
+	}
+	removed := false
+	after, err := s.Repository.FindOne(table, id)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		removed = true
+	case err != nil:
+		return err
+	case s.trackColumns.isDeleted(table, after):
+		//soft deleted
+		removed = true
+		current = bson.D(*after)
+	default:
+		current = bson.D(*after)
+	}
+	return s.Repository.InsertHistory(table, &HistoryEntry{
+		RecordId:  id.ToObjectId(),
+		Operation: operation,
+		Actor:     s.actor(),
+		Timestamp: time.Now(),
+		Changes:   diffDocuments(old, current),
+		Removed:   removed,
+	})
+}
+
+// findBefore loads the record ahead of a write when the table keeps history or soft deletes,
+// a record flagged as deleted is not found unless value restores it.
+func (s *service) findBefore(table *MetaTable, id ID, value *DataObject) (*DataObjectResp, error) {
+	if !table.History && !s.trackColumns.softDelete(table) {
+		return nil, nil
+	}
+	existing, err := s.Repository.FindOne(table, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.trackColumns.isDeleted(table, existing) && !s.trackColumns.restores(table, value) {
+		return nil, mongo.ErrNoDocuments
+	}
+	return existing, nil
+}
+
+func (s *service) FindOneAsOf(table *MetaTable, id ID, at time.Time) (*DataObjectResp, error) {
+	entries, err := s.Repository.FindHistory(table, id)
+	if err != nil {
+		return nil, err
+	}
+	dor := recordAsOf(entries, at)
+	if dor == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	return dor, s.computeRecords(table, dor)
+}
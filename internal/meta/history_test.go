@@ -0,0 +1,127 @@
+package meta_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// historyRepository keeps records and history entries in maps.
+type historyRepository struct {
+	meta.Repository
+	records map[meta.ID]bson.D
+	history []*meta.HistoryEntry
+}
+
+func toDocument(value map[string]interface{}) bson.D {
+	keys := []string{}
+	for k := range value {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	d := bson.D{}
+	for _, k := range keys {
+		v := value[k]
+		if m, ok := v.(map[string]interface{}); ok {
+			v = toDocument(m)
+		}
+		d = append(d, bson.E{Key: k, Value: v})
+	}
+	return d
+}
+
+func (r *historyRepository) FindOne(table *meta.MetaTable, id meta.ID) (*meta.DataObjectResp, error) {
+	d, ok := r.records[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	dor := meta.DataObjectResp(d)
+	return &dor, nil
+}
+
+func (r *historyRepository) InsertOne(table *meta.MetaTable, value *meta.DataObject) (*meta.ID, error) {
+	id := meta.ID(primitive.NewObjectID())
+	r.records[id] = toDocument(*value)
+	return &id, nil
+}
+
+func (r *historyRepository) PatchOne(table *meta.MetaTable, id meta.ID, value *meta.DataObject) error {
+	m := bson.M(r.records[id].Map())
+	for k, v := range *value {
+		m[k] = v
+	}
+	r.records[id] = toDocument(m)
+	return nil
+}
+
+func (r *historyRepository) DeleteOne(table *meta.MetaTable, id meta.ID) error {
+	delete(r.records, id)
+	return nil
+}
+
+func (r *historyRepository) InsertHistory(table *meta.MetaTable, entry *meta.HistoryEntry) error {
+	r.history = append(r.history, entry)
+	return nil
+}
+
+func (r *historyRepository) FindHistory(table *meta.MetaTable, id meta.ID) ([]*meta.HistoryEntry, error) {
+	entries := []*meta.HistoryEntry{}
+	for _, entry := range r.history {
+		if entry.RecordId == id.ToObjectId() {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func TestHistoryRecordsFieldChanges(t *testing.T) {
+	store := &historyRepository{records: map[meta.ID]bson.D{}}
+	var repository meta.Repository = store
+	metaService := meta.NewService(&repository)
+	table := &meta.MetaTable{
+		Name:    "prices",
+		History: true,
+		Columns: []*meta.MetaColumn{
+			{Name: "name", DataType: meta.DataTypeString},
+			{Name: "price", DataType: meta.DataTypeJson, NestedColumns: []*meta.MetaColumn{
+				{Name: "currency", DataType: meta.DataTypeString},
+				{Name: "amount", DataType: meta.DataTypeDecimal},
+			}},
+		},
+	}
+
+	id, err := metaService.InsertOne(table, &meta.DataObject{
+		"name":  "Apple iPhone 13",
+		"price": map[string]interface{}{"currency": "CNY", "amount": 5999.0},
+	})
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	inserted := time.Now()
+	time.Sleep(time.Millisecond)
+
+	err = metaService.PatchOne(table, *id, &meta.DataObject{
+		"price": map[string]interface{}{"currency": "CNY", "amount": 5499.0},
+	})
+	assert.NoError(t, err)
+	entries, err := metaService.FindHistory(table, *id)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, meta.HistoryOperationUpdate, entries[1].Operation)
+	assert.Equal(t, []*meta.FieldChange{{Path: "price.amount", Old: decimal(t, "5999"), New: decimal(t, "5499")}}, entries[1].Changes)
+
+	assert.NoError(t, metaService.DeleteOne(table, *id))
+
+	dor, err := metaService.FindOneAsOf(table, *id, inserted)
+	assert.NoError(t, err)
+	price, _ := dor.Get("price")
+	assert.Equal(t, bson.D{{Key: "amount", Value: decimal(t, "5999")}, {Key: "currency", Value: "CNY"}}, price)
+
+	_, err = metaService.FindOneAsOf(table, *id, time.Now())
+	assert.Equal(t, mongo.ErrNoDocuments, err)
+}
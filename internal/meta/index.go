@@ -0,0 +1,192 @@
+package meta
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MetaIndex is an index of the collection of a table.
+type MetaIndex struct {
+	Name        string
+	ColumnNames []string //column paths, prefixed by - for a descending key
+	Unique      bool
+	Sparse      bool
+}
+
+// IndexChanges lists the indexes SyncIndexes created and dropped to match the meta table.
+type IndexChanges struct {
+	Table   string   `json:"table"`
+	Created []string `json:"created"`
+	Dropped []string `json:"dropped"`
+}
+
+func (c *IndexChanges) IsEmpty() bool {
+	return len(c.Created) == 0 && len(c.Dropped) == 0
+}
+
+func (i *MetaIndex) keys() bson.D {
+	keys := make(bson.D, 0, len(i.ColumnNames))
+	for _, name := range i.ColumnNames {
+		if name == SearchColumn {
+			keys = append(keys, bson.E{Key: name, Value: "text"})
+		} else if strings.HasPrefix(name, "-") {
+			keys = append(keys, bson.E{Key: name[1:], Value: -1})
+		} else {
+			keys = append(keys, bson.E{Key: name, Value: 1})
+		}
+	}
+	return keys
+}
+
+// validateIndexes checks that every index has a unique name and refers to stored columns.
+func validateIndexes(table *MetaTable) error {
+	names := map[string]bool{}
+	for _, index := range table.Indexes {
+		invalid := func(message string) error {
+			return errors.New("table:" + table.Name + ",index:" + index.Name + "," + message)
+		}
+		if len(index.Name) == 0 || index.Name == "_id_" {
+			return invalid("index name is required and should not be _id_")
+		}
+		if index.Name == searchIndex(table).Name {
+			return invalid("index name is reserved for the search index")
+		}
+		if names[index.Name] {
+			return invalid("duplicate index name")
+		}
+		names[index.Name] = true
+		if len(index.ColumnNames) == 0 {
+			return invalid("index has no column")
+		}
+		for _, name := range index.ColumnNames {
+			if _, err := queryColumn(table, strings.TrimPrefix(name, "-")); err != nil {
+				return invalid(err.(*ValidationError).Message)
+			}
+		}
+	}
+	return nil
+}
+
+// planIndexes compares the indexes of a collection with the ones of table, an index whose definition
+// changed is dropped and created again.
+func planIndexes(table *MetaTable, existing []*MetaIndex) (create []*MetaIndex, drop []string) {
+	current := map[string]*MetaIndex{}
+	for _, index := range existing {
+		current[index.Name] = index
+	}
+	wanted := map[string]bool{}
+	for _, index := range table.indexes() {
+		wanted[index.Name] = true
+		if c, ok := current[index.Name]; ok && reflect.DeepEqual(c.keys(), index.keys()) && c.Unique == index.Unique && c.Sparse == index.Sparse {
+			continue
+		}
+		if _, ok := current[index.Name]; ok {
+			drop = append(drop, index.Name)
+		}
+		create = append(create, index)
+	}
+	for _, index := range existing {
+		if !wanted[index.Name] {
+			drop = append(drop, index.Name)
+		}
+	}
+	sort.Strings(drop)
+	return create, drop
+}
+
+func changesOf(table *MetaTable, create []*MetaIndex, drop []string) *IndexChanges {
+	changes := &IndexChanges{Table: table.Name, Created: []string{}, Dropped: append([]string{}, drop...)}
+	for _, index := range create {
+		changes.Created = append(changes.Created, index.Name)
+	}
+	return changes
+}
+
+// mongoIndex is an entry of listIndexes.
+type mongoIndex struct {
+	Name   string `bson:"name"`
+	Key    bson.D `bson:"key"`
+	Unique bool   `bson:"unique"`
+	Sparse bool   `bson:"sparse"`
+}
+
+func (r *repository) SyncIndexes(table *MetaTable, dryRun bool) (*IndexChanges, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	indexes := db.Collection(table.Name).Indexes()
+	cursor, err := indexes.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var listed []*mongoIndex
+	if err := cursor.All(ctx, &listed); err != nil {
+		return nil, err
+	}
+	var existing []*MetaIndex
+	for _, mi := range listed {
+		if mi.Name == "_id_" {
+			continue
+		}
+		index := &MetaIndex{Name: mi.Name, Unique: mi.Unique, Sparse: mi.Sparse}
+		for _, e := range mi.Key {
+			if e.Key == "_fts" {
+				//text indexes list their terms as _fts and _ftsx, the only one is the search index
+				index.ColumnNames = []string{SearchColumn}
+				break
+			}
+			if toVersion(e.Value) < 0 {
+				index.ColumnNames = append(index.ColumnNames, "-"+e.Key)
+			} else {
+				index.ColumnNames = append(index.ColumnNames, e.Key)
+			}
+		}
+		existing = append(existing, index)
+	}
+	create, drop := planIndexes(table, existing)
+	if dryRun {
+		return changesOf(table, create, drop), nil
+	}
+	for _, name := range drop {
+		if _, err := indexes.DropOne(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	if len(create) > 0 {
+		models := make([]mongo.IndexModel, 0, len(create))
+		for _, index := range create {
+			opts := options.Index().SetName(index.Name).SetUnique(index.Unique).SetSparse(index.Sparse)
+			if index.Name == searchIndex(table).Name {
+				//the terms are tokenized already, no stemming nor stop words
+				opts.SetDefaultLanguage("none")
+			}
+			models = append(models, mongo.IndexModel{Keys: index.keys(), Options: opts})
+		}
+		if _, err := indexes.CreateMany(ctx, models); err != nil {
+			return nil, err
+		}
+	}
+	return changesOf(table, create, drop), nil
+}
+
+// SyncIndexes records the indexes of table, the memory repository does not enforce them.
+func (r *memoryRepository) SyncIndexes(table *MetaTable, dryRun bool) (*IndexChanges, error) {
+	defer r.lock()()
+	create, drop := planIndexes(table, r.store.indexes[table.Name])
+	if !dryRun {
+		indexes := make([]*MetaIndex, 0, len(table.Indexes))
+		for _, index := range table.indexes() {
+			copied := *index
+			indexes = append(indexes, &copied)
+		}
+		r.store.indexes[table.Name] = indexes
+	}
+	return changesOf(table, create, drop), nil
+}
@@ -0,0 +1,114 @@
+package meta_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// fixtureCarts reads the carts table of the yaml fixture, which has computed, array and nullable columns.
+func fixtureCarts(t *testing.T) *meta.MetaTable {
+	data, err := ioutil.ReadFile("../../tests/fixtures/meta/meta_tables.yml")
+	assert.NoError(t, err)
+	tables, err := meta.UnmarshalMetaTablesYAML(data)
+	assert.NoError(t, err)
+	return tables[1]
+}
+
+func TestSyncIndexes(t *testing.T) {
+	repository := meta.NewMemoryRepository()
+	carts := fixtureCarts(t)
+	carts.Indexes = []*meta.MetaIndex{
+		{Name: "carts_user", ColumnNames: []string{"userId", "-total"}},
+		{Name: "carts_tags", ColumnNames: []string{"tags"}},
+	}
+	assert.NoError(t, carts.Validate())
+
+	changes, err := repository.SyncIndexes(carts, true)
+	assert.NoError(t, err)
+	assert.Equal(t, &meta.IndexChanges{Table: "carts", Created: []string{"carts_user", "carts_tags"}, Dropped: []string{}}, changes)
+	changes, err = repository.SyncIndexes(carts, false)
+	assert.NoError(t, err)
+	assert.Len(t, changes.Created, 2)
+	changes, err = repository.SyncIndexes(carts, false)
+	assert.NoError(t, err)
+	assert.True(t, changes.IsEmpty())
+
+	carts.Indexes = []*meta.MetaIndex{{Name: "carts_user", ColumnNames: []string{"userId"}, Unique: true}}
+	changes, err = repository.SyncIndexes(carts, false)
+	assert.NoError(t, err)
+	assert.Equal(t, &meta.IndexChanges{Table: "carts", Created: []string{"carts_user"}, Dropped: []string{"carts_tags", "carts_user"}}, changes)
+}
+
+func TestValidateIndexes(t *testing.T) {
+	for _, indexes := range [][]*meta.MetaIndex{
+		{{Name: "", ColumnNames: []string{"userId"}}},
+		{{Name: "a", ColumnNames: []string{"userId"}}, {Name: "a", ColumnNames: []string{"tags"}}},
+		{{Name: "a"}},
+		{{Name: "a", ColumnNames: []string{"color"}}},
+		{{Name: "a", ColumnNames: []string{"-itemCount"}}},
+	} {
+		carts := fixtureCarts(t)
+		carts.Indexes = indexes
+		assert.Error(t, carts.Validate())
+	}
+}
+
+func TestDiffMetaTables(t *testing.T) {
+	from, to := fixtureCarts(t), fixtureCarts(t)
+	changes, err := meta.DiffMetaTables(from, to)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	to.Description = "shopping carts"
+	to.Columns = to.Columns[:len(to.Columns)-1]
+	quantity := to.ColumnByPath("cartItems.quantity")
+	quantity.DataType = meta.DataTypeLong
+	to.Columns = append(to.Columns, &meta.MetaColumn{Name: "coupon", DataType: meta.DataTypeString})
+	to.Indexes = []*meta.MetaIndex{{Name: "carts_user", ColumnNames: []string{"userId"}}}
+	changes, err = meta.DiffMetaTables(from, to)
+	assert.NoError(t, err)
+	assert.Equal(t, []*meta.MetaTableChange{
+		{Op: meta.ChangeChange, Path: "columns.cartItems.nestedColumns.quantity.dataType", From: "int", To: "long"},
+		{Op: meta.ChangeRemove, Path: "columns.note", From: changes[1].From},
+		{Op: meta.ChangeAdd, Path: "columns.coupon", To: map[string]interface{}{"name": "coupon", "dataType": "string"}},
+		{Op: meta.ChangeAdd, Path: "description", To: "shopping carts"},
+		{Op: meta.ChangeChange, Path: "indexes.carts_user.columnNames", From: []interface{}{"userId", "-total"}, To: []interface{}{"userId"}},
+	}, changes)
+	assert.Equal(t, "note", changes[1].From.(map[string]interface{})["name"])
+}
+
+func TestConvertFilter(t *testing.T) {
+	carts := fixtureCarts(t)
+	filter, err := meta.ConvertFilter(carts, map[string]interface{}{
+		"cartItems.quantity": map[string]interface{}{"$gte": float64(2), "$in": []interface{}{"2", float64(3)}},
+		"$or":                []interface{}{map[string]interface{}{"tags": "gift"}, map[string]interface{}{"note": map[string]interface{}{"$exists": true}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "$or", Value: bson.A{bson.D{{Key: "tags", Value: "gift"}}, bson.D{{Key: "note", Value: bson.D{{Key: "$exists", Value: true}}}}}},
+		{Key: "cartItems.quantity", Value: bson.D{{Key: "$gte", Value: int64(2)}, {Key: "$in", Value: bson.A{int64(2), int64(3)}}}},
+	}, filter)
+
+	for _, filter := range []map[string]interface{}{
+		{"color": "red"},
+		{"itemCount": float64(1)},
+		{"tags": map[string]interface{}{"$where": "true"}},
+		{"userId": "42"},
+		{"$or": []interface{}{}},
+		{"note": map[string]interface{}{"$regex": "("}},
+	} {
+		_, err := meta.ConvertFilter(carts, filter)
+		_, ok := err.(*meta.ValidationError)
+		assert.True(t, ok, "%v: %v", filter, err)
+	}
+
+	sort, err := meta.ConvertSort(carts, []string{"-total", "_id"})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "total", Value: -1}, {Key: "_id", Value: 1}}, sort)
+	_, err = meta.ConvertSort(carts, []string{"itemCount"})
+	assert.Error(t, err)
+}
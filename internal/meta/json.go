@@ -0,0 +1,169 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MarshalJSON renders the record as plain JSON in column order,
+// decimals as exact strings, object ids as hex strings and dates in RFC 3339.
+func (do DataObjectResp) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeJSONDocument(&buf, bson.D(do)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeJSONDocument(buf *bytes.Buffer, d bson.D) error {
+	buf.WriteByte('{')
+	for i, e := range d {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(e.Key)
+		if err != nil {
+			return err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		if err := writeJSONValue(buf, e.Value); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func writeJSONValue(buf *bytes.Buffer, v interface{}) error {
+	if d, ok := asDocument(v); ok {
+		return writeJSONDocument(buf, d)
+	}
+	var value interface{}
+	switch v := v.(type) {
+	case bson.A, []interface{}:
+		buf.WriteByte('[')
+		for i, item := range itemsOf(v) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONValue(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	case primitive.Decimal128:
+		value = v.String()
+	case primitive.ObjectID:
+		value = v.Hex()
+	case ID:
+		value = v.String()
+	case primitive.DateTime:
+		value = v.Time()
+	case primitive.Timestamp:
+		value = time.Unix(int64(v.T), 0)
+	default:
+		value = v
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+	return nil
+}
+
+// UnmarshalDataObjectJSON reads a record in the form written by MarshalJSON, converting every value
+// to the data type of its column. Keys without a column are dropped.
+func UnmarshalDataObjectJSON(table *MetaTable, data []byte) (*DataObject, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var m map[string]interface{}
+	if err := decoder.Decode(&m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, errors.New("table:" + table.Name + ",record should be an object")
+	}
+	values, err := jsonColumns(table, "", table.Columns, m)
+	if err != nil {
+		return nil, err
+	}
+	do := DataObject(values)
+	return &do, nil
+}
+
+func jsonColumns(table *MetaTable, prefix string, columns []*MetaColumn, m map[string]interface{}) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(m))
+	for _, c := range columns {
+		v, ok := m[c.Name]
+		if !ok {
+			continue
+		}
+		path := prefix + c.Name
+		if v == nil {
+			values[c.Name] = nil
+			continue
+		}
+		if !c.IsArray {
+			value, err := jsonValue(table, path, c, v)
+			if err != nil {
+				return nil, err
+			}
+			values[c.Name] = value
+			continue
+		}
+		items, ok := v.([]interface{})
+		if !ok {
+			return nil, &ValidationError{Table: table.Name, Column: path, Message: "value should be an array"}
+		}
+		converted := make([]interface{}, len(items))
+		for i, item := range items {
+			value, err := jsonValue(table, path+"."+strconv.Itoa(i), c, item)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = value
+		}
+		values[c.Name] = converted
+	}
+	return values, nil
+}
+
+func jsonValue(table *MetaTable, path string, c *MetaColumn, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if c.DataType == DataTypeJson {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, &ValidationError{Table: table.Name, Column: path, Message: "value should be an object"}
+		}
+		return jsonColumns(table, path+".", c.NestedColumns, m)
+	}
+	if n, ok := v.(json.Number); ok {
+		//decimals and strings keep the exact digits
+		switch c.DataType {
+		case DataTypeDecimal, DataTypeString:
+			v = n.String()
+		default:
+			if i, err := n.Int64(); err == nil {
+				v = i
+			} else if f, err := n.Float64(); err == nil {
+				v = f
+			}
+		}
+	}
+	value, err := ConvertValue(c.DataType, v)
+	if err != nil {
+		return nil, &ValidationError{Table: table.Name, Column: path, Message: err.Error()}
+	}
+	return value, nil
+}
@@ -0,0 +1,524 @@
+package meta
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryStore keeps every collection as marshalled documents, so stored records
+// decode exactly like the ones read from mongo and can never be altered by callers.
+type memoryStore struct {
+	mu          sync.Mutex
+	collections map[string][]bson.Raw
+	indexes     map[string][]*MetaIndex //by collection, see SyncIndexes
+	watchers    map[chan struct{}]struct{}
+}
+
+// memoryRepository is the offline Repository, used by tests and tools running without mongo.
+type memoryRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+func NewMemoryRepository() Repository {
+	return &memoryRepository{store: &memoryStore{
+		collections: map[string][]bson.Raw{},
+		indexes:     map[string][]*MetaIndex{},
+		watchers:    map[chan struct{}]struct{}{},
+	}}
+}
+
+// lock guards the store, calls made inside a transaction already hold it.
+func (r *memoryRepository) lock() func() {
+	if r.inTx {
+		return func() {}
+	}
+	r.store.mu.Lock()
+	return r.store.mu.Unlock
+}
+
+func (s *memoryStore) insert(name string, value interface{}) (primitive.ObjectID, error) {
+	b, err := bson.Marshal(value)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	raw := bson.Raw(b)
+	idValue := raw.Lookup("_id")
+	id, ok := idValue.ObjectIDOK()
+	if !ok && idValue.Type != 0 {
+		return primitive.NilObjectID, errors.New("collection:" + name + ",_id should be an ObjectId")
+	}
+	if !ok {
+		var d bson.D
+		if err := bson.Unmarshal(raw, &d); err != nil {
+			return primitive.NilObjectID, err
+		}
+		id = primitive.NewObjectID()
+		b, err = bson.Marshal(append(bson.D{{Key: "_id", Value: id}}, d...))
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+		raw = bson.Raw(b)
+	}
+	if s.indexOf(name, id) >= 0 {
+		return primitive.NilObjectID, mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key error collection: " + name}}}
+	}
+	s.collections[name] = append(s.collections[name], raw)
+	if name == table_name {
+		s.notify()
+	}
+	return id, nil
+}
+
+func (s *memoryStore) indexOf(name string, id primitive.ObjectID) int {
+	for i, raw := range s.collections[name] {
+		if rid, ok := raw.Lookup("_id").ObjectIDOK(); ok && rid == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *memoryStore) find(name string, id primitive.ObjectID) (bson.Raw, bool) {
+	i := s.indexOf(name, id)
+	if i < 0 {
+		return nil, false
+	}
+	return s.collections[name][i], true
+}
+
+func (s *memoryStore) replace(name string, id primitive.ObjectID, document bson.D) error {
+	i := s.indexOf(name, id)
+	if i < 0 {
+		return mongo.ErrNoDocuments
+	}
+	b, err := bson.Marshal(append(bson.D{{Key: "_id", Value: id}}, withoutKey(document, "_id")...))
+	if err != nil {
+		return err
+	}
+	s.collections[name][i] = b
+	return nil
+}
+
+func (s *memoryStore) remove(name string, id primitive.ObjectID) bool {
+	i := s.indexOf(name, id)
+	if i < 0 {
+		return false
+	}
+	docs := s.collections[name]
+	s.collections[name] = append(docs[:i:i], docs[i+1:]...)
+	return true
+}
+
+func (s *memoryStore) snapshot() map[string][]bson.Raw {
+	copied := make(map[string][]bson.Raw, len(s.collections))
+	for name, docs := range s.collections {
+		copied[name] = append([]bson.Raw(nil), docs...)
+	}
+	return copied
+}
+
+// notify wakes the watchers without blocking, they reload once the lock is released.
+func (s *memoryStore) notify() {
+	for ch := range s.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (r *memoryRepository) FindMetaTableById(id ID) (*MetaTable, error) {
+	defer r.lock()()
+	raw, ok := r.store.find(table_name, id.ToObjectId())
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	var table MetaTable
+	err := bson.Unmarshal(raw, &table)
+	return &table, err
+}
+
+func (r *memoryRepository) FindMetaTableByName(tableName string) (*MetaTable, error) {
+	defer r.lock()()
+	for _, raw := range r.store.collections[table_name] {
+		if name, _ := raw.Lookup("name").StringValueOK(); name == tableName {
+			var table MetaTable
+			err := bson.Unmarshal(raw, &table)
+			return &table, err
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *memoryRepository) FindAllMetaTables() ([]*MetaTable, error) {
+	defer r.lock()()
+	var tables []*MetaTable
+	for _, raw := range r.store.collections[table_name] {
+		var table MetaTable
+		if err := bson.Unmarshal(raw, &table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, &table)
+	}
+	return tables, nil
+}
+
+func (r *memoryRepository) InsertMetaTable(table *MetaTable) (*ID, error) {
+	defer r.lock()()
+	oid, err := r.store.insert(table_name, table)
+	if err != nil {
+		return nil, err
+	}
+	id := ID(oid)
+	return &id, nil
+}
+
+func (r *memoryRepository) InsertManyMetaTables(tables []*MetaTable) ([]*ID, error) {
+	defer r.lock()()
+	ids := make([]*ID, len(tables))
+	for i, table := range tables {
+		oid, err := r.store.insert(table_name, table)
+		if err != nil {
+			return nil, err
+		}
+		id := ID(oid)
+		ids[i] = &id
+	}
+	return ids, nil
+}
+
+func (r *memoryRepository) UpdateMetaTable(table *MetaTable) error {
+	defer r.lock()()
+	b, err := bson.Marshal(table)
+	if err != nil {
+		return err
+	}
+	var document bson.D
+	if err := bson.Unmarshal(b, &document); err != nil {
+		return err
+	}
+	if err := r.store.replace(table_name, table.Id, document); err != nil {
+		return err
+	}
+	r.store.notify()
+	return nil
+}
+
+func (r *memoryRepository) DeleteMetaTable(id ID) error {
+	defer r.lock()()
+	if !r.store.remove(table_name, id.ToObjectId()) {
+		return mongo.ErrNoDocuments
+	}
+	r.store.notify()
+	return nil
+}
+
+func (r *memoryRepository) Find(table *MetaTable, query *Query) ([]*DataObjectResp, error) {
+	dors, err := r.FindAll(table)
+	if err != nil {
+		return nil, err
+	}
+	return findRecords(dors, query)
+}
+
+func (r *memoryRepository) Count(table *MetaTable, filter bson.D) (int64, error) {
+	dors, err := r.Find(table, &Query{Filter: filter})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(dors)), nil
+}
+
+func (r *memoryRepository) FindAll(table *MetaTable) ([]*DataObjectResp, error) {
+	defer r.lock()()
+	result := []*DataObjectResp{}
+	for _, raw := range r.store.collections[table.Name] {
+		var dor DataObjectResp
+		if err := bson.Unmarshal(raw, &dor); err != nil {
+			return nil, err
+		}
+		result = append(result, &dor)
+	}
+	return result, nil
+}
+
+func (r *memoryRepository) FindOne(table *MetaTable, id ID) (*DataObjectResp, error) {
+	defer r.lock()()
+	raw, ok := r.store.find(table.Name, id.ToObjectId())
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	var dor DataObjectResp
+	err := bson.Unmarshal(raw, &dor)
+	return &dor, err
+}
+
+func (r *memoryRepository) InsertOne(table *MetaTable, do *DataObject) (*ID, error) {
+	defer r.lock()()
+	document, err := assemblyDocument(table, do)
+	if err != nil {
+		return nil, err
+	}
+	oid, err := r.store.insert(table.Name, append(document, bson.E{Key: VersionColumn, Value: int64(1)}))
+	if err != nil {
+		return nil, err
+	}
+	id := ID(oid)
+	return &id, nil
+}
+
+func (r *memoryRepository) InsertMany(table *MetaTable, values []*DataObject) ([]*ID, error) {
+	defer r.lock()()
+	ids := make([]*ID, len(values))
+	for i, value := range values {
+		document := bson.M{}
+		for k, v := range *value {
+			document[k] = v
+		}
+		document[VersionColumn] = int64(1)
+		oid, err := r.store.insert(table.Name, document)
+		if err != nil {
+			return nil, err
+		}
+		id := ID(oid)
+		ids[i] = &id
+	}
+	return ids, nil
+}
+
+func (r *memoryRepository) UpdateOne(table *MetaTable, id ID, do *DataObject) error {
+	defer r.lock()()
+	raw, ok := r.store.find(table.Name, id.ToObjectId())
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	return r.replace(table, id, do, rawVersion(raw))
+}
+
+func (r *memoryRepository) UpdateOneWithVersion(table *MetaTable, id ID, do *DataObject, version int64) error {
+	defer r.lock()()
+	if err := r.checkVersion(table, id, version); err != nil {
+		return err
+	}
+	return r.replace(table, id, do, version)
+}
+
+func (r *memoryRepository) replace(table *MetaTable, id ID, do *DataObject, version int64) error {
+	document, err := assemblyDocument(table, do)
+	if err != nil {
+		return err
+	}
+	return r.store.replace(table.Name, id.ToObjectId(), append(document, bson.E{Key: VersionColumn, Value: version + 1}))
+}
+
+func (r *memoryRepository) PatchOne(table *MetaTable, id ID, do *DataObject) error {
+	defer r.lock()()
+	return r.patch(table, id, do)
+}
+
+func (r *memoryRepository) PatchOneWithVersion(table *MetaTable, id ID, do *DataObject, version int64) error {
+	defer r.lock()()
+	if err := r.checkVersion(table, id, version); err != nil {
+		return err
+	}
+	return r.patch(table, id, do)
+}
+
+func (r *memoryRepository) patch(table *MetaTable, id ID, do *DataObject) error {
+	raw, ok := r.store.find(table.Name, id.ToObjectId())
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	set, err := assemblyDocument(table, do)
+	if err != nil {
+		return err
+	}
+	var document bson.D
+	if err := bson.Unmarshal(raw, &document); err != nil {
+		return err
+	}
+	version := rawVersion(raw)
+	set = append(withoutKey(set, "_id"), bson.E{Key: VersionColumn, Value: version + 1})
+	for _, e := range set {
+		document = setKey(document, e.Key, e.Value)
+	}
+	return r.store.replace(table.Name, id.ToObjectId(), document)
+}
+
+func (r *memoryRepository) checkVersion(table *MetaTable, id ID, version int64) error {
+	raw, ok := r.store.find(table.Name, id.ToObjectId())
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	if actual := rawVersion(raw); actual != version {
+		return &ConflictError{Table: table.Name, Id: id, Expected: version, Actual: actual}
+	}
+	return nil
+}
+
+func rawVersion(raw bson.Raw) int64 {
+	version, _ := raw.Lookup(VersionColumn).AsInt64OK()
+	return version
+}
+
+func setKey(d bson.D, key string, value interface{}) bson.D {
+	for i, e := range d {
+		if e.Key == key {
+			d[i].Value = value
+			return d
+		}
+	}
+	return append(d, bson.E{Key: key, Value: value})
+}
+
+func (r *memoryRepository) DeleteOne(table *MetaTable, id ID) error {
+	defer r.lock()()
+	if !r.store.remove(table.Name, id.ToObjectId()) {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *memoryRepository) InsertHistory(table *MetaTable, entry *HistoryEntry) error {
+	defer r.lock()()
+	_, err := r.store.insert(historyTableName(table), entry)
+	return err
+}
+
+func (r *memoryRepository) FindHistory(table *MetaTable, id ID) ([]*HistoryEntry, error) {
+	defer r.lock()()
+	entries := []*HistoryEntry{}
+	for _, raw := range r.store.collections[historyTableName(table)] {
+		var entry HistoryEntry
+		if err := bson.Unmarshal(raw, &entry); err != nil {
+			return nil, err
+		}
+		if entry.RecordId == id.ToObjectId() {
+			entries = append(entries, &entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	return entries, nil
+}
+
+func (r *memoryRepository) FindDictionaryById(id ID) (*Dictionary, error) {
+	defer r.lock()()
+	raw, ok := r.store.find(dictionary_table_name, id.ToObjectId())
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	var dictionary Dictionary
+	err := bson.Unmarshal(raw, &dictionary)
+	return &dictionary, err
+}
+
+func (r *memoryRepository) FindDictionary(group, name string) (*Dictionary, error) {
+	dictionaries, err := r.FindDictionariesByGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	for _, dictionary := range dictionaries {
+		if dictionary.Name == name {
+			return dictionary, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *memoryRepository) FindDictionariesByGroup(group string) ([]*Dictionary, error) {
+	defer r.lock()()
+	dictionaries := []*Dictionary{}
+	for _, raw := range r.store.collections[dictionary_table_name] {
+		if g, _ := raw.Lookup("group").StringValueOK(); g != group {
+			continue
+		}
+		var dictionary Dictionary
+		if err := bson.Unmarshal(raw, &dictionary); err != nil {
+			return nil, err
+		}
+		dictionaries = append(dictionaries, &dictionary)
+	}
+	sortDictionaries(dictionaries)
+	return dictionaries, nil
+}
+
+func (r *memoryRepository) InsertDictionary(dictionary *Dictionary) (*ID, error) {
+	defer r.lock()()
+	oid, err := r.store.insert(dictionary_table_name, dictionary)
+	if err != nil {
+		return nil, err
+	}
+	id := ID(oid)
+	return &id, nil
+}
+
+func (r *memoryRepository) UpdateDictionary(dictionary *Dictionary) error {
+	defer r.lock()()
+	b, err := bson.Marshal(dictionary)
+	if err != nil {
+		return err
+	}
+	var document bson.D
+	if err := bson.Unmarshal(b, &document); err != nil {
+		return err
+	}
+	return r.store.replace(dictionary_table_name, dictionary.Id, document)
+}
+
+func (r *memoryRepository) DeleteDictionary(id ID) error {
+	defer r.lock()()
+	if !r.store.remove(dictionary_table_name, id.ToObjectId()) {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *memoryRepository) WatchMetaTables(ctx context.Context, onChange func()) error {
+	ch := make(chan struct{}, 1)
+	r.store.mu.Lock()
+	r.store.watchers[ch] = struct{}{}
+	r.store.mu.Unlock()
+	defer func() {
+		r.store.mu.Lock()
+		delete(r.store.watchers, ch)
+		r.store.mu.Unlock()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ch:
+			onChange()
+		}
+	}
+}
+
+// RunTransaction holds the store for the duration of fn and restores the previous
+// state when fn fails, nested transactions join the outer one.
+func (r *memoryRepository) RunTransaction(ctx context.Context, fn func(tx Repository) error) error {
+	if r.inTx {
+		return fn(r)
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	snapshot := r.store.snapshot()
+	err := fn(&memoryRepository{store: r.store, inTx: true})
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		r.store.collections = snapshot
+		r.store.notify()
+		return err
+	}
+	return nil
+}
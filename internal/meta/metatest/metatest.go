@@ -0,0 +1,40 @@
+// Package metatest sets up meta services over the memory repository for the tests of the packages
+// built on meta.
+package metatest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+// Fixture is the path of the meta tables shared by the tests, brands and carts.
+var Fixture = fixture()
+
+func fixture() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "../../../tests/fixtures/meta/meta_tables.yml")
+}
+
+// NewService returns a service over a memory repository holding the meta tables of Fixture,
+// resolved through the returned registry, and the currencies dictionary with CNY.
+func NewService(t testing.TB) (meta.MetaService, *meta.Registry) {
+	t.Helper()
+	data, err := ioutil.ReadFile(Fixture)
+	assert.NoError(t, err)
+	tables, err := meta.UnmarshalMetaTablesYAML(data)
+	assert.NoError(t, err)
+	repository := meta.NewMemoryRepository()
+	registry := meta.NewRegistry(repository)
+	service := meta.NewService(&repository, meta.WithRegistry(registry), meta.WithDictionaryCache(meta.NewDictionaryCache(repository, 0)))
+	_, err = service.InsertManyMetaTables(tables)
+	assert.NoError(t, err)
+	assert.NoError(t, registry.Load())
+	_, err = service.InsertDictionary(&meta.Dictionary{Group: "currencies", Name: "CNY", DataType: meta.DataTypeString})
+	assert.NoError(t, err)
+	return service, registry
+}
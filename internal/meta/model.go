@@ -249,10 +249,7 @@ func (do *DataObject) Get(key string) (interface{}, bool) {
 
 //dataObjectResp get
 func (do *DataObjectResp) Get(key string) (interface{}, bool) {
-	v := bson.D(*do)
-
-	value, ok := v.Map()[key]
-	return value, ok
+	return lookupKey(bson.D(*do), key)
 }
 func (do *DataObjectResp) ToJson() (string, error) {
 
@@ -281,8 +278,14 @@ type MetaTable struct {
 	PrimaryKey    *PrimaryKey
 	RelationShips []*RelationShip
 	Indexes       []*MetaIndex
+	History       bool //record every change into the <name>_history collection
 	Track
 }
+//Column finds a top level column by name
+func (t *MetaTable) Column(name string) *MetaColumn {
+	return findColumn(t.Columns, name)
+}
+
 type MetaColumn struct {
 	Name          string
 	Description   string
@@ -297,6 +300,9 @@ type MetaColumn struct {
 	DefaultValue  interface{}
 	NestedColumns []*MetaColumn
 	Attributes    []*Attribute
+	Dictionary    string //dictionary group holding the allowed values
+	Expression    string //computed from the other columns, see computed.go
+	IsVirtual     bool   //computed on read instead of stored
 }
 type PrimaryKey struct {
 	Name            string
@@ -317,8 +323,6 @@ func NewObjectIdPrimaryKey(name string, columnNames []string) *PrimaryKey {
 	}
 }
 
-type MetaIndex struct {
-}
 type RelationShip struct {
 	Name      string
 	Type      RelationShipType
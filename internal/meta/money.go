@@ -0,0 +1,409 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RoundingMode int8
+
+const (
+	RoundHalfUp RoundingMode = iota //away from zero on ties, the default
+	RoundHalfEven
+	RoundDown //towards zero
+	RoundUp   //away from zero
+	RoundFloor
+	RoundCeiling
+)
+
+func (m RoundingMode) String() string {
+	switch m {
+	case RoundHalfEven:
+		return "halfEven"
+	case RoundDown:
+		return "down"
+	case RoundUp:
+		return "up"
+	case RoundFloor:
+		return "floor"
+	case RoundCeiling:
+		return "ceiling"
+	default:
+		return "halfUp"
+	}
+}
+
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	for m := RoundHalfUp; m <= RoundCeiling; m++ {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return RoundHalfUp, errors.New("unknown rounding mode " + s)
+}
+
+// RoundingMode returns the rounding mode attribute of the column, RoundHalfUp when not set.
+func (c *MetaColumn) RoundingMode() RoundingMode {
+	mode, _ := ParseRoundingMode(c.stringAttribute(AttributeRoundingMode))
+	return mode
+}
+
+// ParseDecimal parses s exactly and rounds it to scale decimals.
+func ParseDecimal(s string, scale int, mode RoundingMode) (primitive.Decimal128, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return primitive.Decimal128{}, typeError(DataTypeDecimal, s)
+	}
+	return ratToDecimal(r, scale, mode)
+}
+
+// RoundDecimal rounds d to scale decimals, the result always has exactly scale decimals.
+func RoundDecimal(d primitive.Decimal128, scale int, mode RoundingMode) (primitive.Decimal128, error) {
+	r, err := toRat(d)
+	if err != nil {
+		return primitive.Decimal128{}, err
+	}
+	return ratToDecimal(r, scale, mode)
+}
+
+func AddDecimal(a, b primitive.Decimal128) (primitive.Decimal128, error) {
+	return decimalOp(a, b, maxInt(decimalScale(a), decimalScale(b)), func(x, y *big.Rat) *big.Rat { return x.Add(x, y) })
+}
+
+func SubDecimal(a, b primitive.Decimal128) (primitive.Decimal128, error) {
+	return decimalOp(a, b, maxInt(decimalScale(a), decimalScale(b)), func(x, y *big.Rat) *big.Rat { return x.Sub(x, y) })
+}
+
+// MulDecimal multiplies exactly, the product carries the decimals of both operands.
+func MulDecimal(a, b primitive.Decimal128) (primitive.Decimal128, error) {
+	return decimalOp(a, b, decimalScale(a)+decimalScale(b), func(x, y *big.Rat) *big.Rat { return x.Mul(x, y) })
+}
+
+// DivDecimal divides a by b rounding the quotient to scale decimals.
+func DivDecimal(a, b primitive.Decimal128, scale int, mode RoundingMode) (primitive.Decimal128, error) {
+	x, err := toRat(a)
+	if err != nil {
+		return primitive.Decimal128{}, err
+	}
+	y, err := toRat(b)
+	if err != nil {
+		return primitive.Decimal128{}, err
+	}
+	if y.Sign() == 0 {
+		return primitive.Decimal128{}, errors.New("division by zero")
+	}
+	return ratToDecimal(x.Quo(x, y), scale, mode)
+}
+
+// CompareDecimal returns -1, 0 or 1 as a is less than, equal to or greater than b.
+func CompareDecimal(a, b primitive.Decimal128) (int, error) {
+	x, err := toRat(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := toRat(b)
+	if err != nil {
+		return 0, err
+	}
+	return x.Cmp(y), nil
+}
+
+func decimalOp(a, b primitive.Decimal128, scale int, op func(x, y *big.Rat) *big.Rat) (primitive.Decimal128, error) {
+	x, err := toRat(a)
+	if err != nil {
+		return primitive.Decimal128{}, err
+	}
+	y, err := toRat(b)
+	if err != nil {
+		return primitive.Decimal128{}, err
+	}
+	return ratToDecimal(op(x, y), scale, RoundHalfUp)
+}
+
+// Money is an amount in a currency, the shape of the {currency, amount} columns.
+type Money struct {
+	Currency string               `bson:"currency" json:"currency"`
+	Amount   primitive.Decimal128 `bson:"amount" json:"amount"`
+}
+
+var ErrCurrencyMismatch = errors.New("currencies do not match")
+
+func NewMoney(currency string, amount string, scale int) (Money, error) {
+	d, err := ParseDecimal(amount, scale, RoundHalfUp)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Currency: currency, Amount: d}, nil
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	d, err := AddDecimal(m.Amount, o.Amount)
+	return Money{Currency: m.Currency, Amount: d}, err
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	d, err := SubDecimal(m.Amount, o.Amount)
+	return Money{Currency: m.Currency, Amount: d}, err
+}
+
+// Mul multiplies the amount by quantity keeping the scale of the amount.
+func (m Money) Mul(quantity int64) (Money, error) {
+	r, err := toRat(m.Amount)
+	if err != nil {
+		return Money{}, err
+	}
+	d, err := ratToDecimal(r.Mul(r, new(big.Rat).SetInt64(quantity)), decimalScale(m.Amount), RoundHalfUp)
+	return Money{Currency: m.Currency, Amount: d}, err
+}
+
+func (m Money) String() string {
+	return m.Amount.String() + " " + m.Currency
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// isMoneyColumn tells json columns shaped as {currency, amount}.
+func isMoneyColumn(c *MetaColumn) bool {
+	if c.DataType != DataTypeJson || c.IsArray {
+		return false
+	}
+	currency, amount := findColumn(c.NestedColumns, "currency"), findColumn(c.NestedColumns, "amount")
+	return currency != nil && currency.DataType == DataTypeString && amount != nil && amount.DataType == DataTypeDecimal
+}
+
+// normalizeDecimals converts the values of decimal columns to Decimal128 with the declared scale,
+// and checks the currency of money columns.
+func (s *service) normalizeDecimals(table *MetaTable, prefix string, columns []*MetaColumn, values map[string]interface{}) error {
+	for _, c := range columns {
+		v, ok := values[c.Name]
+		if !ok || v == nil {
+			continue
+		}
+		path := prefix + c.Name
+		switch {
+		case c.DataType == DataTypeDecimal && !c.IsComputed():
+			var err error
+			if c.IsArray {
+				var items []interface{}
+				if items, err = ConvertValues(DataTypeUnknown, v); err == nil {
+					for i, item := range items {
+						if items[i], err = columnDecimal(c, item); err != nil {
+							break
+						}
+					}
+					values[c.Name] = items
+				}
+			} else {
+				values[c.Name], err = columnDecimal(c, v)
+			}
+			if err != nil {
+				return &ValidationError{Table: table.Name, Column: path, Message: err.Error()}
+			}
+		case len(c.NestedColumns) > 0:
+			switch v := v.(type) {
+			case map[string]interface{}:
+				if isMoneyColumn(c) {
+					if err := s.validateCurrency(table, path+".currency", c, v["currency"]); err != nil {
+						return err
+					}
+				}
+				if err := s.normalizeDecimals(table, path+".", c.NestedColumns, v); err != nil {
+					return err
+				}
+			case []interface{}:
+				for i, item := range v {
+					if m, ok := item.(map[string]interface{}); ok {
+						if err := s.normalizeDecimals(table, path+"."+strconv.Itoa(i)+".", c.NestedColumns, m); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateCurrency checks the code format, and the currency dictionary when the column declares none.
+func (s *service) validateCurrency(table *MetaTable, path string, c *MetaColumn, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	code, ok := v.(string)
+	if !ok || !currencyCode.MatchString(code) {
+		return &ValidationError{Table: table.Name, Column: path, Message: fmt.Sprintf("value %v is not a currency code", v)}
+	}
+	if len(findColumn(c.NestedColumns, "currency").Dictionary) > 0 || len(s.currencies) == 0 {
+		//dictionary columns are checked by validateEnums
+		return nil
+	}
+	allowed, err := s.dictionaryByName(s.currencies)
+	if err != nil {
+		return err
+	}
+	if _, ok := allowed[code]; !ok {
+		return &ValidationError{Table: table.Name, Column: path, Message: "value " + code + " is not in dictionary " + s.currencies}
+	}
+	return nil
+}
+
+// columnDecimal converts v with the scale, the rounding mode and the total digits of the column.
+func columnDecimal(c *MetaColumn, v interface{}) (primitive.Decimal128, error) {
+	r, err := toRat(v)
+	if err != nil {
+		return primitive.Decimal128{}, typeError(DataTypeDecimal, v)
+	}
+	scale := c.scale()
+	if scale == 0 {
+		//no declared scale, keep the value as is
+		scale = maxInt(ratScale(r), 0)
+	}
+	d, err := ratToDecimal(r, scale, c.RoundingMode())
+	if err != nil {
+		return d, err
+	}
+	if c.Length > 0 {
+		bi, _, _ := d.BigInt()
+		if digits := len(strings.TrimPrefix(bi.String(), "-")); digits > c.Length {
+			return d, fmt.Errorf("value %v exceeds %d digits", v, c.Length)
+		}
+	}
+	return d, nil
+}
+
+// toRat converts a number exactly, floats go through their shortest representation.
+func toRat(v interface{}) (*big.Rat, error) {
+	switch v := v.(type) {
+	case *big.Rat:
+		return new(big.Rat).Set(v), nil
+	case primitive.Decimal128:
+		bi, exp, err := v.BigInt()
+		if err != nil {
+			return nil, typeError(DataTypeDecimal, v)
+		}
+		r := new(big.Rat).SetInt(bi)
+		pow := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exp))), nil))
+		if exp < 0 {
+			return r.Quo(r, pow), nil
+		}
+		return r.Mul(r, pow), nil
+	case float32:
+		return toRat(strconv.FormatFloat(float64(v), 'f', -1, 32))
+	case float64:
+		return toRat(strconv.FormatFloat(v, 'f', -1, 64))
+	case string:
+		if r, ok := new(big.Rat).SetString(strings.TrimSpace(v)); ok {
+			return r, nil
+		}
+	default:
+		if i, err := toInt64(DataTypeLong, v); err == nil {
+			return new(big.Rat).SetInt64(i.(int64)), nil
+		}
+	}
+	return nil, typeError(DataTypeDecimal, v)
+}
+
+// ratToDecimal rounds r to scale decimals.
+func ratToDecimal(r *big.Rat, scale int, mode RoundingMode) (primitive.Decimal128, error) {
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow))
+	d, ok := primitive.ParseDecimal128FromBigInt(roundRat(scaled, mode), -scale)
+	if !ok {
+		return d, errors.New("value " + r.RatString() + " is out of the decimal range")
+	}
+	return d, nil
+}
+
+// roundRat rounds r to an integer.
+func roundRat(r *big.Rat, mode RoundingMode) *big.Int {
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if rem.Sign() == 0 {
+		return q
+	}
+	sign := r.Sign()
+	away := false
+	switch mode {
+	case RoundUp:
+		away = true
+	case RoundFloor:
+		away = sign < 0
+	case RoundCeiling:
+		away = sign > 0
+	case RoundHalfUp, RoundHalfEven:
+		//compare twice the remainder to the denominator
+		cmp := new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(r.Denom())
+		away = cmp > 0 || cmp == 0 && (mode == RoundHalfUp || q.Bit(0) == 1)
+	}
+	if away {
+		q.Add(q, big.NewInt(int64(sign)))
+	}
+	return q
+}
+
+// ratString formats r exactly when it has a finite decimal expansion.
+func ratString(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	if s := ratScale(r); s >= 0 {
+		return r.FloatString(s)
+	}
+	return r.FloatString(10)
+}
+
+// ratScale returns the number of decimals of r, -1 when they are infinite.
+func ratScale(r *big.Rat) int {
+	denom := new(big.Int).Set(r.Denom())
+	twos, fives := 0, 0
+	for denom.Bit(0) == 0 && denom.Cmp(big.NewInt(1)) > 0 {
+		denom.Rsh(denom, 1)
+		twos++
+	}
+	five, m := big.NewInt(5), new(big.Int)
+	for denom.Cmp(big.NewInt(1)) > 0 {
+		q, _ := new(big.Int).QuoRem(denom, five, m)
+		if m.Sign() != 0 {
+			return -1
+		}
+		denom = q
+		fives++
+	}
+	if twos > fives {
+		return twos
+	}
+	return fives
+}
+
+func decimalScale(d primitive.Decimal128) int {
+	_, exp, err := d.BigInt()
+	if err != nil || exp >= 0 {
+		return 0
+	}
+	return -exp
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
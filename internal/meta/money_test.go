@@ -0,0 +1,134 @@
+package meta_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseDecimalRounds(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		mode     meta.RoundingMode
+		expected string
+	}{
+		{"1.005", meta.RoundHalfUp, "1.01"},
+		{"-1.005", meta.RoundHalfUp, "-1.01"},
+		{"1.005", meta.RoundHalfEven, "1.00"},
+		{"1.015", meta.RoundHalfEven, "1.02"},
+		{"1.009", meta.RoundDown, "1.00"},
+		{"1.001", meta.RoundUp, "1.01"},
+		{"-1.001", meta.RoundFloor, "-1.01"},
+		{"-1.009", meta.RoundCeiling, "-1.00"},
+		{"19.9", meta.RoundHalfUp, "19.90"},
+	} {
+		d, err := meta.ParseDecimal(c.value, 2, c.mode)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, d.String(), c.value+" "+c.mode.String())
+	}
+	_, err := meta.ParseDecimal("abc", 2, meta.RoundHalfUp)
+	assert.Error(t, err)
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	a, b := decimal(t, "0.10"), decimal(t, "0.2")
+	sum, err := meta.AddDecimal(a, b)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.30", sum.String())
+	difference, err := meta.SubDecimal(a, b)
+	assert.NoError(t, err)
+	assert.Equal(t, "-0.10", difference.String())
+	product, err := meta.MulDecimal(decimal(t, "19.90"), decimal(t, "3"))
+	assert.NoError(t, err)
+	assert.Equal(t, "59.70", product.String())
+	quotient, err := meta.DivDecimal(decimal(t, "10.00"), decimal(t, "3"), 2, meta.RoundHalfUp)
+	assert.NoError(t, err)
+	assert.Equal(t, "3.33", quotient.String())
+	_, err = meta.DivDecimal(a, decimal(t, "0"), 2, meta.RoundHalfUp)
+	assert.Error(t, err)
+	cmp, err := meta.CompareDecimal(decimal(t, "1.10"), decimal(t, "1.1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cmp)
+
+	price, err := meta.NewMoney("CNY", "19.9", 2)
+	assert.NoError(t, err)
+	total, err := price.Mul(3)
+	assert.NoError(t, err)
+	assert.Equal(t, "59.70 CNY", total.String())
+	_, err = total.Add(meta.Money{Currency: "USD", Amount: decimal(t, "1.00")})
+	assert.Equal(t, meta.ErrCurrencyMismatch, err)
+	j, err := json.Marshal(total)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"currency":"CNY","amount":"59.70"}`, string(j))
+}
+
+func moneyTable() *meta.MetaTable {
+	return &meta.MetaTable{
+		Name: "offers",
+		Columns: []*meta.MetaColumn{
+			{Name: "_id", DataType: meta.DataTypeObjectId},
+			{Name: "price", DataType: meta.DataTypeJson, NestedColumns: []*meta.MetaColumn{
+				{Name: "currency", DataType: meta.DataTypeString},
+				{Name: "amount", DataType: meta.DataTypeDecimal, Length: 6, Precision: 2},
+			}},
+			{Name: "discount", DataType: meta.DataTypeDecimal, Length: 19, Precision: 2, Attributes: []*meta.Attribute{
+				meta.NewAttribute(meta.AttributeRoundingMode, meta.RoundDown.String()),
+			}},
+		},
+	}
+}
+
+func TestDecimalColumnsAreStoredWithTheirScale(t *testing.T) {
+	repository := meta.NewMemoryRepository()
+	metaService := meta.NewService(&repository, meta.WithCurrencies("currencies"), meta.WithDictionaryCache(meta.NewDictionaryCache(repository, 0)))
+	_, err := metaService.InsertDictionary(&meta.Dictionary{Group: "currencies", Name: "CNY", DataType: meta.DataTypeString})
+	assert.NoError(t, err)
+	table := moneyTable()
+
+	id, err := metaService.InsertOne(table, &meta.DataObject{
+		"price":    map[string]interface{}{"currency": "CNY", "amount": 0.1 + 0.2},
+		"discount": "1.999",
+	})
+	assert.NoError(t, err)
+	offer, err := metaService.FindOne(table, *id)
+	assert.NoError(t, err)
+	discount, _ := offer.Get("discount")
+	assert.Equal(t, decimal(t, "1.99"), discount)
+	j, err := json.Marshal(offer)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"_id":"`+id.String()+`","price":{"currency":"CNY","amount":"0.30"},"discount":"1.99","_version":1}`, string(j))
+
+	_, err = metaService.InsertOne(table, &meta.DataObject{"price": map[string]interface{}{"currency": "CNY", "amount": "12345.67"}})
+	validation, ok := err.(*meta.ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, "price.amount", validation.Column)
+
+	_, err = metaService.InsertOne(table, &meta.DataObject{"price": map[string]interface{}{"currency": "USD", "amount": "1"}})
+	validation, ok = err.(*meta.ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, "price.currency", validation.Column)
+
+	_, err = metaService.InsertOne(table, &meta.DataObject{"price": map[string]interface{}{"currency": "cny", "amount": "1"}})
+	_, ok = err.(*meta.ValidationError)
+	assert.True(t, ok)
+}
+
+func TestRoundingModeAttributeIsValidated(t *testing.T) {
+	assert.Error(t, meta.NewAttribute(meta.AttributeRoundingMode, "nearest").Validate())
+	assert.NoError(t, meta.NewAttribute(meta.AttributeRoundingMode, "halfEven").Validate())
+	assert.Error(t, meta.NewAttribute(meta.AttributeRoundingMode, nil).Validate())
+}
+
+func TestMarshalJSONKeepsColumnOrder(t *testing.T) {
+	id := primitive.NewObjectID()
+	j, err := json.Marshal(meta.DataObjectResp{
+		{Key: "_id", Value: id},
+		{Key: "tags", Value: bson.A{"a", meta.DataObjectResp{{Key: "z", Value: int32(1)}, {Key: "a", Value: decimal(t, "2.50")}}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"_id":"`+id.Hex()+`","tags":["a",{"z":1,"a":"2.50"}]}`, string(j))
+}
@@ -0,0 +1,418 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Query selects a page of records, Filter and Sort refer to columns by path: price.amount, cartItems.quantity.
+type Query struct {
+	//Filter is a mongo query document, the memory repository understands
+	//$eq $ne $gt $gte $lt $lte $in $nin $exists $regex $and $or $nor
+	Filter bson.D
+	Sort   bson.D //path to 1 for ascending or -1 for descending
+	Skip   int64
+	Limit  int64 //0 returns every matching record
+}
+
+// ColumnByPath resolves a dotted path through json columns, array indexes are skipped: cartItems.0.price.amount.
+func (t *MetaTable) ColumnByPath(path string) *MetaColumn {
+	columns := t.Columns
+	var c *MetaColumn
+	for _, part := range strings.Split(path, ".") {
+		if c != nil && c.IsArray && isIndex(part) {
+			continue
+		}
+		if c = findColumn(columns, part); c == nil {
+			return nil
+		}
+		columns = c.NestedColumns
+	}
+	return c
+}
+
+func isIndex(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// findRecords runs a query over decoded records, the way mongo would.
+func findRecords(dors []*DataObjectResp, query *Query) ([]*DataObjectResp, error) {
+	if query == nil {
+		query = &Query{}
+	}
+	matched := []*DataObjectResp{}
+	for _, dor := range dors {
+		ok, err := matchFilter(bson.D(*dor), query.Filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, dor)
+		}
+	}
+	if len(query.Sort) > 0 {
+		sort.SliceStable(matched, func(i, j int) bool {
+			for _, e := range query.Sort {
+				c := compareSortValues(pathValue(bson.D(*matched[i]), e.Key), pathValue(bson.D(*matched[j]), e.Key))
+				if c != 0 {
+					if toVersion(e.Value) < 0 {
+						return c > 0
+					}
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+	if query.Skip > 0 {
+		if query.Skip >= int64(len(matched)) {
+			return []*DataObjectResp{}, nil
+		}
+		matched = matched[query.Skip:]
+	}
+	if query.Limit > 0 && query.Limit < int64(len(matched)) {
+		matched = matched[:query.Limit]
+	}
+	return matched, nil
+}
+
+func matchFilter(d bson.D, filter bson.D) (bool, error) {
+	for _, e := range filter {
+		var ok bool
+		var err error
+		switch e.Key {
+		case "$and", "$or", "$nor":
+			ok, err = matchLogical(d, e.Key, e.Value)
+		default:
+			if strings.HasPrefix(e.Key, "$") {
+				return false, errors.New("unsupported query operator " + e.Key)
+			}
+			ok, err = matchPath(d, e.Key, e.Value)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(d bson.D, operator string, v interface{}) (bool, error) {
+	clauses := itemsOf(v)
+	if clauses == nil {
+		return false, errors.New(operator + " expects an array")
+	}
+	for _, clause := range clauses {
+		filter, ok := queryDocument(clause)
+		if !ok {
+			return false, errors.New(operator + " expects documents")
+		}
+		matched, err := matchFilter(d, filter)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case operator == "$and" && !matched:
+			return false, nil
+		case operator == "$or" && matched:
+			return true, nil
+		case operator == "$nor" && matched:
+			return false, nil
+		}
+	}
+	return operator != "$or", nil
+}
+
+// queryDocument reads the ordered or unordered documents used to write queries.
+func queryDocument(v interface{}) (bson.D, bool) {
+	if d, ok := asDocument(v); ok {
+		return d, true
+	}
+	switch v := v.(type) {
+	case bson.M:
+		return mapDocument(v), true
+	case map[string]interface{}:
+		return mapDocument(v), true
+	}
+	return nil, false
+}
+
+func mapDocument(m map[string]interface{}) bson.D {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	d := make(bson.D, len(keys))
+	for i, k := range keys {
+		d[i] = bson.E{Key: k, Value: m[k]}
+	}
+	return d
+}
+
+// isOperatorDocument tells {$gt: 1} from an embedded document value.
+func isOperatorDocument(d bson.D) bool {
+	return len(d) > 0 && strings.HasPrefix(d[0].Key, "$")
+}
+
+func matchPath(d bson.D, path string, condition interface{}) (bool, error) {
+	values, found := pathValues(d, strings.Split(path, "."))
+	operators, ok := queryDocument(condition)
+	if !ok || !isOperatorDocument(operators) {
+		return anyEqual(values, condition), nil
+	}
+	var options string
+	for _, e := range operators {
+		if e.Key == "$options" {
+			options, _ = e.Value.(string)
+		}
+	}
+	for _, e := range operators {
+		var ok bool
+		switch e.Key {
+		case "$eq":
+			ok = anyEqual(values, e.Value)
+		case "$ne":
+			ok = !anyEqual(values, e.Value)
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = anyCompare(values, e.Value, e.Key)
+		case "$in", "$nin":
+			items := itemsOf(e.Value)
+			if items == nil {
+				return false, errors.New(e.Key + " expects an array")
+			}
+			for _, item := range items {
+				if anyEqual(values, item) {
+					ok = true
+					break
+				}
+			}
+			if e.Key == "$nin" {
+				ok = !ok
+			}
+		case "$exists":
+			want, _ := e.Value.(bool)
+			ok = found == want
+		case "$regex":
+			pattern, err := regexPattern(e.Value, options)
+			if err != nil {
+				return false, err
+			}
+			for _, v := range values {
+				if s, isString := v.(string); isString && pattern.MatchString(s) {
+					ok = true
+					break
+				}
+			}
+		case "$options":
+			continue
+		default:
+			return false, errors.New("unsupported query operator " + e.Key)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func regexPattern(v interface{}, options string) (*regexp.Regexp, error) {
+	var pattern string
+	switch v := v.(type) {
+	case string:
+		pattern = v
+	case primitive.Regex:
+		pattern, options = v.Pattern, v.Options
+	default:
+		return nil, fmt.Errorf("$regex expects a string, got %T", v)
+	}
+	if strings.Contains(options, "i") {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// pathValues collects the values at path, traversing arrays like mongo does:
+// an array is matched by its items as well as by itself.
+func pathValues(v interface{}, parts []string) ([]interface{}, bool) {
+	if len(parts) == 0 {
+		if items := itemsOf(v); items != nil {
+			return append([]interface{}{v}, items...), true
+		}
+		return []interface{}{v}, true
+	}
+	if items := itemsOf(v); items != nil {
+		if isIndex(parts[0]) {
+			var i int
+			fmt.Sscan(parts[0], &i)
+			if i < len(items) {
+				return pathValues(items[i], parts[1:])
+			}
+			return nil, false
+		}
+		var values []interface{}
+		found := false
+		for _, item := range items {
+			if vs, ok := pathValues(item, parts); ok {
+				values = append(values, vs...)
+				found = true
+			}
+		}
+		return values, found
+	}
+	d, ok := queryDocument(v)
+	if !ok {
+		return nil, false
+	}
+	value, ok := lookupKey(d, parts[0])
+	if !ok {
+		return nil, false
+	}
+	return pathValues(value, parts[1:])
+}
+
+// pathValue returns the first value at path, used to sort records.
+func pathValue(d bson.D, path string) interface{} {
+	values, _ := pathValues(d, strings.Split(path, "."))
+	for _, v := range values {
+		if itemsOf(v) == nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func anyEqual(values []interface{}, want interface{}) bool {
+	if len(values) == 0 {
+		//missing fields equal null
+		return want == nil
+	}
+	for _, v := range values {
+		if c, ok := compareValues(v, want); ok && c == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func anyCompare(values []interface{}, want interface{}, operator string) bool {
+	for _, v := range values {
+		c, ok := compareValues(v, want)
+		if !ok {
+			continue
+		}
+		switch {
+		case operator == "$gt" && c > 0, operator == "$gte" && c >= 0,
+			operator == "$lt" && c < 0, operator == "$lte" && c <= 0:
+			return true
+		}
+	}
+	return false
+}
+
+// value classes, ordered like bson sorts them
+const (
+	classNull = iota
+	classNumber
+	classString
+	classDocument
+	classArray
+	classObjectId
+	classBool
+	classTime
+	classOther
+)
+
+// classOf returns the class of v and a value ordered within the class.
+func classOf(v interface{}) (int, interface{}) {
+	switch v := v.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return classNull, nil
+	case string:
+		return classString, v
+	case bool:
+		return classBool, v
+	case primitive.ObjectID:
+		return classObjectId, v.Hex()
+	case ID:
+		return classObjectId, v.String()
+	case time.Time:
+		return classTime, v.UnixNano()
+	case primitive.DateTime:
+		return classTime, v.Time().UnixNano()
+	case primitive.Timestamp:
+		return classTime, time.Unix(int64(v.T), 0).UnixNano()
+	case int, int32, int64, float32, float64, primitive.Decimal128, *big.Rat:
+		if r, err := toRat(v); err == nil {
+			return classNumber, r
+		}
+	}
+	if _, ok := queryDocument(v); ok {
+		return classDocument, nil
+	}
+	if itemsOf(v) != nil {
+		return classArray, nil
+	}
+	return classOther, nil
+}
+
+// compareValues orders two values of the same class, ok is false when they cannot be compared.
+func compareValues(a, b interface{}) (c int, ok bool) {
+	ca, va := classOf(a)
+	cb, vb := classOf(b)
+	if ca != cb {
+		return 0, false
+	}
+	switch ca {
+	case classNull:
+		return 0, true
+	case classNumber:
+		return va.(*big.Rat).Cmp(vb.(*big.Rat)), true
+	case classString, classObjectId:
+		return strings.Compare(va.(string), vb.(string)), true
+	case classBool:
+		x, y := va.(bool), vb.(bool)
+		switch {
+		case x == y:
+			return 0, true
+		case !x:
+			return -1, true
+		}
+		return 1, true
+	case classTime:
+		x, y := va.(int64), vb.(int64)
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// compareSortValues orders any two values, values of different classes by class.
+func compareSortValues(a, b interface{}) int {
+	if c, ok := compareValues(a, b); ok {
+		return c
+	}
+	ca, _ := classOf(a)
+	cb, _ := classOf(b)
+	return ca - cb
+}
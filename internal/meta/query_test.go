@@ -0,0 +1,109 @@
+package meta_test
+
+import (
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMemoryFind(t *testing.T) {
+	metaService := newMemoryService(t)
+	carts, _ := metaService.FindMetaTableByName("carts")
+	for _, quantities := range [][]interface{}{{1}, {2, 5}, {3}} {
+		var items []interface{}
+		for _, q := range quantities {
+			items = append(items, map[string]interface{}{"quantity": q, "price": map[string]interface{}{"currency": "CNY", "amount": q}})
+		}
+		_, err := metaService.InsertOne(carts, &meta.DataObject{"cartItems": items})
+		assert.NoError(t, err)
+	}
+	quantities := func(query *meta.Query) [][]int64 {
+		dors, err := metaService.Find(carts, query)
+		assert.NoError(t, err)
+		var result [][]int64
+		for _, dor := range dors {
+			var qs []int64
+			items, _ := dor.Get("cartItems")
+			for _, item := range items.(bson.A) {
+				item := item.(meta.DataObjectResp)
+				q, _ := item.GetInt64("quantity")
+				qs = append(qs, q)
+			}
+			result = append(result, qs)
+		}
+		return result
+	}
+
+	assert.Equal(t, [][]int64{{2, 5}, {3}}, quantities(&meta.Query{Filter: bson.D{{Key: "cartItems.quantity", Value: bson.M{"$gte": 2.5}}}}))
+	assert.Equal(t, [][]int64{{1}, {3}}, quantities(&meta.Query{Filter: bson.D{{Key: "cartItems.quantity", Value: bson.M{"$nin": bson.A{2, 5}}}}}))
+	assert.Equal(t, [][]int64{{2, 5}}, quantities(&meta.Query{Filter: bson.D{{Key: "cartItems.1.quantity", Value: bson.M{"$exists": true}}}}))
+	assert.Equal(t, [][]int64{{1}, {3}}, quantities(&meta.Query{Filter: bson.D{{Key: "$or", Value: bson.A{
+		bson.M{"cartItems.price.amount": decimal(t, "1.00")},
+		bson.M{"cartItems.quantity": int64(3)},
+	}}}}))
+	assert.Equal(t, [][]int64{{3}, {2, 5}, {1}}, quantities(&meta.Query{Sort: bson.D{{Key: "cartItems.0.quantity", Value: -1}}}))
+	assert.Equal(t, [][]int64{{2, 5}}, quantities(&meta.Query{Sort: bson.D{{Key: "cartItems.0.quantity", Value: 1}}, Skip: 1, Limit: 1}))
+	assert.Empty(t, quantities(&meta.Query{Skip: 3}))
+
+	count, err := metaService.Count(carts, bson.D{{Key: "cartItems.quantity", Value: bson.M{"$lt": 3}}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	_, err = metaService.Count(carts, bson.D{{Key: "$where", Value: "true"}})
+	assert.Error(t, err)
+}
+
+func TestMemoryFindRegex(t *testing.T) {
+	metaService := newMemoryService(t)
+	brands, _ := metaService.FindMetaTableByName("brands")
+	for _, name := range []string{"Apple", "apricot", "banana"} {
+		_, err := metaService.InsertOne(brands, &meta.DataObject{"name": name})
+		assert.NoError(t, err)
+	}
+	dors, err := metaService.Find(brands, &meta.Query{Filter: bson.D{{Key: "name", Value: bson.D{{Key: "$regex", Value: "^ap"}, {Key: "$options", Value: "i"}}}}})
+	assert.NoError(t, err)
+	assert.Len(t, dors, 2)
+	dors, err = metaService.Find(brands, &meta.Query{Filter: bson.D{{Key: "name", Value: bson.M{"$regex": "^ap"}}, {Key: "name", Value: bson.M{"$ne": "apricot"}}}})
+	assert.NoError(t, err)
+	assert.Len(t, dors, 0)
+}
+
+func TestColumnByPath(t *testing.T) {
+	carts := cartsMetaTable
+	assert.Equal(t, "amount", carts.ColumnByPath("cartItems.0.price.amount").Name)
+	assert.Equal(t, "quantity", carts.ColumnByPath("cartItems.quantity").Name)
+	assert.Nil(t, carts.ColumnByPath("cartItems.color"))
+	assert.Nil(t, carts.ColumnByPath("userId.0"))
+}
+
+func TestUpdateAndDeleteMetaTable(t *testing.T) {
+	repository := meta.NewMemoryRepository()
+	registry := meta.NewRegistry(repository)
+	metaService := meta.NewService(&repository, meta.WithRegistry(registry))
+	brands := brandsMetaTable
+	id, err := metaService.InsertMetaTable(&brands)
+	assert.NoError(t, err)
+	assert.NoError(t, registry.Load())
+
+	b, err := meta.MarshalMetaTableJSON(&brands)
+	assert.NoError(t, err)
+	table, err := meta.UnmarshalMetaTableJSON(b)
+	assert.NoError(t, err)
+	assert.Equal(t, *id, meta.ID(table.Id))
+	table.Description = "brands of the products"
+	assert.NoError(t, metaService.UpdateMetaTable(table))
+	cached, ok := registry.Get("brands")
+	assert.True(t, ok)
+	assert.Equal(t, "brands of the products", cached.Description)
+	stored, err := repository.FindMetaTableById(*id)
+	assert.NoError(t, err)
+	assert.Equal(t, "brands of the products", stored.Description)
+	assert.Equal(t, brands.CreatedAt.Unix(), stored.CreatedAt.Unix())
+
+	assert.NoError(t, metaService.DeleteMetaTable(*id))
+	_, ok = registry.Get("brands")
+	assert.False(t, ok)
+	assert.Equal(t, mongo.ErrNoDocuments, metaService.DeleteMetaTable(*id))
+}
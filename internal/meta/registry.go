@@ -0,0 +1,184 @@
+package meta
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const defaultPollInterval = 10 * time.Second
+
+// Registry keeps every meta table in memory, resolving them by name or id without a round trip.
+type Registry struct {
+	repository Repository
+	mu         sync.RWMutex
+	loaded     bool
+	byName     map[string]*MetaTable
+	byId       map[ID]*MetaTable
+	snapshot   map[ID][]byte
+	listeners  []func()
+}
+
+func NewRegistry(repository Repository) *Registry {
+	return &Registry{
+		repository: repository,
+		byName:     map[string]*MetaTable{},
+		byId:       map[ID]*MetaTable{},
+		snapshot:   map[ID][]byte{},
+	}
+}
+
+// Load reads all meta tables from the repository, replacing the cached ones.
+// Listeners are notified when anything changed since the previous load.
+func (r *Registry) Load() error {
+	tables, err := r.repository.FindAllMetaTables()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*MetaTable, len(tables))
+	byId := make(map[ID]*MetaTable, len(tables))
+	snapshot := make(map[ID][]byte, len(tables))
+	for _, table := range tables {
+		id := ID(table.Id)
+		byName[table.Name] = table
+		byId[id] = table
+		b, err := bson.Marshal(table)
+		if err != nil {
+			return err
+		}
+		snapshot[id] = b
+	}
+
+	r.mu.Lock()
+	changed := !r.loaded || !sameSnapshot(r.snapshot, snapshot)
+	r.byName, r.byId, r.snapshot = byName, byId, snapshot
+	r.loaded = true
+	listeners := r.listeners
+	r.mu.Unlock()
+
+	if changed {
+		for _, fn := range listeners {
+			fn()
+		}
+	}
+	return nil
+}
+
+func sameSnapshot(a, b map[ID][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, v := range a {
+		if w, ok := b[id]; !ok || !bytes.Equal(v, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// Loaded reports whether Load has succeeded at least once.
+func (r *Registry) Loaded() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.loaded
+}
+
+func (r *Registry) Get(name string) (*MetaTable, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	table, ok := r.byName[name]
+	return table, ok
+}
+
+func (r *Registry) GetById(id ID) (*MetaTable, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	table, ok := r.byId[id]
+	return table, ok
+}
+
+// All returns the cached tables in no particular order.
+func (r *Registry) All() []*MetaTable {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tables := make([]*MetaTable, 0, len(r.byId))
+	for _, table := range r.byId {
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// Put adds or replaces a single table, used after writes made through this process.
+func (r *Registry) Put(table *MetaTable) {
+	id := ID(table.Id)
+	b, _ := bson.Marshal(table)
+	r.mu.Lock()
+	if old, ok := r.byId[id]; ok && old.Name != table.Name {
+		delete(r.byName, old.Name)
+	}
+	r.byName[table.Name] = table
+	r.byId[id] = table
+	r.snapshot[id] = b
+	listeners := r.listeners
+	r.mu.Unlock()
+	for _, fn := range listeners {
+		fn()
+	}
+}
+
+// Remove drops a table from the cache.
+func (r *Registry) Remove(id ID) {
+	r.mu.Lock()
+	table, ok := r.byId[id]
+	if ok {
+		delete(r.byName, table.Name)
+		delete(r.byId, id)
+		delete(r.snapshot, id)
+	}
+	listeners := r.listeners
+	r.mu.Unlock()
+	if ok {
+		for _, fn := range listeners {
+			fn()
+		}
+	}
+}
+
+// OnChange registers fn to be called whenever the cached tables change.
+func (r *Registry) OnChange(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+// Watch keeps the registry up to date until ctx is done.
+// It listens on the metas change stream and falls back to polling every interval
+// when change streams are unavailable.
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	err := r.repository.WatchMetaTables(ctx, func() {
+		r.Load()
+	})
+	if err == nil || ctx.Err() != nil {
+		return nil
+	}
+	return r.poll(ctx, interval)
+}
+
+func (r *Registry) poll(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.Load()
+		}
+	}
+}
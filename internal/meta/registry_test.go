@@ -0,0 +1,100 @@
+package meta_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type stubMetaRepository struct {
+	meta.Repository
+	mu      sync.Mutex
+	tables  []*meta.MetaTable
+	queries int
+}
+
+func (r *stubMetaRepository) FindAllMetaTables() ([]*meta.MetaTable, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries++
+	var tables []*meta.MetaTable
+	for _, table := range r.tables {
+		copied := *table
+		tables = append(tables, &copied)
+	}
+	return tables, nil
+}
+
+func (r *stubMetaRepository) FindMetaTableByName(tableName string) (*meta.MetaTable, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries++
+	return nil, errors.New("not found")
+}
+
+func (r *stubMetaRepository) WatchMetaTables(ctx context.Context, onChange func()) error {
+	return errors.New("change streams not supported")
+}
+
+func (r *stubMetaRepository) setTables(tables ...*meta.MetaTable) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tables = tables
+}
+
+func TestRegistryResolvesByNameAndId(t *testing.T) {
+	products := &meta.MetaTable{Id: primitive.NewObjectID(), Name: "products"}
+	brands := &meta.MetaTable{Id: primitive.NewObjectID(), Name: "brands"}
+	stub := &stubMetaRepository{tables: []*meta.MetaTable{products, brands}}
+	registry := meta.NewRegistry(stub)
+	assert.NoError(t, registry.Load())
+
+	var repository meta.Repository = stub
+	metaService := meta.NewService(&repository, meta.WithRegistry(registry))
+	queries := stub.queries
+
+	table, err := metaService.FindMetaTableByName("brands")
+	assert.NoError(t, err)
+	assert.Equal(t, brands.Id, table.Id)
+	table, err = metaService.FindMetaTableById(meta.ID(products.Id))
+	assert.NoError(t, err)
+	assert.Equal(t, "products", table.Name)
+	tables, err := metaService.FindAllMetaTables()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(tables))
+	assert.Equal(t, queries, stub.queries)
+}
+
+func TestRegistryPollingFallback(t *testing.T) {
+	stub := &stubMetaRepository{tables: []*meta.MetaTable{{Id: primitive.NewObjectID(), Name: "products"}}}
+	registry := meta.NewRegistry(stub)
+	assert.NoError(t, registry.Load())
+	changed := make(chan struct{}, 1)
+	registry.OnChange(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go registry.Watch(ctx, 10*time.Millisecond)
+
+	stub.setTables(&meta.MetaTable{Id: primitive.NewObjectID(), Name: "carts"})
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("registry was not refreshed")
+	}
+	_, ok := registry.Get("carts")
+	assert.True(t, ok)
+	_, ok = registry.Get("products")
+	assert.False(t, ok)
+}
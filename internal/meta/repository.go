@@ -8,11 +8,13 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
 	table_name = "metas"
-	timeout    = 30 * time.Second
+	//defaultTimeout bounds every call of the repository unless WithTimeout says otherwise
+	defaultTimeout = 30 * time.Second
 )
 
 type Repository interface {
@@ -21,21 +23,72 @@ type Repository interface {
 	FindAllMetaTables() ([]*MetaTable, error)
 	InsertMetaTable(table *MetaTable) (*ID, error)
 	InsertManyMetaTables(tables []*MetaTable) ([]*ID, error)
+	UpdateMetaTable(table *MetaTable) error
+	DeleteMetaTable(id ID) error
 	FindAll(table *MetaTable) ([]*DataObjectResp, error)
+	//Find returns the records matching query, sorted and paged
+	Find(table *MetaTable, query *Query) ([]*DataObjectResp, error)
+	//Count returns the number of records matching filter
+	Count(table *MetaTable, filter bson.D) (int64, error)
+	//Aggregate returns the groups of records computed by aggregation, see Aggregation
+	Aggregate(table *MetaTable, aggregation *Aggregation) ([]*DataObjectResp, error)
+	//Search returns the records matching the terms of query best first, see MetaService.Search
+	Search(table *MetaTable, query string, filter bson.D, page *Page) (*SearchResult, error)
+	//Facets counts the records matching the terms of query and filter by facet, see MetaService.Facets
+	Facets(table *MetaTable, query string, filter bson.D, facets []*Facet) (map[string][]*FacetBucket, error)
 	FindOne(table *MetaTable, id ID) (*DataObjectResp, error)
 	InsertOne(table *MetaTable, value *DataObject) (*ID, error)
 	InsertMany(table *MetaTable, values []*DataObject) ([]*ID, error)
+	UpdateOne(table *MetaTable, id ID, value *DataObject) error
+	PatchOne(table *MetaTable, id ID, value *DataObject) error
+	UpdateOneWithVersion(table *MetaTable, id ID, value *DataObject, version int64) error
+	PatchOneWithVersion(table *MetaTable, id ID, value *DataObject, version int64) error
+	DeleteOne(table *MetaTable, id ID) error
+	//Upsert inserts value or updates the record having its values of keyColumns
+	Upsert(table *MetaTable, keyColumns []string, value *DataObject) (*UpsertResult, error)
+	//UpsertMany upserts values in order and returns the records written before an error
+	UpsertMany(table *MetaTable, keyColumns []string, values []*DataObject) (*UpsertResult, error)
+	InsertHistory(table *MetaTable, entry *HistoryEntry) error
+	FindHistory(table *MetaTable, id ID) ([]*HistoryEntry, error)
+	FindDictionaryById(id ID) (*Dictionary, error)
+	FindDictionary(group, name string) (*Dictionary, error)
+	FindDictionariesByGroup(group string) ([]*Dictionary, error)
+	InsertDictionary(dictionary *Dictionary) (*ID, error)
+	UpdateDictionary(dictionary *Dictionary) error
+	DeleteDictionary(id ID) error
+	//SyncIndexes creates and drops the indexes of the collection of table to match table.Indexes,
+	//dryRun only reports the changes
+	SyncIndexes(table *MetaTable, dryRun bool) (*IndexChanges, error)
+	WatchMetaTables(ctx context.Context, onChange func()) error
+	RunTransaction(ctx context.Context, fn func(tx Repository) error) error
 }
 
 type repository struct {
-	db *Database
+	db      *Database
+	ctx     context.Context
+	timeout time.Duration
 }
 
-func NewRepository(db *Database) Repository {
-	return &repository{db}
+type RepositoryOption func(*repository)
+
+//WithTimeout bounds every call of the repository, mongo.timeout of the configuration.
+func WithTimeout(timeout time.Duration) RepositoryOption {
+	return func(r *repository) {
+		if timeout > 0 {
+			r.timeout = timeout
+		}
+	}
+}
+
+func NewRepository(db *Database, options ...RepositoryOption) Repository {
+	r := &repository{db: db, ctx: context.Background(), timeout: defaultTimeout}
+	for _, option := range options {
+		option(r)
+	}
+	return r
 }
 func (r *repository) FindMetaTableById(id ID) (*MetaTable, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
 	defer cancel()
 	db := mongo.Database(*r.db)
 	coll := db.Collection(table_name)
@@ -45,7 +98,7 @@ func (r *repository) FindMetaTableById(id ID) (*MetaTable, error) {
 }
 
 func (r *repository) FindMetaTableByName(tableName string) (*MetaTable, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
 	defer cancel()
 	db := mongo.Database(*r.db)
 	coll := db.Collection(table_name)
@@ -55,7 +108,7 @@ func (r *repository) FindMetaTableByName(tableName string) (*MetaTable, error) {
 	return &table, err
 }
 func (r *repository) FindAllMetaTables() ([]*MetaTable, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
 	defer cancel()
 	db := mongo.Database(*r.db)
 	coll := db.Collection(table_name)
@@ -75,10 +128,48 @@ func (r *repository) FindAllMetaTables() ([]*MetaTable, error) {
 	}
 	return tables, nil
 }
+
+//WatchMetaTables blocks until ctx is done, calling onChange for every change on the metas collection.
+//It fails when the server does not support change streams (e.g. a standalone mongod).
+func (r *repository) WatchMetaTables(ctx context.Context, onChange func()) error {
+	db := mongo.Database(*r.db)
+	coll := db.Collection(table_name)
+	stream, err := coll.Watch(ctx, mongo.Pipeline{})
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+	for stream.Next(ctx) {
+		onChange()
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return stream.Err()
+}
+//RunTransaction runs fn inside a session transaction, every call made on tx is part of it.
+//The whole transaction is retried on transient errors and the commit on unknown commit results.
+func (r *repository) RunTransaction(ctx context.Context, fn func(tx Repository) error) error {
+	if _, ok := r.ctx.(mongo.SessionContext); ok {
+		return fn(r)
+	}
+	db := mongo.Database(*r.db)
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(&repository{db: r.db, ctx: sc, timeout: r.timeout})
+	})
+	return err
+}
 func (r *repository) InsertMetaTable(table *MetaTable) (*ID, error) {
 	db := mongo.Database(*r.db)
 	coll := db.Collection(table_name)
-	result, err := coll.InsertOne(context.TODO(), table)
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	result, err := coll.InsertOne(ctx, table)
 	if err != nil {
 		return nil, err
 	}
@@ -93,21 +184,96 @@ func (r *repository) InsertManyMetaTables(tables []*MetaTable) ([]*ID, error) {
 	for _, table := range tables {
 		bsonTables = append(bsonTables, table)
 	}
-	result, err := coll.InsertMany(context.TODO(), bsonTables)
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	result, err := coll.InsertMany(ctx, bsonTables)
 	if err != nil {
 		return nil, err
 	}
 	var ids = make([]*ID, len(result.InsertedIDs))
-	var id ID
 	for i, iid := range result.InsertedIDs {
-		id = ParseID(iid)
+		id := ParseID(iid)
 		ids[i] = &id
 	}
 	return ids, nil
 }
+func (r *repository) UpdateMetaTable(table *MetaTable) error {
+	db := mongo.Database(*r.db)
+	coll := db.Collection(table_name)
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	result, err := coll.ReplaceOne(ctx, bson.M{"_id": table.Id}, table)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+func (r *repository) DeleteMetaTable(id ID) error {
+	db := mongo.Database(*r.db)
+	coll := db.Collection(table_name)
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	result, err := coll.DeleteOne(ctx, bson.M{"_id": id.ToObjectId()})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+func (r *repository) Find(table *MetaTable, query *Query) ([]*DataObjectResp, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(table.Name)
+	if query == nil {
+		query = &Query{}
+	}
+	filter := query.Filter
+	if filter == nil {
+		filter = bson.D{}
+	}
+	findOptions := options.Find()
+	if len(query.Sort) > 0 {
+		findOptions.SetSort(query.Sort)
+	}
+	if query.Skip > 0 {
+		findOptions.SetSkip(query.Skip)
+	}
+	if query.Limit > 0 {
+		findOptions.SetLimit(query.Limit)
+	}
+	cursor, err := coll.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	result := []*DataObjectResp{}
+	for cursor.Next(ctx) {
+		var dor DataObjectResp
+		if err := cursor.Decode(&dor); err != nil {
+			return nil, err
+		}
+		result = append(result, &dor)
+	}
+	return result, cursor.Err()
+}
+func (r *repository) Count(table *MetaTable, filter bson.D) (int64, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	if filter == nil {
+		filter = bson.D{}
+	}
+	return db.Collection(table.Name).CountDocuments(ctx, filter)
+}
 func (r *repository) FindAll(table *MetaTable) ([]*DataObjectResp, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
 	defer cancel()
 	db := mongo.Database(*r.db)
 	coll := db.Collection(table.Name)
@@ -128,7 +294,7 @@ func (r *repository) FindAll(table *MetaTable) ([]*DataObjectResp, error) {
 }
 
 func (r *repository) FindOne(table *MetaTable, id ID) (*DataObjectResp, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
 	defer cancel()
 	db := mongo.Database(*r.db)
 	coll := db.Collection(table.Name)
@@ -139,22 +305,267 @@ func (r *repository) FindOne(table *MetaTable, id ID) (*DataObjectResp, error) {
 func (r *repository) InsertOne(table *MetaTable, do *DataObject) (*ID, error) {
 	db := mongo.Database(*r.db)
 	coll := db.Collection(table.Name)
-	insertDocument := bson.D{}
+	insertDocument, err := assemblyDocument(table, do)
+	if err != nil {
+		return nil, err
+	}
+	insertDocument = append(insertDocument, bson.E{Key: VersionColumn, Value: int64(1)})
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	result, err := coll.InsertOne(ctx, insertDocument)
+	if err != nil {
+		return nil, err
+	}
+	id := ParseID(result.InsertedID)
+	return &id, nil
+}
+
+//UpdateOne replaces the whole record, the _id is kept
+func (r *repository) UpdateOne(table *MetaTable, id ID, do *DataObject) error {
+	var err error
+	for i := 0; i < maxVersionRetries; i++ {
+		var version int64
+		version, err = r.currentVersion(table, id)
+		if err != nil {
+			return err
+		}
+		err = r.UpdateOneWithVersion(table, id, do, version)
+		if _, conflict := err.(*ConflictError); !conflict {
+			return err
+		}
+	}
+	return err
+}
+
+//UpdateOneWithVersion replaces the record only if it is still at version
+func (r *repository) UpdateOneWithVersion(table *MetaTable, id ID, do *DataObject, version int64) error {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(table.Name)
+	document, err := assemblyDocument(table, do)
+	if err != nil {
+		return err
+	}
+	document = append(withoutKey(document, "_id"), bson.E{Key: VersionColumn, Value: version + 1})
+	result, err := coll.ReplaceOne(ctx, versionFilter(id, version), document)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return r.conflict(table, id, version)
+	}
+	return nil
+}
+
+//PatchOne only sets the columns present in value
+func (r *repository) PatchOne(table *MetaTable, id ID, do *DataObject) error {
+	return r.patch(table, id, do, bson.M{"_id": id.ToObjectId()})
+}
+
+//PatchOneWithVersion sets the columns present in value only if the record is still at version
+func (r *repository) PatchOneWithVersion(table *MetaTable, id ID, do *DataObject, version int64) error {
+	err := r.patch(table, id, do, versionFilter(id, version))
+	if err == mongo.ErrNoDocuments {
+		return r.conflict(table, id, version)
+	}
+	return err
+}
+
+func (r *repository) patch(table *MetaTable, id ID, do *DataObject, filter bson.M) error {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(table.Name)
+	document, err := assemblyDocument(table, do)
+	if err != nil {
+		return err
+	}
+	update := bson.D{{Key: "$inc", Value: bson.M{VersionColumn: int64(1)}}}
+	if document = withoutKey(document, "_id"); len(document) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: document})
+	}
+	result, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *repository) currentVersion(table *MetaTable, id ID) (int64, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(table.Name)
+	var value DataObjectResp
+	opts := options.FindOne().SetProjection(bson.M{VersionColumn: 1})
+	if err := coll.FindOne(ctx, bson.M{"_id": id.ToObjectId()}, opts).Decode(&value); err != nil {
+		return 0, err
+	}
+	return value.Version(), nil
+}
+
+//conflict tells a missing record from one written by someone else
+func (r *repository) conflict(table *MetaTable, id ID, expected int64) error {
+	actual, err := r.currentVersion(table, id)
+	if err != nil {
+		return err
+	}
+	return &ConflictError{Table: table.Name, Id: id, Expected: expected, Actual: actual}
+}
+
+func (r *repository) DeleteOne(table *MetaTable, id ID) error {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(table.Name)
+	result, err := coll.DeleteOne(ctx, bson.M{"_id": id.ToObjectId()})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *repository) InsertHistory(table *MetaTable, entry *HistoryEntry) error {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(historyTableName(table))
+	_, err := coll.InsertOne(ctx, entry)
+	return err
+}
+
+//FindHistory returns the changes of a record, oldest first
+func (r *repository) FindHistory(table *MetaTable, id ID) ([]*HistoryEntry, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(historyTableName(table))
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := coll.Find(ctx, bson.M{"recordid": id.ToObjectId()}, opts)
+	if err != nil {
+		return nil, err
+	}
+	entries := []*HistoryEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *repository) FindDictionaryById(id ID) (*Dictionary, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(dictionary_table_name)
+	var dictionary Dictionary
+	err := coll.FindOne(ctx, bson.M{"_id": id.ToObjectId()}).Decode(&dictionary)
+	return &dictionary, err
+}
+
+func (r *repository) FindDictionary(group, name string) (*Dictionary, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(dictionary_table_name)
+	var dictionary Dictionary
+	err := coll.FindOne(ctx, bson.M{"group": group, "name": name}).Decode(&dictionary)
+	return &dictionary, err
+}
+
+//FindDictionariesByGroup returns the dictionaries of a group ordered by name
+func (r *repository) FindDictionariesByGroup(group string) ([]*Dictionary, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(dictionary_table_name)
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := coll.Find(ctx, bson.M{"group": group}, opts)
+	if err != nil {
+		return nil, err
+	}
+	dictionaries := []*Dictionary{}
+	if err := cursor.All(ctx, &dictionaries); err != nil {
+		return nil, err
+	}
+	return dictionaries, nil
+}
+
+func (r *repository) InsertDictionary(dictionary *Dictionary) (*ID, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(dictionary_table_name)
+	result, err := coll.InsertOne(ctx, dictionary)
+	if err != nil {
+		return nil, err
+	}
+	id := ParseID(result.InsertedID)
+	return &id, nil
+}
+
+func (r *repository) UpdateDictionary(dictionary *Dictionary) error {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(dictionary_table_name)
+	result, err := coll.ReplaceOne(ctx, bson.M{"_id": dictionary.Id}, dictionary)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *repository) DeleteDictionary(id ID) error {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(dictionary_table_name)
+	result, err := coll.DeleteOne(ctx, bson.M{"_id": id.ToObjectId()})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+//assemblyDocument keeps only the columns declared by the table
+func assemblyDocument(table *MetaTable, do *DataObject) (bson.D, error) {
+	document := bson.D{}
 	for _, c := range table.Columns {
 		if e, exist := do.Get(c.Name); exist {
 			v, err := assemblyNestedColumns(c, e)
 			if err != nil {
 				return nil, err
 			}
-			insertDocument = append(insertDocument, bson.E{Key: c.Name, Value: v})
+			document = append(document, bson.E{Key: c.Name, Value: v})
 		}
 	}
-	result, err := coll.InsertOne(context.TODO(), insertDocument)
-	if err != nil {
-		return nil, err
+	if terms, exist := do.Get(SearchColumn); exist {
+		document = append(document, bson.E{Key: SearchColumn, Value: terms})
 	}
-	id := ParseID(result.InsertedID)
-	return &id, nil
+	return document, nil
+}
+
+func withoutKey(d bson.D, key string) bson.D {
+	result := bson.D{}
+	for _, e := range d {
+		if e.Key != key {
+			result = append(result, e)
+		}
+	}
+	return result
 }
 
 func assemblyNestedColumns(c *MetaColumn, val interface{}) (interface{}, error) {
@@ -210,7 +621,18 @@ func assemblyNestedColumns(c *MetaColumn, val interface{}) (interface{}, error)
 		}
 	default:
 		switch v := val.(type) {
-		case map[string]interface{}, []interface{}:
+		case []interface{}:
+			if !c.IsArray {
+				return v, errors.New("column:" + c.Name + ",value should not be a map[string]interface{} or []interface{}")
+			}
+			for _, item := range v {
+				switch item.(type) {
+				case map[string]interface{}, []interface{}:
+					return v, errors.New("column:" + c.Name + ",items should not be a map[string]interface{} or []interface{}")
+				}
+			}
+			return v, nil
+		case map[string]interface{}:
 			return v, errors.New("column:" + c.Name + ",value should not be a map[string]interface{} or []interface{}")
 		// case string:
 			
@@ -229,16 +651,22 @@ func (r *repository) InsertMany(table *MetaTable, values []*DataObject) ([]*ID,
 	//convert to bson.D
 	var bsonValues []interface{}
 	for _, value := range values {
-		bsonValues = append(bsonValues, value)
+		document := bson.M{}
+		for k, v := range *value {
+			document[k] = v
+		}
+		document[VersionColumn] = int64(1)
+		bsonValues = append(bsonValues, document)
 	}
-	result, err := coll.InsertMany(context.TODO(), bsonValues)
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	result, err := coll.InsertMany(ctx, bsonValues)
 	if err != nil {
 		return nil, err
 	}
 	var ids = make([]*ID, len(result.InsertedIDs))
-	var id ID
 	for i, iid := range result.InsertedIDs {
-		id = ParseID(iid)
+		id := ParseID(iid)
 		ids[i] = &id
 	}
 	return ids, nil
@@ -0,0 +1,90 @@
+package meta_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// stalledDatabase connects to a server accepting connections and never answering,
+// so every call waits until its context is done.
+func stalledDatabase(t *testing.T) *meta.Database {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	client, err := mongo.Connect(context.Background(), options.Client().
+		ApplyURI("mongodb://"+listener.Addr().String()).
+		SetDirect(true).
+		SetServerSelectionTimeout(time.Minute))
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		client.Disconnect(context.Background())
+		listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	db := meta.Database(*client.Database("raya"))
+	return &db
+}
+
+func TestRepositoryTimeout(t *testing.T) {
+	repository := meta.NewRepository(stalledDatabase(t), meta.WithTimeout(50*time.Millisecond))
+	table := brandsMetaTable
+	calls := map[string]func() error{
+		"InsertMetaTable": func() error {
+			_, err := repository.InsertMetaTable(&table)
+			return err
+		},
+		"InsertManyMetaTables": func() error {
+			_, err := repository.InsertManyMetaTables([]*meta.MetaTable{&table})
+			return err
+		},
+		"UpdateMetaTable": func() error { return repository.UpdateMetaTable(&table) },
+		"DeleteMetaTable": func() error { return repository.DeleteMetaTable(meta.NilObjectID()) },
+		"InsertOne": func() error {
+			_, err := repository.InsertOne(&table, &meta.DataObject{"name": "Apple"})
+			return err
+		},
+		"InsertMany": func() error {
+			_, err := repository.InsertMany(&table, []*meta.DataObject{{"name": "Apple"}})
+			return err
+		},
+		"FindOne": func() error {
+			_, err := repository.FindOne(&table, meta.ID(primitive.NewObjectID()))
+			return err
+		},
+	}
+	for name, call := range calls {
+		done := make(chan error, 1)
+		go func() { done <- call() }()
+		select {
+		case err := <-done:
+			assert.Error(t, err, name)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s is not bounded by the timeout", name)
+		}
+	}
+}
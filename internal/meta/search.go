@@ -0,0 +1,411 @@
+package meta
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SearchColumn holds the search terms of the searchable columns of a record, separated by spaces.
+// The service writes it and hides it from the records it reads.
+const SearchColumn = "_search"
+
+const (
+	highlightStart = "<em>"
+	highlightEnd   = "</em>"
+	fragmentSize   = 80 //runes around the first match of a long value
+)
+
+// Tokenizer splits text into the terms it is searched by, both when a record is written and
+// when a query is searched.
+type Tokenizer interface {
+	Tokens(text string) []string
+}
+
+// NGramTokenizer splits text into lower case words and runs of Chinese, Japanese or Korean characters
+// into their n-grams of 1 to N runes, 2 by default. 绿茶饮料 gives 绿 茶 饮 料 绿茶 茶饮 饮料,
+// so any part of a Chinese word is found without a dictionary.
+type NGramTokenizer struct {
+	N int
+}
+
+func (t NGramTokenizer) Tokens(text string) []string {
+	n := t.N
+	if n <= 0 {
+		n = 2
+	}
+	var tokens []string
+	var word, run []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushRun := func() {
+		for size := 1; size <= n && size <= len(run); size++ {
+			for i := 0; i+size <= len(run); i++ {
+				tokens = append(tokens, string(run[i:i+size]))
+			}
+		}
+		run = run[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flushWord()
+			run = append(run, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushRun()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushRun()
+		}
+	}
+	flushWord()
+	flushRun()
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// Page selects a page of results, Number starts at 1. A nil page selects every result.
+type Page struct {
+	Number int64 `json:"page"`
+	Size   int64 `json:"pageSize"`
+}
+
+func (p *Page) skipLimit() (int64, int64) {
+	if p == nil || p.Size <= 0 {
+		return 0, 0
+	}
+	if p.Number <= 1 {
+		return 0, p.Size
+	}
+	return (p.Number - 1) * p.Size, p.Size
+}
+
+// SearchResult is a page of the records matching a search, best first.
+type SearchResult struct {
+	Total int64        `json:"total"`
+	Hits  []*SearchHit `json:"hits"`
+}
+
+// SearchHit is a record found by a search, Highlights holds the matching values of its searchable columns
+// by path with the matches wrapped in <em></em>.
+type SearchHit struct {
+	Record     *DataObjectResp     `json:"record"`
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// searchablePaths returns the paths of the searchable columns of table, nested ones included.
+func searchablePaths(table *MetaTable) []string {
+	var paths []string
+	var walk func(prefix string, columns []*MetaColumn)
+	walk = func(prefix string, columns []*MetaColumn) {
+		for _, c := range columns {
+			if c.Searchable() {
+				paths = append(paths, prefix+c.Name)
+			}
+			walk(prefix+c.Name+".", c.NestedColumns)
+		}
+	}
+	walk("", table.Columns)
+	return paths
+}
+
+// searchIndex is the text index of the search terms, created by SyncIndexes once a column is searchable.
+func searchIndex(table *MetaTable) *MetaIndex {
+	return &MetaIndex{Name: table.Name + "_search", ColumnNames: []string{SearchColumn}}
+}
+
+// indexes returns the indexes of table, its text index included.
+func (t *MetaTable) indexes() []*MetaIndex {
+	if len(searchablePaths(t)) == 0 {
+		return t.Indexes
+	}
+	return append(append([]*MetaIndex{}, t.Indexes...), searchIndex(t))
+}
+
+// searchValues collects the strings at path, through arrays and documents.
+func searchValues(v interface{}, parts []string) []string {
+	if items := itemsOf(v); items != nil {
+		var values []string
+		for _, item := range items {
+			values = append(values, searchValues(item, parts)...)
+		}
+		return values
+	}
+	if len(parts) == 0 {
+		if s, ok := v.(string); ok && len(s) > 0 {
+			return []string{s}
+		}
+		return nil
+	}
+	return searchValues(fieldOf(v, parts[0]), parts[1:])
+}
+
+// stampSearch sets the search terms of a record being written from its searchable columns.
+func (s *service) stampSearch(table *MetaTable, value *DataObject) {
+	paths := searchablePaths(table)
+	if len(paths) == 0 {
+		return
+	}
+	var terms []string
+	for _, path := range paths {
+		for _, text := range searchValues(*value, strings.Split(path, ".")) {
+			terms = append(terms, s.tokenizer.Tokens(text)...)
+		}
+	}
+	(*value)[SearchColumn] = strings.Join(terms, " ")
+}
+
+// stampPatchSearch sets the search terms of a patched record when the patch changes a searchable column,
+// the terms of the columns left alone are read from the existing record.
+func (s *service) stampPatchSearch(table *MetaTable, id ID, value *DataObject) error {
+	touched := false
+	for _, path := range searchablePaths(table) {
+		if _, ok := (*value)[strings.Split(path, ".")[0]]; ok {
+			touched = true
+		}
+	}
+	if !touched {
+		return nil
+	}
+	existing, err := s.Repository.FindOne(table, id)
+	if err != nil {
+		return err
+	}
+	merged := DataObject(bson.D(*existing).Map())
+	for k, v := range *value {
+		merged[k] = v
+	}
+	s.stampSearch(table, &merged)
+	(*value)[SearchColumn] = merged[SearchColumn]
+	return nil
+}
+
+// hideSearch drops the search terms of read records.
+func hideSearch(dors ...*DataObjectResp) {
+	for _, dor := range dors {
+		if _, ok := dor.Get(SearchColumn); ok {
+			*dor = DataObjectResp(withoutKey(bson.D(*dor), SearchColumn))
+		}
+	}
+}
+
+// Search finds the records of table whose searchable columns hold the terms of query, ranked by relevance.
+// filter narrows the records like Query.Filter.
+func (s *service) Search(table *MetaTable, query string, filter bson.D, page *Page) (*SearchResult, error) {
+	if len(searchablePaths(table)) == 0 {
+		return nil, &ValidationError{Table: table.Name, Message: "table has no searchable column"}
+	}
+	tokens := distinctTokens(s.tokenizer.Tokens(query))
+	if len(tokens) == 0 {
+		return &SearchResult{Hits: []*SearchHit{}}, nil
+	}
+	result, err := s.Repository.Search(table, strings.Join(tokens, " "), s.live(table, filter), page)
+	if err != nil {
+		return nil, err
+	}
+	for _, hit := range result.Hits {
+		if err := s.computeRecords(table, hit.Record); err != nil {
+			return nil, err
+		}
+		hit.Highlights = highlights(table, hit.Record, tokens)
+	}
+	return result, nil
+}
+
+func distinctTokens(tokens []string) []string {
+	seen := map[string]bool{}
+	distinct := []string{}
+	for _, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			distinct = append(distinct, token)
+		}
+	}
+	return distinct
+}
+
+func highlights(table *MetaTable, dor *DataObjectResp, tokens []string) map[string][]string {
+	result := map[string][]string{}
+	for _, path := range searchablePaths(table) {
+		for _, text := range searchValues(bson.D(*dor), strings.Split(path, ".")) {
+			if fragment, ok := highlight(text, tokens); ok {
+				result[path] = append(result[path], fragment)
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// highlight wraps the matches of tokens in text, a long text is cut around its first match.
+func highlight(text string, tokens []string) (string, bool) {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		//the case mapping changed the length, match the text as it is
+		lower = runes
+	}
+	marked := make([]bool, len(runes))
+	found := false
+	for _, token := range tokens {
+		t := []rune(token)
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if string(lower[i:i+len(t)]) == token {
+				for j := i; j < i+len(t); j++ {
+					marked[j] = true
+				}
+				found = true
+			}
+		}
+	}
+	if !found {
+		return "", false
+	}
+	start, end := 0, len(runes)
+	if len(runes) > fragmentSize {
+		first := 0
+		for !marked[first] {
+			first++
+		}
+		if start = first - fragmentSize/4; start < 0 {
+			start = 0
+		}
+		if end = start + fragmentSize; end > len(runes) {
+			end = len(runes)
+		}
+	}
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		if marked[i] && (i == start || !marked[i-1]) {
+			b.WriteString(highlightStart)
+		}
+		b.WriteRune(runes[i])
+		if marked[i] && (i == end-1 || !marked[i+1]) {
+			b.WriteString(highlightEnd)
+		}
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// Search runs a $text query of the terms of query, separated by spaces, ranked by text score.
+func (r *repository) Search(table *MetaTable, query string, filter bson.D, page *Page) (*SearchResult, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	db := mongo.Database(*r.db)
+	coll := db.Collection(table.Name)
+	filter = append(bson.D{{Key: "$text", Value: bson.D{{Key: "$search", Value: query}}}}, filter...)
+	total, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	score := bson.D{{Key: "$meta", Value: "textScore"}}
+	findOptions := options.Find().
+		SetProjection(bson.D{{Key: "_score", Value: score}}).
+		SetSort(bson.D{{Key: "_score", Value: score}})
+	skip, limit := page.skipLimit()
+	if skip > 0 {
+		findOptions.SetSkip(skip)
+	}
+	if limit > 0 {
+		findOptions.SetLimit(limit)
+	}
+	cursor, err := coll.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	result := &SearchResult{Total: total, Hits: []*SearchHit{}}
+	for cursor.Next(ctx) {
+		var dor DataObjectResp
+		if err := cursor.Decode(&dor); err != nil {
+			return nil, err
+		}
+		hit := &SearchHit{}
+		if v, ok := dor.Get("_score"); ok {
+			hit.Score, _ = v.(float64)
+		}
+		dor = DataObjectResp(withoutKey(withoutKey(bson.D(dor), "_score"), SearchColumn))
+		hit.Record = &dor
+		result.Hits = append(result.Hits, hit)
+	}
+	return result, cursor.Err()
+}
+
+// Search scores the records like searchHits.
+func (r *memoryRepository) Search(table *MetaTable, query string, filter bson.D, page *Page) (*SearchResult, error) {
+	hits, err := r.searchHits(table, query, filter)
+	if err != nil {
+		return nil, err
+	}
+	result := &SearchResult{Total: int64(len(hits)), Hits: hits}
+	skip, limit := page.skipLimit()
+	if skip >= int64(len(hits)) {
+		result.Hits = []*SearchHit{}
+		return result, nil
+	}
+	result.Hits = hits[skip:]
+	if limit > 0 && limit < int64(len(result.Hits)) {
+		result.Hits = result.Hits[:limit]
+	}
+	return result, nil
+}
+
+// searchHits returns the records matching filter and the terms of query best first, every record
+// matching filter for an empty query. Longer terms weigh more and repeated ones a little more.
+func (r *memoryRepository) searchHits(table *MetaTable, query string, filter bson.D) ([]*SearchHit, error) {
+	dors, err := r.Find(table, &Query{Filter: filter})
+	if err != nil {
+		return nil, err
+	}
+	terms := map[string]bool{}
+	for _, term := range strings.Fields(query) {
+		terms[term] = true
+	}
+	hits := []*SearchHit{}
+	for _, dor := range dors {
+		stored, _ := dor.Get(SearchColumn)
+		text, _ := stored.(string)
+		counts := map[string]int{}
+		for _, term := range strings.Fields(text) {
+			if terms[term] {
+				counts[term]++
+			}
+		}
+		score := 0.0
+		for term, count := range counts {
+			score += float64(utf8.RuneCountInString(term)) * (1 + math.Log(float64(count)))
+		}
+		if score > 0 || len(terms) == 0 {
+			record := DataObjectResp(withoutKey(bson.D(*dor), SearchColumn))
+			hits = append(hits, &SearchHit{Record: &record, Score: score})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+	return hits, nil
+}
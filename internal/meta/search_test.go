@@ -0,0 +1,124 @@
+package meta_test
+
+import (
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const productsYAML = `
+- name: products
+  columns:
+    - name: name
+      dataType: string
+      attributes:
+        - {name: searchable, value: true}
+    - name: description
+      dataType: string
+      isNullable: true
+      attributes:
+        - {name: searchable, value: true}
+    - name: brand
+      dataType: string
+    - name: price
+      dataType: decimal
+      isNullable: true
+    - name: specifications
+      dataType: json
+      isArray: true
+      isNullable: true
+      nestedColumns:
+        - name: name
+          dataType: string
+        - name: value
+          dataType: string
+    - name: medias
+      dataType: json
+      isArray: true
+      isNullable: true
+      nestedColumns:
+        - name: caption
+          dataType: string
+          isNullable: true
+          attributes:
+            - {name: searchable, value: true}
+`
+
+func TestNGramTokenizer(t *testing.T) {
+	assert.Equal(t, []string{"绿", "茶", "饮", "料", "绿茶", "茶饮", "饮料", "500ml", "tea"}, meta.NGramTokenizer{}.Tokens("绿茶饮料 500ml, Tea"))
+	assert.Equal(t, []string{"绿", "茶", "绿茶"}, meta.NGramTokenizer{N: 3}.Tokens("绿茶"))
+	assert.Empty(t, meta.NGramTokenizer{}.Tokens(" ,. "))
+}
+
+func TestSearch(t *testing.T) {
+	tables, err := meta.UnmarshalMetaTablesYAML([]byte(productsYAML))
+	assert.NoError(t, err)
+	products := tables[0]
+	repository := meta.NewMemoryRepository()
+	service := meta.NewService(&repository)
+	_, err = service.InsertMetaTable(products)
+	assert.NoError(t, err)
+
+	changes, err := service.SyncIndexes(products, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"products_search"}, changes.Created)
+
+	ids := map[string]meta.ID{}
+	for _, record := range []string{
+		`{"name": "西湖龙井绿茶", "description": "明前采摘的绿茶，清香回甘", "brand": "a"}`,
+		`{"name": "铁观音", "description": "乌龙茶", "brand": "a", "medias": [{"caption": "茶园的绿茶树"}]}`,
+		`{"name": "Green Tea Latte", "brand": "b"}`,
+	} {
+		id, err := service.InsertOne(products, cart(t, products, record))
+		assert.NoError(t, err)
+		do := cart(t, products, record)
+		name, _ := do.GetPath("name")
+		ids[name.(string)] = *id
+	}
+
+	result, err := service.Search(products, "绿茶", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), result.Total)
+	first, _ := result.Hits[0].Record.GetString("name")
+	assert.Equal(t, "西湖龙井绿茶", first, "more matching terms rank first")
+	assert.Equal(t, map[string][]string{
+		"name":        {"西湖龙井<em>绿茶</em>"},
+		"description": {"明前采摘的<em>绿茶</em>，清香回甘"},
+	}, result.Hits[0].Highlights)
+	assert.Equal(t, map[string][]string{"medias.caption": {"<em>茶</em>园的<em>绿茶</em>树"}, "description": {"乌龙<em>茶</em>"}}, result.Hits[1].Highlights)
+	_, hidden := result.Hits[0].Record.Get(meta.SearchColumn)
+	assert.False(t, hidden)
+
+	result, err = service.Search(products, "green TEA", bson.D{{Key: "brand", Value: "b"}}, &meta.Page{Number: 1, Size: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.Total)
+	assert.Equal(t, map[string][]string{"name": {"<em>Green</em> <em>Tea</em> Latte"}}, result.Hits[0].Highlights)
+
+	result, err = service.Search(products, "茶", nil, &meta.Page{Number: 2, Size: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), result.Total)
+	assert.Len(t, result.Hits, 1)
+
+	//a patch of a searchable column updates the terms
+	assert.NoError(t, service.PatchOne(products, ids["Green Tea Latte"], &meta.DataObject{"description": "抹茶拿铁"}))
+	result, err = service.Search(products, "抹茶", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), result.Total)
+	first, _ = result.Hits[0].Record.GetString("name")
+	assert.Equal(t, "Green Tea Latte", first)
+	result, err = service.Search(products, "latte", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.Total, "the terms of the other columns are kept")
+
+	dor, err := service.FindOne(products, ids["铁观音"])
+	assert.NoError(t, err)
+	_, hidden = dor.Get(meta.SearchColumn)
+	assert.False(t, hidden)
+
+	carts := fixtureCarts(t)
+	_, err = service.Search(carts, "gift", nil, nil)
+	_, ok := err.(*meta.ValidationError)
+	assert.True(t, ok, "%v", err)
+}
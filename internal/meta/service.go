@@ -2,22 +2,147 @@ package meta
 
 import (
 	"bytes"
+	"context"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type MetaService interface {
 	Repository
 	FindAllToJson(table *MetaTable) (string, error)
+	//FindOneAsOf rebuilds a record from its history as it was at the given time
+	FindOneAsOf(table *MetaTable, id ID, at time.Time) (*DataObjectResp, error)
+	//WithContext returns a service bound to ctx, the actor of ctx is used to track records
+	WithContext(ctx context.Context) MetaService
+	//ResolveLabels adds the dictionary label next to the value of every dictionary column
+	ResolveLabels(table *MetaTable, dors ...*DataObjectResp) error
+	//RenderForm describes the editor of a table for the admin frontend
+	RenderForm(table *MetaTable) (*Form, error)
+	//WithTransaction runs fn atomically, every call made on tx is committed or rolled back together
+	WithTransaction(ctx context.Context, fn func(tx MetaService) error) error
+	//Validate runs the checks of InsertOne on value without writing it, decimals are rounded
+	//and stored computed columns evaluated in place
+	Validate(table *MetaTable, value *DataObject) error
+	//Search finds the records whose searchable columns hold the terms of query, ranked by relevance
+	//and highlighted, filter narrows them like Query.Filter
+	Search(table *MetaTable, query string, filter bson.D, page *Page) (*SearchResult, error)
+	//Facets counts the records of the same result set as Search by facet, in one round trip
+	Facets(table *MetaTable, query string, filter bson.D, facets []*Facet) (map[string][]*FacetBucket, error)
+	//CheckFilter rejects a client filter on the deleted column of a soft deleting table,
+	//deleted records are only read through a service made WithDeleted
+	CheckFilter(table *MetaTable, filter bson.D) error
 }
 type service struct {
 	Repository
+	ctx          context.Context
+	registry     *Registry
+	dictionaries *DictionaryCache
+	trackColumns TrackColumns
+	currencies   string
+	tokenizer    Tokenizer
+	//reads include the records flagged as deleted
+	deleted bool
+	//meta tables inserted inside a transaction, registered once it commits
+	pending *[]*MetaTable
+}
+
+type ServiceOption func(*service)
+
+//WithRegistry resolves meta tables from the registry instead of querying the repository.
+func WithRegistry(registry *Registry) ServiceOption {
+	return func(s *service) {
+		s.registry = registry
+	}
+}
+
+//WithDictionaryCache serves dictionary lookups from the cache, it is invalidated by writes made through the service.
+func WithDictionaryCache(cache *DictionaryCache) ServiceOption {
+	return func(s *service) {
+		s.dictionaries = cache
+	}
 }
 
-func NewService(repository *Repository) MetaService {
-	return &service{
-		Repository: *repository,
+//WithTrackColumns overrides the column names stamped on inserted, updated and deleted records.
+func WithTrackColumns(columns TrackColumns) ServiceOption {
+	return func(s *service) {
+		s.trackColumns = columns
 	}
 }
+
+//WithCurrencies checks the currency of {currency, amount} columns against a dictionary group.
+func WithCurrencies(group string) ServiceOption {
+	return func(s *service) {
+		s.currencies = group
+	}
+}
+
+//WithTokenizer splits the searchable columns into search terms, NGramTokenizer by default.
+func WithTokenizer(tokenizer Tokenizer) ServiceOption {
+	return func(s *service) {
+		s.tokenizer = tokenizer
+	}
+}
+
+//WithDeleted reads the records flagged as deleted along with the live ones, for audits and restores.
+func WithDeleted() ServiceOption {
+	return func(s *service) {
+		s.deleted = true
+	}
+}
+
+func NewService(repository *Repository, options ...ServiceOption) MetaService {
+	s := &service{
+		Repository:   *repository,
+		ctx:          context.Background(),
+		trackColumns: DefaultTrackColumns,
+		tokenizer:    NGramTokenizer{N: 2},
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+func (s *service) WithContext(ctx context.Context) MetaService {
+	copied := *s
+	copied.ctx = ctx
+	return &copied
+}
+
+func (s *service) WithTransaction(ctx context.Context, fn func(tx MetaService) error) error {
+	if s.pending != nil {
+		//already inside a transaction
+		return fn(s)
+	}
+	var pending []*MetaTable
+	err := s.Repository.RunTransaction(ctx, func(repository Repository) error {
+		pending = nil
+		tx := *s
+		tx.Repository = repository
+		tx.ctx = ctx
+		if actor := s.actor(); actor != nil && ActorFromContext(ctx) == nil {
+			//keep the actor bound by WithContext
+			tx.ctx = WithActor(ctx, *actor)
+		}
+		tx.pending = &pending
+		return fn(&tx)
+	})
+	if err != nil {
+		return err
+	}
+	if s.registry != nil {
+		for _, table := range pending {
+			s.registry.Put(table)
+		}
+	}
+	return nil
+}
+
+func (s *service) actor() *ID {
+	return ActorFromContext(s.ctx)
+}
+
 func (s *service) FindAllToJson(table *MetaTable) (string, error) {
 	dors, err := s.FindAll(table)
 	if err != nil {
@@ -26,30 +151,249 @@ func (s *service) FindAllToJson(table *MetaTable) (string, error) {
 	return ToJson(dors)
 }
 
+func (s *service) FindMetaTableById(id ID) (*MetaTable, error) {
+	if s.registry != nil {
+		if table, ok := s.registry.GetById(id); ok {
+			return table, nil
+		}
+	}
+	return s.Repository.FindMetaTableById(id)
+}
+
+func (s *service) FindMetaTableByName(tableName string) (*MetaTable, error) {
+	if s.registry != nil {
+		if table, ok := s.registry.Get(tableName); ok {
+			return table, nil
+		}
+	}
+	return s.Repository.FindMetaTableByName(tableName)
+}
+
+func (s *service) FindAllMetaTables() ([]*MetaTable, error) {
+	if s.registry != nil && s.registry.Loaded() {
+		return s.registry.All(), nil
+	}
+	return s.Repository.FindAllMetaTables()
+}
+
 func (s *service) InsertMetaTable(table *MetaTable) (*ID, error) {
+	if err := table.Validate(); err != nil {
+		return nil, err
+	}
 	if len(table.ModelName) == 0 {
 		table.ModelName = table.Name
 	}
 	setTrack(table, nil)
-	return s.Repository.InsertMetaTable(table)
+	id, err := s.Repository.InsertMetaTable(table)
+	if err != nil {
+		return nil, err
+	}
+	s.register(table, id)
+	return id, nil
 }
 
 func (s *service) InsertManyMetaTables(tables []*MetaTable) ([]*ID, error) {
 	for _, table := range tables {
+		if err := table.Validate(); err != nil {
+			return nil, err
+		}
 		if len(table.ModelName) == 0 {
 			table.ModelName = table.Name
 		}
 		setTrack(table, nil)
 	}
-	return s.Repository.InsertManyMetaTables(tables)
+	ids, err := s.Repository.InsertManyMetaTables(tables)
+	if err != nil {
+		return nil, err
+	}
+	for i, table := range tables {
+		s.register(table, ids[i])
+	}
+	return ids, nil
+}
+
+//UpdateMetaTable replaces a meta table, keeping when and by whom it was created
+func (s *service) UpdateMetaTable(table *MetaTable) error {
+	if err := table.Validate(); err != nil {
+		return err
+	}
+	existing, err := s.Repository.FindMetaTableById(ID(table.Id))
+	if err != nil {
+		return err
+	}
+	if len(table.ModelName) == 0 {
+		table.ModelName = table.Name
+	}
+	table.CreatedAt = existing.CreatedAt
+	table.CreatedBy = existing.CreatedBy
+	table.UpdatedAt = time.Now()
+	table.UpdatedBy = s.actor()
+	if err := s.Repository.UpdateMetaTable(table); err != nil {
+		return err
+	}
+	id := ID(table.Id)
+	s.register(table, &id)
+	return nil
+}
+
+//DeleteMetaTable removes a meta table, the records of the table are kept
+func (s *service) DeleteMetaTable(id ID) error {
+	if err := s.Repository.DeleteMetaTable(id); err != nil {
+		return err
+	}
+	if s.registry != nil {
+		s.registry.Remove(id)
+	}
+	return nil
+}
+
+func (s *service) register(table *MetaTable, id *ID) {
+	if s.registry == nil || id == nil {
+		return
+	}
+	table.Id = id.ToObjectId()
+	if s.pending != nil {
+		*s.pending = append(*s.pending, table)
+		return
+	}
+	s.registry.Put(table)
+}
+
+func (s *service) Validate(table *MetaTable, value *DataObject) error {
+	if err := s.validateEnums(table, value); err != nil {
+		return err
+	}
+	if err := s.normalizeDecimals(table, "", table.Columns, *value); err != nil {
+		return err
+	}
+	return computeColumns(table.Columns, *value)
+}
+
+func (s *service) InsertOne(table *MetaTable, value *DataObject) (*ID, error) {
+	if err := s.Validate(table, value); err != nil {
+		return nil, err
+	}
+	s.trackColumns.stampInsert(table, value, s.actor(), time.Now())
+	s.stampSearch(table, value)
+	id, err := s.Repository.InsertOne(table, value)
+	if err != nil {
+		return nil, err
+	}
+	return id, s.recordHistory(table, HistoryOperationInsert, *id, nil)
 }
 
 func (s *service) InsertMany(table *MetaTable, values []*DataObject) ([]*ID, error) {
-	// for _, value := range values {
-	// 	setTrack(table,nil)
-	// }
-	
-	return s.Repository.InsertMany(table, values)
+	now := time.Now()
+	for _, value := range values {
+		if err := s.Validate(table, value); err != nil {
+			return nil, err
+		}
+		s.trackColumns.stampInsert(table, value, s.actor(), now)
+		s.stampSearch(table, value)
+	}
+	ids, err := s.Repository.InsertMany(table, values)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := s.recordHistory(table, HistoryOperationInsert, *id, nil); err != nil {
+			return ids, err
+		}
+	}
+	return ids, nil
+}
+
+func (s *service) UpdateOne(table *MetaTable, id ID, value *DataObject) error {
+	return s.update(table, id, value, nil)
+}
+
+func (s *service) UpdateOneWithVersion(table *MetaTable, id ID, value *DataObject, version int64) error {
+	return s.update(table, id, value, &version)
+}
+
+func (s *service) update(table *MetaTable, id ID, value *DataObject, version *int64) error {
+	if err := s.Validate(table, value); err != nil {
+		return err
+	}
+	existing, err := s.Repository.FindOne(table, id)
+	if err != nil {
+		return err
+	}
+	if s.trackColumns.isDeleted(table, existing) && !s.trackColumns.restores(table, value) {
+		return mongo.ErrNoDocuments
+	}
+	if version != nil && existing.Version() != *version {
+		return &ConflictError{Table: table.Name, Id: id, Expected: *version, Actual: existing.Version()}
+	}
+	s.trackColumns.stampUpdate(table, value, existing, s.actor(), time.Now())
+	s.stampSearch(table, value)
+	if version != nil {
+		err = s.Repository.UpdateOneWithVersion(table, id, value, *version)
+	} else {
+		err = s.Repository.UpdateOne(table, id, value)
+	}
+	if err != nil {
+		return err
+	}
+	return s.recordHistory(table, HistoryOperationUpdate, id, existing)
+}
+
+func (s *service) PatchOne(table *MetaTable, id ID, value *DataObject) error {
+	return s.patch(table, id, value, nil)
+}
+
+func (s *service) PatchOneWithVersion(table *MetaTable, id ID, value *DataObject, version int64) error {
+	return s.patch(table, id, value, &version)
+}
+
+func (s *service) patch(table *MetaTable, id ID, value *DataObject, version *int64) error {
+	if err := s.validateEnums(table, value); err != nil {
+		return err
+	}
+	if err := s.normalizeDecimals(table, "", table.Columns, *value); err != nil {
+		return err
+	}
+	before, err := s.findBefore(table, id, value)
+	if err != nil {
+		return err
+	}
+	if s.trackColumns.isDeleted(table, before) {
+		s.trackColumns.clearDeleted(table, value)
+	}
+	if err := s.computePatch(table, id, value); err != nil {
+		return err
+	}
+	if err := s.stampPatchSearch(table, id, value); err != nil {
+		return err
+	}
+	s.trackColumns.stampPatch(table, value, s.actor(), time.Now())
+	if version != nil {
+		err = s.Repository.PatchOneWithVersion(table, id, value, *version)
+	} else {
+		err = s.Repository.PatchOne(table, id, value)
+	}
+	if err != nil {
+		return err
+	}
+	return s.recordHistory(table, HistoryOperationUpdate, id, before)
+}
+
+//DeleteOne flags the record as deleted when the table has a deleted column, otherwise removes it.
+//A record already flagged is not found.
+func (s *service) DeleteOne(table *MetaTable, id ID) error {
+	before, err := s.findBefore(table, id, nil)
+	if err != nil {
+		return err
+	}
+	if s.trackColumns.softDelete(table) {
+		err = s.Repository.PatchOne(table, id, s.trackColumns.stampDelete(table, s.actor(), time.Now()))
+	} else {
+		err = s.Repository.DeleteOne(table, id)
+	}
+	if err != nil {
+		return err
+	}
+	return s.recordHistory(table, HistoryOperationDelete, id, before)
 }
 func setTrack(table *MetaTable, updateBy *ID) {
 	table.CreatedAt = time.Now()
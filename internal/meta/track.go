@@ -0,0 +1,167 @@
+package meta
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TrackColumns names the columns used to stamp audit information on records.
+// A column is only stamped when the meta table declares it.
+type TrackColumns struct {
+	CreatedAt string
+	UpdatedAt string
+	CreatedBy string
+	UpdatedBy string
+	Deleted   string
+	DeletedAt string
+}
+
+// DefaultTrackColumns matches the columns used by the existing schemas.
+var DefaultTrackColumns = TrackColumns{
+	CreatedAt: "createAt",
+	UpdatedAt: "updateAt",
+	CreatedBy: "createBy",
+	UpdatedBy: "updateBy",
+	Deleted:   "deleted",
+	DeletedAt: "deleteAt",
+}
+
+// Has tells whether name is one of the track columns.
+func (tc TrackColumns) Has(name string) bool {
+	switch name {
+	case tc.CreatedAt, tc.CreatedBy, tc.UpdatedAt, tc.UpdatedBy, tc.DeletedAt, tc.Deleted:
+		return len(name) > 0
+	}
+	return false
+}
+
+func (tc TrackColumns) put(table *MetaTable, do *DataObject, column string, value interface{}) {
+	if column == "" || table.Column(column) == nil {
+		return
+	}
+	if value == nil {
+		delete(*do, column)
+		return
+	}
+	do.Put(column, value)
+}
+
+func actorValue(actor *ID) interface{} {
+	if actor == nil {
+		return nil
+	}
+	return actor.ToObjectId()
+}
+
+// stampInsert sets the created and updated columns, discarding values sent by the caller.
+func (tc TrackColumns) stampInsert(table *MetaTable, do *DataObject, actor *ID, now time.Time) {
+	tc.put(table, do, tc.CreatedAt, now)
+	tc.put(table, do, tc.UpdatedAt, now)
+	tc.put(table, do, tc.CreatedBy, actorValue(actor))
+	tc.put(table, do, tc.UpdatedBy, actorValue(actor))
+}
+
+// stampUpdate sets the updated columns and restores the created columns from the stored record.
+func (tc TrackColumns) stampUpdate(table *MetaTable, do *DataObject, existing *DataObjectResp, actor *ID, now time.Time) {
+	var stored bson.M
+	if existing != nil {
+		stored = bson.D(*existing).Map()
+	}
+	tc.put(table, do, tc.CreatedAt, stored[tc.CreatedAt])
+	tc.put(table, do, tc.CreatedBy, stored[tc.CreatedBy])
+	tc.put(table, do, tc.UpdatedAt, now)
+	tc.put(table, do, tc.UpdatedBy, actorValue(actor))
+}
+
+// stampPatch sets the updated columns and drops any attempt to change the created columns.
+func (tc TrackColumns) stampPatch(table *MetaTable, do *DataObject, actor *ID, now time.Time) {
+	delete(*do, tc.CreatedAt)
+	delete(*do, tc.CreatedBy)
+	tc.put(table, do, tc.UpdatedAt, now)
+	tc.put(table, do, tc.UpdatedBy, actorValue(actor))
+}
+
+// softDelete reports whether the table flags deleted records instead of removing them.
+func (tc TrackColumns) softDelete(table *MetaTable) bool {
+	return tc.Deleted != "" && table.Column(tc.Deleted) != nil
+}
+
+func (tc TrackColumns) stampDelete(table *MetaTable, actor *ID, now time.Time) *DataObject {
+	do := DataObject{}
+	tc.put(table, &do, tc.Deleted, true)
+	tc.put(table, &do, tc.DeletedAt, now)
+	tc.put(table, &do, tc.UpdatedAt, now)
+	tc.put(table, &do, tc.UpdatedBy, actorValue(actor))
+	return &do
+}
+
+// live narrows filter to the records not flagged as deleted.
+func (tc TrackColumns) live(table *MetaTable, filter bson.D) bson.D {
+	if !tc.softDelete(table) {
+		return filter
+	}
+	alive := bson.D{{Key: tc.Deleted, Value: bson.D{{Key: "$ne", Value: true}}}}
+	if len(filter) == 0 {
+		return alive
+	}
+	return bson.D{{Key: "$and", Value: bson.A{filter, alive}}}
+}
+
+// live narrows filter to the records not flagged as deleted, unless the service reads them.
+func (s *service) live(table *MetaTable, filter bson.D) bson.D {
+	if s.deleted {
+		return filter
+	}
+	return s.trackColumns.live(table, filter)
+}
+
+func (s *service) CheckFilter(table *MetaTable, filter bson.D) error {
+	if s.deleted || !s.trackColumns.softDelete(table) || !s.trackColumns.filtersDeleted(filter) {
+		return nil
+	}
+	return &ValidationError{Table: table.Name, Column: s.trackColumns.Deleted, Message: "deleted records cannot be filtered"}
+}
+
+// filtersDeleted tells whether filter refers to the deleted column, through $and, $or and $nor.
+func (tc TrackColumns) filtersDeleted(filter bson.D) bool {
+	for _, e := range filter {
+		if e.Key == tc.Deleted {
+			return true
+		}
+		if e.Key == "$and" || e.Key == "$or" || e.Key == "$nor" {
+			for _, clause := range itemsOf(e.Value) {
+				if d, ok := queryDocument(clause); ok && tc.filtersDeleted(d) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isDeleted reports whether a stored record is flagged as deleted.
+func (tc TrackColumns) isDeleted(table *MetaTable, dor *DataObjectResp) bool {
+	if !tc.softDelete(table) || dor == nil {
+		return false
+	}
+	deleted, _ := dor.Get(tc.Deleted)
+	return deleted == true
+}
+
+// restores reports whether a write clears the deleted flag of a record.
+func (tc TrackColumns) restores(table *MetaTable, value *DataObject) bool {
+	if !tc.softDelete(table) || value == nil {
+		return false
+	}
+	deleted, ok := (*value)[tc.Deleted]
+	return ok && deleted == false
+}
+
+// clearDeleted sets the deleted columns of a write restoring a record.
+func (tc TrackColumns) clearDeleted(table *MetaTable, do *DataObject) {
+	(*do)[tc.Deleted] = false
+	if tc.DeletedAt != "" && table.Column(tc.DeletedAt) != nil {
+		(*do)[tc.DeletedAt] = nil
+	}
+}
@@ -0,0 +1,171 @@
+package meta_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type recordingRepository struct {
+	meta.Repository
+	stored  *meta.DataObjectResp
+	written *meta.DataObject
+	patched *meta.DataObject
+	deleted bool
+}
+
+func (r *recordingRepository) FindOne(table *meta.MetaTable, id meta.ID) (*meta.DataObjectResp, error) {
+	return r.stored, nil
+}
+
+func (r *recordingRepository) InsertOne(table *meta.MetaTable, value *meta.DataObject) (*meta.ID, error) {
+	r.written = value
+	id := meta.ID(primitive.NewObjectID())
+	return &id, nil
+}
+
+func (r *recordingRepository) UpdateOne(table *meta.MetaTable, id meta.ID, value *meta.DataObject) error {
+	r.written = value
+	return nil
+}
+
+func (r *recordingRepository) PatchOne(table *meta.MetaTable, id meta.ID, value *meta.DataObject) error {
+	r.patched = value
+	return nil
+}
+
+func (r *recordingRepository) DeleteOne(table *meta.MetaTable, id meta.ID) error {
+	r.deleted = true
+	return nil
+}
+
+func TestTrackRecordOnInsertAndUpdate(t *testing.T) {
+	recorder := &recordingRepository{}
+	var repository meta.Repository = recorder
+	actor := meta.ID(primitive.NewObjectID())
+	metaService := meta.NewService(&repository).WithContext(meta.WithActor(context.Background(), actor))
+
+	product := meta.DataObject{"name": "Apple iPhone 13", "createBy": "5c3c8f8f9f8f8e2c6a0a0a0a"}
+	_, err := metaService.InsertOne(&brandsMetaTable, &product)
+	assert.NoError(t, err)
+	assert.Equal(t, actor.ToObjectId(), product["createBy"])
+	assert.Equal(t, actor.ToObjectId(), product["updateBy"])
+	assert.IsType(t, time.Time{}, product["createAt"])
+
+	createdAt := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	creator := primitive.NewObjectID()
+	recorder.stored = &meta.DataObjectResp{
+		{Key: "name", Value: "Apple iPhone 13"},
+		{Key: "createAt", Value: createdAt},
+		{Key: "createBy", Value: creator},
+	}
+	update := meta.DataObject{"name": "Apple iPhone 13 Pro", "createAt": time.Now()}
+	err = metaService.UpdateOne(&brandsMetaTable, meta.NilObjectID(), &update)
+	assert.NoError(t, err)
+	assert.Equal(t, createdAt, update["createAt"])
+	assert.Equal(t, creator, update["createBy"])
+	assert.Equal(t, actor.ToObjectId(), update["updateBy"])
+}
+
+func TestTrackRecordOnDelete(t *testing.T) {
+	recorder := &recordingRepository{}
+	var repository meta.Repository = recorder
+	metaService := meta.NewService(&repository)
+
+	err := metaService.DeleteOne(&brandsMetaTable, meta.NilObjectID())
+	assert.NoError(t, err)
+	assert.False(t, recorder.deleted)
+	assert.Equal(t, true, (*recorder.patched)["deleted"])
+	assert.IsType(t, time.Time{}, (*recorder.patched)["deleteAt"])
+
+	err = metaService.DeleteOne(&cartsMetaTable, meta.NilObjectID())
+	assert.NoError(t, err)
+	assert.True(t, recorder.deleted)
+}
+
+func TestTrackColumnsOnlyStampDeclaredColumns(t *testing.T) {
+	recorder := &recordingRepository{}
+	var repository meta.Repository = recorder
+	metaService := meta.NewService(&repository)
+
+	cart := meta.DataObject{"userId": primitive.NewObjectID()}
+	_, err := metaService.InsertOne(&cartsMetaTable, &cart)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(bson.M(cart)))
+
+	metaService = meta.NewService(&repository, meta.WithTrackColumns(meta.TrackColumns{UpdatedAt: "lastModified"}))
+	table := meta.MetaTable{Name: "notes", Columns: []*meta.MetaColumn{{Name: "lastModified", DataType: meta.DataTypeDateTime}}}
+	note := meta.DataObject{}
+	_, err = metaService.InsertOne(&table, &note)
+	assert.NoError(t, err)
+	assert.IsType(t, time.Time{}, note["lastModified"])
+}
+
+func TestSoftDeletedRecordsAreHidden(t *testing.T) {
+	repository := meta.NewMemoryRepository()
+	metaService := meta.NewService(&repository)
+	brands := brandsMetaTable
+	brands.History = true
+	_, err := metaService.InsertMetaTable(&brands)
+	assert.NoError(t, err)
+	id, err := metaService.InsertOne(&brands, &meta.DataObject{"name": "Apple"})
+	assert.NoError(t, err)
+	_, err = metaService.InsertOne(&brands, &meta.DataObject{"name": "Huawei"})
+	assert.NoError(t, err)
+	assert.NoError(t, metaService.DeleteOne(&brands, *id))
+
+	_, err = metaService.FindOne(&brands, *id)
+	assert.Equal(t, mongo.ErrNoDocuments, err)
+	all, err := metaService.FindAll(&brands)
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+	found, err := metaService.Find(&brands, &meta.Query{Filter: bson.D{{Key: "name", Value: "Apple"}}})
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+	found, err = metaService.Find(&brands, nil)
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	count, err := metaService.Count(&brands, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	_, err = metaService.FindOneAsOf(&brands, *id, time.Now())
+	assert.Equal(t, mongo.ErrNoDocuments, err)
+	assert.Equal(t, mongo.ErrNoDocuments, metaService.DeleteOne(&brands, *id))
+	assert.Equal(t, mongo.ErrNoDocuments, metaService.PatchOne(&brands, *id, &meta.DataObject{"name": "Apple Inc."}))
+
+	//a filter on the deleted column does not reveal them
+	deleted := bson.D{{Key: "deleted", Value: true}}
+	found, err = metaService.Find(&brands, &meta.Query{Filter: deleted})
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+	found, err = metaService.Find(&brands, &meta.Query{Filter: bson.D{{Key: "$or", Value: bson.A{deleted, bson.D{{Key: "name", Value: "Apple"}}}}}})
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+	_, ok := metaService.CheckFilter(&brands, bson.D{{Key: "$or", Value: bson.A{deleted}}}).(*meta.ValidationError)
+	assert.True(t, ok)
+	assert.NoError(t, metaService.CheckFilter(&brands, bson.D{{Key: "name", Value: "Apple"}}))
+
+	//on purpose through a service reading them
+	withDeleted := meta.NewService(&repository, meta.WithDeleted())
+	assert.NoError(t, withDeleted.CheckFilter(&brands, deleted))
+	found, err = withDeleted.Find(&brands, &meta.Query{Filter: deleted})
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	_, err = withDeleted.FindOne(&brands, *id)
+	assert.NoError(t, err)
+
+	//a patch clearing the flag restores the record
+	assert.NoError(t, metaService.PatchOne(&brands, *id, &meta.DataObject{"deleted": false}))
+	brand, err := metaService.FindOne(&brands, *id)
+	assert.NoError(t, err)
+	deleteAt, _ := brand.Get("deleteAt")
+	assert.Nil(t, deleteAt)
+	_, err = metaService.FindOneAsOf(&brands, *id, time.Now())
+	assert.NoError(t, err)
+}
@@ -0,0 +1,109 @@
+package meta_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newMemoryService(t *testing.T) meta.MetaService {
+	repository := meta.NewMemoryRepository()
+	metaService := meta.NewService(&repository)
+	products, brands, carts := productMetaTable, brandsMetaTable, cartsMetaTable
+	_, err := metaService.InsertManyMetaTables([]*meta.MetaTable{&products, &brands, &carts})
+	assert.NoError(t, err)
+	return metaService
+}
+
+func TestWithTransactionCommits(t *testing.T) {
+	metaService := newMemoryService(t)
+	brands, _ := metaService.FindMetaTableByName("brands")
+	carts, _ := metaService.FindMetaTableByName("carts")
+
+	err := metaService.WithTransaction(context.Background(), func(tx meta.MetaService) error {
+		if _, err := tx.InsertOne(brands, &meta.DataObject{"name": "Apple"}); err != nil {
+			return err
+		}
+		_, err := tx.InsertOne(carts, &meta.DataObject{"userId": primitive.NewObjectID()})
+		return err
+	})
+	assert.NoError(t, err)
+	all, _ := metaService.FindAll(brands)
+	assert.Equal(t, 1, len(all))
+	all, _ = metaService.FindAll(carts)
+	assert.Equal(t, 1, len(all))
+}
+
+func TestWithTransactionRollsBack(t *testing.T) {
+	metaService := newMemoryService(t)
+	brands, _ := metaService.FindMetaTableByName("brands")
+	id, err := metaService.InsertOne(brands, &meta.DataObject{"name": "Apple"})
+	assert.NoError(t, err)
+
+	failure := errors.New("out of stock")
+	err = metaService.WithTransaction(context.Background(), func(tx meta.MetaService) error {
+		if err := tx.PatchOne(brands, *id, &meta.DataObject{"name": "Huawei"}); err != nil {
+			return err
+		}
+		if _, err := tx.InsertOne(brands, &meta.DataObject{"name": "Xiaomi"}); err != nil {
+			return err
+		}
+		return failure
+	})
+	assert.Equal(t, failure, err)
+
+	all, _ := metaService.FindAll(brands)
+	assert.Equal(t, 1, len(all))
+	brand, err := metaService.FindOne(brands, *id)
+	assert.NoError(t, err)
+	name, _ := brand.Get("name")
+	assert.Equal(t, "Apple", name)
+	assert.Equal(t, int64(1), brand.Version())
+}
+
+func TestWithTransactionLoadsDictionaries(t *testing.T) {
+	metaService := newEnumService(t)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- metaService.WithTransaction(context.Background(), func(tx meta.MetaService) error {
+			_, err := tx.InsertOne(&ordersMetaTable, &meta.DataObject{"status": "paid"})
+			return err
+		})
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the transaction waits on the dictionary cache")
+	}
+	all, _ := metaService.FindAll(&ordersMetaTable)
+	assert.Equal(t, 1, len(all))
+
+	//the group loaded inside the transaction was not cached
+	_, err := metaService.InsertOne(&ordersMetaTable, &meta.DataObject{"status": "paid"})
+	assert.NoError(t, err)
+}
+
+func TestWithTransactionKeepsActor(t *testing.T) {
+	actor := meta.ID(primitive.NewObjectID())
+	metaService := newMemoryService(t).WithContext(meta.WithActor(context.Background(), actor))
+	brands, _ := metaService.FindMetaTableByName("brands")
+
+	var id *meta.ID
+	err := metaService.WithTransaction(context.Background(), func(tx meta.MetaService) error {
+		var err error
+		id, err = tx.InsertOne(brands, &meta.DataObject{"name": "Apple"})
+		return err
+	})
+	assert.NoError(t, err)
+	brand, err := metaService.FindOne(brands, *id)
+	assert.NoError(t, err)
+	createBy, _ := brand.Get("createBy")
+	assert.Equal(t, actor.ToObjectId(), createBy)
+}
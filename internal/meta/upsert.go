@@ -0,0 +1,255 @@
+package meta
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UpsertResult counts the records written by Upsert and UpsertMany, Ids holds the id of the record
+// of every value in order.
+type UpsertResult struct {
+	Inserted  int   `json:"inserted"`
+	Updated   int   `json:"updated"`
+	Unchanged int   `json:"unchanged"`
+	Ids       []*ID `json:"ids"`
+}
+
+func (r *UpsertResult) add(other *UpsertResult) {
+	r.Inserted += other.Inserted
+	r.Updated += other.Updated
+	r.Unchanged += other.Unchanged
+	r.Ids = append(r.Ids, other.Ids...)
+}
+
+// upsertOps are the writes an upsert is made of, the service passes its own to validate,
+// track and record history. restore, when set, returns the patch reviving a matched record
+// flagged as deleted, nil for any other record.
+type upsertOps struct {
+	find    func(table *MetaTable, query *Query) ([]*DataObjectResp, error)
+	insert  func(table *MetaTable, value *DataObject) (*ID, error)
+	patch   func(table *MetaTable, id ID, value *DataObject, version int64) error
+	restore func(table *MetaTable, existing *DataObjectResp, value *DataObject) *DataObject
+}
+
+// upsert matches the record having the values of keyColumns of value. A missing record is inserted,
+// a record whose columns already hold the values of value is left unchanged and any other is patched
+// at the version it was read, retrying when it changed in between.
+func upsert(ops upsertOps, table *MetaTable, keyColumns []string, value *DataObject) (*UpsertResult, error) {
+	filter, err := keyFilter(table, keyColumns, value)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; ; i++ {
+		found, err := ops.find(table, &Query{Filter: filter, Limit: 2})
+		if err != nil {
+			return nil, err
+		}
+		if len(found) > 1 {
+			return nil, &ValidationError{Table: table.Name, Column: strings.Join(keyColumns, ","), Message: "key matches several records"}
+		}
+		if len(found) == 0 {
+			id, err := ops.insert(table, value)
+			if mongo.IsDuplicateKeyError(err) && i < maxVersionRetries {
+				//inserted in between, update it
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			return &UpsertResult{Inserted: 1, Ids: []*ID{id}}, nil
+		}
+		existing := found[0]
+		oid, _ := existing.Get("_id")
+		id := ParseID(oid)
+		patch := value
+		if ops.restore != nil {
+			if restored := ops.restore(table, existing, value); restored != nil {
+				patch = restored
+			}
+		}
+		if patch == value && holds(existing, value) {
+			return &UpsertResult{Unchanged: 1, Ids: []*ID{&id}}, nil
+		}
+		err = ops.patch(table, id, patch, existing.Version())
+		if _, conflict := err.(*ConflictError); conflict && i < maxVersionRetries {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &UpsertResult{Updated: 1, Ids: []*ID{&id}}, nil
+	}
+}
+
+func upsertMany(ops upsertOps, table *MetaTable, keyColumns []string, values []*DataObject) (*UpsertResult, error) {
+	result := &UpsertResult{Ids: []*ID{}}
+	for _, value := range values {
+		one, err := upsert(ops, table, keyColumns, value)
+		if err != nil {
+			return result, err
+		}
+		result.add(one)
+	}
+	return result, nil
+}
+
+// keyFilter matches the values of keyColumns in value, every key column needs a value.
+func keyFilter(table *MetaTable, keyColumns []string, value *DataObject) (bson.D, error) {
+	if len(keyColumns) == 0 {
+		return nil, &ValidationError{Table: table.Name, Message: "key columns are required"}
+	}
+	filter := bson.D{}
+	for _, column := range keyColumns {
+		c := table.ColumnByPath(column)
+		if c == nil || c.IsArray || c.DataType == DataTypeJson {
+			return nil, &ValidationError{Table: table.Name, Column: column, Message: "key column should be a scalar column"}
+		}
+		v, ok := value.GetPath(column)
+		if !ok || v == nil {
+			return nil, &ValidationError{Table: table.Name, Column: column, Message: "key column has no value"}
+		}
+		filter = append(filter, bson.E{Key: column, Value: v})
+	}
+	return filter, nil
+}
+
+// holds tells whether every column of value is already stored by existing.
+func holds(existing *DataObjectResp, value *DataObject) bool {
+	for column, v := range *value {
+		stored, _ := existing.Get(column)
+		if !sameValue(v, stored) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameValue compares a value about to be written with a stored one: numbers of any type,
+// documents in any key order, missing keys as null and times to the millisecond mongo keeps.
+func sameValue(a, b interface{}) bool {
+	if da, ok := queryDocument(a); ok {
+		db, ok := queryDocument(b)
+		if !ok {
+			return false
+		}
+		keys := map[string]bool{}
+		for _, e := range da {
+			keys[e.Key] = true
+			stored, _ := lookupKey(db, e.Key)
+			if !sameValue(e.Value, stored) {
+				return false
+			}
+		}
+		for _, e := range db {
+			if !keys[e.Key] && e.Value != nil {
+				return false
+			}
+		}
+		return true
+	}
+	if ia, ok := arrayItems(a); ok {
+		ib, ok := arrayItems(b)
+		if !ok {
+			//an empty array is written where nothing was stored
+			return len(ia) == 0 && b == nil
+		}
+		if len(ia) != len(ib) {
+			return false
+		}
+		for i := range ia {
+			if !sameValue(ia[i], ib[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	ca, ta := classOf(a)
+	cb, tb := classOf(b)
+	if ca == classTime && cb == classTime {
+		return ta.(int64)/int64(time.Millisecond) == tb.(int64)/int64(time.Millisecond)
+	}
+	c, ok := compareValues(a, b)
+	return ok && c == 0
+}
+
+func arrayItems(v interface{}) ([]interface{}, bool) {
+	switch v.(type) {
+	case []interface{}, bson.A, []bson.D:
+		return itemsOf(v), true
+	}
+	return nil, false
+}
+
+func (r *repository) upsertOps() upsertOps {
+	return upsertOps{find: r.Find, insert: r.InsertOne, patch: r.PatchOneWithVersion}
+}
+
+func (r *repository) Upsert(table *MetaTable, keyColumns []string, value *DataObject) (*UpsertResult, error) {
+	return upsert(r.upsertOps(), table, keyColumns, value)
+}
+
+func (r *repository) UpsertMany(table *MetaTable, keyColumns []string, values []*DataObject) (*UpsertResult, error) {
+	return upsertMany(r.upsertOps(), table, keyColumns, values)
+}
+
+// the memory repository locks within each write, not around the upsert
+func (r *memoryRepository) upsertOps() upsertOps {
+	return upsertOps{find: r.Find, insert: r.InsertOne, patch: r.PatchOneWithVersion}
+}
+
+func (r *memoryRepository) Upsert(table *MetaTable, keyColumns []string, value *DataObject) (*UpsertResult, error) {
+	return upsert(r.upsertOps(), table, keyColumns, value)
+}
+
+func (r *memoryRepository) UpsertMany(table *MetaTable, keyColumns []string, values []*DataObject) (*UpsertResult, error) {
+	return upsertMany(r.upsertOps(), table, keyColumns, values)
+}
+
+// the service validates every value before writing any and writes through its own methods,
+// stamping the tracked columns and recording history, a soft deleted record matching the key
+// is restored rather than inserted again when no live record matches it
+func (s *service) upsertOps() upsertOps {
+	return upsertOps{find: s.findKey, insert: s.InsertOne, patch: s.PatchOneWithVersion, restore: s.restoreDeleted}
+}
+
+// findKey returns the live records matching query, the deleted ones when none is alive.
+func (s *service) findKey(table *MetaTable, query *Query) ([]*DataObjectResp, error) {
+	live := *query
+	live.Filter = s.trackColumns.live(table, query.Filter)
+	found, err := s.find(table, &live)
+	if err != nil || len(found) > 0 || !s.trackColumns.softDelete(table) {
+		return found, err
+	}
+	return s.find(table, query)
+}
+
+func (s *service) restoreDeleted(table *MetaTable, existing *DataObjectResp, value *DataObject) *DataObject {
+	if !s.trackColumns.isDeleted(table, existing) {
+		return nil
+	}
+	restored := DataObject{}
+	for k, v := range *value {
+		restored[k] = v
+	}
+	s.trackColumns.clearDeleted(table, &restored)
+	return &restored
+}
+
+func (s *service) Upsert(table *MetaTable, keyColumns []string, value *DataObject) (*UpsertResult, error) {
+	if err := s.Validate(table, value); err != nil {
+		return nil, err
+	}
+	return upsert(s.upsertOps(), table, keyColumns, value)
+}
+
+func (s *service) UpsertMany(table *MetaTable, keyColumns []string, values []*DataObject) (*UpsertResult, error) {
+	for _, value := range values {
+		if err := s.Validate(table, value); err != nil {
+			return nil, err
+		}
+	}
+	return upsertMany(s.upsertOps(), table, keyColumns, values)
+}
@@ -0,0 +1,138 @@
+package meta_test
+
+import (
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func cart(t *testing.T, carts *meta.MetaTable, record string) *meta.DataObject {
+	do, err := meta.UnmarshalDataObjectJSON(carts, []byte(record))
+	assert.NoError(t, err)
+	return do
+}
+
+func TestUpsert(t *testing.T) {
+	repository := meta.NewMemoryRepository()
+	service := meta.NewService(&repository)
+	carts := fixtureCarts(t)
+	_, err := service.InsertMetaTable(carts)
+	assert.NoError(t, err)
+	_, err = service.InsertDictionary(&meta.Dictionary{Group: "currencies", Name: "CNY", DataType: meta.DataTypeString})
+	assert.NoError(t, err)
+	const item = `"cartItems": [{"productId": "5f1d7a9b2c3e4f5a6b7c8d9f", "quantity": 2, "price": {"currency": "CNY", "amount": "1.5"}}]`
+
+	result, err := service.Upsert(carts, []string{"note"}, cart(t, carts, `{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "note": "a", `+item+`}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Inserted)
+	id := *result.Ids[0]
+
+	//the same values read back with decimals, documents and arrays leave the record unchanged
+	result, err = service.Upsert(carts, []string{"note"}, cart(t, carts, `{"note": "a", "userId": "5f1d7a9b2c3e4f5a6b7c8d9e", `+item+`}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &meta.UpsertResult{Unchanged: 1, Ids: []*meta.ID{&id}}, result)
+
+	result, err = service.UpsertMany(carts, []string{"userId", "note"}, []*meta.DataObject{
+		cart(t, carts, `{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "note": "a", "tags": ["sale"]}`),
+		cart(t, carts, `{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "note": "b"}`),
+		cart(t, carts, `{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "note": "b"}`),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Inserted)
+	assert.Equal(t, 1, result.Updated)
+	assert.Equal(t, 1, result.Unchanged)
+	assert.Equal(t, id, *result.Ids[0])
+	assert.Equal(t, *result.Ids[1], *result.Ids[2])
+
+	dor, err := service.FindOne(carts, id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), dor.Version())
+	tags, _ := dor.Get("tags")
+	assert.Equal(t, bson.A{"sale"}, tags)
+	total, err := dor.GetDecimal("total")
+	assert.NoError(t, err)
+	assert.Equal(t, "3.00", total.String())
+	count, err := service.Count(carts, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestUpsertRestoresSoftDeleted(t *testing.T) {
+	repository := meta.NewMemoryRepository()
+	service := meta.NewService(&repository)
+	brands := brandsMetaTable
+	_, err := service.InsertMetaTable(&brands)
+	assert.NoError(t, err)
+	result, err := service.Upsert(&brands, []string{"name"}, &meta.DataObject{"name": "Apple"})
+	assert.NoError(t, err)
+	id := *result.Ids[0]
+	assert.NoError(t, service.DeleteOne(&brands, id))
+
+	result, err = service.Upsert(&brands, []string{"name"}, &meta.DataObject{"name": "Apple"})
+	assert.NoError(t, err)
+	assert.Equal(t, &meta.UpsertResult{Updated: 1, Ids: []*meta.ID{&id}}, result)
+	brand, err := service.FindOne(&brands, id)
+	assert.NoError(t, err)
+	deleted, _ := brand.Get("deleted")
+	assert.Equal(t, false, deleted)
+	count, err := service.Count(&brands, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestUpsertPrefersLiveRecord(t *testing.T) {
+	repository := meta.NewMemoryRepository()
+	service := meta.NewService(&repository)
+	brands := brandsMetaTable
+	_, err := service.InsertMetaTable(&brands)
+	assert.NoError(t, err)
+	deletedID, err := service.InsertOne(&brands, &meta.DataObject{"name": "Apple"})
+	assert.NoError(t, err)
+	assert.NoError(t, service.DeleteOne(&brands, *deletedID))
+	liveID, err := service.InsertOne(&brands, &meta.DataObject{"name": "Apple"})
+	assert.NoError(t, err)
+
+	result, err := service.Upsert(&brands, []string{"name"}, &meta.DataObject{"name": "Apple"})
+	assert.NoError(t, err)
+	assert.Equal(t, &meta.UpsertResult{Unchanged: 1, Ids: []*meta.ID{liveID}}, result)
+	_, err = service.FindOne(&brands, *deletedID)
+	assert.Error(t, err, "the deleted record stays deleted")
+
+	assert.NoError(t, service.DeleteOne(&brands, *liveID))
+	_, err = service.Upsert(&brands, []string{"name"}, &meta.DataObject{"name": "Apple"})
+	assert.Error(t, err, "two deleted records match the key")
+}
+
+func TestUpsertErrors(t *testing.T) {
+	repository := meta.NewMemoryRepository()
+	service := meta.NewService(&repository)
+	carts := fixtureCarts(t)
+	_, err := service.InsertMetaTable(carts)
+	assert.NoError(t, err)
+
+	for _, keyColumns := range [][]string{nil, {"colour"}, {"tags"}, {"note"}} {
+		_, err := service.Upsert(carts, keyColumns, cart(t, carts, `{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e"}`))
+		_, ok := err.(*meta.ValidationError)
+		assert.True(t, ok, "%v: %v", keyColumns, err)
+	}
+
+	//values are validated before any is written
+	_, err = service.UpsertMany(carts, []string{"note"}, []*meta.DataObject{
+		cart(t, carts, `{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "note": "a"}`),
+		cart(t, carts, `{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "note": "b", "cartItems": [{"price": {"currency": "EUR"}}]}`),
+	})
+	_, ok := err.(*meta.ValidationError)
+	assert.True(t, ok, "%v", err)
+	count, err := service.Count(carts, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	for i := 0; i < 2; i++ {
+		_, err = service.InsertOne(carts, cart(t, carts, `{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "note": "a"}`))
+		assert.NoError(t, err)
+	}
+	_, err = service.Upsert(carts, []string{"note"}, cart(t, carts, `{"userId": "5f1d7a9b2c3e4f5a6b7c8d9e", "note": "a"}`))
+	assert.EqualError(t, err, (&meta.ValidationError{Table: "carts", Column: "note", Message: "key matches several records"}).Error())
+}
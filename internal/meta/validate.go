@@ -0,0 +1,43 @@
+package meta
+
+import "errors"
+
+// ValidationError is returned when a value does not satisfy its column definition.
+type ValidationError struct {
+	Table   string
+	Column  string //dotted path of the value, array items include their index
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return "table:" + e.Table + ",column:" + e.Column + "," + e.Message
+}
+
+// Validate checks a meta table definition before it is registered.
+func (t *MetaTable) Validate() error {
+	if len(t.Name) == 0 {
+		return errors.New("meta table name is required")
+	}
+	if err := validateAttributes(t, "", t.Columns); err != nil {
+		return err
+	}
+	if err := validateIndexes(t); err != nil {
+		return err
+	}
+	return validateExpressions(t, "", t.Columns)
+}
+
+// validateAttributes checks the attributes of every column, nested ones included.
+func validateAttributes(table *MetaTable, prefix string, columns []*MetaColumn) error {
+	for _, c := range columns {
+		for _, a := range c.Attributes {
+			if err := a.Validate(); err != nil {
+				return &ValidationError{Table: table.Name, Column: prefix + c.Name, Message: err.Error()}
+			}
+		}
+		if err := validateAttributes(table, prefix+c.Name+".", c.NestedColumns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// VersionColumn holds the version of every record written through the Repository,
+// it starts at 1 and is incremented by every update or patch.
+const VersionColumn = "_version"
+
+const maxVersionRetries = 3
+
+// AnyVersion is the version of If-Match: *, any version of an existing record.
+const AnyVersion int64 = -1
+
+var (
+	ErrInvalidETag  = errors.New("invalid etag")
+	ErrETagMismatch = errors.New("etag of another record")
+)
+
+// ConflictError is returned when a record was changed since the expected version was read.
+type ConflictError struct {
+	Table    string
+	Id       ID
+	Expected int64
+	Actual   int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("table:%s,record:%s,expected version %d but found %d", e.Table, e.Id, e.Expected, e.Actual)
+}
+
+// versionFilter matches records at version, records written before versioning count as 0.
+func versionFilter(id ID, version int64) bson.M {
+	if version == 0 {
+		return bson.M{"_id": id.ToObjectId(), VersionColumn: bson.M{"$in": bson.A{0, nil}}}
+	}
+	return bson.M{"_id": id.ToObjectId(), VersionColumn: version}
+}
+
+func toVersion(v interface{}) int64 {
+	switch v := v.(type) {
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+// Version returns the record version, 0 for records never written through the Repository.
+func (do *DataObjectResp) Version() int64 {
+	v, _ := do.Get(VersionColumn)
+	return toVersion(v)
+}
+
+// ETag identifies the current version of the record, to be compared against If-Match.
+func (do *DataObjectResp) ETag() string {
+	id, _ := do.Get("_id")
+	return `"` + ParseID(id).String() + "-" + strconv.FormatInt(do.Version(), 10) + `"`
+}
+
+// ParseETag extracts the version from an ETag produced by DataObjectResp.ETag for the record id.
+// * matches any version and gives AnyVersion, the ETag of another record gives ErrETagMismatch.
+func ParseETag(etag string, id ID) (int64, error) {
+	etag = strings.TrimSpace(etag)
+	if etag == "*" {
+		return AnyVersion, nil
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	etag = strings.Trim(etag, `"`)
+	i := strings.LastIndex(etag, "-")
+	if i < 0 {
+		return 0, ErrInvalidETag
+	}
+	version, err := strconv.ParseInt(etag[i+1:], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidETag
+	}
+	if etag[:i] != id.String() {
+		return 0, ErrETagMismatch
+	}
+	return version, nil
+}
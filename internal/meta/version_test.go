@@ -0,0 +1,45 @@
+package meta_test
+
+import (
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestETagRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	dor := meta.DataObjectResp{{Key: "_id", Value: id}, {Key: meta.VersionColumn, Value: int64(7)}}
+	assert.Equal(t, int64(7), dor.Version())
+	assert.Equal(t, `"`+id.Hex()+`-7"`, dor.ETag())
+
+	version, err := meta.ParseETag("W/"+dor.ETag(), meta.ID(id))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), version)
+	_, err = meta.ParseETag(`"abc"`, meta.ID(id))
+	assert.Equal(t, meta.ErrInvalidETag, err)
+	_, err = meta.ParseETag(dor.ETag(), meta.ID(primitive.NewObjectID()))
+	assert.Equal(t, meta.ErrETagMismatch, err)
+	version, err = meta.ParseETag("*", meta.ID(id))
+	assert.NoError(t, err)
+	assert.Equal(t, meta.AnyVersion, version)
+}
+
+func TestUpdateWithStaleVersionConflicts(t *testing.T) {
+	id := primitive.NewObjectID()
+	recorder := &recordingRepository{stored: &meta.DataObjectResp{
+		{Key: "_id", Value: id},
+		{Key: "name", Value: "Apple"},
+		{Key: meta.VersionColumn, Value: int64(2)},
+	}}
+	var repository meta.Repository = recorder
+	metaService := meta.NewService(&repository)
+
+	err := metaService.UpdateOneWithVersion(&brandsMetaTable, meta.ID(id), &meta.DataObject{"name": "Huawei"}, 1)
+	conflict, ok := err.(*meta.ConflictError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), conflict.Expected)
+	assert.Equal(t, int64(2), conflict.Actual)
+	assert.Nil(t, recorder.written)
+}
@@ -0,0 +1,318 @@
+package meta
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/yaml.v3"
+)
+
+// The yaml form of meta tables is a list of tables, enums are written by name.
+// The same form is used for JSON, with the id of stored tables:
+//
+//	# meta_tables.yml
+//	- name: carts
+//	  primaryKey: {name: carts_pk_id, columnNames: [_id], idGeneratorType: objectId}
+//	  columns:
+//	    - {name: _id, dataType: objectId}
+//	    - name: cartItems
+//	      dataType: json
+//	      isArray: true
+//	      nestedColumns:
+//	        - {name: quantity, dataType: int}
+//	  indexes:
+//	    - {name: carts_user, columnNames: [userId, -total]}
+type yamlTable struct {
+	Id            string              `yaml:"-" json:"id,omitempty"`
+	Name          string              `yaml:"name" json:"name"`
+	ModelName     string              `yaml:"modelName,omitempty" json:"modelName,omitempty"`
+	Description   string              `yaml:"description,omitempty" json:"description,omitempty"`
+	History       bool                `yaml:"history,omitempty" json:"history,omitempty"`
+	PrimaryKey    *yamlPrimaryKey     `yaml:"primaryKey,omitempty" json:"primaryKey,omitempty"`
+	Columns       []*yamlColumn       `yaml:"columns" json:"columns"`
+	RelationShips []*yamlRelationShip `yaml:"relationShips,omitempty" json:"relationShips,omitempty"`
+	Indexes       []*yamlIndex        `yaml:"indexes,omitempty" json:"indexes,omitempty"`
+}
+
+type yamlPrimaryKey struct {
+	Name            string   `yaml:"name" json:"name"`
+	ColumnNames     []string `yaml:"columnNames,flow" json:"columnNames"`
+	IdGeneratorType string   `yaml:"idGeneratorType,omitempty" json:"idGeneratorType,omitempty"`
+}
+
+type yamlColumn struct {
+	Name          string           `yaml:"name" json:"name"`
+	Description   string           `yaml:"description,omitempty" json:"description,omitempty"`
+	DataType      string           `yaml:"dataType" json:"dataType"`
+	Length        int              `yaml:"length,omitempty" json:"length,omitempty"`
+	Precision     int              `yaml:"precision,omitempty" json:"precision,omitempty"`
+	Scale         int              `yaml:"scale,omitempty" json:"scale,omitempty"`
+	IsNullable    bool             `yaml:"isNullable,omitempty" json:"isNullable,omitempty"`
+	Validators    []string         `yaml:"validators,omitempty" json:"validators,omitempty"`
+	IsNestable    bool             `yaml:"isNestable,omitempty" json:"isNestable,omitempty"`
+	IsArray       bool             `yaml:"isArray,omitempty" json:"isArray,omitempty"`
+	DefaultValue  interface{}      `yaml:"defaultValue,omitempty" json:"defaultValue,omitempty"`
+	Dictionary    string           `yaml:"dictionary,omitempty" json:"dictionary,omitempty"`
+	Expression    string           `yaml:"expression,omitempty" json:"expression,omitempty"`
+	IsVirtual     bool             `yaml:"isVirtual,omitempty" json:"isVirtual,omitempty"`
+	InputType     string           `yaml:"inputType,omitempty" json:"inputType,omitempty"`
+	Attributes    []*yamlAttribute `yaml:"attributes,omitempty" json:"attributes,omitempty"`
+	NestedColumns []*yamlColumn    `yaml:"nestedColumns,omitempty" json:"nestedColumns,omitempty"`
+}
+
+type yamlAttribute struct {
+	Name     string      `yaml:"name" json:"name"`
+	Value    interface{} `yaml:"value" json:"value"`
+	DataType string      `yaml:"dataType,omitempty" json:"dataType,omitempty"`
+}
+
+type yamlRelationShip struct {
+	Name      string `yaml:"name" json:"name"`
+	Type      string `yaml:"type" json:"type"`
+	Column    string `yaml:"column" json:"column"`
+	RefTable  string `yaml:"refTable" json:"refTable"`
+	RefColumn string `yaml:"refColumn" json:"refColumn"`
+}
+
+type yamlIndex struct {
+	Name        string   `yaml:"name" json:"name"`
+	ColumnNames []string `yaml:"columnNames,flow" json:"columnNames"`
+	Unique      bool     `yaml:"unique,omitempty" json:"unique,omitempty"`
+	Sparse      bool     `yaml:"sparse,omitempty" json:"sparse,omitempty"`
+}
+
+// UnmarshalMetaTablesYAML reads a yaml list of meta tables and validates them.
+func UnmarshalMetaTablesYAML(data []byte) ([]*MetaTable, error) {
+	var yts []*yamlTable
+	if err := yaml.Unmarshal(data, &yts); err != nil {
+		return nil, err
+	}
+	tables := make([]*MetaTable, 0, len(yts))
+	for _, yt := range yts {
+		table, err := yt.metaTable()
+		if err != nil {
+			return nil, err
+		}
+		if err := table.Validate(); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// MarshalMetaTablesYAML writes meta tables in the form read by UnmarshalMetaTablesYAML.
+func MarshalMetaTablesYAML(tables []*MetaTable) ([]byte, error) {
+	yts := make([]*yamlTable, 0, len(tables))
+	for _, table := range tables {
+		yts = append(yts, documentOf(table))
+	}
+	return yaml.Marshal(yts)
+}
+
+func documentOf(table *MetaTable) *yamlTable {
+	yt := &yamlTable{
+		Name:        table.Name,
+		ModelName:   table.ModelName,
+		Description: table.Description,
+		History:     table.History,
+		Columns:     yamlColumns(table.Columns),
+	}
+	if pk := table.PrimaryKey; pk != nil {
+		yt.PrimaryKey = &yamlPrimaryKey{Name: pk.Name, ColumnNames: pk.ColumnNames, IdGeneratorType: pk.IdGeneratorType.String()}
+	}
+	for _, r := range table.RelationShips {
+		yt.RelationShips = append(yt.RelationShips, &yamlRelationShip{
+			Name: r.Name, Type: r.Type.String(), Column: r.Column, RefTable: r.RefTable, RefColumn: r.RefColumn,
+		})
+	}
+	for _, index := range table.Indexes {
+		yt.Indexes = append(yt.Indexes, &yamlIndex{Name: index.Name, ColumnNames: index.ColumnNames, Unique: index.Unique, Sparse: index.Sparse})
+	}
+	if !table.Id.IsZero() {
+		yt.Id = table.Id.Hex()
+	}
+	return yt
+}
+
+// MarshalMetaTableJSON writes a meta table in the form read by UnmarshalMetaTableJSON.
+func MarshalMetaTableJSON(table *MetaTable) ([]byte, error) {
+	return json.Marshal(documentOf(table))
+}
+
+// MarshalMetaTablesJSON writes a list of meta tables.
+func MarshalMetaTablesJSON(tables []*MetaTable) ([]byte, error) {
+	yts := make([]*yamlTable, 0, len(tables))
+	for _, table := range tables {
+		yts = append(yts, documentOf(table))
+	}
+	return json.Marshal(yts)
+}
+
+// UnmarshalMetaTableJSON reads a meta table in the yaml form written as JSON, it is not validated.
+func UnmarshalMetaTableJSON(data []byte) (*MetaTable, error) {
+	var yt yamlTable
+	if err := json.Unmarshal(data, &yt); err != nil {
+		return nil, err
+	}
+	table, err := yt.metaTable()
+	if err != nil {
+		return nil, err
+	}
+	if len(yt.Id) > 0 {
+		id, err := primitive.ObjectIDFromHex(yt.Id)
+		if err != nil {
+			return nil, errors.New("table:" + yt.Name + ",invalid id " + yt.Id)
+		}
+		table.Id = id
+	}
+	return table, nil
+}
+
+func yamlColumns(columns []*MetaColumn) []*yamlColumn {
+	ycs := make([]*yamlColumn, 0, len(columns))
+	for _, c := range columns {
+		yc := &yamlColumn{
+			Name:          c.Name,
+			Description:   c.Description,
+			DataType:      c.DataType.String(),
+			Length:        c.Length,
+			Precision:     c.Precision,
+			Scale:         c.Scale,
+			IsNullable:    c.IsNullable,
+			Validators:    c.Validators,
+			IsNestable:    c.IsNestable,
+			IsArray:       c.IsArray,
+			DefaultValue:  c.DefaultValue,
+			Dictionary:    c.Dictionary,
+			Expression:    c.Expression,
+			IsVirtual:     c.IsVirtual,
+			NestedColumns: yamlColumns(c.NestedColumns),
+		}
+		if inputType, ok := c.InputType(); ok {
+			yc.InputType = inputType.String()
+		}
+		for _, a := range c.Attributes {
+			if a.Type == AttributeTypeInputType {
+				continue
+			}
+			ya := &yamlAttribute{Name: a.Name, Value: a.Value}
+			if a.DataType != DataTypeUnknown {
+				ya.DataType = a.DataType.String()
+			}
+			yc.Attributes = append(yc.Attributes, ya)
+		}
+		ycs = append(ycs, yc)
+	}
+	return ycs
+}
+
+func (yt *yamlTable) metaTable() (*MetaTable, error) {
+	table := &MetaTable{
+		Name:        yt.Name,
+		ModelName:   yt.ModelName,
+		Description: yt.Description,
+		History:     yt.History,
+	}
+	if len(table.ModelName) == 0 {
+		table.ModelName = table.Name
+	}
+	if pk := yt.PrimaryKey; pk != nil {
+		generator := IdGeneratorTypeUnknown
+		if len(pk.IdGeneratorType) > 0 {
+			generator = IdGeneratorType(enumByName(pk.IdGeneratorType, int8(IdGeneratorTypeAutoIncrement), func(i int8) string { return IdGeneratorType(i).String() }))
+			if generator == IdGeneratorTypeUnknown {
+				return nil, errors.New("table:" + yt.Name + ",unknown id generator type " + pk.IdGeneratorType)
+			}
+		}
+		table.PrimaryKey = &PrimaryKey{Name: pk.Name, ColumnNames: pk.ColumnNames, IdGeneratorType: generator}
+	}
+	columns, err := yt.metaColumns(yt.Columns)
+	if err != nil {
+		return nil, err
+	}
+	table.Columns = columns
+	for _, yr := range yt.RelationShips {
+		t := RelationShipType(enumByName(yr.Type, int8(RelationShipTypeManyToMany), func(i int8) string { return RelationShipType(i).String() }))
+		if t == RelationShipTypeUnknown {
+			return nil, errors.New("table:" + yt.Name + ",unknown relationship type " + yr.Type)
+		}
+		table.RelationShips = append(table.RelationShips, &RelationShip{
+			Name: yr.Name, Type: t, Column: yr.Column, RefTable: yr.RefTable, RefColumn: yr.RefColumn,
+		})
+	}
+	for _, yi := range yt.Indexes {
+		table.Indexes = append(table.Indexes, &MetaIndex{Name: yi.Name, ColumnNames: yi.ColumnNames, Unique: yi.Unique, Sparse: yi.Sparse})
+	}
+	return table, nil
+}
+
+func (yt *yamlTable) metaColumns(ycs []*yamlColumn) ([]*MetaColumn, error) {
+	columns := make([]*MetaColumn, 0, len(ycs))
+	for _, yc := range ycs {
+		dataType, err := dataTypeByName(yc.DataType)
+		if err != nil {
+			return nil, fmt.Errorf("table:%s,column:%s,%w", yt.Name, yc.Name, err)
+		}
+		c := &MetaColumn{
+			Name:         yc.Name,
+			Description:  yc.Description,
+			DataType:     dataType,
+			Length:       yc.Length,
+			Precision:    yc.Precision,
+			Scale:        yc.Scale,
+			IsNullable:   yc.IsNullable,
+			Validators:   yc.Validators,
+			IsNestable:   yc.IsNestable,
+			IsArray:      yc.IsArray,
+			DefaultValue: yc.DefaultValue,
+			Dictionary:   yc.Dictionary,
+			Expression:   yc.Expression,
+			IsVirtual:    yc.IsVirtual,
+		}
+		if len(yc.InputType) > 0 {
+			inputType := InputType(enumByName(yc.InputType, int8(InputTypePassword), func(i int8) string { return InputType(i).String() }))
+			if inputType == InputTypeUnknown {
+				return nil, errors.New("table:" + yt.Name + ",column:" + yc.Name + ",unknown input type " + yc.InputType)
+			}
+			c.Attributes = append(c.Attributes, &Attribute{Name: "inputType", Type: AttributeTypeInputType, Value: inputType.String()})
+		}
+		for _, ya := range yc.Attributes {
+			a := NewAttribute(ya.Name, ya.Value)
+			if len(ya.DataType) > 0 {
+				if a.DataType, err = dataTypeByName(ya.DataType); err != nil {
+					return nil, fmt.Errorf("table:%s,column:%s,attribute:%s,%w", yt.Name, yc.Name, ya.Name, err)
+				}
+			}
+			c.Attributes = append(c.Attributes, a)
+		}
+		if c.NestedColumns, err = yt.metaColumns(yc.NestedColumns); err != nil {
+			return nil, err
+		}
+		if len(c.NestedColumns) == 0 {
+			c.NestedColumns = nil
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+func dataTypeByName(name string) (DataType, error) {
+	dataType := DataType(enumByName(name, int8(DataTypeUrl), func(i int8) string { return DataType(i).String() }))
+	if dataType == DataTypeUnknown {
+		return dataType, errors.New("unknown data type " + name)
+	}
+	return dataType, nil
+}
+
+// enumByName finds the value of an int8 enum from its String, 0 when unknown.
+func enumByName(name string, last int8, stringOf func(int8) string) int8 {
+	for i := int8(1); i <= last; i++ {
+		if stringOf(i) == name {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package meta_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetaTablesYAML(t *testing.T) {
+	data, err := ioutil.ReadFile("../../tests/fixtures/meta/meta_tables.yml")
+	assert.NoError(t, err)
+	tables, err := meta.UnmarshalMetaTablesYAML(data)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(tables))
+
+	carts := tables[1]
+	assert.Equal(t, meta.IdGeneratorTypeObjectId, carts.PrimaryKey.IdGeneratorType)
+	price := carts.Column("cartItems").NestedColumns[2]
+	assert.Equal(t, meta.DataTypeDecimal, price.NestedColumns[1].DataType)
+	assert.Equal(t, "currencies", price.NestedColumns[0].Dictionary)
+	assert.True(t, carts.Column("itemCount").IsVirtual)
+	assert.Equal(t, "备注", carts.Column("note").Label())
+	assert.Equal(t, meta.RelationShipTypeManyToOne, carts.RelationShips[0].Type)
+	assert.Equal(t, []*meta.MetaIndex{{Name: "carts_user", ColumnNames: []string{"userId", "-total"}}}, carts.Indexes)
+
+	written, err := meta.MarshalMetaTablesYAML(tables)
+	assert.NoError(t, err)
+	read, err := meta.UnmarshalMetaTablesYAML(written)
+	assert.NoError(t, err)
+	assert.Equal(t, tables, read)
+
+	_, err = meta.UnmarshalMetaTablesYAML([]byte("- {name: t, columns: [{name: a, dataType: varchar}]}"))
+	assert.EqualError(t, err, "table:t,column:a,unknown data type varchar")
+	_, err = meta.UnmarshalMetaTablesYAML([]byte("- {name: t, columns: [{name: a, dataType: int, expression: 'b + 1'}]}"))
+	_, ok := err.(*meta.ValidationError)
+	assert.True(t, ok)
+}
+
+func TestEncodeDataObject(t *testing.T) {
+	_, products, dor := insertProduct(t)
+	var p product
+	assert.NoError(t, dor.Decode(products, &p))
+	do, err := meta.EncodeDataObject(&p)
+	assert.NoError(t, err)
+	url, err := do.GetString("medias.1.url")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://img.example.com/back.jpg", url)
+	_, isMap := (*do)["price"].(map[string]interface{})
+	assert.True(t, isMap)
+	id, err := do.GetObjectID("_id")
+	assert.NoError(t, err)
+	assert.Equal(t, p.Id.ToObjectId(), id)
+}
@@ -0,0 +1,78 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/drkliu/zj-raya/internal/logging"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// error codes, see the ErrorDetail schema of codegen.GenerateOpenAPI
+const (
+	codeValidation       = "validation"
+	codeNotFound         = "notFound"
+	codeConflict         = "conflict"
+	codeBadRequest       = "badRequest"
+	codeMethodNotAllowed = "methodNotAllowed"
+	codeInternal         = "internal"
+)
+
+// apiError is the body of every failed request: {"error": {"code": "notFound", "message": "..."}}.
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Table   string `json:"table,omitempty"`
+	Column  string `json:"column,omitempty"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func badRequest(message string) *apiError {
+	return &apiError{Status: http.StatusBadRequest, Code: codeBadRequest, Message: message}
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, mongo.ErrNoDocuments)
+}
+
+// toAPIError maps the errors of the meta package to their status and code,
+// unexpected errors are logged and hidden from the client.
+func toAPIError(err error) *apiError {
+	var apiErr *apiError
+	var validation *meta.ValidationError
+	var conflict *meta.ConflictError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &validation):
+		return &apiError{Status: http.StatusUnprocessableEntity, Code: codeValidation, Message: validation.Message, Table: validation.Table, Column: validation.Column}
+	case errors.As(err, &conflict):
+		return &apiError{Status: http.StatusPreconditionFailed, Code: codeConflict, Message: conflict.Error(), Table: conflict.Table}
+	case isNotFound(err):
+		return &apiError{Status: http.StatusNotFound, Code: codeNotFound, Message: "no such record"}
+	case mongo.IsDuplicateKeyError(err):
+		return &apiError{Status: http.StatusConflict, Code: codeConflict, Message: "duplicate key"}
+	case errors.Is(err, meta.ErrETagMismatch):
+		return &apiError{Status: http.StatusPreconditionFailed, Code: codeConflict, Message: err.Error()}
+	case errors.Is(err, meta.ErrInvalidETag):
+		return badRequest(err.Error())
+	}
+	logging.Errorf("rest: %v", err)
+	return &apiError{Status: http.StatusInternalServerError, Code: codeInternal, Message: "internal server error"}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	apiErr := toAPIError(err)
+	body, _ := json.Marshal(struct {
+		Error *apiError `json:"error"`
+	}{apiErr})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status)
+	w.Write(body)
+}
@@ -0,0 +1,178 @@
+package rest
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// operators of filter[path][op]=value, eq when omitted
+var operators = map[string]string{
+	"eq":     "$eq",
+	"ne":     "$ne",
+	"gt":     "$gt",
+	"gte":    "$gte",
+	"lt":     "$lt",
+	"lte":    "$lte",
+	"in":     "$in",
+	"nin":    "$nin",
+	"exists": "$exists",
+	"like":   "$regex",
+}
+
+// parseQuery maps the query parameters of GET /api/{table} to a meta.Query:
+//
+//	page=2&pageSize=50
+//	sort=-createAt,name
+//	filter[name]=apple&filter[price.amount][gte]=10&filter[tags][in]=a,b&filter[name][like]=app
+//
+// Values are converted to the data type of their column, paths are checked against the table.
+func parseQuery(table *meta.MetaTable, values url.Values, maxPageSize int) (*meta.Query, int64, error) {
+	pageNumber, err := intParam(values, "page", 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	pageSize, err := intParam(values, "pageSize", defaultPageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	if pageSize > int64(maxPageSize) {
+		return nil, 0, badRequest("pageSize should not exceed " + strconv.Itoa(maxPageSize))
+	}
+	query := &meta.Query{Skip: (pageNumber - 1) * pageSize, Limit: pageSize}
+	if s := values.Get("sort"); len(s) > 0 {
+		for _, key := range strings.Split(s, ",") {
+			order := 1
+			if strings.HasPrefix(key, "-") {
+				key, order = key[1:], -1
+			}
+			if _, err := queryColumn(table, key); err != nil {
+				return nil, 0, err
+			}
+			query.Sort = append(query.Sort, bson.E{Key: key, Value: order})
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	//a stable filter keeps the mongo query plans cacheable
+	sort.Strings(keys)
+	conditions := map[string]bson.D{}
+	var paths []string
+	for _, key := range keys {
+		path, operator, err := filterKey(key)
+		if err != nil {
+			return nil, 0, err
+		}
+		c, err := queryColumn(table, path)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, err := filterValue(table, path, c, operator, values.Get(key))
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, ok := conditions[path]; !ok {
+			paths = append(paths, path)
+		}
+		conditions[path] = append(conditions[path], bson.E{Key: operator, Value: value})
+		if operator == "$regex" {
+			conditions[path] = append(conditions[path], bson.E{Key: "$options", Value: "i"})
+		}
+	}
+	for _, path := range paths {
+		query.Filter = append(query.Filter, bson.E{Key: path, Value: conditions[path]})
+	}
+	return query, pageNumber, nil
+}
+
+func intParam(values url.Values, name string, defaultValue int64) (int64, error) {
+	s := values.Get(name)
+	if len(s) == 0 {
+		return defaultValue, nil
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || i < 1 {
+		return 0, badRequest(name + " should be a positive integer")
+	}
+	return i, nil
+}
+
+// filterKey splits filter[path] and filter[path][op].
+func filterKey(key string) (string, string, error) {
+	rest := strings.TrimPrefix(key, "filter[")
+	end := strings.Index(rest, "]")
+	if end <= 0 {
+		return "", "", badRequest("invalid filter " + key)
+	}
+	path, rest := rest[:end], rest[end+1:]
+	if len(rest) == 0 {
+		return path, "$eq", nil
+	}
+	if !strings.HasPrefix(rest, "[") || !strings.HasSuffix(rest, "]") {
+		return "", "", badRequest("invalid filter " + key)
+	}
+	operator, ok := operators[rest[1:len(rest)-1]]
+	if !ok {
+		return "", "", badRequest("unknown filter operator " + rest[1:len(rest)-1])
+	}
+	return path, operator, nil
+}
+
+// queryColumn finds the column of a filter or sort path, computed on read columns are not stored.
+func queryColumn(table *meta.MetaTable, path string) (*meta.MetaColumn, error) {
+	c := table.ColumnByPath(path)
+	if c == nil && path == "_id" {
+		return &meta.MetaColumn{Name: "_id", DataType: meta.DataTypeObjectId}, nil
+	}
+	if c == nil {
+		return nil, &apiError{Status: http.StatusBadRequest, Code: codeBadRequest, Message: "unknown column " + path, Table: table.Name, Column: path}
+	}
+	if c.IsComputed() && c.IsVirtual {
+		return nil, &apiError{Status: http.StatusBadRequest, Code: codeBadRequest, Message: "column is computed on read", Table: table.Name, Column: path}
+	}
+	return c, nil
+}
+
+func filterValue(table *meta.MetaTable, path string, c *meta.MetaColumn, operator string, s string) (interface{}, error) {
+	invalid := func(message string) error {
+		return &apiError{Status: http.StatusBadRequest, Code: codeBadRequest, Message: message, Table: table.Name, Column: path}
+	}
+	switch operator {
+	case "$exists":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, invalid("exists expects true or false")
+		}
+		return b, nil
+	case "$regex":
+		return regexp.QuoteMeta(s), nil
+	case "$in", "$nin":
+		items := bson.A{}
+		for _, item := range strings.Split(s, ",") {
+			v, err := meta.ConvertValue(c.DataType, item)
+			if err != nil {
+				return nil, invalid(err.Error())
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	}
+	if c.DataType == meta.DataTypeJson {
+		return nil, invalid("json columns can only be filtered with exists")
+	}
+	v, err := meta.ConvertValue(c.DataType, s)
+	if err != nil {
+		return nil, invalid(err.Error())
+	}
+	return v, nil
+}
@@ -0,0 +1,391 @@
+// Package rest serves the records and the definitions of every meta table over HTTP.
+//
+//	GET, POST               /api/{table}
+//	GET, PUT, PATCH, DELETE /api/{table}/{id}
+//	GET                     /api/openapi.json
+//	GET, POST               /meta/tables
+//	GET, PUT, DELETE        /meta/tables/{name}
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/drkliu/zj-raya/internal/codegen"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultPageSize = 20
+	defaultMaxPage  = 100
+	defaultMaxBody  = 10 << 20
+)
+
+// Server is the http.Handler of the generic API.
+type Server struct {
+	service     meta.MetaService
+	maxPageSize int
+	maxBodySize int64
+}
+
+type Option func(*Server)
+
+// WithMaxPageSize bounds the pageSize parameter, 100 by default.
+func WithMaxPageSize(size int) Option {
+	return func(s *Server) {
+		s.maxPageSize = size
+	}
+}
+
+// WithMaxBodySize bounds request bodies, 10MB by default.
+func WithMaxBodySize(size int64) Option {
+	return func(s *Server) {
+		s.maxBodySize = size
+	}
+}
+
+func NewServer(service meta.MetaService, options ...Option) *Server {
+	s := &Server{service: service, maxPageSize: defaultMaxPage, maxBodySize: defaultMaxBody}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	service := s.service.WithContext(r.Context())
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "api" && parts[1] == "openapi.json":
+		s.openAPI(w, r, service)
+	case len(parts) == 2 && parts[0] == "api":
+		s.records(w, r, service, parts[1])
+	case len(parts) == 3 && parts[0] == "api":
+		s.record(w, r, service, parts[1], parts[2])
+	case len(parts) == 2 && parts[0] == "meta" && parts[1] == "tables":
+		s.metaTables(w, r, service)
+	case len(parts) == 3 && parts[0] == "meta" && parts[1] == "tables":
+		s.metaTable(w, r, service, parts[2])
+	default:
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: codeNotFound, Message: "no route for " + r.URL.Path})
+	}
+}
+
+// page is the body of GET /api/{table}.
+type page struct {
+	Items    []*meta.DataObjectResp `json:"items"`
+	Total    int64                  `json:"total"`
+	Page     int64                  `json:"page"`
+	PageSize int64                  `json:"pageSize"`
+}
+
+type created struct {
+	Id string `json:"id"`
+}
+
+func (s *Server) records(w http.ResponseWriter, r *http.Request, service meta.MetaService, name string) {
+	table, err := findTable(service, name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		query, pageNumber, err := parseQuery(table, r.URL.Query(), s.maxPageSize)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := service.CheckFilter(table, query.Filter); err != nil {
+			writeError(w, err)
+			return
+		}
+		total, err := service.Count(table, query.Filter)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		items, err := service.Find(table, query)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, &page{Items: items, Total: total, Page: pageNumber, PageSize: query.Limit})
+	case http.MethodPost:
+		do, err := s.readRecord(r, table)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		id, err := service.InsertOne(table, do)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/api/"+table.Name+"/"+id.String())
+		writeJSON(w, http.StatusCreated, &created{Id: id.String()})
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) record(w http.ResponseWriter, r *http.Request, service meta.MetaService, name string, hex string) {
+	table, err := findTable(service, name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	id, err := parseID(hex)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		dor, err := service.FindOne(table, id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("ETag", dor.ETag())
+		writeJSON(w, http.StatusOK, dor)
+	case http.MethodPut, http.MethodPatch:
+		do, err := s.readRecord(r, table)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		err = s.write(r, service, table, id, do)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if err := service.DeleteOne(table, id); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+// write replaces or patches a record, checking the version given by If-Match, * or no If-Match writes any version.
+func (s *Server) write(r *http.Request, service meta.MetaService, table *meta.MetaTable, id meta.ID, do *meta.DataObject) error {
+	version := meta.AnyVersion
+	if etag := r.Header.Get("If-Match"); len(etag) > 0 {
+		parsed, err := meta.ParseETag(etag, id)
+		if err == meta.ErrInvalidETag {
+			return badRequest("If-Match: " + err.Error())
+		}
+		if err != nil {
+			return err
+		}
+		version = parsed
+	}
+	if version == meta.AnyVersion {
+		if r.Method == http.MethodPut {
+			return service.UpdateOne(table, id, do)
+		}
+		return service.PatchOne(table, id, do)
+	}
+	if r.Method == http.MethodPut {
+		return service.UpdateOneWithVersion(table, id, do, version)
+	}
+	return service.PatchOneWithVersion(table, id, do, version)
+}
+
+func (s *Server) readRecord(r *http.Request, table *meta.MetaTable) (*meta.DataObject, error) {
+	body, err := s.readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	do, err := meta.UnmarshalDataObjectJSON(table, body)
+	if err != nil {
+		if _, ok := err.(*meta.ValidationError); ok {
+			return nil, err
+		}
+		return nil, badRequest(err.Error())
+	}
+	return do, nil
+}
+
+func (s *Server) readBody(r *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, s.maxBodySize+1))
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	if int64(len(body)) > s.maxBodySize {
+		return nil, &apiError{Status: http.StatusRequestEntityTooLarge, Code: codeBadRequest, Message: "request body is too large"}
+	}
+	return body, nil
+}
+
+func (s *Server) openAPI(w http.ResponseWriter, r *http.Request, service meta.MetaService) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	tables, err := sortedTables(service)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	doc, err := codegen.GenerateOpenAPI(tables, codegen.OpenAPIOptions{Title: "raya", Version: "1.0.0"})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(doc)
+}
+
+func (s *Server) metaTables(w http.ResponseWriter, r *http.Request, service meta.MetaService) {
+	switch r.Method {
+	case http.MethodGet:
+		tables, err := sortedTables(service)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		body, err := meta.MarshalMetaTablesJSON(tables)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeRaw(w, http.StatusOK, body)
+	case http.MethodPost:
+		table, err := s.readMetaTable(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if _, err := service.FindMetaTableByName(table.Name); err == nil {
+			writeError(w, &apiError{Status: http.StatusConflict, Code: codeConflict, Message: "meta table already exists", Table: table.Name})
+			return
+		}
+		id, err := service.InsertMetaTable(table)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/meta/tables/"+table.Name)
+		writeJSON(w, http.StatusCreated, &created{Id: id.String()})
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) metaTable(w http.ResponseWriter, r *http.Request, service meta.MetaService, name string) {
+	existing, err := findTable(service, name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		body, err := meta.MarshalMetaTableJSON(existing)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeRaw(w, http.StatusOK, body)
+	case http.MethodPut:
+		table, err := s.readMetaTable(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if table.Name != name {
+			writeError(w, badRequest("the name of a meta table cannot be changed"))
+			return
+		}
+		table.Id = existing.Id
+		if err := service.UpdateMetaTable(table); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if err := service.DeleteMetaTable(meta.ID(existing.Id)); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (s *Server) readMetaTable(r *http.Request) (*meta.MetaTable, error) {
+	body, err := s.readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	table, err := meta.UnmarshalMetaTableJSON(body)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	if err := table.Validate(); err != nil {
+		if _, ok := err.(*meta.ValidationError); ok {
+			return nil, err
+		}
+		return nil, &apiError{Status: http.StatusUnprocessableEntity, Code: codeValidation, Message: err.Error(), Table: table.Name}
+	}
+	return table, nil
+}
+
+func findTable(service meta.MetaService, name string) (*meta.MetaTable, error) {
+	table, err := service.FindMetaTableByName(name)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, &apiError{Status: http.StatusNotFound, Code: codeNotFound, Message: "no meta table " + name, Table: name}
+		}
+		return nil, err
+	}
+	return table, nil
+}
+
+func sortedTables(service meta.MetaService) ([]*meta.MetaTable, error) {
+	tables, err := service.FindAllMetaTables()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	return tables, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeRaw(w, status, body)
+}
+
+func writeRaw(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, &apiError{Status: http.StatusMethodNotAllowed, Code: codeMethodNotAllowed, Message: "allowed methods are " + strings.Join(methods, ", ")})
+}
+
+func parseID(hex string) (meta.ID, error) {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return meta.NilObjectID(), &apiError{Status: http.StatusNotFound, Code: codeNotFound, Message: "invalid record id " + hex}
+	}
+	return meta.ID(id), nil
+}
@@ -0,0 +1,242 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta/metatest"
+	"github.com/drkliu/zj-raya/internal/rest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	service, _ := metatest.NewService(t)
+	server := httptest.NewServer(rest.NewServer(service, rest.WithMaxPageSize(50)))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// call sends body as JSON and decodes the JSON response into a map.
+func call(t *testing.T, server *httptest.Server, method, path, body string, header ...string) (*http.Response, map[string]interface{}) {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	var result map[string]interface{}
+	if resp.StatusCode != http.StatusNoContent {
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	}
+	return resp, result
+}
+
+func errorOf(result map[string]interface{}) map[string]interface{} {
+	e, _ := result["error"].(map[string]interface{})
+	return e
+}
+
+const cart = `{
+	"userId": "5f1d7a9b2c3e4f5a6b7c8d9e",
+	"cartItems": [{"productId": "5f1d7a9b2c3e4f5a6b7c8d9f", "quantity": 3, "price": {"currency": "CNY", "amount": "19.90"}}],
+	"tags": ["gift"]
+}`
+
+func TestRecordLifecycle(t *testing.T) {
+	server := newTestServer(t)
+
+	resp, result := call(t, server, http.MethodPost, "/api/carts", cart)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	id := result["id"].(string)
+	assert.Equal(t, "/api/carts/"+id, resp.Header.Get("Location"))
+
+	resp, result = call(t, server, http.MethodGet, "/api/carts/"+id, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, id, result["_id"])
+	assert.Equal(t, "59.70", result["total"])
+	assert.Equal(t, float64(1), result["itemCount"])
+	assert.Equal(t, "5f1d7a9b2c3e4f5a6b7c8d9e", result["userId"])
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	resp, _ = call(t, server, http.MethodPatch, "/api/carts/"+id, `{"note": "leave at the door"}`, "If-Match", etag)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, result = call(t, server, http.MethodPatch, "/api/carts/"+id, `{"note": "stale"}`, "If-Match", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	assert.Equal(t, "conflict", errorOf(result)["code"])
+	resp, _ = call(t, server, http.MethodPatch, "/api/carts/"+id, `{"note": "any"}`, "If-Match", "*")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	//the etag of another record at the same version
+	_, first := call(t, server, http.MethodPost, "/api/carts", cart)
+	_, second := call(t, server, http.MethodPost, "/api/carts", cart)
+	resp, _ = call(t, server, http.MethodGet, "/api/carts/"+first["id"].(string), "")
+	resp, result = call(t, server, http.MethodPatch, "/api/carts/"+second["id"].(string), `{"note": "foreign"}`, "If-Match", resp.Header.Get("ETag"))
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	assert.Equal(t, "conflict", errorOf(result)["code"])
+
+	resp, _ = call(t, server, http.MethodPut, "/api/carts/"+id, strings.Replace(cart, `"quantity": 3`, `"quantity": 1`, 1))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	_, result = call(t, server, http.MethodGet, "/api/carts/"+id, "")
+	assert.Equal(t, "19.90", result["total"])
+	assert.Nil(t, result["note"], "put replaces the whole record")
+
+	resp, _ = call(t, server, http.MethodDelete, "/api/carts/"+id, "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, result = call(t, server, http.MethodGet, "/api/carts/"+id, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "notFound", errorOf(result)["code"])
+}
+
+func TestSoftDeletedRecordIsNotFound(t *testing.T) {
+	server := newTestServer(t)
+	stores := `{"name": "stores", "columns": [{"name": "_id", "dataType": "objectId"}, {"name": "name", "dataType": "string"},
+		{"name": "deleted", "dataType": "bool", "isNullable": true}, {"name": "deleteAt", "dataType": "dateTime", "isNullable": true}]}`
+	resp, _ := call(t, server, http.MethodPost, "/meta/tables", stores)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, result := call(t, server, http.MethodPost, "/api/stores", `{"name": "first"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	id := result["id"].(string)
+
+	resp, _ = call(t, server, http.MethodDelete, "/api/stores/"+id, "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, result = call(t, server, http.MethodGet, "/api/stores/"+id, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "notFound", errorOf(result)["code"])
+	_, result = call(t, server, http.MethodGet, "/api/stores", "")
+	assert.Equal(t, float64(0), result["total"])
+	resp, result = call(t, server, http.MethodGet, "/api/stores?filter[deleted]=true", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "deleted", errorOf(result)["column"])
+	resp, _ = call(t, server, http.MethodDelete, "/api/stores/"+id, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestListFiltersSortsAndPages(t *testing.T) {
+	server := newTestServer(t)
+	for _, name := range []string{"apple", "huawei", "xiaomi", "oppo", "vivo"} {
+		resp, _ := call(t, server, http.MethodPost, "/api/brands", `{"name": "`+name+`"}`)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+	names := func(result map[string]interface{}) []string {
+		var names []string
+		for _, item := range result["items"].([]interface{}) {
+			names = append(names, item.(map[string]interface{})["name"].(string))
+		}
+		return names
+	}
+
+	resp, result := call(t, server, http.MethodGet, "/api/brands?sort=-name&page=2&pageSize=2", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"oppo", "huawei"}, names(result))
+	assert.Equal(t, float64(5), result["total"])
+	assert.Equal(t, float64(2), result["page"])
+	assert.Equal(t, float64(2), result["pageSize"])
+
+	_, result = call(t, server, http.MethodGet, "/api/brands?filter[name][like]=O&sort=name", "")
+	assert.Equal(t, []string{"oppo", "vivo", "xiaomi"}, names(result))
+	_, result = call(t, server, http.MethodGet, "/api/brands?filter[name][in]=apple,vivo&filter[name][ne]=vivo", "")
+	assert.Equal(t, []string{"apple"}, names(result))
+	assert.Equal(t, float64(1), result["total"])
+
+	call(t, server, http.MethodPost, "/api/carts", cart)
+	call(t, server, http.MethodPost, "/api/carts", strings.Replace(cart, `"quantity": 3`, `"quantity": 1`, 1))
+	_, result = call(t, server, http.MethodGet, "/api/carts?filter[cartItems.quantity][gte]=2", "")
+	assert.Equal(t, float64(1), result["total"])
+	_, result = call(t, server, http.MethodGet, "/api/carts?filter[cartItems.price.amount]=19.90&filter[tags]=gift", "")
+	assert.Equal(t, float64(2), result["total"])
+}
+
+func TestErrorBodies(t *testing.T) {
+	server := newTestServer(t)
+
+	resp, result := call(t, server, http.MethodGet, "/api/users", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, map[string]interface{}{"code": "notFound", "message": "no meta table users", "table": "users"}, errorOf(result))
+
+	resp, result = call(t, server, http.MethodPost, "/api/carts", strings.Replace(cart, "CNY", "USD", 1))
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "validation", errorOf(result)["code"])
+	assert.Equal(t, "carts", errorOf(result)["table"])
+	assert.Equal(t, "cartItems.0.price.currency", errorOf(result)["column"])
+
+	resp, result = call(t, server, http.MethodPost, "/api/carts", `{"cartItems": [{"quantity": "many"}]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "cartItems.0.quantity", errorOf(result)["column"])
+
+	resp, result = call(t, server, http.MethodPost, "/api/carts", `{"userId":`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "badRequest", errorOf(result)["code"])
+
+	resp, result = call(t, server, http.MethodGet, "/api/carts?filter[color]=red", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "color", errorOf(result)["column"])
+	resp, result = call(t, server, http.MethodGet, "/api/carts?sort=itemCount", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "column is computed on read", errorOf(result)["message"])
+	resp, _ = call(t, server, http.MethodGet, "/api/carts?pageSize=51", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = call(t, server, http.MethodGet, "/api/carts?filter[total][gt]=ten", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, result = call(t, server, http.MethodGet, "/api/carts/not-an-id", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "notFound", errorOf(result)["code"])
+	resp, result = call(t, server, http.MethodPost, "/api/carts/5f1d7a9b2c3e4f5a6b7c8d9e", cart)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.Equal(t, "GET, PUT, PATCH, DELETE", resp.Header.Get("Allow"))
+	assert.Equal(t, "methodNotAllowed", errorOf(result)["code"])
+}
+
+func TestMetaTables(t *testing.T) {
+	server := newTestServer(t)
+
+	resp, err := http.Get(server.URL + "/meta/tables")
+	assert.NoError(t, err)
+	var tables []map[string]interface{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&tables))
+	resp.Body.Close()
+	assert.Len(t, tables, 2)
+	assert.Equal(t, "brands", tables[0]["name"])
+	assert.NotEmpty(t, tables[0]["id"])
+
+	stores := `{"name": "stores", "columns": [{"name": "_id", "dataType": "objectId"}, {"name": "name", "dataType": "string"}]}`
+	resp, result := call(t, server, http.MethodPost, "/meta/tables", stores)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.NotEmpty(t, result["id"])
+	resp, _ = call(t, server, http.MethodPost, "/meta/tables", stores)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp, result = call(t, server, http.MethodPost, "/meta/tables", `{"name": "bad", "columns": [{"name": "a", "dataType": "color"}]}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, errorOf(result)["message"], "unknown data type color")
+
+	resp, _ = call(t, server, http.MethodPost, "/api/stores", `{"name": "first", "city": "shanghai"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, _ = call(t, server, http.MethodPut, "/meta/tables/stores", strings.Replace(stores, `]}`, `, {"name": "city", "dataType": "string", "isNullable": true}]}`, 1))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	_, result = call(t, server, http.MethodGet, "/meta/tables/stores", "")
+	assert.Len(t, result["columns"], 3)
+	resp, _ = call(t, server, http.MethodPut, "/meta/tables/stores", strings.Replace(stores, "stores", "shops", 1))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = call(t, server, http.MethodPost, "/api/stores", `{"name": "second", "city": "beijing"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	_, result = call(t, server, http.MethodGet, "/api/stores?filter[city]=beijing", "")
+	assert.Equal(t, float64(1), result["total"], "the city of the first store was dropped before the column existed")
+
+	resp, _ = call(t, server, http.MethodDelete, "/meta/tables/stores", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, _ = call(t, server, http.MethodGet, "/api/stores", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, result = call(t, server, http.MethodGet, "/api/openapi.json", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "3.1.0", result["openapi"])
+}
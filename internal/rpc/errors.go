@@ -0,0 +1,51 @@
+package rpc
+
+import (
+	"errors"
+
+	"github.com/drkliu/zj-raya/internal/logging"
+	"github.com/drkliu/zj-raya/internal/meta"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func isNotFound(err error) bool {
+	return errors.Is(err, mongo.ErrNoDocuments)
+}
+
+// invalidColumn is an INVALID_ARGUMENT status naming the faulty column path in a BadRequest detail.
+func invalidColumn(code codes.Code, column, message string) error {
+	st := status.New(code, message)
+	if len(column) > 0 {
+		if detailed, err := st.WithDetails(&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: column, Description: message}},
+		}); err == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
+
+// toStatus maps the errors of the meta package to their gRPC status,
+// unexpected errors are logged and hidden from the client.
+func toStatus(err error) error {
+	var validation *meta.ValidationError
+	var conflict *meta.ConflictError
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.As(err, &validation):
+		return invalidColumn(codes.InvalidArgument, validation.Column, validation.Error())
+	case errors.As(err, &conflict):
+		return status.Error(codes.Aborted, conflict.Error())
+	case isNotFound(err):
+		return status.Error(codes.NotFound, "no such record")
+	case mongo.IsDuplicateKeyError(err):
+		return status.Error(codes.AlreadyExists, "duplicate key")
+	}
+	logging.Errorf("rpc: %v", err)
+	return status.Error(codes.Internal, "internal server error")
+}
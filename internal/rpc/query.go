@@ -0,0 +1,37 @@
+package rpc
+
+import (
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/drkliu/zj-raya/internal/rpc/rpcpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// query converts a QueryRequest, its filter is checked by meta.ConvertFilter and
+// MetaService.CheckFilter.
+func (s *Server) query(table *meta.MetaTable, req *rpcpb.QueryRequest) (*meta.Query, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if limit < 0 || limit > s.maxLimit || req.Skip < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "limit should be between 1 and %d, skip should not be negative", s.maxLimit)
+	}
+	query := &meta.Query{Skip: req.Skip, Limit: limit}
+	sort, err := meta.ConvertSort(table, req.Sort)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	query.Sort = sort
+	if req.Filter != nil {
+		filter, err := meta.ConvertFilter(table, req.Filter.AsMap())
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		if err := s.service.CheckFilter(table, filter); err != nil {
+			return nil, toStatus(err)
+		}
+		query.Filter = filter
+	}
+	return query, nil
+}
@@ -0,0 +1,4 @@
+// Package rpcpb holds the protobuf messages and the gRPC stubs of records.proto.
+package rpcpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative records.proto
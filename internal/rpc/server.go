@@ -0,0 +1,223 @@
+// Package rpc implements the RecordService of records.proto over a meta.MetaService,
+// records travel as google.protobuf.Struct values in the JSON form of the REST API.
+//
+//	s := grpc.NewServer()
+//	rpcpb.RegisterRecordServiceServer(s, rpc.NewServer(metaService))
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/drkliu/zj-raya/internal/rpc/rpcpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	defaultLimit    = 20
+	defaultMaxLimit = 100
+)
+
+// Server is the rpcpb.RecordServiceServer of the generic API.
+type Server struct {
+	rpcpb.UnimplementedRecordServiceServer
+	service  meta.MetaService
+	maxLimit int64
+}
+
+type Option func(*Server)
+
+// WithMaxLimit bounds the limit of Query requests, 100 by default.
+func WithMaxLimit(limit int64) Option {
+	return func(s *Server) {
+		s.maxLimit = limit
+	}
+}
+
+func NewServer(service meta.MetaService, options ...Option) *Server {
+	s := &Server{service: service, maxLimit: defaultMaxLimit}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+func (s *Server) Get(ctx context.Context, req *rpcpb.GetRequest) (*rpcpb.GetResponse, error) {
+	service := s.service.WithContext(ctx)
+	table, err := findTable(service, req.Table)
+	if err != nil {
+		return nil, err
+	}
+	id, err := parseID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	dor, err := service.FindOne(table, id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	record, err := toStruct(dor)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &rpcpb.GetResponse{Record: record, Version: dor.Version()}, nil
+}
+
+func (s *Server) Query(ctx context.Context, req *rpcpb.QueryRequest) (*rpcpb.QueryResponse, error) {
+	service := s.service.WithContext(ctx)
+	table, err := findTable(service, req.Table)
+	if err != nil {
+		return nil, err
+	}
+	query, err := s.query(table, req)
+	if err != nil {
+		return nil, err
+	}
+	total, err := service.Count(table, query.Filter)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	dors, err := service.Find(table, query)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	records := make([]*structpb.Struct, len(dors))
+	for i, dor := range dors {
+		if records[i], err = toStruct(dor); err != nil {
+			return nil, toStatus(err)
+		}
+	}
+	return &rpcpb.QueryResponse{Records: records, Total: total}, nil
+}
+
+func (s *Server) Insert(ctx context.Context, req *rpcpb.InsertRequest) (*rpcpb.InsertResponse, error) {
+	service := s.service.WithContext(ctx)
+	table, err := findTable(service, req.Table)
+	if err != nil {
+		return nil, err
+	}
+	do, err := fromStruct(table, req.Record)
+	if err != nil {
+		return nil, err
+	}
+	id, err := service.InsertOne(table, do)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &rpcpb.InsertResponse{Id: id.String()}, nil
+}
+
+func (s *Server) Update(ctx context.Context, req *rpcpb.UpdateRequest) (*rpcpb.UpdateResponse, error) {
+	service := s.service.WithContext(ctx)
+	table, err := findTable(service, req.Table)
+	if err != nil {
+		return nil, err
+	}
+	id, err := parseID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	do, err := fromStruct(table, req.Record)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case req.Version == nil && req.Patch:
+		err = service.PatchOne(table, id, do)
+	case req.Version == nil:
+		err = service.UpdateOne(table, id, do)
+	case req.Patch:
+		err = service.PatchOneWithVersion(table, id, do, *req.Version)
+	default:
+		err = service.UpdateOneWithVersion(table, id, do, *req.Version)
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &rpcpb.UpdateResponse{}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *rpcpb.DeleteRequest) (*rpcpb.DeleteResponse, error) {
+	service := s.service.WithContext(ctx)
+	table, err := findTable(service, req.Table)
+	if err != nil {
+		return nil, err
+	}
+	id, err := parseID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := service.DeleteOne(table, id); err != nil {
+		return nil, toStatus(err)
+	}
+	return &rpcpb.DeleteResponse{}, nil
+}
+
+func (s *Server) DescribeTable(ctx context.Context, req *rpcpb.DescribeTableRequest) (*rpcpb.DescribeTableResponse, error) {
+	table, err := findTable(s.service.WithContext(ctx), req.Table)
+	if err != nil {
+		return nil, err
+	}
+	b, err := meta.MarshalMetaTableJSON(table)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	described := &structpb.Struct{}
+	if err := protojson.Unmarshal(b, described); err != nil {
+		return nil, toStatus(err)
+	}
+	return &rpcpb.DescribeTableResponse{Table: described}, nil
+}
+
+func findTable(service meta.MetaService, name string) (*meta.MetaTable, error) {
+	if len(name) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing table")
+	}
+	table, err := service.FindMetaTableByName(name)
+	if isNotFound(err) {
+		return nil, status.Errorf(codes.NotFound, "no meta table %s", name)
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return table, nil
+}
+
+func parseID(hex string) (meta.ID, error) {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return meta.ID{}, status.Errorf(codes.InvalidArgument, "invalid id %q", hex)
+	}
+	return meta.ID(id), nil
+}
+
+// toStruct converts a record through its JSON form.
+func toStruct(dor *meta.DataObjectResp) (*structpb.Struct, error) {
+	b, err := json.Marshal(dor)
+	if err != nil {
+		return nil, err
+	}
+	record := &structpb.Struct{}
+	return record, protojson.Unmarshal(b, record)
+}
+
+// fromStruct converts and checks a record through its JSON form, like the REST bodies.
+func fromStruct(table *meta.MetaTable, record *structpb.Struct) (*meta.DataObject, error) {
+	if record == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing record")
+	}
+	b, err := protojson.Marshal(record)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	do, err := meta.UnmarshalDataObjectJSON(table, b)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return do, nil
+}
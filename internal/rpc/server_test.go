@@ -0,0 +1,201 @@
+package rpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/drkliu/zj-raya/internal/meta"
+	"github.com/drkliu/zj-raya/internal/meta/metatest"
+	"github.com/drkliu/zj-raya/internal/rpc"
+	"github.com/drkliu/zj-raya/internal/rpc/rpcpb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func newTestClient(t *testing.T) rpcpb.RecordServiceClient {
+	service, _ := metatest.NewService(t)
+	return dial(t, service)
+}
+
+// dial serves service over an in-memory connection.
+func dial(t *testing.T, service meta.MetaService) rpcpb.RecordServiceClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	rpcpb.RegisterRecordServiceServer(server, rpc.NewServer(service, rpc.WithMaxLimit(50)))
+	go server.Serve(listener)
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+	})
+	return rpcpb.NewRecordServiceClient(conn)
+}
+
+func newStruct(t *testing.T, m map[string]interface{}) *structpb.Struct {
+	s, err := structpb.NewStruct(m)
+	assert.NoError(t, err)
+	return s
+}
+
+func cart(t *testing.T, quantity float64, amount string, tags ...interface{}) *structpb.Struct {
+	return newStruct(t, map[string]interface{}{
+		"userId": "5f1d7a9b2c3e4f5a6b7c8d9e",
+		"cartItems": []interface{}{map[string]interface{}{
+			"productId": "5f1d7a9b2c3e4f5a6b7c8d9f",
+			"quantity":  quantity,
+			"price":     map[string]interface{}{"currency": "CNY", "amount": amount},
+		}},
+		"tags": tags,
+	})
+}
+
+func TestRecordLifecycle(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	inserted, err := client.Insert(ctx, &rpcpb.InsertRequest{Table: "carts", Record: cart(t, 3, "19.90", "gift")})
+	assert.NoError(t, err)
+	got, err := client.Get(ctx, &rpcpb.GetRequest{Table: "carts", Id: inserted.Id})
+	assert.NoError(t, err)
+	record := got.Record.AsMap()
+	assert.Equal(t, inserted.Id, record["_id"])
+	assert.Equal(t, "59.70", record["total"])
+	assert.Equal(t, float64(1), record["itemCount"])
+	assert.Equal(t, []interface{}{"gift"}, record["tags"])
+	assert.Equal(t, int64(1), got.Version)
+
+	_, err = client.Update(ctx, &rpcpb.UpdateRequest{Table: "carts", Id: inserted.Id, Record: newStruct(t, map[string]interface{}{"note": "备注"}), Patch: true, Version: &got.Version})
+	assert.NoError(t, err)
+	_, err = client.Update(ctx, &rpcpb.UpdateRequest{Table: "carts", Id: inserted.Id, Record: newStruct(t, map[string]interface{}{"note": "x"}), Patch: true, Version: &got.Version})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	got, err = client.Get(ctx, &rpcpb.GetRequest{Table: "carts", Id: inserted.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "备注", got.Record.AsMap()["note"])
+	assert.Equal(t, "59.70", got.Record.AsMap()["total"])
+
+	_, err = client.Update(ctx, &rpcpb.UpdateRequest{Table: "carts", Id: inserted.Id, Record: cart(t, 1, "2.50")})
+	assert.NoError(t, err)
+	got, err = client.Get(ctx, &rpcpb.GetRequest{Table: "carts", Id: inserted.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "2.50", got.Record.AsMap()["total"])
+	assert.Nil(t, got.Record.AsMap()["note"])
+
+	_, err = client.Delete(ctx, &rpcpb.DeleteRequest{Table: "carts", Id: inserted.Id})
+	assert.NoError(t, err)
+	_, err = client.Get(ctx, &rpcpb.GetRequest{Table: "carts", Id: inserted.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestQuery(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	for i, amount := range []string{"5.00", "12.50", "30.00"} {
+		_, err := client.Insert(ctx, &rpcpb.InsertRequest{Table: "carts", Record: cart(t, float64(i+1), amount, []string{"a", "b", "c"}[i])})
+		assert.NoError(t, err)
+	}
+	totals := func(req *rpcpb.QueryRequest) []interface{} {
+		req.Table = "carts"
+		resp, err := client.Query(ctx, req)
+		assert.NoError(t, err)
+		var totals []interface{}
+		for _, record := range resp.GetRecords() {
+			totals = append(totals, record.AsMap()["total"])
+		}
+		return append(totals, resp.GetTotal())
+	}
+	assert.Equal(t, []interface{}{"90.00", "25.00", "5.00", int64(3)}, totals(&rpcpb.QueryRequest{Sort: []string{"-total"}}))
+	assert.Equal(t, []interface{}{"25.00", int64(3)}, totals(&rpcpb.QueryRequest{Sort: []string{"total"}, Skip: 1, Limit: 1}))
+	assert.Equal(t, []interface{}{"25.00", "90.00", int64(2)}, totals(&rpcpb.QueryRequest{
+		Filter: newStruct(t, map[string]interface{}{"cartItems.price.amount": map[string]interface{}{"$gte": "10"}}),
+		Sort:   []string{"total"},
+	}))
+	assert.Equal(t, []interface{}{"5.00", "90.00", int64(2)}, totals(&rpcpb.QueryRequest{
+		Filter: newStruct(t, map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"tags": "a"},
+			map[string]interface{}{"cartItems.quantity": map[string]interface{}{"$in": []interface{}{3}}},
+		}}),
+		Sort: []string{"total"},
+	}))
+
+	for _, req := range []*rpcpb.QueryRequest{
+		{Table: "carts", Sort: []string{"itemCount"}},
+		{Table: "carts", Limit: 51},
+		{Table: "carts", Filter: newStruct(t, map[string]interface{}{"color": "red"})},
+		{Table: "carts", Filter: newStruct(t, map[string]interface{}{"tags": map[string]interface{}{"$where": "true"}})},
+		{Table: "carts", Filter: newStruct(t, map[string]interface{}{"_id": "not an id"})},
+	} {
+		_, err := client.Query(ctx, req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), req.String())
+	}
+}
+
+func TestDeletedRecordsCannotBeFiltered(t *testing.T) {
+	service, _ := metatest.NewService(t)
+	stores := &meta.MetaTable{
+		Name:       "stores",
+		PrimaryKey: &meta.PrimaryKey{Name: "stores_pk_id", ColumnNames: []string{"_id"}, IdGeneratorType: meta.IdGeneratorTypeObjectId},
+		Columns: []*meta.MetaColumn{
+			{Name: "_id", DataType: meta.DataTypeObjectId},
+			{Name: "name", DataType: meta.DataTypeString},
+			{Name: "deleted", DataType: meta.DataTypeBool, IsNullable: true},
+		},
+	}
+	_, err := service.InsertMetaTable(stores)
+	assert.NoError(t, err)
+	client := dial(t, service)
+	ctx := context.Background()
+
+	_, err = client.Query(ctx, &rpcpb.QueryRequest{Table: "stores", Filter: newStruct(t, map[string]interface{}{"deleted": true})})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.Query(ctx, &rpcpb.QueryRequest{Table: "stores", Filter: newStruct(t, map[string]interface{}{"$nor": []interface{}{map[string]interface{}{"deleted": false}}})})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.Query(ctx, &rpcpb.QueryRequest{Table: "stores", Filter: newStruct(t, map[string]interface{}{"name": "first"})})
+	assert.NoError(t, err)
+}
+
+func TestErrors(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := client.Get(ctx, &rpcpb.GetRequest{Table: "users", Id: "5f1d7a9b2c3e4f5a6b7c8d9e"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.Get(ctx, &rpcpb.GetRequest{Table: "carts", Id: "42"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	record := cart(t, 1, "1.00")
+	record.Fields["cartItems"].GetListValue().Values[0].GetStructValue().Fields["price"].GetStructValue().Fields["currency"] = structpb.NewStringValue("USD")
+	_, err = client.Insert(ctx, &rpcpb.InsertRequest{Table: "carts", Record: record})
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		violations := st.Details()[0].(*errdetails.BadRequest).FieldViolations
+		assert.Equal(t, "cartItems.0.price.currency", violations[0].Field)
+	}
+	_, err = client.Insert(ctx, &rpcpb.InsertRequest{Table: "carts"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestDescribeTable(t *testing.T) {
+	client := newTestClient(t)
+	resp, err := client.DescribeTable(context.Background(), &rpcpb.DescribeTableRequest{Table: "carts"})
+	assert.NoError(t, err)
+	table := resp.Table.AsMap()
+	assert.Equal(t, "carts", table["name"])
+	columns := table["columns"].([]interface{})
+	assert.Equal(t, "_id", columns[0].(map[string]interface{})["name"])
+	relationShips := table["relationShips"].([]interface{})
+	assert.Equal(t, "users", relationShips[0].(map[string]interface{})["refTable"])
+
+	_, err = client.DescribeTable(context.Background(), &rpcpb.DescribeTableRequest{Table: "users"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,35 @@
+// Package meta exposes the meta runtime to modules outside zj-raya. The typed repositories
+// generated by metagen are written against it, its types are the ones of the server.
+package meta
+
+import (
+	"github.com/drkliu/zj-raya/internal/meta"
+)
+
+type (
+	Repository       = meta.Repository
+	RepositoryOption = meta.RepositoryOption
+	MetaService      = meta.MetaService
+	ServiceOption    = meta.ServiceOption
+	Database         = meta.Database
+	Registry         = meta.Registry
+	MetaTable        = meta.MetaTable
+	MetaColumn       = meta.MetaColumn
+	ID               = meta.ID
+	DataObject       = meta.DataObject
+	DataObjectResp   = meta.DataObjectResp
+	Query            = meta.Query
+)
+
+var (
+	NewRepository           = meta.NewRepository
+	NewMemoryRepository     = meta.NewMemoryRepository
+	WithTimeout             = meta.WithTimeout
+	NewService              = meta.NewService
+	WithRegistry            = meta.WithRegistry
+	NewRegistry             = meta.NewRegistry
+	EncodeDataObject        = meta.EncodeDataObject
+	ParseID                 = meta.ParseID
+	UnmarshalMetaTablesYAML = meta.UnmarshalMetaTablesYAML
+	UnmarshalMetaTableJSON  = meta.UnmarshalMetaTableJSON
+)